@@ -19,8 +19,11 @@ import (
 
 	"bytes"
 
+	"time"
+
 	"github.com/dedis/cothority/app/lib/config"
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/sda"
 	"github.com/dedis/cothority/services/identity"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -53,9 +56,15 @@ func main() {
 			Value: "~/.ssh",
 			Usage: "The configuration-directory of the ssh-directory",
 		},
+		cli.IntFlag{
+			Name:  "timeout, t",
+			Value: 10,
+			Usage: "time in seconds to wait for the answer of the cothority",
+		},
 	}
 	app.Before = func(c *cli.Context) error {
 		log.SetDebugVisible(c.Int("debug"))
+		sda.ClientTimeout = time.Duration(c.Int("timeout")) * time.Second
 		return nil
 	}
 	app.Run(os.Args)
@@ -0,0 +1,189 @@
+// Compat detects changes of the wire format of the packets registered to the
+// network library. It dumps the registered packets together with a
+// description of their encoding, and compares two dumps to find the packets
+// whose encoding changed without a change of their version.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+	"github.com/satori/go.uuid"
+	"gopkg.in/urfave/cli.v1"
+
+	// Empty imports to have the init-functions called which register the
+	// packets.
+	_ "github.com/dedis/cothority/protocols"
+	_ "github.com/dedis/cothority/services"
+)
+
+// Packet describes the wire format of a registered packet.
+type Packet struct {
+	Name    string
+	Version int
+	ID      string
+	// Go is the name of the Go type
+	Go string
+	// Schema describes the encoding of the packet
+	Schema string
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "Compat"
+	app.Usage = "Detect changes of the wire format of the network packets."
+	app.Commands = []cli.Command{
+		{
+			Name:    "dump",
+			Aliases: []string{"d"},
+			Usage:   "print the registered packets as JSON",
+			Action: func(c *cli.Context) error {
+				return dump(os.Stdout)
+			},
+		},
+		{
+			Name:      "check",
+			Aliases:   []string{"c"},
+			Usage:     "compare two dumps and fail if the wire format changed",
+			ArgsUsage: "old.json new.json",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 2 {
+					return errors.New("Please give the old and the new dump")
+				}
+				old, err := readDump(c.Args().Get(0))
+				if err != nil {
+					return err
+				}
+				cur, err := readDump(c.Args().Get(1))
+				if err != nil {
+					return err
+				}
+				if !check(os.Stdout, old, cur) {
+					return cli.NewExitError("Incompatible wire format", 1)
+				}
+				return nil
+			},
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// dump writes all registered packets to w.
+func dump(w io.Writer) error {
+	var packets []Packet
+	for _, rp := range network.RegisteredPackets() {
+		packets = append(packets, Packet{
+			Name:    rp.Name,
+			Version: rp.Version,
+			ID:      uuid.UUID(rp.ID).String(),
+			Go:      rp.Type.String(),
+			Schema:  schema(rp.Type, nil),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(packets)
+}
+
+// readDump reads a file written by dump.
+func readDump(file string) ([]Packet, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var packets []Packet
+	err = json.NewDecoder(f).Decode(&packets)
+	return packets, err
+}
+
+// check compares the old and the new packets and writes the differences to
+// w. It returns false if the schema of a packet changed or a packet has
+// been removed.
+func check(w io.Writer, old, cur []Packet) bool {
+	curIDs := make(map[string]Packet)
+	for _, p := range cur {
+		curIDs[p.ID] = p
+	}
+	oldIDs := make(map[string]Packet)
+	ok := true
+	for _, p := range old {
+		oldIDs[p.ID] = p
+		c, found := curIDs[p.ID]
+		switch {
+		case !found:
+			ok = false
+			fmt.Fprintf(w, "removed: %s/v%d (%s)", p.Name, p.Version, p.Go)
+			for _, c := range cur {
+				if c.Schema == p.Schema && c.Go != p.Go {
+					fmt.Fprintf(w, " - renamed to %s? Pin it with "+
+						"network.RegisterPacketTypeVersion(\"%s\", %d, ...)",
+						c.Go, p.Name, p.Version)
+					break
+				}
+			}
+			fmt.Fprintln(w)
+		case c.Schema != p.Schema:
+			ok = false
+			fmt.Fprintf(w, "changed: %s/v%d - increase its version\n\told: %s\n\tnew: %s\n",
+				p.Name, p.Version, p.Schema, c.Schema)
+		}
+	}
+	for _, p := range cur {
+		if _, found := oldIDs[p.ID]; !found {
+			fmt.Fprintf(w, "added: %s/v%d (%s)\n", p.Name, p.Version, p.Go)
+		}
+	}
+	return ok
+}
+
+// schema describes how a value of type t is encoded by protobuf: the
+// exported fields of structs are encoded in their order, the names of the
+// types and fields don't matter. seen holds the structs being described, to
+// stop at recursive types.
+func schema(t reflect.Type, seen []reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + schema(t.Elem(), seen)
+	case reflect.Slice:
+		return "[]" + schema(t.Elem(), seen)
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + schema(t.Elem(), seen)
+	case reflect.Map:
+		return "map[" + schema(t.Key(), seen) + "]" + schema(t.Elem(), seen)
+	case reflect.Interface:
+		// interfaces are encoded by the constructors, like abstract.Point
+		return t.String()
+	case reflect.Struct:
+		if t.PkgPath() == "time" {
+			return t.String()
+		}
+		for i, s := range seen {
+			if s == t {
+				return "^" + strconv.Itoa(len(seen)-i)
+			}
+		}
+		seen = append(seen, t)
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			fields = append(fields, schema(f.Type, seen))
+		}
+		return "{" + strings.Join(fields, ";") + "}"
+	default:
+		return t.Kind().String()
+	}
+}
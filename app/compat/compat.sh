@@ -0,0 +1,39 @@
+#!/usr/bin/env bash
+# Compares the wire format of the network packets between two commits.
+#
+#   ./compat.sh OLD [NEW]
+#
+# If NEW is not given, the working tree is used. Both commits must contain
+# app/compat. The script exits with 1 if a packet changed its encoding
+# without changing its version, or if a packet has been removed.
+
+set -e
+
+if [ -z "$1" ]; then
+	echo "Usage: $0 OLD [NEW]"
+	exit 1
+fi
+OLD=$1
+NEW=$2
+REPO=$( git rev-parse --show-toplevel )
+TMP=$( mktemp -d )
+trap "rm -rf $TMP" EXIT
+
+# dump COMMIT FILE writes the packets registered at COMMIT to FILE.
+dump(){
+	local src=$REPO
+	if [ -n "$1" ]; then
+		# build the commit in its own GOPATH, so that its packages are used
+		src=$TMP/$1/src/github.com/dedis/cothority
+		mkdir -p $( dirname $src )
+		git -C $REPO worktree add -f $src $1 > /dev/null
+		GOPATH=$TMP/$1:$GOPATH go run $src/app/compat/compat.go dump > $2
+		git -C $REPO worktree remove -f $src
+	else
+		go run $src/app/compat/compat.go dump > $2
+	fi
+}
+
+dump $OLD $TMP/old.json
+dump "$NEW" $TMP/new.json
+go run $REPO/app/compat/compat.go check $TMP/old.json $TMP/new.json
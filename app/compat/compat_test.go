@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNode struct {
+	Name     string
+	Children []*testNode
+	private  int
+}
+
+type testRenamedNode struct {
+	Label    string
+	Children []*testRenamedNode
+}
+
+func TestSchema(t *testing.T) {
+	s := schema(reflect.TypeOf(testNode{}), nil)
+	assert.Equal(t, "{string;[]*^1}", s)
+	assert.Equal(t, s, schema(reflect.TypeOf(testRenamedNode{}), nil))
+}
+
+func TestCheck(t *testing.T) {
+	old := []Packet{
+		{Name: "a", ID: "1", Go: "p.A", Schema: "{int}"},
+		{Name: "b", ID: "2", Go: "p.B", Schema: "{string}"},
+	}
+	buf := &bytes.Buffer{}
+	assert.True(t, check(buf, old, old))
+	assert.Equal(t, "", buf.String())
+
+	cur := []Packet{
+		{Name: "a", ID: "1", Go: "p.A", Schema: "{int;int}"},
+		{Name: "c", ID: "3", Go: "p.C", Schema: "{string}"},
+	}
+	assert.False(t, check(buf, old, cur))
+	out := buf.String()
+	assert.Contains(t, out, "changed: a/v0")
+	assert.Contains(t, out, "removed: b/v0 (p.B) - renamed to p.C?")
+	assert.Contains(t, out, "added: c/v0 (p.C)")
+}
@@ -33,6 +33,14 @@ type CothoritydConfig struct {
 	Public  string
 	Private string
 	Address network.Address
+	// ACL restricts the access to services: it maps the name of a service
+	// to the hex-encoded public keys of the clients allowed to use it.
+	// Services not listed are open to everybody.
+	ACL map[string][]string `toml:",omitempty"`
+	// Metrics is the address of the HTTP listener serving the metrics of
+	// the conode in the Prometheus text format. If empty, no metrics are
+	// served.
+	Metrics string `toml:",omitempty"`
 }
 
 // Save will save this CothoritydConfig to the given file name. It
@@ -68,7 +76,25 @@ func ParseCothorityd(file string) (*CothoritydConfig, *sda.Conode, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	acl := make(map[string][]abstract.Point)
+	for service, keys := range hc.ACL {
+		publics := make([]abstract.Point, len(keys))
+		for i, k := range keys {
+			publics[i], err = crypto.ReadPubHex(network.Suite, k)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Wrong key in ACL of %s: %s",
+					service, err)
+			}
+		}
+		acl[service] = publics
+	}
 	conode := sda.NewConodeTCP(network.NewServerIdentity(point, hc.Address), secret)
+	for service, publics := range acl {
+		if err := conode.SetACL(service, publics); err != nil {
+			conode.Close()
+			return nil, nil, err
+		}
+	}
 	return hc, conode, nil
 }
 
@@ -81,7 +107,7 @@ func CreateCothoritydConfig(defaultFile string) (*CothoritydConfig, string, erro
 	var err error
 	var str string
 	// IP:PORT
-	fmt.Println("[+] Type the IP:PORT (ipv4) address of this host (accessible from Internet):")
+	fmt.Println("[+] Type the IP:PORT or HOSTNAME:PORT address of this host (accessible from Internet):")
 	str, err = reader.ReadString('\n')
 	str = strings.TrimSpace(str)
 	address := network.NewTCPAddress(str)
@@ -217,6 +243,9 @@ func (gt *GroupToml) String() string {
 
 // toServerIdentity converts this ServerToml struct to a ServerIdentity.
 func (s *ServerToml) toServerIdentity(suite abstract.Suite) (*network.ServerIdentity, error) {
+	if !s.Address.Valid() {
+		return nil, fmt.Errorf("Invalid address: %s", s.Address)
+	}
 	pubR := strings.NewReader(s.Public)
 	public, err := crypto.ReadPub64(suite, pubR)
 	if err != nil {
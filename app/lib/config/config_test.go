@@ -54,6 +54,25 @@ func TestReadGroupDescToml(t *testing.T) {
 	if group.description[group.Roster.List[1]] != "Ismail's server" {
 		t.Fatal("This should be Ismail's server")
 	}
+
+	// IPv6 and hostnames
+	group, err = ReadGroupDescToml(strings.NewReader(
+		strings.Replace(strings.Replace(serverGroup, "5.135.161.91", "[2001:db8::1]", 1),
+			"185.26.156.40", "conode.example.org", 1)))
+	log.ErrFatal(err)
+	if group.Roster.List[0].Address != network.NewTCPAddress("[2001:db8::1]:2000") {
+		t.Fatal("Wrong IPv6 address")
+	}
+	if group.Roster.List[1].Address.Host() != "conode.example.org" {
+		t.Fatal("Wrong hostname")
+	}
+
+	// Invalid address
+	_, err = ReadGroupDescToml(strings.NewReader(
+		strings.Replace(serverGroup, "5.135.161.91", "5.135.161", 1)))
+	if err == nil {
+		t.Fatal("Invalid address should be refused")
+	}
 }
 
 func TestInput(t *testing.T) {
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/cothority/sda"
+)
+
+// MetricsPath is the path of the metrics on the HTTP listener.
+const MetricsPath = "/metrics"
+
+// serveMetrics listens on addr and serves the metrics of the conode in the
+// Prometheus text format until the program stops.
+func serveMetrics(addr string, c *sda.Conode) {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, NewMetricsHandler(c))
+	log.Info("Serving metrics on", addr+MetricsPath)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Error("Couldn't serve metrics:", err)
+	}
+}
+
+// NewMetricsHandler returns a http.Handler writing the metrics of the conode
+// in the Prometheus text format: the state of the connections, the traffic
+// per peer and per message type, the number of running protocol instances,
+// the client requests of each service and the metrics of the services
+// implementing sda.MetricsReporter.
+func NewMetricsHandler(c *sda.Conode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, c)
+	})
+}
+
+// writeMetrics writes all metrics of the conode to w.
+func writeMetrics(w io.Writer, c *sda.Conode) {
+	m := &metricsWriter{w: w}
+
+	up, down := 0, 0
+	for _, p := range c.Peers() {
+		if p.Up {
+			up++
+		} else {
+			down++
+		}
+	}
+	m.family("cothority_peers", "gauge", "Number of peers by state of the connection.")
+	m.sample("cothority_peers", labels{"state", "up"}, float64(up))
+	m.sample("cothority_peers", labels{"state", "down"}, float64(down))
+
+	m.family("cothority_tx_bytes_total", "counter", "Bytes sent by all connections.")
+	m.sample("cothority_tx_bytes_total", nil, float64(c.Tx()))
+	m.family("cothority_rx_bytes_total", "counter", "Bytes received by all connections.")
+	m.sample("cothority_rx_bytes_total", nil, float64(c.Rx()))
+
+	// only the peers the conode maintains connections to have their own
+	// series, the clients are summed up in network.OtherPeersAddress, so
+	// that the number of series doesn't grow with every client
+	peers := make(map[string]network.Traffic)
+	var addrs []string
+	for a, t := range c.PeerTraffic() {
+		peers[a.String()] = t
+		addrs = append(addrs, a.String())
+	}
+	sort.Strings(addrs)
+	m.family("cothority_peer_messages_total", "counter", "Messages exchanged with each peer.")
+	for _, a := range addrs {
+		t := peers[a]
+		m.sample("cothority_peer_messages_total", labels{"peer", a, "direction", "tx"}, float64(t.MsgsTx))
+		m.sample("cothority_peer_messages_total", labels{"peer", a, "direction", "rx"}, float64(t.MsgsRx))
+	}
+	m.family("cothority_peer_bytes_total", "counter", "Bytes exchanged with each peer.")
+	for _, a := range addrs {
+		t := peers[a]
+		m.sample("cothority_peer_bytes_total", labels{"peer", a, "direction", "tx"}, float64(t.BytesTx))
+		m.sample("cothority_peer_bytes_total", labels{"peer", a, "direction", "rx"}, float64(t.BytesRx))
+	}
+	m.family("cothority_peer_errors_total", "counter", "Messages to or from each peer that failed.")
+	for _, a := range addrs {
+		m.sample("cothority_peer_errors_total", labels{"peer", a}, float64(peers[a].Errors))
+	}
+
+	types := make(map[string]struct{ tx, rx, btx, brx, errs uint64 })
+	var names []string
+	for id, t := range c.TypeTraffic() {
+		name := id.String()
+		if _, ok := types[name]; !ok {
+			names = append(names, name)
+		}
+		v := types[name]
+		v.tx += t.MsgsTx
+		v.rx += t.MsgsRx
+		v.btx += t.BytesTx
+		v.brx += t.BytesRx
+		v.errs += t.Errors
+		types[name] = v
+	}
+	sort.Strings(names)
+	m.family("cothority_type_messages_total", "counter", "Messages exchanged of each message type.")
+	for _, n := range names {
+		m.sample("cothority_type_messages_total", labels{"type", n, "direction", "tx"}, float64(types[n].tx))
+		m.sample("cothority_type_messages_total", labels{"type", n, "direction", "rx"}, float64(types[n].rx))
+	}
+	m.family("cothority_type_bytes_total", "counter", "Bytes exchanged of each message type.")
+	for _, n := range names {
+		m.sample("cothority_type_bytes_total", labels{"type", n, "direction", "tx"}, float64(types[n].btx))
+		m.sample("cothority_type_bytes_total", labels{"type", n, "direction", "rx"}, float64(types[n].brx))
+	}
+	m.family("cothority_type_errors_total", "counter", "Messages of each message type that failed.")
+	for _, n := range names {
+		m.sample("cothority_type_errors_total", labels{"type", n}, float64(types[n].errs))
+	}
+
+	m.family("cothority_protocol_instances", "gauge", "Number of running protocol instances.")
+	m.sample("cothority_protocol_instances", nil, float64(c.ProtocolInstances()))
+
+	instances := c.Instances()
+	var protocols []string
+	for p := range instances {
+		protocols = append(protocols, p)
+	}
+	sort.Strings(protocols)
+	m.family("cothority_protocol_instances_by_name", "gauge", "Number of running instances of each protocol.")
+	for _, p := range protocols {
+		m.sample("cothority_protocol_instances_by_name", labels{"protocol", p}, float64(len(instances[p])))
+	}
+
+	trees, rosters := c.TreesRosters()
+	m.family("cothority_trees", "gauge", "Number of trees kept by the overlay.")
+	m.sample("cothority_trees", nil, float64(trees))
+	m.family("cothority_rosters", "gauge", "Number of rosters kept by the overlay.")
+	m.sample("cothority_rosters", nil, float64(rosters))
+
+	d := c.DropStats()
+	m.family("cothority_dropped_messages_total", "counter", "Messages dropped by the overlay.")
+	m.sample("cothority_dropped_messages_total", labels{"reason", "instance_queue"}, float64(d.InstanceQueue))
+	m.sample("cothority_dropped_messages_total", labels{"reason", "pending_messages"}, float64(d.PendingMessages))
+	m.sample("cothority_dropped_messages_total", labels{"reason", "pending_trees"}, float64(d.PendingTrees))
+	m.sample("cothority_dropped_messages_total", labels{"reason", "expired"}, float64(d.Expired))
+	m.sample("cothority_dropped_messages_total", labels{"reason", "unsolicited"}, float64(d.Unsolicited))
+	m.sample("cothority_dropped_messages_total", labels{"reason", "invalid_id"}, float64(d.InvalidID))
+	m.sample("cothority_dropped_messages_total", labels{"reason", "not_member"}, float64(d.NotMember))
+
+	stats := c.ServiceStats()
+	var services []string
+	for s := range stats {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+	m.family("cothority_service_requests_total", "counter", "Client requests processed by each service.")
+	for _, s := range services {
+		m.sample("cothority_service_requests_total", labels{"service", s}, float64(stats[s].Requests))
+	}
+	m.family("cothority_service_refused_total", "counter", "Client requests refused by the access control of each service.")
+	for _, s := range services {
+		m.sample("cothority_service_refused_total", labels{"service", s}, float64(stats[s].Refused))
+	}
+	m.family("cothority_service_request_seconds", "summary", "Time spent processing the client requests of each service.")
+	for _, s := range services {
+		m.sample("cothority_service_request_seconds_sum", labels{"service", s}, stats[s].Latency.Seconds())
+		m.sample("cothority_service_request_seconds_count", labels{"service", s}, float64(stats[s].Requests))
+	}
+
+	metrics := c.ServiceMetrics()
+	services = services[:0]
+	for s := range metrics {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+	for _, s := range services {
+		var keys []string
+		for k := range metrics[s] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := metricName("cothority_" + strings.ToLower(s) + "_" + k)
+			m.family(name, "gauge", "Metric "+k+" of the service "+s+".")
+			m.sample(name, nil, metrics[s][k])
+		}
+	}
+}
+
+// labels holds the names and values of the labels of a sample, alternating.
+type labels []string
+
+// metricsWriter writes metrics in the Prometheus text format.
+type metricsWriter struct {
+	w io.Writer
+}
+
+// family writes the help and type of a metric.
+func (m *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one value of a metric.
+func (m *metricsWriter) sample(name string, l labels, value float64) {
+	fmt.Fprint(m.w, name)
+	if len(l) > 0 {
+		var pairs []string
+		for i := 0; i+1 < len(l); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", l[i], escapeLabel(l[i+1])))
+		}
+		fmt.Fprintf(m.w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(m.w, " %g\n", value)
+}
+
+// escapeLabel escapes the characters not allowed in a label value.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// metricName replaces the characters not allowed in a metric name by '_'.
+func metricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/cothority/sda"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	c := local.GenConodes(2)
+	assert.Nil(t, c[0].Send(c[1].ServerIdentity, &sda.RequestRoster{}))
+
+	buf := &bytes.Buffer{}
+	writeMetrics(buf, c[0])
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE cothority_peers gauge\n")
+	assert.Contains(t, out, `cothority_peers{state="up"} 1`)
+	// the request and the exchange of the versions
+	assert.Contains(t, out, `cothority_peer_messages_total{peer="`+
+		c[1].ServerIdentity.Address.String()+`",direction="tx"} 2`)
+	assert.Contains(t, out, `cothority_type_messages_total{type="sda.RequestRoster",direction="tx"} 1`)
+	assert.Contains(t, out, `cothority_type_messages_total{type="network.Versions",direction="tx"} 1`)
+	assert.Contains(t, out, "cothority_protocol_instances 0\n")
+	assert.Contains(t, out, `cothority_dropped_messages_total{reason="instance_queue"} 0`)
+}
+
+func TestWriteMetricsClients(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	c := local.GenConodes(1)
+	for i := 0; i < 3; i++ {
+		// the request fails, but the traffic is counted
+		local.NewClient("Status").Send(c[0].ServerIdentity, &sda.RequestRoster{})
+	}
+
+	buf := &bytes.Buffer{}
+	writeMetrics(buf, c[0])
+	out := buf.String()
+	assert.NotContains(t, out, "client:")
+	assert.Contains(t, out, `cothority_peer_messages_total{peer="`+
+		network.OtherPeersAddress.String()+`",direction="rx"} 3`)
+}
+
+func TestMetricsEscape(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\n`, escapeLabel("a\"b\\c\n"))
+	assert.Equal(t, "cothority_my_service_x", metricName("cothority_my-service.x"))
+}
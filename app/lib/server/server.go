@@ -87,7 +87,7 @@ func InteractiveConfig(binaryName string) {
 		portStr = port
 	}
 
-	serverBinding = network.NewTCPAddress(hostStr + ":" + portStr)
+	serverBinding = network.NewTCPAddress(net.JoinHostPort(hostStr, portStr))
 	if !serverBinding.Valid() {
 		log.Error("Unable to validate address given", serverBinding)
 		return
@@ -113,7 +113,7 @@ func InteractiveConfig(binaryName string) {
 				log.Error("Could not parse your public IP address", err)
 				failedPublic = true
 			} else {
-				publicAddress = network.NewTCPAddress(strings.TrimSpace(string(buff)) + ":" + portStr)
+				publicAddress = network.NewTCPAddress(net.JoinHostPort(strings.TrimSpace(string(buff)), portStr))
 			}
 		}
 	} else {
@@ -414,28 +414,28 @@ func GetDefaultConfigFile(binaryName string) string {
 	}
 }
 
-// askReachableAddress uses stdin to get the contactable IP-address of the server
-// and adding port if necessary.
+// askReachableAddress uses stdin to get the contactable address of the server
+// and adding port if necessary. The address can be an IPv4 address, an IPv6
+// address or a hostname.
 // In case of an error, it will Fatal.
 func askReachableAddress(port string) network.Address {
-	ipStr := config.Input(DefaultAddress, "IP-address where your server can be reached")
+	ipStr := config.Input(DefaultAddress, "IP-address or hostname where your server can be reached")
 
-	splitted := strings.Split(ipStr, ":")
-	if len(splitted) == 2 && splitted[1] != port {
+	host, p, err := net.SplitHostPort(ipStr)
+	if err != nil {
+		// no port given - only a host, which might be a bare IPv6 address
+		host = strings.Trim(ipStr, "[]")
+		p = port
+	}
+	if p != port {
 		// if the client gave a port number, it must be the same
 		log.Fatal("The port you gave is not the same as the one your server will be listening. Abort.")
-	} else if len(splitted) == 2 && net.ParseIP(splitted[0]) == nil {
-		// of if the IP address is wrong
-		log.Fatal("Invalid IP:port address given:", ipStr)
-	} else if len(splitted) == 1 {
-		// check if the ip is valid
-		if net.ParseIP(ipStr) == nil {
-			log.Fatal("Invalid IP address given:", ipStr)
-		}
-		// add the port
-		ipStr = ipStr + ":" + port
 	}
-	return network.NewTCPAddress(ipStr)
+	addr := network.NewTCPAddress(net.JoinHostPort(host, port))
+	if !addr.Valid() {
+		log.Fatal("Invalid address given:", ipStr)
+	}
+	return addr
 }
 
 // tryConnect binds to the given IP address and ask an internet service to
@@ -499,15 +499,20 @@ func tryConnect(ip, binding network.Address) error {
 }
 
 // RunServer starts a cothority server with the given config file name. It can
-// be used by different apps (like CoSi, for example)
+// be used by different apps (like CoSi, for example).
+// If the config file has a Metrics address, the metrics of the server are
+// served there over HTTP.
 func RunServer(configFilename string) {
 	if _, err := os.Stat(configFilename); os.IsNotExist(err) {
 		log.Fatalf("[-] Configuration file does not exists. %s", configFilename)
 	}
 	// Let's read the config
-	_, conode, err := config.ParseCothorityd(configFilename)
+	hc, conode, err := config.ParseCothorityd(configFilename)
 	if err != nil {
 		log.Fatal("Couldn't parse config:", err)
 	}
+	if hc.Metrics != "" {
+		go serveMetrics(hc.Metrics, conode)
+	}
 	conode.Start()
 }
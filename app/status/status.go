@@ -3,7 +3,9 @@
 package main
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"errors"
 
@@ -29,6 +31,11 @@ func main() {
 			Value: "group.toml",
 			Usage: "Cothority group definition in `FILE.toml`",
 		},
+		cli.IntFlag{
+			Name:  "timeout, t",
+			Value: 10,
+			Usage: "time in `seconds` to wait for the answer of each server",
+		},
 		cli.IntFlag{
 			Name:  "debug, d",
 			Value: 0,
@@ -44,18 +51,31 @@ func main() {
 }
 
 // network will contact all cothorities in the group-file and print
-// the status-report of each one.
+// the status-report of each one. The servers are contacted in parallel and a
+// server that doesn't answer in time is reported as such.
 func network(c *cli.Context) error {
 	groupToml := c.GlobalString("g")
 	el, err := readGroup(groupToml)
 	log.ErrFatal(err, "Couldn't Read File")
 	log.Lvl3(el)
 	cl := status.NewClient()
-	for i := 0; i < len(el.List); i++ {
-		log.Lvl3(el.List[i])
-		sr, _ := cl.GetStatus(el.List[i])
-		printConn(sr)
-		log.Lvl3(cl)
+	timeout := time.Duration(c.GlobalInt("timeout")) * time.Second
+	// replace the default timeout of the client for each reply
+	cl.SetTimeout(timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for r := range cl.StreamToAll(ctx, el, &status.Request{}) {
+		log.Lvl3(r.ServerIdentity)
+		if r.Err != nil {
+			log.Error("Couldn't get status of", r.ServerIdentity.Address, r.Err)
+			continue
+		}
+		sr, ok := r.Packet.Msg.(status.Response)
+		if !ok {
+			log.Error("Wrong reply from", r.ServerIdentity.Address)
+			continue
+		}
+		printConn(&sr)
 	}
 	return nil
 }
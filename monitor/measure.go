@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"time"
 
 	"github.com/dedis/cothority/log"
@@ -42,10 +43,13 @@ type Measure interface {
 	Record()
 }
 
-// SingleMeasure is a pair name - value we want to send
+// SingleMeasure is a pair name - value we want to send. If Node is not
+// empty, the value has been measured on that node only and is not part of
+// the statistics of the simulation, but of that node.
 type SingleMeasure struct {
 	Name  string
 	Value float64
+	Node  string `json:",omitempty"`
 }
 
 // TimeMeasure represents a measure regarding time: It includes the wallclock
@@ -88,6 +92,16 @@ func NewSingleMeasure(name string, value float64) *SingleMeasure {
 	}
 }
 
+// NewNodeMeasure returns a SingleMeasure of a single node. The monitor keeps
+// the measures of every node apart, see Stats.Nodes.
+func NewNodeMeasure(node, name string, value float64) *SingleMeasure {
+	return &SingleMeasure{
+		Name:  name,
+		Value: value,
+		Node:  node,
+	}
+}
+
 // Record sends the value to the monitor. Reset the value to 0.
 func (sm *SingleMeasure) Record() {
 	if err := send(sm); err != nil {
@@ -185,6 +199,41 @@ func (cm *CounterIOMeasure) Record() {
 	cm.baseTx = bTx
 }
 
+// CounterMapMeasure records a set of increasing counters identified by a
+// key, like the traffic per message type of a network.Router. Each time
+// Record() is called, the increase of every counter since the last call is
+// sent as **name**_**key**.
+type CounterMapMeasure struct {
+	name     string
+	counters func() map[string]uint64
+	base     map[string]uint64
+}
+
+// NewCounterMapMeasure returns a fresh CounterMapMeasure. The base values are
+// set to the current values returned by counters.
+func NewCounterMapMeasure(name string, counters func() map[string]uint64) *CounterMapMeasure {
+	return &CounterMapMeasure{
+		name:     name,
+		counters: counters,
+		base:     counters(),
+	}
+}
+
+// Record sends the increase of all counters in the order of their keys and
+// resets them.
+func (cm *CounterMapMeasure) Record() {
+	current := cm.counters()
+	keys := make([]string, 0, len(current))
+	for k := range current {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		NewSingleMeasure(cm.name+"_"+k, float64(current[k]-cm.base[k])).Record()
+	}
+	cm.base = current
+}
+
 // Send transmits the given struct over the network.
 func send(v interface{}) error {
 	if encoder == nil {
@@ -58,3 +58,31 @@ func TestCounterIOMeasureRecord(t *testing.T) {
 	EndAndCleanup()
 	time.Sleep(100 * time.Millisecond)
 }
+
+func TestCounterMapMeasureRecord(t *testing.T) {
+	mon, _ := setupMonitor(t)
+	counters := map[string]uint64{"a": 5, "b": 10}
+	cm := NewCounterMapMeasure("dummy", func() map[string]uint64 {
+		c := make(map[string]uint64)
+		for k, v := range counters {
+			c[k] = v
+		}
+		return c
+	})
+	counters["a"] += 10
+	counters["b"] += 20
+	cm.Record()
+
+	time.Sleep(100 * time.Millisecond)
+	stat := mon.Stats()
+	stat.Collect()
+	a, b := stat.Value("dummy_a"), stat.Value("dummy_b")
+	if a == nil || a.Avg() != 10 {
+		t.Fatal("Stats doesn't have the right value for a")
+	}
+	if b == nil || b.Avg() != 20 {
+		t.Fatal("Stats doesn't have the right value for b")
+	}
+	EndAndCleanup()
+	time.Sleep(100 * time.Millisecond)
+}
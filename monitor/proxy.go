@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"sync"
 
 	"github.com/dedis/cothority/log"
 )
@@ -28,6 +29,10 @@ var proxyConns map[string]*json.Encoder
 
 var proxyDone chan bool
 
+// proxyListener is the listener of the running proxy, nil if no proxy runs
+var proxyListener net.Listener
+var proxyLock sync.Mutex
+
 func init() {
 	proxyDone = make(chan bool)
 }
@@ -60,6 +65,9 @@ func Proxy(redirection string) error {
 		return fmt.Errorf("Error while binding proxy to addr %s: %v", sinkAddr, err)
 	}
 	log.Lvl2("Proxy listening on", sinkAddr)
+	proxyLock.Lock()
+	proxyListener = ln
+	proxyLock.Unlock()
 	newConn := make(chan bool)
 	closeConn := make(chan bool)
 	finished := false
@@ -103,9 +111,14 @@ func Proxy(redirection string) error {
 					if err := serverConn.Close(); err != nil {
 						log.Error("Couldn't close server connection:", err)
 					}
-					if err := ln.Close(); err != nil {
-						log.Error("Couldn't close listener:", err)
+					proxyLock.Lock()
+					if proxyListener == ln {
+						if err := ln.Close(); err != nil {
+							log.Error("Couldn't close listener:", err)
+						}
+						proxyListener = nil
 					}
+					proxyLock.Unlock()
 					finished = true
 					break
 				}
@@ -115,6 +128,23 @@ func Proxy(redirection string) error {
 	return nil
 }
 
+// ProxyStop closes the listener of the proxy and its connection to the sink,
+// even if some connections to the proxy are still open, so that the port of
+// the proxy can be bound again. It does nothing if no proxy runs.
+func ProxyStop() error {
+	proxyLock.Lock()
+	defer proxyLock.Unlock()
+	if proxyListener == nil {
+		return nil
+	}
+	err := proxyListener.Close()
+	proxyListener = nil
+	if serverConn != nil {
+		serverConn.Close()
+	}
+	return err
+}
+
 // connectToSink starts the connection with the server
 func connectToSink(redirection string) error {
 	conn, err := net.Dial("tcp", redirection)
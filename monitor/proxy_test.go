@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"net"
 	"strconv"
 	"testing"
 	"time"
@@ -58,3 +59,31 @@ func TestProxy(t *testing.T) {
 		t.Error("Monitor not finished")
 	}
 }
+
+func TestProxyStop(t *testing.T) {
+	sink, err := net.Listen("tcp", "localhost:8101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	go func() {
+		for {
+			if _, err := sink.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// nobody connects to the proxy, but it can be bound again once stopped
+	for i := 0; i < 2; i++ {
+		if err := Proxy("localhost:8101"); err != nil {
+			t.Fatal("Couldn't start proxy:", err)
+		}
+		if err := ProxyStop(); err != nil {
+			t.Fatal("Couldn't stop proxy:", err)
+		}
+	}
+	if err := ProxyStop(); err != nil {
+		t.Fatal("Stopping a stopped proxy should do nothing:", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dedis/cothority/log"
 	"github.com/montanaflynn/stats"
@@ -22,13 +23,22 @@ import (
 // Stats holds the different measurements done
 type Stats struct {
 	// The static fields are created when creating the stats out of a
-	// running config.
-	static     map[string]int
+	// running config. Besides integers, they can be fractions, like the
+	// loss rate of the emulated network.
+	static     map[string]float64
 	staticKeys []string
 
 	// The received measures we have and the keys ordered
 	values map[string]*Value
 	keys   []string
+	// The measures of single nodes, summed up per node and name
+	nodes map[string]map[string]float64
+	// All measures in the order they have been received, see Raw
+	raw []RawMeasure
+	// The running config the stats have been created from
+	config map[string]string
+	// Creation time of the stats
+	start time.Time
 
 	// The filter used to filter out abberant data
 	filter DataFilter
@@ -48,17 +58,43 @@ func NewStats(rc map[string]string, defaults ...string) *Stats {
 func (s *Stats) init() *Stats {
 	s.values = make(map[string]*Value)
 	s.keys = make([]string, 0)
-	s.static = make(map[string]int)
+	s.nodes = make(map[string]map[string]float64)
+	s.static = make(map[string]float64)
 	s.staticKeys = make([]string, 0)
+	s.config = make(map[string]string)
+	s.start = time.Now()
 	return s
 }
 
-// Update will update the Stats with this given measure
+// RawMeasure is a measure as received by the monitor, together with the
+// parameters of the run.
+type RawMeasure struct {
+	// Config holds the parameters of the run
+	Config map[string]string
+	// Time since the creation of the Stats in seconds
+	Time float64
+	SingleMeasure
+}
+
+// Update will update the Stats with this given measure. Measures of a single
+// node are only summed up for that node, see Nodes.
 func (s *Stats) Update(m *SingleMeasure) {
 	var value *Value
 	var ok bool
 	s.valuesMutex.Lock()
 	defer s.valuesMutex.Unlock()
+	s.raw = append(s.raw, RawMeasure{
+		Config:        s.config,
+		Time:          time.Since(s.start).Seconds(),
+		SingleMeasure: *m,
+	})
+	if m.Node != "" {
+		if s.nodes[m.Node] == nil {
+			s.nodes[m.Node] = make(map[string]float64)
+		}
+		s.nodes[m.Node][m.Name] += m.Value
+		return
+	}
 	value, ok = s.values[m.Name]
 	if !ok {
 		value = NewValue(m.Name)
@@ -69,6 +105,29 @@ func (s *Stats) Update(m *SingleMeasure) {
 	value.Store(m.Value)
 }
 
+// Raw returns all measures received, including the ones of single nodes, in
+// the order they have been received.
+func (s *Stats) Raw() []RawMeasure {
+	s.valuesMutex.Lock()
+	defer s.valuesMutex.Unlock()
+	return append([]RawMeasure{}, s.raw...)
+}
+
+// Nodes returns the sum of the measures of every node, indexed by the node
+// and the name of the measure.
+func (s *Stats) Nodes() map[string]map[string]float64 {
+	s.valuesMutex.Lock()
+	defer s.valuesMutex.Unlock()
+	nodes := make(map[string]map[string]float64)
+	for n, values := range s.nodes {
+		nodes[n] = make(map[string]float64)
+		for name, v := range values {
+			nodes[n][name] = v
+		}
+	}
+	return nodes
+}
+
 // WriteHeader will write the header to the writer
 func (s *Stats) WriteHeader(w io.Writer) {
 	s.valuesMutex.Lock()
@@ -100,7 +159,7 @@ func (s *Stats) WriteValues(w io.Writer) {
 	var values []string
 	for _, k := range s.staticKeys {
 		if v, ok := s.static[k]; ok {
-			values = append(values, fmt.Sprintf("%d", v))
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
 		}
 	}
 	// write the values
@@ -121,6 +180,7 @@ func AverageStats(stats []*Stats) *Stats {
 	s.valuesMutex.Lock()
 	defer s.valuesMutex.Unlock()
 	s.filter = stats[0].filter
+	s.config = stats[0].config
 	s.static = stats[0].static
 	s.staticKeys = stats[0].staticKeys
 	s.keys = stats[0].keys
@@ -223,6 +283,19 @@ func (s *Stats) Collect() {
 	}
 }
 
+// Summary returns the statistics of every measure, indexed by its name. The
+// filter of the stats is only applied to the values once they have been
+// collected, for example by WriteValues.
+func (s *Stats) Summary() map[string]ValueSummary {
+	s.valuesMutex.Lock()
+	defer s.valuesMutex.Unlock()
+	summary := make(map[string]ValueSummary)
+	for name, v := range s.values {
+		summary[name] = v.Summary()
+	}
+	return summary
+}
+
 // Value returns the value object corresponding to this name in this Stats
 func (s *Stats) Value(name string) *Value {
 	if val, ok := s.values[name]; ok {
@@ -238,7 +311,7 @@ func (s *Stats) String() string {
 	s.Collect()
 	var str string
 	for _, k := range s.staticKeys {
-		str += fmt.Sprintf("%s = %d ", k, s.static[k])
+		str += fmt.Sprintf("%s = %v ", k, s.static[k])
 	}
 	for _, v := range s.values {
 		str += fmt.Sprintf("%v ", v.Values())
@@ -248,6 +321,9 @@ func (s *Stats) String() string {
 
 // Read a config file and fills up some fields for Stats struct
 func (s *Stats) readRunConfig(rc map[string]string, defaults ...string) {
+	for k, v := range rc {
+		s.config[k] = v
+	}
 	// First find the defaults keys
 	for _, def := range defaults {
 		valStr, ok := rc[def]
@@ -258,7 +334,7 @@ func (s *Stats) readRunConfig(rc map[string]string, defaults ...string) {
 			log.Fatal("Could not parse to integer value", def)
 		} else {
 			// registers the static value
-			s.static[def] = i
+			s.static[def] = float64(i)
 			s.staticKeys = append(s.staticKeys, def)
 		}
 	}
@@ -277,11 +353,11 @@ func (s *Stats) readRunConfig(rc map[string]string, defaults ...string) {
 			continue
 		}
 		// store it
-		if i, err := strconv.Atoi(v); err != nil {
+		if f, err := strconv.ParseFloat(v, 64); err != nil {
 			log.Lvl3("Could not parse the value", k, "from runconfig (v=", v, ")")
 			continue
 		} else {
-			s.static[k] = i
+			s.static[k] = f
 			statics = append(statics, k)
 		}
 	}
@@ -412,6 +488,55 @@ func (t *Value) Dev() float64 {
 	return t.dev
 }
 
+// ValueSummary holds the statistics of all values of a measure, including
+// the percentiles using the nearest-rank method.
+type ValueSummary struct {
+	N   int
+	Min float64
+	Max float64
+	Avg float64
+	Sum float64
+	Dev float64
+	P50 float64
+	P90 float64
+	P99 float64
+}
+
+// Summary computes the statistics of the stored values. Contrary to Collect,
+// it can be called as often as needed.
+func (t *Value) Summary() ValueSummary {
+	vs := ValueSummary{N: len(t.store)}
+	if vs.N == 0 {
+		return vs
+	}
+	vs.Min, vs.Max = t.store[0], t.store[0]
+	for _, v := range t.store {
+		vs.Min = math.Min(vs.Min, v)
+		vs.Max = math.Max(vs.Max, v)
+		vs.Sum += v
+	}
+	vs.Avg = vs.Sum / float64(vs.N)
+	if vs.N > 1 {
+		var sq float64
+		for _, v := range t.store {
+			sq += (v - vs.Avg) * (v - vs.Avg)
+		}
+		vs.Dev = math.Sqrt(sq / float64(vs.N-1))
+	}
+	for _, p := range []struct {
+		perc float64
+		dst  *float64
+	}{{50, &vs.P50}, {90, &vs.P90}, {99, &vs.P99}} {
+		v, err := stats.PercentileNearestRank(t.store, p.perc)
+		if err != nil {
+			log.Lvl2("Monitor: couldn't compute percentile of", t.name, err)
+			continue
+		}
+		*p.dst = v
+	}
+	return vs
+}
+
 // HeaderFields returns the first line of the CSV-file
 func (t *Value) HeaderFields() []string {
 	return []string{t.name + "_min", t.name + "_max", t.name + "_avg", t.name + "_sum", t.name + "_dev"}
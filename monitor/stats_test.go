@@ -57,6 +57,54 @@ func TestStatsUpdate(t *testing.T) {
 		t.Error("Aggregate or Update not working")
 	}
 }
+
+func TestStatsNodes(t *testing.T) {
+	stats := NewStats(nil)
+	stats.Update(NewNodeMeasure("1", "msgs", 2))
+	stats.Update(NewNodeMeasure("1", "msgs", 3))
+	stats.Update(NewNodeMeasure("2", "msgs", 1))
+	stats.Update(NewSingleMeasure("round_wall", 10))
+	nodes := stats.Nodes()
+	if nodes["1"]["msgs"] != 5 || nodes["2"]["msgs"] != 1 {
+		t.Error("Wrong node measures:", nodes)
+	}
+	if _, ok := stats.values["msgs"]; ok {
+		t.Error("Node measures shouldn't be in the stats")
+	}
+}
+
+func TestStatsRaw(t *testing.T) {
+	stats := NewStats(map[string]string{"hosts": "2"})
+	stats.Update(NewSingleMeasure("round_wall", 10))
+	stats.Update(NewNodeMeasure("1", "msgs", 2))
+	raw := stats.Raw()
+	if len(raw) != 2 || raw[0].Name != "round_wall" || raw[1].Node != "1" {
+		t.Fatal("Wrong raw measures:", raw)
+	}
+	if raw[0].Config["hosts"] != "2" || raw[1].Time < raw[0].Time {
+		t.Fatal("Wrong config or time:", raw)
+	}
+}
+
+func TestStatsSummary(t *testing.T) {
+	stats := NewStats(nil)
+	for i := 1; i <= 100; i++ {
+		stats.Update(NewSingleMeasure("round_wall", float64(i)))
+	}
+	s := stats.Summary()["round_wall"]
+	if s.N != 100 || s.Min != 1 || s.Max != 100 || s.Sum != 5050 ||
+		s.Avg != 50.5 {
+		t.Fatal("Wrong summary:", s)
+	}
+	if s.P50 != 50 || s.P90 != 90 || s.P99 != 99 {
+		t.Fatal("Wrong percentiles:", s)
+	}
+	// the summary doesn't change the stats
+	if stats.Summary()["round_wall"] != s {
+		t.Fatal("Summary changed")
+	}
+}
+
 func TestStatsOrder(t *testing.T) {
 	m := make(map[string]string)
 	m["servers"] = "1"
@@ -84,6 +132,17 @@ func TestStatsOrder(t *testing.T) {
 	}
 }
 
+func TestStatsStatic(t *testing.T) {
+	rc := map[string]string{"hosts": "4", "loss": "0.5", "suite": "ed25519"}
+	stat := NewStats(rc, "hosts")
+	str := new(bytes.Buffer)
+	stat.WriteHeader(str)
+	stat.WriteValues(str)
+	if str.String() != "hosts,loss\n4,0.5\n" {
+		t.Fatal("Wrong static fields:", str.String())
+	}
+}
+
 func TestValues(t *testing.T) {
 	v1 := NewValue("test")
 	v1.Store(5.0)
@@ -13,9 +13,10 @@ type ConnType string
 
 // Address contains the ConnType and the actual network address. It is used to connect
 // to a remote host with a Conn and to listen by a Listener.
-// A network address holds an IP address and the port number joined
-// by a colon.
-// It doesn't support IPv6 yet.
+// A network address holds a host and the port number joined by a colon. The
+// host can be an IPv4 address, an IPv6 address in brackets or a DNS hostname,
+// e.g. "tcp://[::1]:2000" or "tcp://conode.example.org:2000". Hostnames are
+// resolved only when connecting, so they can point to dynamic IPs.
 type Address string
 
 const (
@@ -73,10 +74,10 @@ func (a Address) NetworkAddress() string {
 // Valid returns true if the address is well formed or false otherwise.
 // An address is well formed if it is of the form: ConnType://NetworkAddress.
 // ConnType must be one of the constants defined in this file,
-// NetworkAddress must contain the IP address + Port number.
-// The IP address is validated by net.ParseIP & the port must be included in the
-// range [0;65536].
-// Ex. tls:192.168.1.10:5678
+// NetworkAddress must contain the host + Port number.
+// The host is either an IP address validated by net.ParseIP, or a valid DNS
+// hostname. The port must be included in the range [0;65536].
+// Ex. tls://192.168.1.10:5678, tcp://[fe80::1]:5678, tcp://example.org:5678
 func (a Address) Valid() bool {
 	vals := strings.Split(string(a), typeAddressSep)
 	if len(vals) != 2 {
@@ -86,7 +87,7 @@ func (a Address) Valid() bool {
 		return false
 	}
 
-	ip, port, e := net.SplitHostPort(vals[1])
+	host, port, e := net.SplitHostPort(vals[1])
 	if e != nil {
 		return false
 	}
@@ -96,10 +97,35 @@ func (a Address) Valid() bool {
 		return false
 	}
 
-	if ip == "localhost" {
-		// localhost is not recognized by net.ParseIP ?
+	if net.ParseIP(host) != nil {
 		return true
-	} else if net.ParseIP(ip) == nil {
+	}
+	// IPv6 addresses with a zone are not supported, and only IPv6
+	// addresses may contain colons.
+	if strings.Contains(host, ":") {
+		return false
+	}
+	return validHostname(host)
+}
+
+// hostnameLabel matches one label of a hostname as defined in RFC 1123.
+var hostnameLabel = regexp.MustCompile("^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$")
+
+// validHostname returns true if host is a syntactically valid DNS hostname.
+// To avoid confusion with wrong IP addresses, the last label may not be
+// numeric.
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if len(host) == 0 || len(host) > 253 {
+		return false
+	}
+	labels := strings.Split(host, ".")
+	for _, l := range labels {
+		if !hostnameLabel.MatchString(l) {
+			return false
+		}
+	}
+	if _, err := strconv.Atoi(labels[len(labels)-1]); err == nil {
 		return false
 	}
 	return true
@@ -122,9 +148,9 @@ func (a Address) Host() string {
 	if e != nil {
 		return ""
 	}
-	// IPv6 unspecified address has to be in brackets.
-	if h == "::" {
-		h = "[::]"
+	// IPv6 addresses have to be in brackets.
+	if strings.Contains(h, ":") {
+		h = "[" + h + "]"
 	}
 	return h
 }
@@ -148,18 +174,44 @@ func (a Address) Port() string {
 // Public returns true if the address is a public and valid one
 // or false otherwise.
 // Specifically it checks if it is a private address by checking
-// 192.168.**,10.***,127.***,172.16-31.**,169.254.**
+// 192.168.**,10.***,127.***,172.16-31.**,169.254.** and the IPv6
+// loopback, unspecified, link-local and unique local addresses.
+// As hostnames are not resolved, all hostnames except "localhost" are
+// considered public.
 func (a Address) Public() bool {
-	private, err := regexp.MatchString("(^127\\.)|(^10\\.)|"+
-		"(^172\\.1[6-9]\\.)|(^172\\.2[0-9]\\.)|"+
-		"(^172\\.3[0-1]\\.)|(^192\\.168\\.)|(^169\\.254)|"+
-		"(^\\[::\\])", a.NetworkAddress())
-	if err != nil {
+	if !a.Valid() {
 		return false
 	}
-	return !private && a.Valid()
+	h, _, _ := net.SplitHostPort(a.NetworkAddress())
+	ip := net.ParseIP(h)
+	if ip == nil {
+		return h != "localhost"
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
 }
 
+// privateNets are the IP ranges that are not reachable from the Internet.
+var privateNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12",
+		"192.168.0.0/16", "169.254.0.0/16", "fc00::/7"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
 // NewAddress takes a connection type and the raw address. It returns a
 // correctly formatted address, which will be of type t.
 // It doesn't do any checking of ConnType or network.
@@ -41,6 +41,14 @@ func TestAddress(t *testing.T) {
 		{"tcp://67.43.129.85:2000", true, PlainTCP, "67.43.129.85:2000", "67.43.129.85", "2000", true},
 		{"purb://10.0.0.4:2000", true, PURB, "10.0.0.4:2000", "10.0.0.4", "2000", false},
 		{"tls://[::]:1000", true, TLS, "[::]:1000", "[::]", "1000", false},
+		{"tcp://[::1]:2000", true, PlainTCP, "[::1]:2000", "[::1]", "2000", false},
+		{"tcp://[fd00::4]:2000", true, PlainTCP, "[fd00::4]:2000", "[fd00::4]", "2000", false},
+		{"tcp://[2001:db8::1]:2000", true, PlainTCP, "[2001:db8::1]:2000", "[2001:db8::1]", "2000", true},
+		{"tcp://localhost:2000", true, PlainTCP, "localhost:2000", "localhost", "2000", false},
+		{"tcp://conode.example.org:2000", true, PlainTCP, "conode.example.org:2000", "conode.example.org", "2000", true},
+		{"tcp://::1:2000", false, InvalidConnType, "", "", "", false},
+		{"tcp://conode_1.example.org:2000", false, InvalidConnType, "", "", "", false},
+		{"tcp://-conode.example.org:2000", false, InvalidConnType, "", "", "", false},
 		{"tls4://10.0.0.4:2000", false, InvalidConnType, "", "", "", false},
 		{"tls://1000.0.0.4:2000", false, InvalidConnType, "", "", "", false},
 		{"tls://10.0.0.4:20000000", false, InvalidConnType, "", "", "", false},
@@ -1,7 +1,7 @@
 package network
 
 import (
-	"errors"
+	"context"
 	"strconv"
 	"sync"
 	"time"
@@ -10,7 +10,7 @@ import (
 )
 
 func init() {
-	RegisterPacketType(&StatusRet{})
+	RegisterPacketTypeVersion("network.StatusRet", 0, &StatusRet{})
 }
 
 // Client is used for the external API of services.
@@ -29,12 +29,38 @@ var baseIDLock sync.Mutex
 
 var timeoutResponse = 10 * time.Second
 
+// TimeoutError is returned by the Client if the remote service didn't
+// answer before the deadline of the request.
+type TimeoutError struct {
+	Address Address
+}
+
+func (te *TimeoutError) Error() string {
+	return "Timeout on sending message to " + te.Address.String()
+}
+
+// IsTimeout returns true if the error is a TimeoutError.
+func IsTimeout(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
 // Send will send the message to the destination service and return the
 // reply.
 // In case of an error, it returns a nil-packet and the error.
-// Send will timeout and return an error if it has not received any response
-// under 10 sec.
+// Send will timeout and return a TimeoutError if it has not received any
+// response under 10 sec.
 func (cl *Client) Send(dst *ServerIdentity, msg Body) (*Packet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutResponse)
+	defer cancel()
+	return cl.SendContext(ctx, dst, msg)
+}
+
+// SendContext is like Send, but returns as soon as ctx is done. If the
+// deadline of ctx is exceeded, a TimeoutError is returned, if ctx is
+// cancelled, ctx.Err() is returned. The connection to the remote host is
+// closed in both cases.
+func (cl *Client) SendContext(ctx context.Context, dst *ServerIdentity, msg Body) (*Packet, error) {
 	kp := config.NewKeyPair(Suite)
 	// Use a unique ID for each connection.
 	baseIDLock.Lock()
@@ -44,19 +70,28 @@ func (cl *Client) Send(dst *ServerIdentity, msg Body) (*Packet, error) {
 	sid := NewServerIdentity(kp.Public, NewAddress(dst.Address.ConnType(),
 		"client:"+strconv.FormatUint(id, 10)))
 
-	c, err := cl.connector(sid, dst)
-	if err != nil {
-		return nil, err
-	}
-	defer c.Close()
-
-	if err := c.Send(sid); err != nil {
-		return nil, err
-	}
-
-	msgCh := make(chan Packet)
-	errCh := make(chan error)
+	// The channels are buffered so that the go-routine can finish even if
+	// nobody listens anymore.
+	msgCh := make(chan Packet, 1)
+	errCh := make(chan error, 1)
+	// done makes sure the connection is closed once we return, even if it
+	// is established afterwards.
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
+		c, err := cl.connector(sid, dst)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		go func() {
+			<-done
+			c.Close()
+		}()
+		if err := c.Send(sid); err != nil {
+			errCh <- err
+			return
+		}
 		if err := c.Send(msg); err != nil {
 			errCh <- err
 			return
@@ -68,27 +103,32 @@ func (cl *Client) Send(dst *ServerIdentity, msg Body) (*Packet, error) {
 			msgCh <- p
 		}
 	}()
-
 	select {
 	case resp := <-msgCh:
 		return &resp, nil
 	case err := <-errCh:
 		return nil, err
-	case <-time.After(timeoutResponse):
-		return nil, errors.New("Timeout on sending message")
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &TimeoutError{dst.Address}
+		}
+		return nil, ctx.Err()
 	}
 }
 
-// StatusRet is used when a status is returned - mostly an error
+// StatusRet is used when a status is returned - mostly an error. If Status
+// is non-empty, Code and Service describe the error.
 type StatusRet struct {
-	Status string
+	Status  string
+	Code    ErrorCode
+	Service string
 }
 
 // StatusOK is used when there is no error but nothing to return
-var StatusOK = &StatusRet{""}
+var StatusOK = &StatusRet{Status: ""}
 
 // ErrMsg converts a combined err and status-message to an error. It
-// returns either the error, or the errormsg, if there is one.
+// returns either the error, or a *ServiceError, if the status holds one.
 func ErrMsg(em *Packet, err error) error {
 	if err != nil {
 		return err
@@ -97,9 +137,98 @@ func ErrMsg(em *Packet, err error) error {
 	if !ok {
 		return nil
 	}
-	statusStr := status.Status
-	if statusStr == "" {
+	if status.Status == "" {
 		return nil
 	}
-	return errors.New("Remote-error: " + statusStr)
+	code := status.Code
+	if code == ErrorCodeOK {
+		// Remote host doesn't send codes
+		code = ErrorCodeInternal
+	}
+	return &ServiceError{
+		Code:    code,
+		Service: status.Service,
+		Message: status.Status,
+	}
+}
+
+// ErrorCode lets a client know what kind of error happened in a remote
+// service.
+type ErrorCode int
+
+const (
+	// ErrorCodeOK means no error happened.
+	ErrorCodeOK ErrorCode = iota
+	// ErrorCodeInternal is used for all errors that don't have a more
+	// specific code.
+	ErrorCodeInternal
+	// ErrorCodeNotFound is used if the requested element is not known to the
+	// service.
+	ErrorCodeNotFound
+	// ErrorCodeInvalidSignature is used if a signature didn't verify.
+	ErrorCodeInvalidSignature
+	// ErrorCodeTimeout is used if the service or the client gave up waiting.
+	ErrorCodeTimeout
+	// ErrorCodeAccessDenied is used if the client is not allowed to use the
+	// service.
+	ErrorCodeAccessDenied
+)
+
+func (ec ErrorCode) String() string {
+	switch ec {
+	case ErrorCodeOK:
+		return "ok"
+	case ErrorCodeInternal:
+		return "internal"
+	case ErrorCodeNotFound:
+		return "not found"
+	case ErrorCodeInvalidSignature:
+		return "invalid signature"
+	case ErrorCodeTimeout:
+		return "timeout"
+	case ErrorCodeAccessDenied:
+		return "access denied"
+	}
+	return "unknown code " + strconv.Itoa(int(ec))
+}
+
+// ServiceError is the error returned by a remote service. Services can return
+// it from their handlers to give a more specific code than
+// ErrorCodeInternal.
+type ServiceError struct {
+	Code    ErrorCode
+	Service string
+	Message string
+}
+
+// NewServiceError returns a ServiceError with the given code. The name of the
+// service is filled in when the error is sent back to the client.
+func NewServiceError(code ErrorCode, msg string) *ServiceError {
+	return &ServiceError{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+func (se *ServiceError) Error() string {
+	str := "Remote-error (" + se.Code.String() + ")"
+	if se.Service != "" {
+		str += " in " + se.Service
+	}
+	return str + ": " + se.Message
+}
+
+// ErrorCodeOf returns the ErrorCode of err: ErrorCodeOK for a nil-error,
+// the code of a ServiceError, ErrorCodeTimeout for a TimeoutError and
+// ErrorCodeInternal for all other errors.
+func ErrorCodeOf(err error) ErrorCode {
+	switch e := err.(type) {
+	case nil:
+		return ErrorCodeOK
+	case *ServiceError:
+		return e.Code
+	case *TimeoutError:
+		return ErrorCodeTimeout
+	}
+	return ErrorCodeInternal
 }
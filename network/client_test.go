@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -45,6 +46,22 @@ func testClient(t *testing.T, fac routerFactory, cl clientFactory) {
 	if err == nil {
 		t.Fatal("Client should not be able to have a response")
 	}
+	// server doesn't answer
+	proc.drop = false
+	proc.silent = true
+	client = cl()
+	_, err = client.Send(r.ServerIdentity, &SimpleMessage{3})
+	require.True(t, IsTimeout(err))
+	// client cancels the request
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	client = cl()
+	_, err = client.SendContext(ctx, r.ServerIdentity, &SimpleMessage{3})
+	require.Equal(t, context.Canceled, err)
+	proc.silent = false
 	// client will get an error message
 	proc.err = true
 	client = cl()
@@ -52,6 +69,7 @@ func testClient(t *testing.T, fac routerFactory, cl clientFactory) {
 	if err == nil {
 		t.Fatal("Client should return an error")
 	}
+	require.Equal(t, ErrorCodeNotFound, ErrorCodeOf(err))
 	timeoutResponse = old
 
 	// client won't connect
@@ -70,6 +88,8 @@ type SendBackProc struct {
 	drop bool
 	// sendback error
 	err bool
+	// don't answer at all
+	silent bool
 }
 
 func NewSendBackProc(t *testing.T, r *Router) *SendBackProc {
@@ -84,6 +104,9 @@ func (sbp *SendBackProc) Process(msg *Packet) {
 	if !ok {
 		sbp.t.Fatal("Not the message expected")
 	}
+	if sbp.silent {
+		return
+	}
 	if sbp.drop {
 		c := sbp.r.connection(msg.ServerIdentity.ID)
 		if c == nil {
@@ -93,7 +116,7 @@ func (sbp *SendBackProc) Process(msg *Packet) {
 			sbp.t.Fatal("closing impossible??")
 		}
 	} else if sbp.err {
-		sbp.r.Send(msg.ServerIdentity, &StatusRet{"Error returning"})
+		sbp.r.Send(msg.ServerIdentity, &StatusRet{Status: "Error returning", Code: ErrorCodeNotFound})
 	} else {
 		err := sbp.r.Send(msg.ServerIdentity, &simple)
 		assert.Nil(sbp.t, err)
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/dedis/cothority/log"
@@ -52,59 +54,139 @@ const NamespaceURL = "https://dedis.epfl.ch/"
 // NamespaceBodyType is the namespace used for PacketTypeID
 const NamespaceBodyType = NamespaceURL + "/protocolType/"
 
+// PacketVersion identifies the wire format of a registered packet type by a
+// stable name and a version.
+type PacketVersion struct {
+	Name    string
+	Version int
+}
+
+// ID returns the PacketTypeID derived from the name and the version. Version
+// 0 gives the same ID as RegisterPacketType for a Go type called Name.
+func (pv PacketVersion) ID() PacketTypeID {
+	url := NamespaceBodyType + pv.Name
+	if pv.Version > 0 {
+		url += "/v" + strconv.Itoa(pv.Version)
+	}
+	return PacketTypeID(uuid.NewV5(uuid.NamespaceURL, url))
+}
+
+// String returns the name and the version.
+func (pv PacketVersion) String() string {
+	return fmt.Sprintf("%s/v%d", pv.Name, pv.Version)
+}
+
 // RegisterPacketType registers a custom "struct" / "packet" and returns the
-// corresponding PacketTypeID.
+// corresponding PacketTypeID, which is derived from the name of the Go
+// type. Renaming the type or moving it to another package changes its
+// PacketTypeID: use RegisterPacketTypeVersion for packets that are sent
+// between conodes of different versions.
 // Simply pass your non-initialized struct.
 func RegisterPacketType(msg Body) PacketTypeID {
-	msgType := TypeToPacketTypeID(msg)
-	val := reflect.ValueOf(msg)
-	if val.Kind() == reflect.Ptr {
-		val = val.Elem()
+	t := bodyType(msg)
+	if id, ok := registry.id(t); ok {
+		return id
 	}
-	t := val.Type()
-	return RegisterPacketUUID(msgType, t)
+	return RegisterPacketUUID(RTypeToPacketTypeID(t), t)
+}
+
+// RegisterPacketTypeVersion registers a custom "struct" / "packet" under an
+// explicit name and version, and returns the corresponding PacketTypeID. The
+// PacketTypeID depends only on name and version, so that the Go type can be
+// renamed or moved without changing the wire format. If the wire format of
+// the packet changes, the version must be increased. Existing packets can be
+// pinned to their current PacketTypeID by registering them with their
+// current Go type name, like "network.ServerIdentity", and version 0.
+// It panics if the PacketTypeID or the type is already registered
+// differently.
+func RegisterPacketTypeVersion(name string, version int, msg Body) PacketTypeID {
+	pv := PacketVersion{name, version}
+	if err := registry.put(pv.ID(), pv, bodyType(msg)); err != nil {
+		log.Panic(err)
+	}
+	return pv.ID()
 }
 
 // RegisterPacketUUID can be used if the uuid and the type is already known
 // NOTE: be sure to only registers VALUE message and not POINTERS to message.
+// It panics if the uuid is already registered for another type.
 func RegisterPacketUUID(mt PacketTypeID, rt reflect.Type) PacketTypeID {
-	if _, typeRegistered := registry.get(mt); typeRegistered {
-		return mt
+	if err := registry.put(mt, PacketVersion{rt.String(), 0}, rt); err != nil {
+		log.Panic(err)
 	}
-	registry.put(mt, rt)
-
 	return mt
 }
 
 // TypeFromData returns the PacketTypeID corresponding to the given structure.
 // It returns 'ErrorType' if the type wasn't found or an error occurred.
 func TypeFromData(msg Body) PacketTypeID {
-	msgType := TypeToPacketTypeID(msg)
-	_, ok := registry.get(msgType)
+	id, ok := registry.id(bodyType(msg))
 	if !ok {
 		return ErrorType
 	}
-	return msgType
+	return id
 }
 
-// TypeToPacketTypeID converts a Body to a PacketTypeID
+// TypeToPacketTypeID converts a Body to a PacketTypeID. If the type is
+// registered, its registered PacketTypeID is returned, else the one derived
+// from the name of the type.
 func TypeToPacketTypeID(msg Body) PacketTypeID {
-	val := reflect.ValueOf(msg)
-	if val.Kind() == reflect.Ptr {
-		val = val.Elem()
-	}
-	url := NamespaceBodyType + val.Type().String()
-	u := uuid.NewV5(uuid.NamespaceURL, url)
+	u := RTypeToPacketTypeID(bodyType(msg))
 	log.Lvl5("Reflecting", reflect.TypeOf(msg), "to", u)
-	return PacketTypeID(u)
+	return u
 }
 
-// RTypeToPacketTypeID converts a reflect.Type to a PacketTypeID
+// RTypeToPacketTypeID converts a reflect.Type to a PacketTypeID. If the type
+// is registered, its registered PacketTypeID is returned, else the one
+// derived from the name of the type.
 func RTypeToPacketTypeID(msg reflect.Type) PacketTypeID {
+	if id, ok := registry.id(msg); ok {
+		return id
+	}
 	url := NamespaceBodyType + msg.String()
 	return PacketTypeID(uuid.NewV5(uuid.NamespaceURL, url))
 }
 
+// bodyType returns the type of msg, or of the value pointed to by msg.
+func bodyType(msg Body) reflect.Type {
+	t := reflect.TypeOf(msg)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// RegisteredPacket describes a registered packet type.
+type RegisteredPacket struct {
+	PacketVersion
+	ID   PacketTypeID
+	Type reflect.Type
+}
+
+// RegisteredPackets returns all registered packet types, sorted by name and
+// version.
+func RegisteredPackets() []RegisteredPacket {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	var rps []RegisteredPacket
+	for id, t := range registry.types {
+		rps = append(rps, RegisteredPacket{registry.versions[id], id, t})
+	}
+	sort.Sort(packetsByVersion(rps))
+	return rps
+}
+
+type packetsByVersion []RegisteredPacket
+
+func (p packetsByVersion) Len() int      { return len(p) }
+func (p packetsByVersion) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p packetsByVersion) Less(i, j int) bool {
+	if p[i].Name != p[j].Name {
+		return p[i].Name < p[j].Name
+	}
+	return p[i].Version < p[j].Version
+}
+
 // DumpTypes is used for debugging - it prints out all known types
 func DumpTypes() {
 	for t, m := range registry.types {
@@ -136,13 +218,18 @@ func (am *Packet) SetError(err error) {
 
 type typeRegistry struct {
 	types map[PacketTypeID]reflect.Type
-	lock  sync.Mutex
+	// ids maps every registered type to its PacketTypeID
+	ids      map[reflect.Type]PacketTypeID
+	versions map[PacketTypeID]PacketVersion
+	lock     sync.Mutex
 }
 
 func newTypeRegistry() *typeRegistry {
 	return &typeRegistry{
-		types: make(map[PacketTypeID]reflect.Type),
-		lock:  sync.Mutex{},
+		types:    make(map[PacketTypeID]reflect.Type),
+		ids:      make(map[reflect.Type]PacketTypeID),
+		versions: make(map[PacketTypeID]PacketVersion),
+		lock:     sync.Mutex{},
 	}
 }
 
@@ -155,11 +242,45 @@ func (tr *typeRegistry) get(id PacketTypeID) (reflect.Type, bool) {
 	return t, ok
 }
 
-// put stores the given type in the typeRegistry.
-func (tr *typeRegistry) put(id PacketTypeID, typ reflect.Type) {
+// id returns the PacketTypeID of the registered type and a boolean
+// indicating if the type is actually registered or not.
+func (tr *typeRegistry) id(typ reflect.Type) (PacketTypeID, bool) {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	id, ok := tr.ids[typ]
+	return id, ok
+}
+
+// version returns the name and version under which the PacketTypeID has
+// been registered.
+func (tr *typeRegistry) version(id PacketTypeID) (PacketVersion, bool) {
 	tr.lock.Lock()
 	defer tr.lock.Unlock()
+	pv, ok := tr.versions[id]
+	return pv, ok
+}
+
+// put stores the given type in the typeRegistry. Registering the same type
+// with the same id twice is allowed, but it returns an error if the id is
+// already used by another type or if the type already has another id.
+func (tr *typeRegistry) put(id PacketTypeID, pv PacketVersion, typ reflect.Type) error {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	if t, ok := tr.types[id]; ok {
+		if t == typ {
+			return nil
+		}
+		return fmt.Errorf("PacketTypeID of %s is already registered for %s",
+			pv, t)
+	}
+	if other, ok := tr.ids[typ]; ok {
+		return fmt.Errorf("%s is already registered as %s", typ,
+			tr.versions[other])
+	}
 	tr.types[id] = typ
+	tr.ids[typ] = id
+	tr.versions[id] = pv
+	return nil
 }
 
 var registry = newTypeRegistry()
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
 )
 
 type TestRegisterS struct {
@@ -36,3 +37,49 @@ func TestRegisterReflect(t *testing.T) {
 		t.Fatal("Register does not work")
 	}
 }
+
+type TestVersionS struct {
+	I int
+}
+
+type TestVersionOtherS struct {
+	S string
+}
+
+func TestRegisterPacketTypeVersion(t *testing.T) {
+	id := RegisterPacketTypeVersion("network.TestVersion", 1, TestVersionS{})
+	require.Equal(t, PacketVersion{"network.TestVersion", 1}.ID(), id)
+	require.Equal(t, id, TypeFromData(&TestVersionS{}))
+	require.Equal(t, id, RegisterPacketType(TestVersionS{}))
+	// version 0 is compatible with RegisterPacketType
+	require.Equal(t, RTypeToPacketTypeID(reflect.TypeOf(TestRegisterS{})),
+		PacketVersion{"network.TestRegisterS", 0}.ID())
+
+	// same registration twice
+	require.Equal(t, id, RegisterPacketTypeVersion("network.TestVersion", 1,
+		&TestVersionS{}))
+	// duplicate ID for another type
+	require.Panics(t, func() {
+		RegisterPacketTypeVersion("network.TestVersion", 1, TestVersionOtherS{})
+	})
+	// type already registered with another version
+	require.Panics(t, func() {
+		RegisterPacketTypeVersion("network.TestVersion", 2, TestVersionS{})
+	})
+
+	buf, err := MarshalRegisteredType(&TestVersionS{12})
+	require.Nil(t, err)
+	typ, msg, err := UnmarshalRegisteredType(buf, DefaultConstructors(Suite))
+	require.Nil(t, err)
+	require.Equal(t, id, typ)
+	require.Equal(t, 12, msg.(TestVersionS).I)
+
+	var found bool
+	for _, rp := range RegisteredPackets() {
+		if rp.ID == id {
+			found = true
+			require.Equal(t, PacketVersion{"network.TestVersion", 1}, rp.PacketVersion)
+		}
+	}
+	require.True(t, found)
+}
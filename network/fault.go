@@ -0,0 +1,288 @@
+package network
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LinkFaults describes the faults injected on the packets sent over a link
+// between two addresses of a LocalManager.
+type LinkFaults struct {
+	// Latency is the minimal delay of each packet.
+	Latency time.Duration
+	// Jitter is the maximal random delay added to Latency. Packets are still
+	// delivered in order, as with a TCP connection.
+	Jitter time.Duration
+	// DropRate is the probability a packet is lost.
+	DropRate float64
+	// DuplicateRate is the probability a packet is delivered twice.
+	DuplicateRate float64
+	// ReorderRate is the probability a packet is held back for ReorderDelay
+	// so that following packets overtake it.
+	ReorderRate float64
+	// ReorderDelay is the additional delay of a reordered packet. If it is
+	// 0, 10 milliseconds are used.
+	ReorderDelay time.Duration
+	// LossRate is the probability a packet is lost once and sent again
+	// after RetransmitDelay, like a lost TCP segment. Contrary to DropRate,
+	// the packet is delivered and the following packets wait for it.
+	LossRate float64
+	// RetransmitDelay is the additional delay of a lost packet. If it is 0,
+	// 200 milliseconds are used, the minimal retransmission timeout of TCP.
+	RetransmitDelay time.Duration
+	// Bandwidth is the throughput of the link in Mbit/s. Every packet
+	// occupies the link for the time needed to transmit it, so that the
+	// following packets wait. If it is 0, the bandwidth is not limited.
+	Bandwidth float64
+}
+
+// FaultStats counts the faults injected by a FaultInjector.
+type FaultStats struct {
+	Delivered     int
+	Dropped       int
+	Duplicated    int
+	Reordered     int
+	Retransmitted int
+}
+
+// FaultInjector makes the delivery of the packets of a LocalManager
+// unreliable. All random decisions are taken from a generator seeded at
+// creation, so that a test using the same seed and sending the same packets
+// sees the same faults. The first packet of every connection, the exchange
+// of the ServerIdentities, is never faulted.
+type FaultInjector struct {
+	sync.Mutex
+	random *rand.Rand
+	// faults of all links without specific faults
+	defaults LinkFaults
+	links    map[link]LinkFaults
+	// partitions maps the name of a partition to the group of each address
+	partitions map[string]map[Address]int
+	// queues holds the delayed packets of each link
+	queues map[link]*delayQueue
+	// busy holds the time until which each link transmits its packets
+	busy  map[link]time.Time
+	stats FaultStats
+}
+
+// link is a directed connection between two addresses.
+type link struct {
+	from, to Address
+}
+
+// NewFaultInjector returns a FaultInjector that doesn't inject any fault
+// until it is configured.
+func NewFaultInjector(seed int64) *FaultInjector {
+	return &FaultInjector{
+		random:     rand.New(rand.NewSource(seed)),
+		links:      make(map[link]LinkFaults),
+		partitions: make(map[string]map[Address]int),
+		queues:     make(map[link]*delayQueue),
+		busy:       make(map[link]time.Time),
+	}
+}
+
+// SetDefault sets the faults of all links that don't have specific faults.
+func (fi *FaultInjector) SetDefault(lf LinkFaults) {
+	fi.Lock()
+	defer fi.Unlock()
+	fi.defaults = lf
+}
+
+// SetLink sets the faults of the packets sent from one address to another.
+// To make a link faulty in both directions, SetLink has to be called twice.
+func (fi *FaultInjector) SetLink(from, to Address, lf LinkFaults) {
+	fi.Lock()
+	defer fi.Unlock()
+	fi.links[link{from, to}] = lf
+}
+
+// ResetLink removes the specific faults of the link, so that it uses the
+// default faults again.
+func (fi *FaultInjector) ResetLink(from, to Address) {
+	fi.Lock()
+	defer fi.Unlock()
+	delete(fi.links, link{from, to})
+}
+
+// Partition splits the given addresses into groups that cannot communicate
+// with each other. New connections between the groups are refused and the
+// packets on existing connections are dropped. Addresses not part of any
+// group are not affected. The partition stays in place until Heal is called
+// with the same name.
+func (fi *FaultInjector) Partition(name string, groups ...[]Address) {
+	fi.Lock()
+	defer fi.Unlock()
+	p := make(map[Address]int)
+	for i, g := range groups {
+		for _, a := range g {
+			p[a] = i
+		}
+	}
+	fi.partitions[name] = p
+}
+
+// Heal removes the partition with the given name.
+func (fi *FaultInjector) Heal(name string) {
+	fi.Lock()
+	defer fi.Unlock()
+	delete(fi.partitions, name)
+}
+
+// Stats returns how many packets have been delivered, dropped, duplicated
+// and reordered.
+func (fi *FaultInjector) Stats() FaultStats {
+	fi.Lock()
+	defer fi.Unlock()
+	return fi.stats
+}
+
+// partitioned returns true if from and to are in different groups of a
+// partition. The lock must be held by the caller.
+func (fi *FaultInjector) partitioned(from, to Address) bool {
+	for _, p := range fi.partitions {
+		gf, okf := p[from]
+		gt, okt := p[to]
+		if okf && okt && gf != gt {
+			return true
+		}
+	}
+	return false
+}
+
+// canConnect returns false if from and to are partitioned.
+func (fi *FaultInjector) canConnect(from, to Address) bool {
+	fi.Lock()
+	defer fi.Unlock()
+	return !fi.partitioned(from, to)
+}
+
+// send applies the faults of the link to the packet of the given size and
+// calls deliver once for every copy of the packet that is not dropped,
+// possibly after a delay.
+func (fi *FaultInjector) send(from, to Address, size int, deliver func()) {
+	// deliver must not be called with the lock held, as the LocalManager
+	// checks for partitions with its own lock held.
+	immediate := 0
+	defer func() {
+		for i := 0; i < immediate; i++ {
+			deliver()
+		}
+	}()
+	fi.Lock()
+	defer fi.Unlock()
+	if fi.partitioned(from, to) {
+		fi.stats.Dropped++
+		return
+	}
+	lf, ok := fi.links[link{from, to}]
+	if !ok {
+		lf = fi.defaults
+	}
+	if fi.random.Float64() < lf.DropRate {
+		fi.stats.Dropped++
+		return
+	}
+	copies := 1
+	if fi.random.Float64() < lf.DuplicateRate {
+		fi.stats.Duplicated++
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		delay := lf.Latency + fi.transmission(link{from, to}, size, lf.Bandwidth)
+		if lf.Jitter > 0 {
+			delay += time.Duration(fi.random.Int63n(int64(lf.Jitter)))
+		}
+		if lf.LossRate > 0 && fi.random.Float64() < lf.LossRate {
+			fi.stats.Retransmitted++
+			retransmit := lf.RetransmitDelay
+			if retransmit == 0 {
+				retransmit = 200 * time.Millisecond
+			}
+			delay += retransmit
+		}
+		fi.stats.Delivered++
+		if fi.random.Float64() < lf.ReorderRate {
+			fi.stats.Reordered++
+			reorder := lf.ReorderDelay
+			if reorder == 0 {
+				reorder = 10 * time.Millisecond
+			}
+			time.AfterFunc(delay+reorder, deliver)
+			continue
+		}
+		if delay == 0 && fi.queues[link{from, to}] == nil {
+			immediate++
+			continue
+		}
+		fi.enqueue(link{from, to}, time.Now().Add(delay), deliver)
+	}
+}
+
+// transmission returns the time from now until a packet of the given size
+// is transmitted over the link and marks the link as busy until then. The
+// lock must be held by the caller.
+func (fi *FaultInjector) transmission(l link, size int, bandwidth float64) time.Duration {
+	if bandwidth <= 0 {
+		return 0
+	}
+	now := time.Now()
+	start := now
+	if busy := fi.busy[l]; busy.After(now) {
+		start = busy
+	}
+	end := start.Add(time.Duration(float64(size*8) / (bandwidth * 1e6) *
+		float64(time.Second)))
+	fi.busy[l] = end
+	return end.Sub(now)
+}
+
+// delayQueue holds the delayed packets of one link, in the order they
+// have to be delivered.
+type delayQueue struct {
+	packets []delayedPacket
+	// last is the delivery time of the last packet in the queue
+	last time.Time
+}
+
+type delayedPacket struct {
+	at      time.Time
+	deliver func()
+}
+
+// enqueue adds a packet to the queue of the link and starts the routine
+// delivering the packets if there is none. A packet is never delivered before
+// the packets sent earlier on the same link. The lock must be held by the
+// caller.
+func (fi *FaultInjector) enqueue(l link, at time.Time, deliver func()) {
+	q, ok := fi.queues[l]
+	if !ok {
+		q = &delayQueue{}
+		fi.queues[l] = q
+		go fi.deliverQueue(l, q)
+	}
+	if at.Before(q.last) {
+		at = q.last
+	}
+	q.last = at
+	q.packets = append(q.packets, delayedPacket{at, deliver})
+}
+
+// deliverQueue delivers the packets of the queue at their time and returns
+// once the queue is empty.
+func (fi *FaultInjector) deliverQueue(l link, q *delayQueue) {
+	for {
+		fi.Lock()
+		if len(q.packets) == 0 {
+			delete(fi.queues, l)
+			fi.Unlock()
+			return
+		}
+		p := q.packets[0]
+		q.packets = q.packets[1:]
+		fi.Unlock()
+		time.Sleep(p.at.Sub(time.Now()))
+		p.deliver()
+	}
+}
@@ -0,0 +1,163 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// faultyPair returns a connection from a to b of a LocalManager using fi and
+// the channel where b receives the SimpleMessages. The first packet of the
+// connection, which is never faulted, has already been sent.
+func faultyPair(t *testing.T, fi *FaultInjector, a, b Address) (*LocalManager, Conn, chan int) {
+	lm := NewLocalManager()
+	lm.SetFaultInjector(fi)
+	received := make(chan int, 10)
+	listener, err := NewLocalListenerWithManager(lm, b)
+	require.Nil(t, err)
+	go listener.Listen(func(c Conn) {
+		for {
+			p, err := c.Receive()
+			if err != nil {
+				return
+			}
+			received <- p.Msg.(SimpleMessage).I
+		}
+	})
+	for !listener.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c, err := NewLocalConnWithManager(lm, a, b)
+	require.Nil(t, err)
+	require.Nil(t, c.Send(&SimpleMessage{0}))
+	require.Equal(t, 0, <-received)
+	return lm, c, received
+}
+
+func expectNothing(t *testing.T, received chan int) {
+	select {
+	case i := <-received:
+		t.Fatal("Received unexpected message", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFaultInjectorDrop(t *testing.T) {
+	a, b := NewLocalAddress("127.0.0.1:2000"), NewLocalAddress("127.0.0.1:2001")
+	fi := NewFaultInjector(1)
+	_, c, received := faultyPair(t, fi, a, b)
+	defer c.Close()
+
+	fi.SetLink(a, b, LinkFaults{DropRate: 1})
+	require.Nil(t, c.Send(&SimpleMessage{1}))
+	expectNothing(t, received)
+
+	fi.ResetLink(a, b)
+	require.Nil(t, c.Send(&SimpleMessage{2}))
+	require.Equal(t, 2, <-received)
+	require.Equal(t, FaultStats{Delivered: 1, Dropped: 1}, fi.Stats())
+}
+
+func TestFaultInjectorPartition(t *testing.T) {
+	a, b := NewLocalAddress("127.0.0.1:2000"), NewLocalAddress("127.0.0.1:2001")
+	fi := NewFaultInjector(1)
+	lm, c, received := faultyPair(t, fi, a, b)
+	defer c.Close()
+
+	fi.Partition("split", []Address{a}, []Address{b})
+	require.Nil(t, c.Send(&SimpleMessage{1}))
+	expectNothing(t, received)
+	_, err := lm.connect(a, b)
+	require.NotNil(t, err)
+
+	fi.Heal("split")
+	require.Nil(t, c.Send(&SimpleMessage{2}))
+	require.Equal(t, 2, <-received)
+	c2, err := lm.connect(a, b)
+	require.Nil(t, err)
+	c2.Close()
+}
+
+func TestFaultInjectorLatency(t *testing.T) {
+	a, b := NewLocalAddress("127.0.0.1:2000"), NewLocalAddress("127.0.0.1:2001")
+	fi := NewFaultInjector(1)
+	_, c, received := faultyPair(t, fi, a, b)
+	defer c.Close()
+
+	fi.SetDefault(LinkFaults{Latency: 50 * time.Millisecond,
+		Jitter: 50 * time.Millisecond})
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		require.Nil(t, c.Send(&SimpleMessage{i}))
+	}
+	// jitter doesn't change the order of the packets
+	for i := 1; i <= 5; i++ {
+		require.Equal(t, i, <-received)
+	}
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestFaultInjectorDuplicate(t *testing.T) {
+	a, b := NewLocalAddress("127.0.0.1:2000"), NewLocalAddress("127.0.0.1:2001")
+	fi := NewFaultInjector(1)
+	_, c, received := faultyPair(t, fi, a, b)
+	defer c.Close()
+
+	fi.SetDefault(LinkFaults{DuplicateRate: 1})
+	require.Nil(t, c.Send(&SimpleMessage{1}))
+	require.Equal(t, 1, <-received)
+	require.Equal(t, 1, <-received)
+	expectNothing(t, received)
+}
+
+func TestFaultInjectorReorder(t *testing.T) {
+	a, b := NewLocalAddress("127.0.0.1:2000"), NewLocalAddress("127.0.0.1:2001")
+	fi := NewFaultInjector(1)
+	_, c, received := faultyPair(t, fi, a, b)
+	defer c.Close()
+
+	fi.SetDefault(LinkFaults{ReorderRate: 1, ReorderDelay: 50 * time.Millisecond})
+	require.Nil(t, c.Send(&SimpleMessage{1}))
+	fi.SetDefault(LinkFaults{})
+	require.Nil(t, c.Send(&SimpleMessage{2}))
+	require.Equal(t, 2, <-received)
+	require.Equal(t, 1, <-received)
+}
+
+func TestFaultInjectorLoss(t *testing.T) {
+	a, b := NewLocalAddress("127.0.0.1:2000"), NewLocalAddress("127.0.0.1:2001")
+	fi := NewFaultInjector(1)
+	_, c, received := faultyPair(t, fi, a, b)
+	defer c.Close()
+
+	fi.SetDefault(LinkFaults{LossRate: 1, RetransmitDelay: 50 * time.Millisecond})
+	start := time.Now()
+	require.Nil(t, c.Send(&SimpleMessage{1}))
+	fi.SetDefault(LinkFaults{})
+	require.Nil(t, c.Send(&SimpleMessage{2}))
+	// the lost packet is retransmitted and the next one waits for it
+	require.Equal(t, 1, <-received)
+	require.Equal(t, 2, <-received)
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+	require.Equal(t, FaultStats{Delivered: 2, Retransmitted: 1}, fi.Stats())
+}
+
+func TestFaultInjectorBandwidth(t *testing.T) {
+	a, b := NewLocalAddress("127.0.0.1:2000"), NewLocalAddress("127.0.0.1:2001")
+	fi := NewFaultInjector(1)
+	_, c, received := faultyPair(t, fi, a, b)
+	defer c.Close()
+
+	// every packet has at least the 16 bytes of its type and takes more
+	// than 12.8 ms at 10 kbit/s
+	fi.SetDefault(LinkFaults{Bandwidth: 0.01})
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		require.Nil(t, c.Send(&SimpleMessage{i}))
+	}
+	for i := 1; i <= 5; i++ {
+		require.Equal(t, i, <-received)
+	}
+	require.True(t, time.Since(start) >= 64*time.Millisecond)
+}
@@ -0,0 +1,293 @@
+package network
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dedis/cothority/log"
+)
+
+// KeepAliveInterval is the time between two keep-alive messages sent to each
+// peer the Router has a connection to.
+var KeepAliveInterval = 10 * time.Second
+
+// PeerTimeout is the time after which a peer that didn't send anything is
+// considered down: its connections are closed and the Router tries to
+// reconnect.
+var PeerTimeout = 3 * KeepAliveInterval
+
+// IdleTimeout is the time after which the connections to a peer are closed if
+// no message other than keep-alives has been exchanged with it. The Router
+// also stops reconnecting to a peer that has been idle for that long.
+var IdleTimeout = 5 * time.Minute
+
+// ReconnectBackoffMin is the time the Router waits before the first
+// reconnection to a peer that went down. The time is doubled after each failed
+// reconnection, up to ReconnectBackoffMax.
+var ReconnectBackoffMin = time.Second
+
+// ReconnectBackoffMax is the maximum time between two reconnections to a
+// peer.
+var ReconnectBackoffMax = time.Minute
+
+// KeepAlive is sent periodically over every connection. The remote Router
+// answers with Pong set to true and the same Sent-value, so that the round
+// trip time can be measured.
+type KeepAlive struct {
+	Pong bool
+	// Sent is the time in nanoseconds when the ping has been sent
+	Sent int64
+}
+
+// KeepAliveType is the PacketTypeID of KeepAlive
+var KeepAliveType = RegisterPacketTypeVersion("network.KeepAlive", 0, KeepAlive{})
+
+// PeerStatus describes the state of the connection to one peer.
+type PeerStatus struct {
+	ServerIdentity *ServerIdentity
+	// Up is true if there is a working connection to the peer
+	Up bool
+	// LastSeen is the last time a packet has been received from the peer
+	LastSeen time.Time
+	// RTT is the round trip time of the last keep-alive
+	RTT time.Duration
+	// Reconnects counts how many times the Router reconnected to the peer
+	Reconnects int
+}
+
+// peer holds the state of a remote ServerIdentity. It is protected by the
+// lock of the Router.
+type peer struct {
+	PeerStatus
+	// lastActive is the last time a message other than a keep-alive has been
+	// sent to or received from the peer
+	lastActive time.Time
+	// backoff is the time to wait before the next reconnection
+	backoff   time.Duration
+	nextRetry time.Time
+	// versions holds the packet types announced by the peer, nil if it
+	// didn't announce them
+	versions *peerVersions
+	// maintained is true if the Router dialed the peer or if the peer is
+	// known, for example as a member of a Roster. Only maintained peers are
+	// reconnected to, the others, like clients, are forgotten once their
+	// connections are closed.
+	maintained bool
+}
+
+// Peers returns the status of all peers the Router maintains the connections
+// to, sorted by address. Peers that only connected to the Router and are not
+// known, like clients, are left out.
+func (r *Router) Peers() []PeerStatus {
+	r.Lock()
+	defer r.Unlock()
+	var ps []PeerStatus
+	for _, p := range r.peers {
+		if p.maintained {
+			ps = append(ps, p.PeerStatus)
+		}
+	}
+	sort.Sort(peersByAddress(ps))
+	return ps
+}
+
+// PeerStatus returns the status of the peer with the given ID and false if
+// the peer is not known.
+func (r *Router) PeerStatus(id ServerIdentityID) (PeerStatus, bool) {
+	r.Lock()
+	defer r.Unlock()
+	p, ok := r.peers[id]
+	if !ok {
+		return PeerStatus{}, false
+	}
+	return p.PeerStatus, true
+}
+
+type peersByAddress []PeerStatus
+
+func (p peersByAddress) Len() int      { return len(p) }
+func (p peersByAddress) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p peersByAddress) Less(i, j int) bool {
+	return p[i].ServerIdentity.Address < p[j].ServerIdentity.Address
+}
+
+// SetKnownPeers sets the function telling whether a remote ServerIdentity is
+// known. Besides the peers it dialed itself, the Router only maintains the
+// connections to known peers.
+func (r *Router) SetKnownPeers(known func(*ServerIdentity) bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.known = known
+}
+
+// isKnown returns true if si is known. It must be called without the lock.
+func (r *Router) isKnown(si *ServerIdentity) bool {
+	r.Lock()
+	known := r.known
+	r.Unlock()
+	return known != nil && known(si)
+}
+
+// maintainKnown starts maintaining the connections to si if it is known,
+// even if si dialed the Router before it was known.
+func (r *Router) maintainKnown(si *ServerIdentity) {
+	r.Lock()
+	p, ok := r.peers[si.ID]
+	if !ok || p.maintained {
+		r.Unlock()
+		return
+	}
+	r.Unlock()
+	if r.isKnown(si) {
+		r.Lock()
+		p.maintained = true
+		r.Unlock()
+	}
+}
+
+// peerUp is called with the lock held whenever a new connection to si is
+// registered. maintain is true if the Router dialed si or if si is known.
+func (r *Router) peerUp(si *ServerIdentity, maintain bool) {
+	now := time.Now()
+	p, ok := r.peers[si.ID]
+	if !ok {
+		p = &peer{PeerStatus: PeerStatus{ServerIdentity: si}}
+		r.peers[si.ID] = p
+		p.lastActive = now
+	} else if !p.Up {
+		p.Reconnects++
+		// the peer might have been restarted with another version
+		p.versions = nil
+	}
+	p.Up = true
+	p.LastSeen = now
+	p.backoff = 0
+	if maintain {
+		p.maintained = true
+	}
+}
+
+// peerDown is called with the lock held when the last connection to a peer
+// has been closed. The Router will try to reconnect to the peer if it
+// maintains the connections to it, else it forgets the peer.
+func (r *Router) peerDown(id ServerIdentityID) {
+	p, ok := r.peers[id]
+	if !ok || !p.Up {
+		return
+	}
+	if !p.maintained {
+		delete(r.peers, id)
+		return
+	}
+	log.Lvl3(r.address, "lost connection to", p.ServerIdentity.Address)
+	p.Up = false
+	p.backoff = ReconnectBackoffMin
+	p.nextRetry = time.Now().Add(p.backoff)
+}
+
+// peerSeen updates the state of the peer when a packet has been received or
+// sent.
+func (r *Router) peerSeen(id ServerIdentityID, received, active bool) {
+	r.Lock()
+	defer r.Unlock()
+	p, ok := r.peers[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if received {
+		p.LastSeen = now
+	}
+	if active {
+		p.lastActive = now
+	}
+}
+
+// handleKeepAlive answers to pings and measures the round trip time of pongs.
+func (r *Router) handleKeepAlive(remote *ServerIdentity, c Conn, ka KeepAlive) {
+	if !ka.Pong {
+		if err := r.sendConn(remote, c, &KeepAlive{Pong: true, Sent: ka.Sent}); err != nil {
+			log.Lvl3(r.address, "couldn't answer keep-alive of", remote.Address, err)
+		}
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if p, ok := r.peers[remote.ID]; ok {
+		p.RTT = time.Since(time.Unix(0, ka.Sent))
+	}
+}
+
+// maintainConnections runs until the Router is stopped and periodically pings
+// all peers, closes the connections to idle or unresponsive peers and
+// reconnects to peers that went down.
+func (r *Router) maintainConnections() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+			r.checkPeers()
+		}
+	}
+}
+
+// checkPeers does one round of pinging, reaping and reconnecting.
+func (r *Router) checkPeers() {
+	now := time.Now()
+	var ping []*peer
+	var pingConns []Conn
+	var toClose []Conn
+	var reconnect []*peer
+	r.Lock()
+	for id, p := range r.peers {
+		conns := r.connections[id]
+		switch {
+		case now.Sub(p.lastActive) > IdleTimeout:
+			log.Lvl3(r.address, "closing idle connections to", p.ServerIdentity.Address)
+			delete(r.peers, id)
+			toClose = append(toClose, conns...)
+		case len(conns) == 0:
+			if !now.Before(p.nextRetry) {
+				reconnect = append(reconnect, p)
+			}
+		case now.Sub(p.LastSeen) > PeerTimeout:
+			log.Lvl2(r.address, "peer", p.ServerIdentity.Address, "timed out")
+			toClose = append(toClose, conns...)
+		default:
+			ping = append(ping, p)
+			pingConns = append(pingConns, conns[0])
+		}
+	}
+	r.Unlock()
+	r.pruneTraffic()
+
+	for _, c := range toClose {
+		if err := c.Close(); err != nil {
+			log.Lvl5(r.address, "closing connection:", err)
+		}
+	}
+	for i, p := range ping {
+		c := pingConns[i]
+		ka := &KeepAlive{Sent: time.Now().UnixNano()}
+		if err := r.sendConn(p.ServerIdentity, c, ka); err != nil {
+			log.Lvl3(r.address, "couldn't ping", c.Remote(), err)
+		}
+	}
+	for _, p := range reconnect {
+		si := p.ServerIdentity
+		log.Lvl3(r.address, "reconnecting to", si.Address)
+		if _, err := r.connect(si); err != nil {
+			r.Lock()
+			p.backoff *= 2
+			if p.backoff > ReconnectBackoffMax {
+				p.backoff = ReconnectBackoffMax
+			}
+			p.nextRetry = time.Now().Add(p.backoff)
+			r.Unlock()
+		}
+	}
+}
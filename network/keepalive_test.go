@@ -0,0 +1,126 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// waitPeer waits until the status of the peer fulfills cond.
+func waitPeer(t *testing.T, r *Router, id ServerIdentityID, cond func(PeerStatus, bool) bool) {
+	for i := 0; i < 100; i++ {
+		if cond(r.PeerStatus(id)) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Peer didn't reach the expected state")
+}
+
+func TestRouterKeepAlive(t *testing.T) {
+	oldInterval, oldTimeout, oldIdle, oldBackoff := KeepAliveInterval,
+		PeerTimeout, IdleTimeout, ReconnectBackoffMin
+	defer func() {
+		KeepAliveInterval, PeerTimeout, IdleTimeout, ReconnectBackoffMin =
+			oldInterval, oldTimeout, oldIdle, oldBackoff
+	}()
+	KeepAliveInterval = 20 * time.Millisecond
+	PeerTimeout = 100 * time.Millisecond
+	ReconnectBackoffMin = 20 * time.Millisecond
+
+	h1, err := NewTestRouterTCP(2020)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(2021)
+	require.Nil(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	for !h1.Listening() || !h2.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Nil(t, h1.Send(h2.ServerIdentity, &SimpleMessage{12}))
+	id2 := h2.ServerIdentity.ID
+
+	// keep-alives measure the round trip time
+	waitPeer(t, h1, id2, func(ps PeerStatus, ok bool) bool {
+		return ok && ps.Up && ps.RTT > 0
+	})
+	require.Equal(t, 1, len(h1.Peers()))
+
+	// the peer goes down
+	require.Nil(t, h2.Stop())
+	waitPeer(t, h1, id2, func(ps PeerStatus, ok bool) bool {
+		return ok && !ps.Up
+	})
+
+	// and comes back at the same address
+	host, err := NewTestTCPHost(2021)
+	require.Nil(t, err)
+	h3 := NewRouter(h2.ServerIdentity, host)
+	go h3.Start()
+	defer h3.Stop()
+	waitPeer(t, h1, id2, func(ps PeerStatus, ok bool) bool {
+		return ok && ps.Up && ps.Reconnects == 1
+	})
+
+	// idle connections are reaped
+	IdleTimeout = 50 * time.Millisecond
+	waitPeer(t, h1, id2, func(ps PeerStatus, ok bool) bool {
+		return !ok
+	})
+	require.Nil(t, h1.connection(id2))
+}
+
+func TestRouterInboundPeers(t *testing.T) {
+	h1, err := NewTestRouterTCP(2022)
+	require.Nil(t, err)
+	h2, err := NewTestRouterTCP(2023)
+	require.Nil(t, err)
+	h3, err := NewTestRouterTCP(2024)
+	require.Nil(t, err)
+	go h1.Start()
+	go h2.Start()
+	go h3.Start()
+	defer h1.Stop()
+	defer h3.Stop()
+	for !h1.Listening() || !h2.Listening() || !h3.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	id1 := h1.ServerIdentity.ID
+	h1.SetKnownPeers(func(si *ServerIdentity) bool {
+		return si.ID == h3.ServerIdentity.ID
+	})
+	require.Nil(t, h2.Send(h1.ServerIdentity, &SimpleMessage{12}))
+	require.Nil(t, h3.Send(h1.ServerIdentity, &SimpleMessage{12}))
+	waitPeer(t, h1, h2.ServerIdentity.ID, func(ps PeerStatus, ok bool) bool {
+		return ok && ps.Up
+	})
+	waitPeer(t, h1, h3.ServerIdentity.ID, func(ps PeerStatus, ok bool) bool {
+		return ok && ps.Up
+	})
+	// only the dialing Router and the known peer are maintained
+	require.Equal(t, 1, len(h2.Peers()))
+	require.Equal(t, id1, h2.Peers()[0].ServerIdentity.ID)
+	require.Equal(t, 1, len(h1.Peers()))
+	require.Equal(t, h3.ServerIdentity.ID, h1.Peers()[0].ServerIdentity.ID)
+
+	// the unknown peer is forgotten once it goes away
+	require.Nil(t, h2.Stop())
+	waitPeer(t, h1, h2.ServerIdentity.ID, func(ps PeerStatus, ok bool) bool {
+		return !ok
+	})
+	require.Equal(t, 1, len(h1.Peers()))
+
+	// and its traffic is only counted with the others
+	h1.pruneTraffic()
+	h1.traffic.Lock()
+	require.Equal(t, 1, len(h1.traffic.peers))
+	h1.traffic.Unlock()
+	traffic := h1.PeerTraffic()
+	require.Equal(t, 2, len(traffic))
+	_, ok := traffic[h2.ServerIdentity.Address]
+	require.False(t, ok)
+	require.True(t, traffic[OtherPeersAddress].MsgsRx >= 1)
+	require.True(t, traffic[h3.ServerIdentity.Address].MsgsRx >= 1)
+}
@@ -38,6 +38,8 @@ type LocalManager struct {
 
 	// connection-counter for giving unique IDs to each connection.
 	counter uint64
+	// faults, if set, makes the delivery of the packets unreliable.
+	faults *FaultInjector
 }
 
 // NewLocalManager returns a fresh new manager that can be used by LocalConn,
@@ -69,6 +71,15 @@ func LocalReset() {
 
 }
 
+// SetFaultInjector makes all connections of the manager use fi to decide
+// how packets are delayed, dropped, duplicated or reordered. A nil fi
+// restores a reliable delivery.
+func (lm *LocalManager) SetFaultInjector(fi *FaultInjector) {
+	lm.Lock()
+	defer lm.Unlock()
+	lm.faults = fi
+}
+
 // isListening returns true if the remote address is listening for connections.
 func (lm *LocalManager) isListening(remote Address) bool {
 	lm.Lock()
@@ -104,6 +115,9 @@ func (lm *LocalManager) connect(local, remote Address) (*LocalConn, error) {
 	if !ok {
 		return nil, fmt.Errorf("%s can't connect to %s: it's not listening", local, remote)
 	}
+	if lm.faults != nil && !lm.faults.canConnect(local, remote) {
+		return nil, fmt.Errorf("%s can't connect to %s: partitioned", local, remote)
+	}
 
 	outEndpoint := endpoint{local, lm.counter}
 	lm.counter++
@@ -123,20 +137,38 @@ func (lm *LocalManager) connect(local, remote Address) (*LocalConn, error) {
 }
 
 // send gets the connection denoted by this endpoint and calls queueMsg
-// with the packet as argument to it.
+// with the packet as argument to it. If a FaultInjector is set and the
+// packet is not the first one of the connection, the packet is handed over
+// to the FaultInjector instead.
 // It returns ErrClosed if it does not find the connection.
-func (lm *LocalManager) send(e endpoint, msg []byte) error {
+func (lm *LocalManager) send(from Address, e endpoint, msg []byte, first bool) error {
 	lm.Lock()
-	defer lm.Unlock()
 	q, ok := lm.conns[e]
 	if !ok {
+		lm.Unlock()
 		return ErrClosed
 	}
-
-	q.incomingQueue <- msg
+	fi := lm.faults
+	if fi == nil || first {
+		q.incomingQueue <- msg
+		lm.Unlock()
+		return nil
+	}
+	lm.Unlock()
+	fi.send(from, e.addr, len(msg), func() { lm.deliver(e, msg) })
 	return nil
 }
 
+// deliver queues a packet delayed by the FaultInjector. The packet is
+// silently dropped if the connection has been closed in the meantime.
+func (lm *LocalManager) deliver(e endpoint, msg []byte) {
+	lm.Lock()
+	defer lm.Unlock()
+	if q, ok := lm.conns[e]; ok {
+		q.incomingQueue <- msg
+	}
+}
+
 // close gets the connection denoted by this endpoint and closes it if
 // it is present.
 func (lm *LocalManager) close(conn *LocalConn) error {
@@ -251,8 +283,9 @@ func (lc *LocalConn) Send(msg Body) error {
 	if err != nil {
 		return err
 	}
+	first := lc.Tx() == 0
 	lc.updateTx(uint64(len(buff)))
-	return lc.manager.send(lc.remote, buff)
+	return lc.manager.send(lc.local.addr, lc.remote, buff, first)
 }
 
 // Receive takes a context (that is not used) and waits for a packet to
@@ -33,7 +33,27 @@ type Router struct {
 	// can be opened at the same time on both endpoints, there can be more
 	// than one connection per ServerIdentityID.
 	connections map[ServerIdentityID][]Conn
+	// peers holds the state of all remote ServerIdentities we are or have
+	// been connected to.
+	peers map[ServerIdentityID]*peer
+	// closedTx and closedRx keep the traffic of the closed connections, so
+	// that Tx and Rx never decrease.
+	closedTx uint64
+	closedRx uint64
+	// traffic counts the messages and bytes by peer and by message type.
+	traffic *trafficCounter
+	// maxPacketSize is applied to all connections supporting a size limit.
+	// If it is 0, the default of the connection is used.
+	maxPacketSize Size
+	// streams serializes the streams sent to a ServerIdentityID, so that
+	// their Chunks don't interleave.
+	streams map[ServerIdentityID]*streamLock
+	// known tells whether a remote ServerIdentity is known, see
+	// SetKnownPeers.
+	known func(*ServerIdentity) bool
 	sync.Mutex
+	// quit stops the routine maintaining the connections.
+	quit chan struct{}
 
 	// boolean flag indicating that the router is already clos{ing,ed}.
 	isClosed bool
@@ -48,6 +68,10 @@ func NewRouter(own *ServerIdentity, h Host) *Router {
 	r := &Router{
 		ServerIdentity: own,
 		connections:    make(map[ServerIdentityID][]Conn),
+		peers:          make(map[ServerIdentityID]*peer),
+		streams:        make(map[ServerIdentityID]*streamLock),
+		quit:           make(chan struct{}),
+		traffic:        newTrafficCounter(),
 		host:           h,
 		Dispatcher:     NewBlockingDispatcher(),
 	}
@@ -56,8 +80,15 @@ func NewRouter(own *ServerIdentity, h Host) *Router {
 }
 
 // Start the listening routine of the underlying Host. This is a
-// blocking call until r.Stop() is called.
+// blocking call until r.Stop() is called. It also starts the routine that
+// sends keep-alives to the peers and reconnects to them if necessary.
 func (r *Router) Start() {
+	r.Lock()
+	if !r.isClosed {
+		r.wg.Add(1)
+		go r.maintainConnections()
+	}
+	r.Unlock()
 	// Any incoming connection waits for the remote server identity
 	// and will create a new handling routine.
 	err := r.host.Listen(func(c Conn) {
@@ -70,7 +101,7 @@ func (r *Router) Start() {
 			}
 			return
 		}
-		if err := r.registerConnection(dst, c); err != nil {
+		if err := r.registerConnection(dst, c, false); err != nil {
 			log.Lvl3(r.address, "does not accept incoming connection to", c.Remote(), "because it's closed")
 			return
 		}
@@ -94,7 +125,10 @@ func (r *Router) Stop() error {
 	var err error
 	err = r.host.Stop()
 	r.Lock()
-	// set the isClosed to true
+	// set the isClosed to true and stop the maintaining routine
+	if !r.isClosed {
+		close(r.quit)
+	}
 	r.isClosed = true
 
 	// then close all connections
@@ -129,22 +163,31 @@ func (r *Router) Send(e *ServerIdentity, msg Body) error {
 		if err != nil {
 			return err
 		}
+	} else {
+		r.maintainKnown(e)
+	}
+
+	if typ := TypeFromData(msg); !r.supports(e.ID, typ) {
+		log.Lvl2(r.address, "doesn't send", typ, "to", e.Address,
+			"as it is not supported")
+		return ErrUnsupportedPacket
 	}
 
 	log.Lvlf4("%s sends to %s msg: %+v", r.address, e, msg)
 	var err error
-	err = c.Send(msg)
+	err = r.sendConn(e, c, msg)
 	if err != nil {
 		log.Lvl2(r.address, "Couldn't send to", e, ":", err, "trying again")
 		c, err := r.connect(e)
 		if err != nil {
 			return err
 		}
-		err = c.Send(msg)
+		err = r.sendConn(e, c, msg)
 		if err != nil {
 			return err
 		}
 	}
+	r.peerSeen(e.ID, false, true)
 	log.Lvl5("Message sent")
 	return nil
 }
@@ -163,17 +206,32 @@ func (r *Router) connect(si *ServerIdentity) (Conn, error) {
 		return nil, err
 	}
 
-	if err := r.registerConnection(si, c); err != nil {
+	if err := r.registerConnection(si, c, true); err != nil {
 		return nil, err
 	}
 
 	if err := r.launchHandleRoutine(si, c); err != nil {
 		return nil, err
 	}
+	if err := r.sendConn(si, c, localVersions(false)); err != nil {
+		log.Lvl3(r.address, "couldn't send versions to", si.Address, err)
+	}
 	return c, nil
 
 }
 
+// sendConn sends msg over c and records the traffic to si.
+func (r *Router) sendConn(si *ServerIdentity, c Conn, msg Body) error {
+	typ := TypeFromData(msg)
+	before := c.Tx()
+	if err := c.Send(msg); err != nil {
+		r.traffic.failed(si, typ)
+		return err
+	}
+	r.traffic.sent(si, typ, c.Tx()-before)
+	return nil
+}
+
 // handleConn waits for incoming messages and calls the dispatcher for
 // each new message. It only quits if the connection is closed or another
 // unrecoverable error in the connection appears.
@@ -183,11 +241,13 @@ func (r *Router) handleConn(remote *ServerIdentity, c Conn) {
 		if err := c.Close(); err != nil {
 			log.Lvl5(r.address, "having error closing conn to", remote.Address, ":", err)
 		}
+		r.unregisterConnection(remote, c)
 		r.wg.Done()
 	}()
 	address := c.Remote()
 	log.Lvl3(r.address, "Handling new connection to", remote.Address)
 	for {
+		before := c.Rx()
 		packet, err := c.Receive()
 
 		if r.Closed() {
@@ -204,19 +264,56 @@ func (r *Router) handleConn(remote *ServerIdentity, c Conn) {
 			}
 			// Temporary error, continue.
 			log.Lvl3(r.ServerIdentity, "Error with connection", address, "=>", err)
+			r.traffic.failed(remote, packet.MsgType)
+			continue
+		}
+		r.traffic.received(remote, packet.MsgType, c.Rx()-before)
+
+		if packet.MsgType == KeepAliveType {
+			r.peerSeen(remote.ID, true, false)
+			r.handleKeepAlive(remote, c, packet.Msg.(KeepAlive))
 			continue
 		}
+		if packet.MsgType == VersionsType {
+			r.peerSeen(remote.ID, true, false)
+			r.handleVersions(remote, c, packet.Msg.(Versions))
+			continue
+		}
+		r.peerSeen(remote.ID, true, true)
 
 		packet.From = address
 		packet.ServerIdentity = remote
 
 		if err := r.Dispatch(&packet); err != nil {
 			log.Lvl3("Error dispatching:", err)
+			r.traffic.failed(remote, packet.MsgType)
 		}
 
 	}
 }
 
+// sizeLimiter is implemented by the connections that limit the size of the
+// packets they send and receive, like TCPConn.
+type sizeLimiter interface {
+	SetMaxPacketSize(max Size)
+}
+
+// SetMaxPacketSize sets the maximum size of the packets sent and received on
+// all current and future connections of the router that support a limit. A
+// max of 0 restores the default of the connections.
+func (r *Router) SetMaxPacketSize(max Size) {
+	r.Lock()
+	defer r.Unlock()
+	r.maxPacketSize = max
+	for _, arr := range r.connections {
+		for _, c := range arr {
+			if l, ok := c.(sizeLimiter); ok {
+				l.SetMaxPacketSize(max)
+			}
+		}
+	}
+}
+
 // connection returns the first connection associated with this ServerIdentity.
 // If no connection is found, it returns nil.
 func (r *Router) connection(sid ServerIdentityID) Conn {
@@ -231,9 +328,11 @@ func (r *Router) connection(sid ServerIdentityID) Conn {
 
 // registerConnection registers a ServerIdentity for a new connection, mapped with the
 // real physical address of the connection and the connection itself.
-// It uses the networkLock mutex.
-func (r *Router) registerConnection(remote *ServerIdentity, c Conn) error {
+// It uses the networkLock mutex. dialed is true if the Router opened the
+// connection itself.
+func (r *Router) registerConnection(remote *ServerIdentity, c Conn, dialed bool) error {
 	log.Lvl4(r.address, "Registers", remote.Address)
+	maintain := dialed || r.isKnown(remote)
 	r.Lock()
 	defer r.Unlock()
 	if r.isClosed {
@@ -243,10 +342,40 @@ func (r *Router) registerConnection(remote *ServerIdentity, c Conn) error {
 	if okc {
 		log.Lvl5("Connection already registered. Appending new connection to same identity.")
 	}
+	if r.maxPacketSize > 0 {
+		if l, ok := c.(sizeLimiter); ok {
+			l.SetMaxPacketSize(r.maxPacketSize)
+		}
+	}
 	r.connections[remote.ID] = append(r.connections[remote.ID], c)
+	r.peerUp(remote, maintain)
 	return nil
 }
 
+// unregisterConnection removes a closed connection. If it was the last
+// connection to this ServerIdentity, the peer is marked as down.
+func (r *Router) unregisterConnection(remote *ServerIdentity, c Conn) {
+	r.Lock()
+	defer r.Unlock()
+	arr := r.connections[remote.ID]
+	for i, conn := range arr {
+		if conn == c {
+			arr = append(arr[:i], arr[i+1:]...)
+			r.closedTx += c.Tx()
+			r.closedRx += c.Rx()
+			break
+		}
+	}
+	if len(arr) == 0 {
+		delete(r.connections, remote.ID)
+		if !r.isClosed {
+			r.peerDown(remote.ID)
+		}
+		return
+	}
+	r.connections[remote.ID] = arr
+}
+
 func (r *Router) launchHandleRoutine(dst *ServerIdentity, c Conn) error {
 	r.Lock()
 	defer r.Unlock()
@@ -271,7 +400,7 @@ func (r *Router) Closed() bool {
 func (r *Router) Tx() uint64 {
 	r.Lock()
 	defer r.Unlock()
-	var tx uint64
+	tx := r.closedTx
 	for _, arr := range r.connections {
 		for _, c := range arr {
 			tx += c.Tx()
@@ -285,7 +414,7 @@ func (r *Router) Tx() uint64 {
 func (r *Router) Rx() uint64 {
 	r.Lock()
 	defer r.Unlock()
-	var rx uint64
+	rx := r.closedRx
 	for _, arr := range r.connections {
 		for _, c := range arr {
 			rx += c.Rx()
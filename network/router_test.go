@@ -1,6 +1,8 @@
 package network
 
 import (
+	"bytes"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -174,6 +176,100 @@ func TestRouterMessaging(t *testing.T) {
 	}
 }
 
+func TestRouterStream(t *testing.T) {
+	h1, err1 := NewTestRouterTCP(2044)
+	h2, err2 := NewTestRouterTCP(2045)
+	require.Nil(t, err1)
+	require.Nil(t, err2)
+	go h1.Start()
+	go h2.Start()
+	defer func() {
+		h1.Stop()
+		h2.Stop()
+	}()
+	oldChunk := ChunkSize
+	defer func() { ChunkSize = oldChunk }()
+	ChunkSize = 1000
+	h1.SetMaxPacketSize(2000)
+	h2.SetMaxPacketSize(2000)
+
+	received := make(chan []byte)
+	h2.RegisterProcessor(NewStreamReceiver(func(from *ServerIdentity) (io.WriteCloser, error) {
+		require.Equal(t, h1.ServerIdentity.ID, from.ID)
+		return &streamBuffer{done: received}, nil
+	}), ChunkType)
+
+	payload := make([]byte, 10500)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	require.Nil(t, h1.SendStream(h2.ServerIdentity, bytes.NewReader(payload)))
+	require.Equal(t, payload, <-received)
+	c := h1.connection(h2.ServerIdentity.ID)
+	require.Equal(t, Size(2000), c.(*TCPConn).MaxPacketSize())
+}
+
+func TestRouterStreamSlowWriter(t *testing.T) {
+	h1, err1 := NewTestRouterTCP(2046)
+	h2, err2 := NewTestRouterTCP(2047)
+	require.Nil(t, err1)
+	require.Nil(t, err2)
+	go h1.Start()
+	go h2.Start()
+	defer func() {
+		h1.Stop()
+		h2.Stop()
+	}()
+
+	// the writer blocks until it is released
+	release := make(chan struct{})
+	received := make(chan []byte, 1)
+	sr := NewStreamReceiver(func(from *ServerIdentity) (io.WriteCloser, error) {
+		<-release
+		return &streamBuffer{done: received}, nil
+	})
+	h2.RegisterProcessor(sr, ChunkType)
+	proc := newSimpleMessageProc(t)
+	h2.RegisterProcessor(proc, SimpleMessageType)
+
+	require.Nil(t, h1.SendStream(h2.ServerIdentity, bytes.NewReader([]byte("stream"))))
+	h1.Lock()
+	require.Equal(t, 0, len(h1.streams))
+	h1.Unlock()
+	require.Nil(t, h1.Send(h2.ServerIdentity, &SimpleMessage{12}))
+	select {
+	case msg := <-proc.relay:
+		require.Equal(t, 12, msg.I)
+	case <-time.After(time.Second):
+		t.Fatal("The stream blocked the dispatcher")
+	}
+
+	close(release)
+	require.Equal(t, []byte("stream"), <-received)
+	// the routine writing the streams of h1 is done
+	for i := 0; i < 10; i++ {
+		sr.Lock()
+		n := len(sr.queues)
+		sr.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("The queue of the stream hasn't been removed")
+}
+
+// streamBuffer sends its content on done when it is closed.
+type streamBuffer struct {
+	bytes.Buffer
+	done chan []byte
+}
+
+func (s *streamBuffer) Close() error {
+	s.done <- s.Bytes()
+	return nil
+}
+
 func TestRouterLotsOfConnTCP(t *testing.T) {
 	testRouterLotsOfConn(t, NewTestRouterTCP, 5)
 }
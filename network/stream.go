@@ -0,0 +1,222 @@
+package network
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/dedis/cothority/log"
+)
+
+// ChunkSize is the maximum number of bytes of a payload sent in one Chunk by
+// SendStream. It has to be smaller than the maximum packet size of the
+// connection.
+var ChunkSize = 1024 * 1024
+
+// Chunk is one part of a payload sent by SendStream.
+type Chunk struct {
+	Data []byte
+	// Last is true for the last Chunk of a payload
+	Last bool
+}
+
+// ChunkType is the PacketTypeID of Chunk
+var ChunkType = RegisterPacketTypeVersion("network.Chunk", 0, Chunk{})
+
+// SendStream reads r until io.EOF and sends the payload over c as a series of
+// Chunks of at most ChunkSize bytes. This allows to send payloads bigger than
+// the maximum packet size of the connection without holding the whole payload
+// in memory.
+func SendStream(c Conn, r io.Reader) error {
+	return sendStream(c.Send, r)
+}
+
+// SendStream sends the payload read from rd to the ServerIdentity as a series
+// of Chunks, connecting to it if needed. The remote Router needs a
+// StreamReceiver to reassemble the payload. Streams to the same
+// ServerIdentity are sent one after the other.
+func (r *Router) SendStream(si *ServerIdentity, rd io.Reader) error {
+	r.Lock()
+	l, ok := r.streams[si.ID]
+	if !ok {
+		l = &streamLock{}
+		r.streams[si.ID] = l
+	}
+	l.users++
+	r.Unlock()
+	l.Lock()
+	defer func() {
+		l.Unlock()
+		r.Lock()
+		if l.users--; l.users == 0 {
+			delete(r.streams, si.ID)
+		}
+		r.Unlock()
+	}()
+
+	c := r.connection(si.ID)
+	if c == nil {
+		var err error
+		if c, err = r.connect(si); err != nil {
+			return err
+		}
+	}
+	return sendStream(func(msg Body) error {
+		return r.sendConn(si, c, msg)
+	}, rd)
+}
+
+// streamLock serializes the streams sent to a ServerIdentity. It is removed
+// from Router.streams once no stream uses it anymore.
+type streamLock struct {
+	sync.Mutex
+	// users is the number of streams sending or waiting to send
+	users int
+}
+
+// sendStream reads r until io.EOF and sends the Chunks using send.
+func sendStream(send func(Body) error, r io.Reader) error {
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if err := send(&Chunk{Data: buf[:n], Last: last}); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// ReceiveStream receives the Chunks sent by SendStream on c and writes them
+// to w. It returns the number of bytes written once the last Chunk has been
+// received.
+func ReceiveStream(c Conn, w io.Writer) (int64, error) {
+	var written int64
+	for {
+		p, err := c.Receive()
+		if err != nil {
+			return written, err
+		}
+		if p.MsgType != ChunkType {
+			return written, errors.New("Received a non-Chunk packet in a stream")
+		}
+		chunk := p.Msg.(Chunk)
+		n, err := w.Write(chunk.Data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if chunk.Last {
+			return written, nil
+		}
+	}
+}
+
+// StreamReceiver is a Processor reassembling the streams sent by
+// Router.SendStream. As the Chunks of a stream have to be processed in order,
+// it must be registered for ChunkType directly on the Router, whose
+// dispatcher handles the packets of a connection one after the other. The
+// Chunks are queued and written by one routine per sender, so that a slow
+// writer doesn't hold up the dispatcher.
+type StreamReceiver struct {
+	// open returns the writer for a new stream from a ServerIdentity
+	open   func(from *ServerIdentity) (io.WriteCloser, error)
+	queues map[ServerIdentityID]*chunkQueue
+	sync.Mutex
+}
+
+// chunkQueue holds the Chunks from a ServerIdentity that are not written yet.
+type chunkQueue struct {
+	chunks []Chunk
+	// cond is signaled when a Chunk is added, its Locker is the
+	// StreamReceiver.
+	cond *sync.Cond
+}
+
+// NewStreamReceiver returns a StreamReceiver calling open for every new
+// stream. The payload of the stream is written to the returned writer, which
+// is closed after the last Chunk. The streams from one ServerIdentity are
+// written one after the other.
+func NewStreamReceiver(open func(from *ServerIdentity) (io.WriteCloser, error)) *StreamReceiver {
+	return &StreamReceiver{
+		open:   open,
+		queues: make(map[ServerIdentityID]*chunkQueue),
+	}
+}
+
+// Process implements the Processor interface. It only queues the Chunk. If
+// the stream can't be opened or written, the rest of it is dropped.
+func (s *StreamReceiver) Process(p *Packet) {
+	chunk, ok := p.Msg.(Chunk)
+	if !ok {
+		return
+	}
+	from := p.ServerIdentity
+	s.Lock()
+	defer s.Unlock()
+	q, ok := s.queues[from.ID]
+	if !ok {
+		q = &chunkQueue{cond: sync.NewCond(s)}
+		s.queues[from.ID] = q
+		go s.write(from, q)
+	}
+	q.chunks = append(q.chunks, chunk)
+	q.cond.Signal()
+}
+
+// write writes the Chunks of q to the writers returned by open. It returns
+// once q is empty between two streams.
+func (s *StreamReceiver) write(from *ServerIdentity, q *chunkQueue) {
+	var w io.WriteCloser
+	for {
+		s.Lock()
+		for len(q.chunks) == 0 && w != nil {
+			q.cond.Wait()
+		}
+		if len(q.chunks) == 0 {
+			delete(s.queues, from.ID)
+			s.Unlock()
+			return
+		}
+		chunk := q.chunks[0]
+		q.chunks[0] = Chunk{}
+		q.chunks = q.chunks[1:]
+		s.Unlock()
+
+		if w == nil {
+			var err error
+			if w, err = s.open(from); err != nil {
+				log.Error("Couldn't open stream from", from, ":", err)
+				w = discardCloser{}
+			}
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			log.Error("Couldn't write stream from", from, ":", err)
+			w.Close()
+			w = discardCloser{}
+		}
+		if chunk.Last {
+			if err := w.Close(); err != nil {
+				log.Error("Couldn't close stream from", from, ":", err)
+			}
+			w = nil
+		}
+	}
+}
+
+// discardCloser drops the rest of a stream that failed.
+type discardCloser struct{}
+
+func (discardCloser) Write(b []byte) (int, error) {
+	return ioutil.Discard.Write(b)
+}
+
+func (discardCloser) Close() error {
+	return nil
+}
@@ -3,6 +3,7 @@ package network
 import (
 	"bytes"
 	"errors"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -42,10 +43,18 @@ var ErrTimeout = errors.New("Timeout Error")
 // ErrUnknown is an unknown error.
 var ErrUnknown = errors.New("Unknown Error")
 
+// ErrPacketTooLarge is returned if a packet is bigger than the maximum size
+// allowed for the connection.
+var ErrPacketTooLarge = errors.New("Packet too large")
+
 // Size is a type to reprensent the size that is sent before every packet to
 // correctly decode it.
 type Size uint32
 
+// MaxPacketSize is the default maximum size of a packet a TCPConn accepts.
+// Bigger payloads have to be sent with SendStream.
+var MaxPacketSize = Size(10 * 1024 * 1024)
+
 // Packet is the container for any Msg
 type Packet struct {
 	// The ServerIdentity of the remote peer we are talking to.
@@ -90,7 +99,7 @@ func (si *ServerIdentity) String() string {
 }
 
 // ServerIdentityType can be used to recognise an ServerIdentity-message
-var ServerIdentityType = RegisterPacketType(ServerIdentity{})
+var ServerIdentityType = RegisterPacketTypeVersion("network.ServerIdentity", 0, ServerIdentity{})
 
 // ServerIdentityToml is the struct that can be marshalled into a toml file
 type ServerIdentityToml struct {
@@ -132,21 +141,26 @@ func (si *ServerIdentityToml) ServerIdentity(suite abstract.Suite) *ServerIdenti
 	pub, err := crypto.ReadPub64(suite, strings.NewReader(si.Public))
 	if err != nil {
 		log.Error("Error while reading public key:", err)
+		return &ServerIdentity{
+			Public:  pub,
+			Address: si.Address,
+		}
 	}
-	return &ServerIdentity{
-		Public:  pub,
-		Address: si.Address,
-	}
+	return NewServerIdentity(pub, si.Address)
 }
 
-// GlobalBind returns the global-binding address. Given any IP:PORT combination,
-// it will return 0.0.0.0:PORT.
+// GlobalBind returns the global-binding address. Given any IP:PORT or
+// HOSTNAME:PORT combination, it will return 0.0.0.0:PORT. For an IPv6
+// address it will return [::]:PORT.
 func GlobalBind(address string) (string, error) {
-	addr := strings.Split(address, ":")
-	if len(addr) != 2 {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
 		return "", errors.New("Not a host:port address")
 	}
-	return "0.0.0.0:" + addr[1], nil
+	if strings.Contains(host, ":") {
+		return net.JoinHostPort("::", port), nil
+	}
+	return net.JoinHostPort("0.0.0.0", port), nil
 }
 
 // counterSafe is a struct that enables to update two counters Rx & Tx
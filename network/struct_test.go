@@ -47,4 +47,14 @@ func TestGlobalBind(t *testing.T) {
 	if err == nil {
 		t.Error("Wrong with global bind")
 	}
+	for addr, global := range map[string]string{
+		"127.0.0.1:2000":          "0.0.0.0:2000",
+		"[::1]:2000":              "[::]:2000",
+		"conode.example.org:2000": "0.0.0.0:2000",
+	} {
+		g, err := GlobalBind(addr)
+		if err != nil || g != global {
+			t.Error("Wrong global bind for", addr, g)
+		}
+	}
 }
@@ -1,7 +1,6 @@
 package network
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -9,6 +8,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dedis/cothority/log"
@@ -39,10 +39,40 @@ type TCPConn struct {
 	receiveMutex sync.Mutex
 	// So we only handle one sending packet at a time
 	sendMutex sync.Mutex
+	// So that packets delayed by the FaultInjector are not interleaved
+	writeMutex sync.Mutex
+	// delayedErr is the error of the last packet delayed by the
+	// FaultInjector that couldn't be sent. It is returned by the following
+	// calls to Send.
+	delayedErr error
+	// sentFirst is true once the first packet, which is never faulted, has
+	// been sent
+	sentFirst bool
+	// maxSize is the biggest packet accepted on this connection. If it is
+	// 0, MaxPacketSize is used.
+	maxSize Size
 
 	counterSafe
 }
 
+// tcpFaults makes the delivery of the packets of all TCPConns unreliable,
+// if it is not nil.
+var tcpFaults struct {
+	sync.Mutex
+	fi *FaultInjector
+}
+
+// SetTCPFaultInjector makes all TCP connections of this process use the
+// default faults of fi to delay, drop, duplicate or reorder the packets they
+// send, so that the network conditions of a simulation can be emulated on
+// localhost. As for the LocalManager, the first packet of every connection
+// is never faulted. A nil fi restores a reliable delivery.
+func SetTCPFaultInjector(fi *FaultInjector) {
+	tcpFaults.Lock()
+	defer tcpFaults.Unlock()
+	tcpFaults.fi = fi
+}
+
 // NewTCPConn will open a TCPConn to the given address.
 // In case of an error it returns a nil TCPConn and the error.
 func NewTCPConn(addr Address) (conn *TCPConn, err error) {
@@ -96,6 +126,9 @@ func (c *TCPConn) Receive() (nm Packet, e error) {
 // whole message. It returns the raw message as slice of bytes.
 // If there is no message available, it blocks until one becomes
 // available.
+// If the size is bigger than the maximum packet size, the connection is
+// closed and ErrPacketTooLarge is returned, before any memory is allocated
+// for the message.
 // In case of an error it returns a nil slice and the error.
 func (c *TCPConn) receiveRaw() ([]byte, error) {
 	c.receiveMutex.Lock()
@@ -105,32 +138,50 @@ func (c *TCPConn) receiveRaw() ([]byte, error) {
 	if err := binary.Read(c.conn, globalOrder, &total); err != nil {
 		return nil, handleError(err)
 	}
+	if total > c.MaxPacketSize() {
+		log.Error("Packet of", total, "bytes from", c.endpoint,
+			"is too large - closing connection")
+		c.Close()
+		return nil, ErrPacketTooLarge
+	}
 	b := make([]byte, total)
 	var read Size
-	var buffer bytes.Buffer
 	for read < total {
 		// Read the size of the next packet.
-		n, err := c.conn.Read(b)
+		n, err := c.conn.Read(b[read:])
 		// Quit if there is an error.
 		if err != nil {
 			return nil, handleError(err)
 		}
-		// Append the read bytes into the buffer.
-		if _, err := buffer.Write(b[:n]); err != nil {
-			log.Error("Couldn't write to buffer:", err)
-		}
 		read += Size(n)
-		b = b[n:]
 	}
 
 	// register how many bytes we read.
 	c.updateRx(uint64(read))
-	return buffer.Bytes(), nil
+	return b, nil
+}
+
+// SetMaxPacketSize sets the maximum size of the packets sent and received on
+// this connection.
+func (c *TCPConn) SetMaxPacketSize(max Size) {
+	atomic.StoreUint32((*uint32)(&c.maxSize), uint32(max))
+}
+
+// MaxPacketSize returns the maximum size of the packets sent and received on
+// this connection.
+func (c *TCPConn) MaxPacketSize() Size {
+	max := Size(atomic.LoadUint32((*uint32)(&c.maxSize)))
+	if max == 0 {
+		return MaxPacketSize
+	}
+	return max
 }
 
 // Send converts the NetworkMessage into an ApplicationMessage
 // and sends it using send().
-// It returns an error if anything was wrong.
+// It returns an error if anything was wrong. A packet delayed by the
+// FaultInjector of SetTCPFaultInjector is sent later, so if it can't be
+// sent, the error is returned by the following calls to Send.
 func (c *TCPConn) Send(obj Body) error {
 	c.sendMutex.Lock()
 	defer c.sendMutex.Unlock()
@@ -144,6 +195,34 @@ func (c *TCPConn) Send(obj Body) error {
 	if err != nil {
 		return fmt.Errorf("Error marshaling  message: %s", err.Error())
 	}
+	if Size(len(b)) > c.MaxPacketSize() {
+		return ErrPacketTooLarge
+	}
+	tcpFaults.Lock()
+	fi := tcpFaults.fi
+	tcpFaults.Unlock()
+	if fi != nil && c.sentFirst {
+		c.writeMutex.Lock()
+		err := c.delayedErr
+		c.writeMutex.Unlock()
+		if err != nil {
+			return err
+		}
+		fi.send(c.Local(), c.Remote(), len(b), func() {
+			if err := c.sendRaw(b); err != nil {
+				if err == ErrClosed {
+					log.Lvl3("Couldn't send delayed packet:", err)
+				} else {
+					log.Error("Couldn't send delayed packet:", err)
+				}
+				c.writeMutex.Lock()
+				c.delayedErr = err
+				c.writeMutex.Unlock()
+			}
+		})
+		return nil
+	}
+	c.sentFirst = true
 	return c.sendRaw(b)
 }
 
@@ -151,6 +230,8 @@ func (c *TCPConn) Send(obj Body) error {
 // whole message b in slices of size maxChunkSize.
 // In case of an error it aborts and returns error.
 func (c *TCPConn) sendRaw(b []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
 	// First write the size
 	packetSize := Size(len(b))
 	if err := binary.Write(c.conn, globalOrder, packetSize); err != nil {
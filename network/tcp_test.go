@@ -288,6 +288,115 @@ func TestTCPConnWithListener(t *testing.T) {
 	}
 }
 
+func TestTCPConnFaults(t *testing.T) {
+	fi := NewFaultInjector(1)
+	fi.SetDefault(LinkFaults{Latency: 50 * time.Millisecond})
+	SetTCPFaultInjector(fi)
+	defer SetTCPFaultInjector(nil)
+
+	addr := NewTCPAddress("127.0.0.1:5680")
+	ln, err := NewTCPListener(addr)
+	require.Nil(t, err)
+	received := make(chan int)
+	go func() {
+		err := ln.Listen(func(c Conn) {
+			for {
+				p, err := c.Receive()
+				if err != nil {
+					return
+				}
+				received <- p.Msg.(SimpleMessage).I
+			}
+		})
+		require.Nil(t, err)
+	}()
+	defer ln.Stop()
+	for !ln.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c, err := NewTCPConn(addr)
+	require.Nil(t, err)
+	defer c.Close()
+
+	// the first packet is never delayed
+	start := time.Now()
+	require.Nil(t, c.Send(&SimpleMessage{1}))
+	require.Equal(t, 1, <-received)
+	require.True(t, time.Since(start) < 50*time.Millisecond)
+	start = time.Now()
+	require.Nil(t, c.Send(&SimpleMessage{2}))
+	require.Nil(t, c.Send(&SimpleMessage{3}))
+	require.Equal(t, 2, <-received)
+	require.Equal(t, 3, <-received)
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+	require.Equal(t, FaultStats{Delivered: 2}, fi.Stats())
+
+	// a delayed packet that couldn't be sent fails the next Send
+	require.Nil(t, c.conn.Close())
+	require.Nil(t, c.Send(&SimpleMessage{4}))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, ErrClosed, c.Send(&SimpleMessage{5}))
+}
+
+func TestTCPConnMaxPacketSize(t *testing.T) {
+	addr := NewTCPAddress("127.0.0.1:5679")
+	ln, err := NewTCPListener(addr)
+	require.Nil(t, err)
+	received := make(chan error)
+	go func() {
+		ln.Listen(func(c Conn) {
+			c.(*TCPConn).SetMaxPacketSize(1000)
+			_, err := c.Receive()
+			received <- err
+		})
+	}()
+	defer ln.Stop()
+
+	c, err := NewTCPConn(addr)
+	require.Nil(t, err)
+	defer c.Close()
+	// Sending side refuses too big packets
+	c.SetMaxPacketSize(1000)
+	require.Equal(t, ErrPacketTooLarge, c.Send(&BigMsg{make([]byte, 2000)}))
+	// Receiving side refuses them before allocation
+	c.SetMaxPacketSize(0)
+	require.Nil(t, c.Send(&BigMsg{make([]byte, 2000)}))
+	require.Equal(t, ErrPacketTooLarge, <-received)
+	// and closes the connection
+	_, err = c.Receive()
+	require.NotNil(t, err)
+}
+
+func TestTCPConnStream(t *testing.T) {
+	addr := NewTCPAddress("127.0.0.1:5680")
+	ln, err := NewTCPListener(addr)
+	require.Nil(t, err)
+	oldChunk := ChunkSize
+	defer func() { ChunkSize = oldChunk }()
+	ChunkSize = 1000
+	var buf bytes.Buffer
+	received := make(chan error)
+	go func() {
+		ln.Listen(func(c Conn) {
+			c.(*TCPConn).SetMaxPacketSize(2000)
+			_, err := ReceiveStream(c, &buf)
+			received <- err
+		})
+	}()
+	defer ln.Stop()
+
+	c, err := NewTCPConn(addr)
+	require.Nil(t, err)
+	defer c.Close()
+	payload := make([]byte, 10500)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	require.Nil(t, SendStream(c, bytes.NewReader(payload)))
+	require.Nil(t, <-received)
+	require.Equal(t, payload, buf.Bytes())
+}
+
 // will create a TCPListener & open a golang net.TCPConn to it
 func TestTCPListener(t *testing.T) {
 	addr := NewTCPAddress("127.0.0.1:5678")
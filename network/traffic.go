@@ -0,0 +1,202 @@
+package network
+
+import (
+	"strings"
+	"sync"
+)
+
+// Traffic counts the messages and bytes exchanged with a peer or of a
+// message type. It implements monitor.CounterIO.
+type Traffic struct {
+	MsgsTx  uint64
+	BytesTx uint64
+	MsgsRx  uint64
+	BytesRx uint64
+	// Errors counts the messages that couldn't be sent, received or
+	// dispatched.
+	Errors uint64
+}
+
+// Tx returns the number of bytes sent.
+func (t Traffic) Tx() uint64 {
+	return t.BytesTx
+}
+
+// Rx returns the number of bytes received.
+func (t Traffic) Rx() uint64 {
+	return t.BytesRx
+}
+
+// OtherPeersAddress is the address under which PeerTraffic reports the
+// traffic of all peers the Router doesn't maintain the connections to, like
+// clients, and of the peers it forgot.
+const OtherPeersAddress = Address("others")
+
+// trafficCounter holds the traffic of a Router broken down by peer and by
+// PacketTypeID.
+type trafficCounter struct {
+	sync.Mutex
+	peers map[ServerIdentityID]*peerTraffic
+	types map[PacketTypeID]*Traffic
+	// others holds the traffic of the peers that have been pruned
+	others Traffic
+}
+
+type peerTraffic struct {
+	address Address
+	Traffic
+}
+
+func newTrafficCounter() *trafficCounter {
+	return &trafficCounter{
+		peers: make(map[ServerIdentityID]*peerTraffic),
+		types: make(map[PacketTypeID]*Traffic),
+	}
+}
+
+// get returns the counters of the peer and of the type. The lock must be
+// held by the caller.
+func (tc *trafficCounter) get(si *ServerIdentity, t PacketTypeID) (*Traffic, *Traffic) {
+	p, ok := tc.peers[si.ID]
+	if !ok {
+		p = &peerTraffic{address: si.Address}
+		tc.peers[si.ID] = p
+	}
+	ty, ok := tc.types[t]
+	if !ok {
+		ty = &Traffic{}
+		tc.types[t] = ty
+	}
+	return &p.Traffic, ty
+}
+
+// sent records a message of the given size sent to si.
+func (tc *trafficCounter) sent(si *ServerIdentity, t PacketTypeID, size uint64) {
+	tc.Lock()
+	defer tc.Unlock()
+	p, ty := tc.get(si, t)
+	p.MsgsTx++
+	ty.MsgsTx++
+	p.BytesTx += size
+	ty.BytesTx += size
+}
+
+// received records a message of the given size received from si.
+func (tc *trafficCounter) received(si *ServerIdentity, t PacketTypeID, size uint64) {
+	tc.Lock()
+	defer tc.Unlock()
+	p, ty := tc.get(si, t)
+	p.MsgsRx++
+	ty.MsgsRx++
+	p.BytesRx += size
+	ty.BytesRx += size
+}
+
+// failed records a message to or from si that couldn't be sent, received or
+// dispatched.
+func (tc *trafficCounter) failed(si *ServerIdentity, t PacketTypeID) {
+	tc.Lock()
+	defer tc.Unlock()
+	p, ty := tc.get(si, t)
+	p.Errors++
+	ty.Errors++
+}
+
+// prune adds the traffic of the peers that are not in keep to the others
+// and removes their counters, so that the counters don't grow with every
+// client connecting.
+func (tc *trafficCounter) prune(keep map[ServerIdentityID]bool) {
+	tc.Lock()
+	defer tc.Unlock()
+	for id, p := range tc.peers {
+		if !keep[id] {
+			tc.others.add(p.Traffic)
+			delete(tc.peers, id)
+		}
+	}
+}
+
+// maintainedPeers returns the IDs of the peers the Router maintains the
+// connections to.
+func (r *Router) maintainedPeers() map[ServerIdentityID]bool {
+	r.Lock()
+	defer r.Unlock()
+	ids := make(map[ServerIdentityID]bool)
+	for id, p := range r.peers {
+		if p.maintained {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// pruneTraffic drops the counters of the peers the Router doesn't maintain
+// the connections to and adds their traffic to OtherPeersAddress.
+func (r *Router) pruneTraffic() {
+	r.traffic.prune(r.maintainedPeers())
+}
+
+// PeerTraffic returns the traffic exchanged with each peer since the Router
+// has been created, indexed by the address of the peer. Only the peers the
+// Router maintains the connections to are reported on their own, the traffic
+// of all others is summed up under OtherPeersAddress. The bytes of messages
+// sent concurrently to the same peer are approximated, as they are measured
+// on the connection.
+func (r *Router) PeerTraffic() map[Address]Traffic {
+	maintained := r.maintainedPeers()
+	r.traffic.Lock()
+	defer r.traffic.Unlock()
+	m := make(map[Address]Traffic)
+	others := r.traffic.others
+	for id, p := range r.traffic.peers {
+		if !maintained[id] {
+			others.add(p.Traffic)
+			continue
+		}
+		t := m[p.address]
+		t.add(p.Traffic)
+		m[p.address] = t
+	}
+	if others != (Traffic{}) {
+		m[OtherPeersAddress] = others
+	}
+	return m
+}
+
+// TypeTraffic returns the traffic of each message type since the Router
+// has been created. Messages that couldn't be decoded are counted with
+// ErrorType.
+func (r *Router) TypeTraffic() map[PacketTypeID]Traffic {
+	r.traffic.Lock()
+	defer r.traffic.Unlock()
+	m := make(map[PacketTypeID]Traffic)
+	for id, t := range r.traffic.types {
+		m[id] = *t
+	}
+	return m
+}
+
+// TrafficCounters returns the counters of TypeTraffic in a flat map, so
+// that they can be recorded with monitor.CounterMapMeasure. The keys are
+// made of the name of the message type and of the counter, for example
+// "network.KeepAlive_bytes_tx".
+func (r *Router) TrafficCounters() map[string]uint64 {
+	m := make(map[string]uint64)
+	for id, t := range r.TypeTraffic() {
+		name := strings.Replace(id.String(), " ", "", -1)
+		m[name+"_msgs_tx"] += t.MsgsTx
+		m[name+"_bytes_tx"] += t.BytesTx
+		m[name+"_msgs_rx"] += t.MsgsRx
+		m[name+"_bytes_rx"] += t.BytesRx
+		m[name+"_errors"] += t.Errors
+	}
+	return m
+}
+
+func (t *Traffic) add(o Traffic) {
+	t.MsgsTx += o.MsgsTx
+	t.BytesTx += o.BytesTx
+	t.MsgsRx += o.MsgsRx
+	t.BytesRx += o.BytesRx
+	t.Errors += o.Errors
+}
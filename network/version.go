@@ -0,0 +1,100 @@
+package network
+
+import (
+	"errors"
+
+	"github.com/dedis/cothority/log"
+)
+
+// ErrUnsupportedPacket is returned by Router.Send if the peer announced
+// other versions of the packet type, but not the version of the packet.
+var ErrUnsupportedPacket = errors.New("packet type not supported by the peer")
+
+// Versions is sent by a Router right after its ServerIdentity when it opens
+// a connection, and lists all packet types it can decode. The remote Router
+// answers with its own Versions and Reply set to true. Clients don't send
+// Versions, so they never receive one.
+type Versions struct {
+	Reply   bool
+	Packets []PacketVersion
+}
+
+// VersionsType is the PacketTypeID of Versions
+var VersionsType = RegisterPacketTypeVersion("network.Versions", 0, Versions{})
+
+// localVersions returns the Versions of all registered packet types.
+func localVersions(reply bool) *Versions {
+	v := &Versions{Reply: reply}
+	for _, rp := range RegisteredPackets() {
+		v.Packets = append(v.Packets, rp.PacketVersion)
+	}
+	return v
+}
+
+// peerVersions holds the packet types announced by a peer.
+type peerVersions struct {
+	ids map[PacketTypeID]bool
+	// names holds the names of the packet types, whatever the version
+	names map[string]bool
+}
+
+// handleVersions stores the packet types supported by the peer, logs the
+// packet types for which the peer only knows other versions and answers if
+// the Versions is not a reply.
+func (r *Router) handleVersions(remote *ServerIdentity, c Conn, v Versions) {
+	pv := &peerVersions{
+		ids:   make(map[PacketTypeID]bool),
+		names: make(map[string]bool),
+	}
+	remoteVersions := make(map[string][]int)
+	for _, rv := range v.Packets {
+		pv.ids[rv.ID()] = true
+		pv.names[rv.Name] = true
+		remoteVersions[rv.Name] = append(remoteVersions[rv.Name], rv.Version)
+	}
+	for _, rp := range RegisteredPackets() {
+		if pv.names[rp.Name] && !pv.ids[rp.ID] {
+			log.Lvl2(r.address, "peer", remote.Address, "supports versions",
+				remoteVersions[rp.Name], "of", rp.Name, "but not", rp.Version)
+		}
+	}
+	r.Lock()
+	if p, ok := r.peers[remote.ID]; ok {
+		p.versions = pv
+	}
+	r.Unlock()
+	if !v.Reply {
+		if err := r.sendConn(remote, c, localVersions(true)); err != nil {
+			log.Lvl3(r.address, "couldn't answer versions of", remote.Address, err)
+		}
+	}
+}
+
+// supports returns false if the peer announced other versions of typ, but
+// not typ itself. Packet types the peer doesn't know at all are allowed,
+// as they might have been registered after the announcement.
+func (r *Router) supports(id ServerIdentityID, typ PacketTypeID) bool {
+	r.Lock()
+	p, ok := r.peers[id]
+	if !ok || p.versions == nil || p.versions.ids[typ] {
+		r.Unlock()
+		return true
+	}
+	names := p.versions.names
+	r.Unlock()
+	pv, ok := registry.version(typ)
+	return !ok || !names[pv.Name]
+}
+
+// PeerSupports returns true if the peer with the given ID announced that it
+// supports the packet type. It returns false if the peer is not known or
+// didn't announce its packet types, like a Router of an older version.
+func (r *Router) PeerSupports(id ServerIdentityID, typ PacketTypeID) bool {
+	r.Lock()
+	defer r.Unlock()
+	p, ok := r.peers[id]
+	if !ok || p.versions == nil {
+		return false
+	}
+	return p.versions.ids[typ]
+}
@@ -0,0 +1,47 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterVersions(t *testing.T) {
+	h1, err := NewTestRouterLocal(2030)
+	require.Nil(t, err)
+	h2, err := NewTestRouterLocal(2031)
+	require.Nil(t, err)
+	go h1.Start()
+	go h2.Start()
+	defer h1.Stop()
+	defer h2.Stop()
+	for !h1.Listening() || !h2.Listening() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Nil(t, h1.Send(h2.ServerIdentity, &SimpleMessage{12}))
+
+	// both routers learn the packet types of the other
+	for i := 0; ; i++ {
+		if h1.PeerSupports(h2.ServerIdentity.ID, SimpleMessageType) &&
+			h2.PeerSupports(h1.ServerIdentity.ID, SimpleMessageType) {
+			break
+		}
+		if i == 100 {
+			t.Fatal("Versions have not been exchanged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the peer only knows another version of SimpleMessage
+	h1.Lock()
+	h1.peers[h2.ServerIdentity.ID].versions = &peerVersions{
+		ids:   map[PacketTypeID]bool{},
+		names: map[string]bool{"network.SimpleMessage": true},
+	}
+	h1.Unlock()
+	require.Equal(t, ErrUnsupportedPacket,
+		h1.Send(h2.ServerIdentity, &SimpleMessage{12}))
+	// packet types unknown to the peer are still sent
+	require.Nil(t, h1.Send(h2.ServerIdentity, &KeepAlive{Pong: true}))
+}
@@ -12,8 +12,10 @@ import (
 	"crypto/sha512"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
 	"github.com/dedis/cothority/sda"
 	"github.com/dedis/crypto/abstract"
 	"github.com/dedis/crypto/cosi"
@@ -48,6 +50,12 @@ type ProtocolBFTCoSi struct {
 	threshold int
 	// our index in the Roster list
 	index int
+	// Timeout is how long a node waits for the commitments and the
+	// responses of its children, multiplied by the height of its subtree -
+	// 0 waits for all children. It is set at the root and passed down in
+	// the announcement. The subtrees of the children missing at the timeout
+	// are added to the exceptions of the round.
+	Timeout time.Duration
 
 	// SDA-channels used to communicate the protocol
 	// channel for announcement
@@ -63,6 +71,9 @@ type ProtocolBFTCoSi struct {
 	challengeCommitChan chan challengeCommitChan
 	// channel for response
 	responseChan chan []responseChan
+	// the children missing when the commitments or responses timed out
+	commitMissing   chan []*sda.TreeNode
+	responseMissing chan []*sda.TreeNode
 
 	// Internal communication channels
 	// channel used to wait for the verification of the block
@@ -83,6 +94,13 @@ type ProtocolBFTCoSi struct {
 	closing bool
 	// mutex for closing down properly
 	closingMutex sync.Mutex
+	// mutex for the messages needed to resume the round once the tree is
+	// repaired
+	repairMutex sync.Mutex
+	// the announcement of the "prepare" round, nil until we handled it
+	prepareAnnounce *Announce
+	// the messages that couldn't be sent to the parent
+	unsent []interface{}
 }
 
 // collectStructs holds the variables that are used during the protocol to hold
@@ -102,6 +120,14 @@ type collectStructs struct {
 	tmpMutex sync.Mutex
 	// exceptions given during the rounds that is used in the signature
 	tempExceptions []Exception
+	// exceptions of the commit round
+	tempCommitExceptions []Exception
+	// commitments of the children taking part in each round, needed to
+	// add the exceptions of the children whose response is missing
+	childCommits map[RoundType]map[sda.TreeNodeID]abstract.Point
+	// challenges of each round, needed to verify the responses of the
+	// children
+	challenges map[RoundType]abstract.Scalar
 	// temporary buffer of "prepare" commitments
 	tempPrepareCommit []abstract.Point
 	// temporary buffer of "commit" commitments
@@ -118,10 +144,14 @@ func NewBFTCoSiProtocol(n *sda.TreeNodeInstance, verify VerificationFunction) (*
 	bft := &ProtocolBFTCoSi{
 		TreeNodeInstance: n,
 		collectStructs: collectStructs{
-			prepare: cosi.NewCosi(n.Suite(), n.Private(), n.Roster().Publics()),
-			commit:  cosi.NewCosi(n.Suite(), n.Private(), n.Roster().Publics()),
+			prepare:      cosi.NewCosi(n.Suite(), n.Private(), n.Roster().Publics()),
+			commit:       cosi.NewCosi(n.Suite(), n.Private(), n.Roster().Publics()),
+			childCommits: make(map[RoundType]map[sda.TreeNodeID]abstract.Point),
+			challenges:   make(map[RoundType]abstract.Scalar),
 		},
 		verifyChan:           make(chan bool),
+		commitMissing:        make(chan []*sda.TreeNode, 1),
+		responseMissing:      make(chan []*sda.TreeNode, 1),
 		VerificationFunction: verify,
 		threshold:            (len(n.Tree().List()) + 1) * 2 / 3,
 		Msg:                  make([]byte, 0),
@@ -138,24 +168,23 @@ func NewBFTCoSiProtocol(n *sda.TreeNodeInstance, verify VerificationFunction) (*
 	if err != nil {
 		return nil, err
 	}
+	n.SetMissingChannel(commitmentType, bft.commitMissing)
+	n.SetMissingChannel(responseType, bft.responseMissing)
 
 	n.OnDoneCallback(bft.nodeDone)
+	n.EnableRepair(bft.handleRepair)
 
 	return bft, nil
 }
 
-// Start will start both rounds "prepare" and "commit" at same time. The
-// "commit" round will wait till the end of the "prepare" round during its
-// challenge phase.
+var commitmentType = network.TypeToPacketTypeID(Commitment{})
+var responseType = network.TypeToPacketTypeID(Response{})
+
+// Start will start the "prepare" round. The "commit" round starts once the
+// root has the commitments of the "prepare" round, and will wait till the
+// end of the "prepare" round during its challenge phase.
 func (bft *ProtocolBFTCoSi) Start() error {
-	if err := bft.startAnnouncement(RoundPrepare); err != nil {
-		return err
-	}
-	go func() {
-		//time.Sleep(time.Second)
-		bft.startAnnouncement(RoundCommit)
-	}()
-	return nil
+	return bft.startAnnouncement(RoundPrepare)
 }
 
 // Dispatch makes sure that the order of the messages is correct by waiting
@@ -180,13 +209,15 @@ func (bft *ProtocolBFTCoSi) Dispatch() error {
 	bft.closingMutex.Unlock()
 
 	// Wait for both prepare and commit round
-	for i := 0; i < 2; i++ {
+	for _, t := range []RoundType{RoundPrepare, RoundCommit} {
 		// Wait for announcement message
-		if err := bft.handleAnnouncement(<-bft.announceChan); err != nil {
+		if err := bft.handleAnnouncement(bft.nextAnnouncement(t)); err != nil {
 			return err
 		}
 		// Wait for commitment messages of all children
-		if err := bft.handleCommitment(<-bft.commitChan); err != nil {
+		msgs := <-bft.commitChan
+		missing := bft.missingChildren(len(msgs), bft.commitMissing)
+		if err := bft.handleCommitment(msgs, missing); err != nil {
 			return err
 		}
 	}
@@ -195,7 +226,9 @@ func (bft *ProtocolBFTCoSi) Dispatch() error {
 	if err := bft.handleChallengePrepare(<-bft.challengePrepareChan); err != nil {
 		return err
 	}
-	if err := bft.handleResponse(<-bft.responseChan); err != nil {
+	msgs := <-bft.responseChan
+	missing := bft.missingChildren(len(msgs), bft.responseMissing)
+	if err := bft.handleResponse(msgs, missing); err != nil {
 		return err
 	}
 
@@ -203,31 +236,58 @@ func (bft *ProtocolBFTCoSi) Dispatch() error {
 	if err := bft.handleChallengeCommit(<-bft.challengeCommitChan); err != nil {
 		return err
 	}
-	if err := bft.handleResponse(<-bft.responseChan); err != nil {
+	msgs = <-bft.responseChan
+	missing = bft.missingChildren(len(msgs), bft.responseMissing)
+	if err := bft.handleResponse(msgs, missing); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// nextAnnouncement returns the announcement of round t, skipping the
+// announcements the new parent of a repaired tree sent again.
+func (bft *ProtocolBFTCoSi) nextAnnouncement(t RoundType) announceChan {
+	for {
+		msg, ok := <-bft.announceChan
+		if !ok || msg.Announce.TYPE == t {
+			return msg
+		}
+	}
+}
+
+// missingChildren returns the children missing from an aggregation of n
+// messages. If the aggregation timed out, they have been sent on c before
+// the messages.
+func (bft *ProtocolBFTCoSi) missingChildren(n int, c chan []*sda.TreeNode) []*sda.TreeNode {
+	if n == 0 || n >= len(bft.Children()) {
+		return nil
+	}
+	return <-c
+}
+
 // Signature will generate the final signature, the output of the BFTCoSi
 // protocol.
-// The signature contains the commit round signature, with the message.
+// The signature contains the commit round signature, with the message and
+// the cosigners that didn't take part in the commit round as Exceptions.
 // If the prepare phase failed, the signature will be nil and the Exceptions
 // will contain the exception from the prepare phase. It can be useful to see
 // which cosigners refused to sign (each exceptions contains the index of a
-// refusing-to-sign signer).
+// refusing-to-sign signer). If more than the threshold of cosigners missed
+// the commit round, the signature will be nil, too.
 // Expect this function to have an undefined behavior when called from a
 // non-root Node.
 func (bft *ProtocolBFTCoSi) Signature() *BFTSignature {
 	bftSig := &BFTSignature{
 		Sig:        bft.commit.Signature(),
 		Msg:        bft.Msg,
-		Exceptions: nil,
+		Exceptions: bft.tempCommitExceptions,
 	}
 	if bft.signRefusal {
 		bftSig.Sig = nil
 		bftSig.Exceptions = bft.tempExceptions
+	} else if len(bft.tempCommitExceptions) >= bft.threshold {
+		bftSig.Sig = nil
 	}
 	return bftSig
 }
@@ -267,61 +327,177 @@ func (bft *ProtocolBFTCoSi) handleAnnouncement(msg announceChan) error {
 	if bft.isClosing() {
 		return errors.New("Closing")
 	}
+	if ann.TYPE == RoundPrepare {
+		bft.Timeout = time.Duration(ann.Timeout) * time.Millisecond
+		bft.setAggregationTimeouts()
+		bft.repairMutex.Lock()
+		bft.prepareAnnounce = &ann
+		bft.repairMutex.Unlock()
+	}
 	if bft.IsLeaf() {
 		return bft.startCommitment(ann.TYPE)
 	}
-	return bft.SendToChildrenInParallel(&ann)
+	// the unreachable children are replaced once the tree is repaired
+	if err := bft.SendToChildrenInParallel(&ann); err != nil {
+		log.Lvl2(bft.Name(), "couldn't announce to all children:", err)
+	}
+	return nil
+}
+
+// handleRepair resumes the round once the tree has been repaired. The new
+// parent excludes the dead node from the rounds it didn't commit to and,
+// if the commitments of the "prepare" round are still missing, announces it
+// to the adopted children. These send it the messages they couldn't send to
+// the dead node. If the dead node committed to a round already, its subtree
+// is excluded at the Timeout.
+func (bft *ProtocolBFTCoSi) handleRepair(repaired *sda.Tree, dead *sda.TreeNode) {
+	if dead.Parent.ID.Equal(bft.TreeNode().ID) {
+		bft.tmpMutex.Lock()
+		_, prepared := bft.childCommits[RoundPrepare]
+		for _, t := range []RoundType{RoundPrepare, RoundCommit} {
+			if _, ok := bft.childCommits[t]; ok {
+				continue
+			}
+			ex := Exception{
+				Index:      dead.RosterIndex,
+				Commitment: bft.Suite().Point().Null(),
+			}
+			if t == RoundPrepare {
+				bft.tempExceptions = append(bft.tempExceptions, ex)
+			} else {
+				bft.tempCommitExceptions = append(bft.tempCommitExceptions, ex)
+			}
+		}
+		bft.tmpMutex.Unlock()
+		bft.repairMutex.Lock()
+		if !prepared && bft.prepareAnnounce != nil {
+			for _, tn := range dead.Children {
+				if err := bft.SendTo(repaired.Search(tn.ID), bft.prepareAnnounce); err != nil {
+					log.Error(bft.Name(), "couldn't announce to", tn.Name(), err)
+				}
+			}
+		}
+		bft.repairMutex.Unlock()
+	}
+
+	bft.repairMutex.Lock()
+	defer bft.repairMutex.Unlock()
+	for len(bft.unsent) > 0 {
+		if err := bft.SendTo(bft.Parent(), bft.unsent[0]); err != nil {
+			log.Error(bft.Name(), "couldn't send to the new parent:", err)
+			return
+		}
+		bft.unsent = bft.unsent[1:]
+	}
+}
+
+// sendToParent sends msg to the parent. If that fails, msg is kept to be
+// sent again once the tree is repaired, or sent to the new parent right
+// away if the tree has been repaired meanwhile. The protocol goes on in
+// both cases, so no error is returned.
+func (bft *ProtocolBFTCoSi) sendToParent(msg interface{}) error {
+	bft.repairMutex.Lock()
+	defer bft.repairMutex.Unlock()
+	parent := bft.Parent()
+	err := bft.SendTo(parent, msg)
+	if err != nil && !bft.Parent().ID.Equal(parent.ID) {
+		err = bft.SendTo(bft.Parent(), msg)
+	}
+	if err != nil {
+		log.Lvl2(bft.Name(), "keeps the message until the tree is repaired:", err)
+		bft.unsent = append(bft.unsent, msg)
+	}
+	return nil
 }
 
 // handleCommitment collects all commitments from children and passes them
-// to the parent or starts the challenge-round if it's the root.
-func (bft *ProtocolBFTCoSi) handleCommitment(msgs []commitChan) error {
+// to the parent or starts the challenge-round if it's the root. The
+// subtrees of the missing children are added to the exceptions.
+func (bft *ProtocolBFTCoSi) handleCommitment(msgs []commitChan, missing []*sda.TreeNode) error {
+	if len(msgs) == 0 {
+		return nil
+	}
 	bft.tmpMutex.Lock()
 	defer bft.tmpMutex.Unlock()
+	if bft.isClosing() {
+		return nil
+	}
+	t := msgs[0].TYPE
+	commits := make(map[sda.TreeNodeID]abstract.Point)
+	var points []abstract.Point
 	for _, msg := range msgs {
-		comm := msg.Commitment
-		if bft.isClosing() {
-			return nil
+		if msg.TYPE != t {
+			return errors.New("Got commitments of both rounds at once")
 		}
+		commits[msg.TreeNode.ID] = msg.Commitment.Commitment
+		points = append(points, msg.Commitment.Commitment)
+	}
+	bft.childCommits[t] = commits
+	for _, c := range missing {
+		bft.addExceptions(t, c, nil)
+	}
 
-		var commitment abstract.Point
-		// store it and check if we have enough commitments
-		switch comm.TYPE {
-		case RoundPrepare:
-			bft.tempPrepareCommit = append(bft.tempPrepareCommit, comm.Commitment)
-			if len(bft.tempPrepareCommit) < len(bft.Children()) {
-				continue
-			}
-			commitment = bft.prepare.Commit(nil, bft.tempPrepareCommit)
-			if bft.IsRoot() {
-				if err := bft.startChallenge(RoundPrepare); err != nil {
-					return nil
-				}
-				continue
-			}
-		case RoundCommit:
-			bft.tempCommitCommit = append(bft.tempCommitCommit, comm.Commitment)
-			if len(bft.tempCommitCommit) < len(bft.Children()) {
-				continue
-			}
-			commitment = bft.commit.Commit(nil, bft.tempCommitCommit)
-			if bft.IsRoot() {
-				// do nothing:
-				// stop the processing of the round, wait the end of
-				// the "prepare" round: calls startChallengeCommit
-				continue
+	var commitment abstract.Point
+	switch t {
+	case RoundPrepare:
+		bft.tempPrepareCommit = points
+		commitment = bft.prepare.Commit(nil, points)
+		if bft.IsRoot() {
+			if err := bft.startChallenge(RoundPrepare); err != nil {
+				return err
 			}
+			return bft.startAnnouncement(RoundCommit)
 		}
-		// set same RoundType as for the received commitment:
-		typedCommitment := &Commitment{
-			TYPE:       comm.TYPE,
-			Commitment: commitment,
+	case RoundCommit:
+		bft.tempCommitCommit = points
+		commitment = bft.commit.Commit(nil, points)
+		if bft.IsRoot() {
+			// do nothing:
+			// stop the processing of the round, wait the end of
+			// the "prepare" round: calls startChallengeCommit
+			return nil
 		}
-		if err := bft.SendToParent(typedCommitment); err != nil {
-			return err
+	}
+	// set same RoundType as for the received commitment:
+	typedCommitment := &Commitment{
+		TYPE:       t,
+		Commitment: commitment,
+	}
+	return bft.sendToParent(typedCommitment)
+}
+
+// addExceptions adds an exception for every node of the subtree of the child
+// c, which didn't take part in the round t. commit is the commitment of the
+// subtree if c sent it, so that it can be taken out of the aggregate
+// commitment.
+func (bft *ProtocolBFTCoSi) addExceptions(t RoundType, c *sda.TreeNode, commit abstract.Point) {
+	c.Visit(0, func(_ int, tn *sda.TreeNode) {
+		ex := Exception{
+			Index:      tn.RosterIndex,
+			Commitment: bft.Suite().Point().Null(),
 		}
+		if tn == c && commit != nil {
+			ex.Commitment = commit
+		}
+		if t == RoundPrepare {
+			bft.tempExceptions = append(bft.tempExceptions, ex)
+		} else {
+			bft.tempCommitExceptions = append(bft.tempCommitExceptions, ex)
+		}
+	})
+	log.Lvl2(bft.Name(), "excludes the subtree of", c.Name())
+}
+
+// setAggregationTimeouts applies the Timeout to the commitments and
+// responses of the children. A node waits longer than its children, so that
+// it gets their messages if they timed out themselves.
+func (bft *ProtocolBFTCoSi) setAggregationTimeouts() {
+	if bft.Timeout <= 0 {
+		return
 	}
-	return nil
+	timeout := bft.Timeout * time.Duration(bft.TreeNode().SubtreeHeight())
+	bft.SetAggregationTimeout(commitmentType, timeout)
+	bft.SetAggregationTimeout(responseType, timeout)
 }
 
 // handleChallengePrepare collects the challenge-messages
@@ -330,6 +506,9 @@ func (bft *ProtocolBFTCoSi) handleChallengePrepare(msg challengePrepareChan) err
 		return nil
 	}
 	ch := msg.ChallengePrepare
+	bft.tmpMutex.Lock()
+	bft.challenges[RoundPrepare] = ch.Challenge
+	bft.tmpMutex.Unlock()
 	if !bft.IsRoot() {
 		bft.Msg = ch.Msg
 		bft.Data = ch.Data
@@ -355,6 +534,9 @@ func (bft *ProtocolBFTCoSi) handleChallengeCommit(msg challengeCommitChan) error
 	}
 
 	ch := msg.ChallengeCommit
+	bft.tmpMutex.Lock()
+	bft.challenges[RoundCommit] = ch.Challenge
+	bft.tmpMutex.Unlock()
 	if !bft.IsRoot() {
 		bft.commit.Challenge(ch.Challenge)
 	}
@@ -382,46 +564,120 @@ func (bft *ProtocolBFTCoSi) handleChallengeCommit(msg challengeCommitChan) error
 	bft.tempExceptions = ch.Signature.Exceptions
 
 	if bft.IsLeaf() {
-		return bft.handleResponseCommit(nil)
+		return bft.handleResponseCommit()
 	}
 
 	return bft.SendToChildrenInParallel(&ch)
 }
 
-// handleResponse is called when a response message arrives.
-func (bft *ProtocolBFTCoSi) handleResponse(msgs []responseChan) error {
-	for _, msg := range msgs {
-		if bft.isClosing() {
-			return errors.New("Quitting instance")
-		}
-		var resp *Response
-		if !bft.IsLeaf() {
-			resp = &msg.Response
+// handleResponse is called when the response messages of the children
+// arrive. The responses of children whose commitment is missing are ignored,
+// and the subtrees of the missing children and of the children with an
+// invalid response are added to the exceptions.
+func (bft *ProtocolBFTCoSi) handleResponse(msgs []responseChan, missing []*sda.TreeNode) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if bft.isClosing() {
+		return errors.New("Quitting instance")
+	}
+	t := msgs[0].Response.TYPE
+	if !bft.IsLeaf() {
+		bft.tmpMutex.Lock()
+		commits := bft.childCommits[t]
+		var responses []abstract.Scalar
+		var exceptions []Exception
+		for _, msg := range msgs {
+			if msg.Response.TYPE != t {
+				bft.tmpMutex.Unlock()
+				return errors.New("Got responses of both rounds at once")
+			}
+			commit, ok := commits[msg.TreeNode.ID]
+			if !ok {
+				log.Lvl2(bft.Name(), "ignores the response of", msg.TreeNode.Name())
+				continue
+			}
+			if !bft.verifyResponse(t, msg.TreeNode, commit, &msg.Response) {
+				log.Lvl2(bft.Name(), "got an invalid response from", msg.TreeNode.Name())
+				bft.addExceptions(t, msg.TreeNode, commit)
+				continue
+			}
+			responses = append(responses, msg.Response.Response)
+			exceptions = append(exceptions, msg.Response.Exceptions...)
 		}
-		if msg.Response.TYPE == RoundPrepare {
-			if err := bft.handleResponsePrepare(resp); err != nil {
-				return err
+		for _, c := range missing {
+			if commit, ok := commits[c.ID]; ok {
+				bft.addExceptions(t, c, commit)
 			}
+		}
+		if t == RoundPrepare {
+			bft.tempPrepareResponse = responses
+			bft.tempExceptions = append(bft.tempExceptions, exceptions...)
 		} else {
-			if err := bft.handleResponseCommit(resp); err != nil {
-				return err
-			}
+			bft.tempCommitResponse = responses
+			bft.tempCommitExceptions = append(bft.tempCommitExceptions, exceptions...)
 		}
+		bft.tmpMutex.Unlock()
 	}
-	return nil
+	if t == RoundPrepare {
+		return bft.handleResponsePrepare()
+	}
+	return bft.handleResponseCommit()
+}
+
+// verifyResponse returns whether the response r of the child c matches its
+// commitment, without the exceptions of its subtree. Exceptions of nodes
+// outside of the subtree are only valid for nodes removed from the tree by a
+// repair.
+func (bft *ProtocolBFTCoSi) verifyResponse(t RoundType, c *sda.TreeNode, commit abstract.Point, r *Response) bool {
+	suite := bft.Suite()
+	if r.Response == nil {
+		return false
+	}
+	subtree := make(map[int]bool)
+	public := suite.Point().Null()
+	c.Visit(0, func(_ int, tn *sda.TreeNode) {
+		subtree[tn.RosterIndex] = true
+		public.Add(public, tn.ServerIdentity.Public)
+	})
+	inTree := make(map[int]bool)
+	for _, tn := range bft.Tree().List() {
+		inTree[tn.RosterIndex] = true
+	}
+	publics := bft.Roster().Publics()
+	commit = suite.Point().Add(suite.Point().Null(), commit)
+	for _, ex := range r.Exceptions {
+		if ex.Index < 0 || ex.Index >= len(publics) || ex.Commitment == nil {
+			return false
+		}
+		if subtree[ex.Index] {
+			public.Sub(public, publics[ex.Index])
+		} else if inTree[ex.Index] {
+			return false
+		}
+		commit.Sub(commit, ex.Commitment)
+	}
+	// r * B == V + k * A, like in the verification of the signature
+	left := suite.Point().Mul(nil, r.Response)
+	right := suite.Point().Mul(public, bft.challenges[t])
+	right.Add(right, commit)
+	return left.Equal(right)
 }
 
 // startAnnouncementPrepare create its announcement for the prepare round and
 // sends it down the tree.
 func (bft *ProtocolBFTCoSi) startAnnouncement(t RoundType) error {
-	bft.announceChan <- announceChan{Announce: Announce{TYPE: t}}
+	bft.announceChan <- announceChan{Announce: Announce{
+		TYPE:    t,
+		Timeout: uint64(bft.Timeout / time.Millisecond),
+	}}
 	return nil
 }
 
 // startCommitment sends the first commitment to the parent node
 func (bft *ProtocolBFTCoSi) startCommitment(t RoundType) error {
 	cm := bft.getCosi(t).CreateCommitment(nil)
-	return bft.SendToParent(&Commitment{TYPE: t, Commitment: cm})
+	return bft.sendToParent(&Commitment{TYPE: t, Commitment: cm})
 }
 
 // startChallenge creates the challenge and sends it to its children
@@ -465,24 +721,14 @@ func (bft *ProtocolBFTCoSi) startChallenge(t RoundType) error {
 
 // startResponse dispatches the response to the correct round-type
 func (bft *ProtocolBFTCoSi) startResponse(t RoundType) error {
-	bft.handleResponse([]responseChan{{Response: Response{TYPE: t}}})
+	bft.handleResponse([]responseChan{{Response: Response{TYPE: t}}}, nil)
 	return nil
 }
 
-// If 'r' is nil, it will starts the response process.
-func (bft *ProtocolBFTCoSi) handleResponsePrepare(r *Response) error {
-	if r != nil {
-		// check if we have enough responses
-		bft.tmpMutex.Lock()
-		bft.tempPrepareResponse = append(bft.tempPrepareResponse, r.Response)
-		bft.tempExceptions = append(bft.tempExceptions, r.Exceptions...)
-		if len(bft.tempPrepareResponse) < len(bft.Children()) {
-			bft.tmpMutex.Unlock()
-			return nil
-		}
-		bft.tmpMutex.Unlock()
-	}
-
+// handleResponsePrepare sends the response of the "prepare" round to the
+// parent once the responses of the children are collected, or starts the
+// "commit" round if it's the root.
+func (bft *ProtocolBFTCoSi) handleResponsePrepare() error {
 	// wait for verification
 	bzrReturn, ok := bft.waitResponseVerification()
 	// append response
@@ -492,7 +738,7 @@ func (bft *ProtocolBFTCoSi) handleResponsePrepare(r *Response) error {
 
 	// Return if we're not root
 	if !bft.IsRoot() {
-		return bft.SendTo(bft.Parent(), bzrReturn)
+		return bft.sendToParent(bzrReturn)
 	}
 	// Since cosi does not support exceptions yet, we have to remove
 	// the responses that are not supposed to be there,i.e. exceptions.
@@ -530,26 +776,13 @@ func (bft *ProtocolBFTCoSi) handleResponsePrepare(r *Response) error {
 	return nil
 }
 
-// handleResponseCommit collects all commits from the children and either
-// passes the aggregate commit to its parent or starts a response-round
-func (bft *ProtocolBFTCoSi) handleResponseCommit(r *Response) error {
-	if r != nil {
-		// check if we have enough
-		bft.tmpMutex.Lock()
-		bft.tempCommitResponse = append(bft.tempCommitResponse, r.Response)
-
-		if len(bft.tempCommitResponse) < len(bft.Children()) {
-			bft.tmpMutex.Unlock()
-			return nil
-		}
-		bft.tmpMutex.Unlock()
-	} else {
-		r = &Response{
-			TYPE:     RoundCommit,
-			Response: bft.Suite().Scalar().Zero(),
-		}
+// handleResponseCommit passes the aggregate response of the "commit" round
+// to the parent once the responses of the children are collected, or
+// finishes the signature if it's the root.
+func (bft *ProtocolBFTCoSi) handleResponseCommit() error {
+	r := &Response{
+		TYPE: RoundCommit,
 	}
-
 	var err error
 	if bft.IsLeaf() {
 		r.Response, err = bft.commit.CreateResponse()
@@ -561,13 +794,14 @@ func (bft *ProtocolBFTCoSi) handleResponseCommit(r *Response) error {
 	}
 
 	if bft.signRefusal {
-		r.Exceptions = append(r.Exceptions, Exception{
+		bft.tempCommitExceptions = append(bft.tempCommitExceptions, Exception{
 			Index:      bft.index,
 			Commitment: bft.commit.GetCommitment(),
 		})
 		// don't include our own!
 		r.Response.Sub(r.Response, bft.commit.GetResponse())
 	}
+	r.Exceptions = bft.tempCommitExceptions
 
 	// notify we have finished to participate in this signature
 	log.Lvl3(bft.Name(), "refusal=", bft.signRefusal)
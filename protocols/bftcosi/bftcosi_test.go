@@ -12,6 +12,7 @@ import (
 	"fmt"
 
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
 	"github.com/dedis/cothority/sda"
 	"github.com/stretchr/testify/assert"
 )
@@ -176,6 +177,139 @@ func TestCheckRefuseParallel(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSilentChild(t *testing.T) {
+	const TestProtocolName = "DummyBFTCoSiSilent"
+
+	// Register test protocol using BFTCoSi
+	sda.GlobalProtocolRegister(TestProtocolName, func(n *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
+		return NewBFTCoSiProtocol(n, func(m []byte, d []byte) bool {
+			return true
+		})
+	})
+
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	_, _, tree := local.GenBigTree(7, 7, 2, true)
+	silent := tree.Root.Children[0]
+	log.ErrFatal(local.Faulty(silent, sda.ByzantineDrop()))
+
+	node, err := local.CreateProtocol(TestProtocolName, tree)
+	log.ErrFatal(err)
+	root := node.(*ProtocolBFTCoSi)
+	root.Msg = []byte("Hello BFTCoSi")
+	root.Timeout = 100 * time.Millisecond
+	done := make(chan bool)
+	root.RegisterOnDone(func() {
+		done <- true
+	})
+	go node.Start()
+	select {
+	case <-done:
+		sig := root.Signature()
+		log.ErrFatal(sig.Verify(root.Suite(), root.Roster().Publics()))
+		excluded := make(map[int]bool)
+		silent.Visit(0, func(_ int, tn *sda.TreeNode) {
+			excluded[tn.RosterIndex] = true
+		})
+		assert.Equal(t, len(excluded), len(sig.Exceptions))
+		for _, ex := range sig.Exceptions {
+			assert.True(t, excluded[ex.Index])
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatal("BFTCoSi didn't finish without the silent child")
+	}
+}
+
+func TestRepair(t *testing.T) {
+	const TestProtocolName = "DummyBFTCoSiRepair"
+
+	// Register test protocol using BFTCoSi
+	sda.GlobalProtocolRegister(TestProtocolName, func(n *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
+		return NewBFTCoSiProtocol(n, func(m []byte, d []byte) bool {
+			return true
+		})
+	})
+	defer func(timeout, interval time.Duration) {
+		sda.FailureTimeout = timeout
+		sda.FailureCheckInterval = interval
+	}(sda.FailureTimeout, sda.FailureCheckInterval)
+	sda.FailureTimeout = 100 * time.Millisecond
+	sda.FailureCheckInterval = 20 * time.Millisecond
+
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	_, _, tree := local.GenBigTree(7, 7, 2, true)
+	dead := tree.Root.Children[0]
+	log.ErrFatal(local.Conodes[dead.ServerIdentity.ID].Close())
+
+	node, err := local.CreateProtocol(TestProtocolName, tree)
+	log.ErrFatal(err)
+	root := node.(*ProtocolBFTCoSi)
+	root.Msg = []byte("Hello BFTCoSi")
+	done := make(chan bool)
+	root.RegisterOnDone(func() {
+		done <- true
+	})
+	go node.Start()
+	select {
+	case <-done:
+		// the children of the dead node took part in the signature
+		sig := root.Signature()
+		log.ErrFatal(sig.Verify(root.Suite(), root.Roster().Publics()))
+		assert.Equal(t, 1, len(sig.Exceptions))
+		assert.Equal(t, dead.RosterIndex, sig.Exceptions[0].Index)
+	case <-time.After(time.Second * 10):
+		t.Fatal("BFTCoSi didn't finish after the repair")
+	}
+}
+
+func TestByzantineResponse(t *testing.T) {
+	const TestProtocolName = "DummyBFTCoSiByzantine"
+
+	// Register test protocol using BFTCoSi
+	sda.GlobalProtocolRegister(TestProtocolName, func(n *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
+		return NewBFTCoSiProtocol(n, func(m []byte, d []byte) bool {
+			return true
+		})
+	})
+
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	_, _, tree := local.GenBigTree(4, 4, 2, true)
+	// the conode of the first child of the root sends random responses in
+	// both rounds - Faulty applies to the whole conode, which holds only
+	// this TreeNode, as every conode is used once in the tree
+	log.ErrFatal(local.Faulty(tree.Root.Children[0],
+		sda.ByzantineCorrupt("Response"),
+		network.TypeToPacketTypeID(Response{})))
+
+	node, err := local.CreateProtocol(TestProtocolName, tree)
+	log.ErrFatal(err)
+	root := node.(*ProtocolBFTCoSi)
+	root.Msg = []byte("Hello BFTCoSi")
+	done := make(chan bool)
+	root.RegisterOnDone(func() {
+		done <- true
+	})
+	go node.Start()
+	select {
+	case <-done:
+		// the subtree of the faulty signer is excluded
+		sig := root.Signature()
+		log.ErrFatal(sig.Verify(root.Suite(), root.Roster().Publics()))
+		excluded := make(map[int]bool)
+		tree.Root.Children[0].Visit(0, func(_ int, tn *sda.TreeNode) {
+			excluded[tn.RosterIndex] = true
+		})
+		assert.Equal(t, len(excluded), len(sig.Exceptions))
+		for _, ex := range sig.Exceptions {
+			assert.True(t, excluded[ex.Index])
+		}
+	case <-time.After(time.Second * 60):
+		t.Fatal("Waited too long for BFTCoSi to finish")
+	}
+}
+
 func runProtocol(t *testing.T, name string, refuseCount int) {
 	for _, nbrHosts := range []int{3, 4, 13} {
 		runProtocolOnce(t, nbrHosts, name, refuseCount, true)
@@ -102,8 +102,6 @@ type ByzCoin struct {
 	// to certain parts of the protocol; mainly used in simulation to do
 	// measurements. Hence functions will not be called in go routines
 
-	// root fails:
-	rootFailMode uint
 	// Call back when we start the announcement of the prepare phase
 	onAnnouncementPrepare func()
 	// callback when we finished the response of the prepare phase
@@ -182,13 +180,12 @@ func NewByzCoinProtocol(n *sda.TreeNodeInstance) (*ByzCoin, error) {
 
 // NewByzCoinRootProtocol returns a new byzcoin struct with the block to sign
 // that will be sent to all others nodes
-func NewByzCoinRootProtocol(n *sda.TreeNodeInstance, transactions []blkparser.Tx, timeOutMs uint64, failMode uint) (*ByzCoin, error) {
+func NewByzCoinRootProtocol(n *sda.TreeNodeInstance, transactions []blkparser.Tx, timeOutMs uint64) (*ByzCoin, error) {
 	bz, err := NewByzCoinProtocol(n)
 	if err != nil {
 		return nil, err
 	}
 	bz.tempBlock, err = GetBlock(transactions, bz.lastBlock, bz.lastKeyBlock)
-	bz.rootFailMode = failMode
 	bz.rootTimeout = timeOutMs
 	return bz, err
 }
@@ -208,8 +205,6 @@ func (bz *ByzCoin) Dispatch() error {
 	return nil
 }
 func (bz *ByzCoin) listen() {
-	// FIXME handle different failure modes
-	fail := (bz.rootFailMode != 0) && bz.IsRoot()
 	var timeoutStarted bool
 	for {
 		var err error
@@ -219,27 +214,19 @@ func (bz *ByzCoin) listen() {
 			err = bz.handleAnnouncement(msg.Announce)
 		case msg := <-bz.commitChan:
 			// Commitment
-			if !fail {
-				err = bz.handleCommit(msg.Commitment)
-			}
+			err = bz.handleCommit(msg.Commitment)
 		case msg := <-bz.challengePrepareChan:
 			// Challenge
-			if !fail {
-				err = bz.handleChallengePrepare(&msg.ChallengePrepare)
-			}
+			err = bz.handleChallengePrepare(&msg.ChallengePrepare)
 		case msg := <-bz.challengeCommitChan:
-			if !fail {
-				err = bz.handleChallengeCommit(&msg.ChallengeCommit)
-			}
+			err = bz.handleChallengeCommit(&msg.ChallengeCommit)
 		case msg := <-bz.responseChan:
 			// Response
-			if !fail {
-				switch msg.Response.TYPE {
-				case RoundPrepare:
-					err = bz.handleResponsePrepare(&msg.Response)
-				case RoundCommit:
-					err = bz.handleResponseCommit(&msg.Response)
-				}
+			switch msg.Response.TYPE {
+			case RoundPrepare:
+				err = bz.handleResponsePrepare(&msg.Response)
+			case RoundCommit:
+				err = bz.handleResponseCommit(&msg.Response)
 			}
 		case timeout := <-bz.timeoutChan:
 			// start the timer
@@ -558,6 +545,8 @@ func (bz *ByzCoin) startResponseCommit() error {
 		}
 		bzr.Response = resp
 	}
+	// notify we have finished to participate in this signature
+	bz.doneSigning <- true
 	log.Lvl3(bz.Name(), "ByzCoin Start Response COMMIT")
 	// send to parent
 	err := bz.SendTo(bz.Parent(), bzr)
@@ -730,19 +719,40 @@ func (bz *ByzCoin) RegisterOnSignatureDone(fn func(*BlockSignature)) {
 
 // startTimer starts the timer to decide whether we should request a view change
 // after a certain timeout or not. If the signature is done, we don't. otherwise
-// we start the view change protocol.
+// we start the view change protocol. A timeout of 0 never requests a view
+// change.
 func (bz *ByzCoin) startTimer(millis uint64) {
-	if bz.rootFailMode != 0 {
-		log.Lvl3(bz.Name(), "Started timer (", millis, ")...")
-		select {
-		case <-bz.doneSigning:
-			return
-		case <-time.After(time.Millisecond * time.Duration(millis)):
-			bz.sendAndMeasureViewchange()
-		}
+	if millis == 0 {
+		return
+	}
+	log.Lvl3(bz.Name(), "Started timer (", millis, ")...")
+	select {
+	case <-bz.doneSigning:
+		return
+	case <-time.After(time.Millisecond * time.Duration(millis)):
+		bz.sendAndMeasureViewchange()
 	}
 }
 
+// sendWrongBlock is a ByzantineStrategy for a leader that sends a block with
+// a wrong parent in the challenge of the "prepare" round, so that the other
+// nodes refuse to sign it.
+func sendWrongBlock(msg *sda.ProtocolMsg, send func(*sda.ProtocolMsg) error) error {
+	ch, ok := msg.Msg.(*ChallengePrepare)
+	if !ok || ch.TrBlock == nil || ch.Header == nil {
+		return send(msg)
+	}
+	header := *ch.Header
+	header.Parent += "*"
+	block := *ch.TrBlock
+	block.Header = &header
+	wrong := *ch
+	wrong.TrBlock = &block
+	c := *msg
+	c.Msg = &wrong
+	return send(&c)
+}
+
 // sendAndMeasureViewChange is a method that creates the viewchange request,
 // broadcast it and measures the time it takes to accept it.
 func (bz *ByzCoin) sendAndMeasureViewchange() {
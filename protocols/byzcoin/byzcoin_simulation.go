@@ -7,6 +7,7 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/dedis/cothority/log"
 	"github.com/dedis/cothority/monitor"
+	"github.com/dedis/cothority/network"
 	"github.com/dedis/cothority/protocols/byzcoin/blockchain"
 	"github.com/dedis/cothority/protocols/byzcoin/cosi"
 	"github.com/dedis/cothority/protocols/manage"
@@ -35,7 +36,7 @@ type SimulationConfig struct {
 	Blocksize int
 	// timeout the leader after TimeoutMs milliseconds
 	TimeoutMs uint64
-	// Fail:
+	// Fail makes the conode of the leader faulty:
 	// 0  do not fail
 	// 1 fail by doing nothing
 	// 2 fail by sending wrong blocks
@@ -89,7 +90,21 @@ func (m *monitorMut) Record() {
 // Run implements sda.Simulation interface
 func (e *Simulation) Run(sdaConf *sda.SimulationConfig) error {
 	log.Lvl2("Simulation starting with: Rounds=", e.Rounds)
-	server := NewByzCoinServer(e.Blocksize, e.TimeoutMs, e.Fail)
+	server := NewByzCoinServer(e.Blocksize, e.TimeoutMs)
+	switch e.Fail {
+	case 0:
+	case 1:
+		// the leader doesn't send its challenges, so that the other nodes
+		// request a view change
+		sdaConf.Conode.Faulty(sda.ByzantineDrop(),
+			network.TypeToPacketTypeID(ChallengePrepare{}),
+			network.TypeToPacketTypeID(ChallengeCommit{}))
+	case 2:
+		sdaConf.Conode.Faulty(sendWrongBlock,
+			network.TypeToPacketTypeID(ChallengePrepare{}))
+	default:
+		return errors.New("Unknown fail mode")
+	}
 
 	pi, err := sdaConf.Overlay.CreateProtocolSDA("Broadcast", sdaConf.Tree)
 	if err != nil {
@@ -144,23 +159,12 @@ func (e *Simulation) Run(sdaConf *sda.SimulationConfig) error {
 		bz.RegisterOnDone(func() {
 			done <- true
 		})
-		if e.Fail > 0 {
-			go func() {
-				err := bz.startAnnouncementPrepare()
-				if err != nil {
-					log.Error("Error while starting "+
-						"announcment prepare:", err)
-				}
-			}()
-			// do not run bz.startAnnouncementCommit()
-		} else {
-			go func() {
-				if err := bz.Start(); err != nil {
-					log.Error("Couldn't start protocol",
-						err)
-				}
-			}()
-		}
+		go func() {
+			if err := bz.Start(); err != nil {
+				log.Error("Couldn't start protocol",
+					err)
+			}
+		}()
 		// wait for the end
 		<-done
 		log.Lvl3("Round", round, "finished")
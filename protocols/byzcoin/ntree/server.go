@@ -15,7 +15,7 @@ type NtreeServer struct {
 func NewNtreeServer(blockSize int) *NtreeServer {
 	ns := new(NtreeServer)
 	// we don't care about timeout + fail in Naive comparison
-	ns.Server = byzcoin.NewByzCoinServer(blockSize, 0, 0)
+	ns.Server = byzcoin.NewByzCoinServer(blockSize, 0)
 	return ns
 }
 
@@ -27,7 +27,6 @@ type Server struct {
 	// how many transactions should we give to an instance
 	blockSize int
 	timeOutMs uint64
-	fail      uint
 	// blockSignatureChan is the channel used to pass out the signatures that
 	// ByzCoin's instances have made
 	blockSignatureChan chan BlockSignature
@@ -40,11 +39,10 @@ type Server struct {
 
 // NewByzCoinServer returns a new fresh ByzCoinServer. It must be given the blockSize in order
 // to efficiently give the transactions to the ByzCoin instances.
-func NewByzCoinServer(blockSize int, timeOutMs uint64, fail uint) *Server {
+func NewByzCoinServer(blockSize int, timeOutMs uint64) *Server {
 	s := &Server{
 		blockSize:          blockSize,
 		timeOutMs:          timeOutMs,
-		fail:               fail,
 		blockSignatureChan: make(chan BlockSignature),
 		transactionChan:    make(chan blkparser.Tx),
 		requestChan:        make(chan bool),
@@ -71,7 +69,7 @@ func (s *Server) Instantiate(node *sda.TreeNodeInstance) (sda.ProtocolInstance,
 	// wait until we have enough blocks
 	currTransactions := s.WaitEnoughBlocks()
 	log.Lvl2("Instantiate ByzCoin Round with", len(currTransactions), "transactions")
-	pi, err := NewByzCoinRootProtocol(node, currTransactions, s.timeOutMs, s.fail)
+	pi, err := NewByzCoinRootProtocol(node, currTransactions, s.timeOutMs)
 
 	return pi, err
 }
@@ -3,8 +3,10 @@ package protocol
 
 import (
 	"sync"
+	"time"
 
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
 	"github.com/dedis/cothority/sda"
 	"github.com/dedis/crypto/abstract"
 	"github.com/dedis/crypto/cosi"
@@ -35,14 +37,24 @@ type CoSi struct {
 	cosi *cosi.CoSi
 	// the message we want to sign typically given by the Root
 	Message []byte
+	// Timeout is how long a node waits for the commitments and the
+	// responses of its children, multiplied by the height of its subtree -
+	// 0 waits for all children. It is set at the root and passed down in
+	// the announcement. As every cosigner has to take part in a signature,
+	// a node missing some children stops, so that the root finishes
+	// without signature.
+	Timeout time.Duration
 	// The channel waiting for Announcement message
 	announce chan chanAnnouncement
-	// the channel waiting for Commitment message
-	commit chan chanCommitment
+	// the channel waiting for the Commitment messages of all children
+	commit chan []chanCommitment
 	// the channel waiting for Challenge message
 	challenge chan chanChallenge
-	// the channel waiting for Response message
-	response chan chanResponse
+	// the channel waiting for the Response messages of all children
+	response chan []chanResponse
+	// the children missing when the commitments or responses timed out
+	commitMissing   chan []*sda.TreeNode
+	responseMissing chan []*sda.TreeNode
 	// the channel that indicates if we are finished or not
 	done chan bool
 	// temporary buffer of commitment messages
@@ -53,6 +65,17 @@ type CoSi struct {
 	tempResponse []abstract.Scalar
 	// lock associated
 	tempResponseLock *sync.Mutex
+	// lock for the state needed to resume the round once the tree is
+	// repaired
+	repairLock sync.Mutex
+	// the announcement we handled, nil until then
+	announcement *Announcement
+	// true once the commitments of the children are aggregated
+	committed bool
+	// the commitment that couldn't be sent to the parent
+	unsent *Commitment
+	// true if a cosigner died during the round
+	incomplete bool
 
 	// hooks related to the various phase of the protocol.
 	announcementHook AnnouncementHook
@@ -106,6 +129,8 @@ func NewCoSi(node *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
 		done:             make(chan bool),
 		tempCommitLock:   new(sync.Mutex),
 		tempResponseLock: new(sync.Mutex),
+		commitMissing:    make(chan []*sda.TreeNode, 1),
+		responseMissing:  make(chan []*sda.TreeNode, 1),
 	}
 	// Register the channels we want to register and listens on
 
@@ -121,10 +146,16 @@ func NewCoSi(node *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
 	if err := node.RegisterChannel(&c.response); err != nil {
 		return c, err
 	}
+	node.SetMissingChannel(commitmentType, c.commitMissing)
+	node.SetMissingChannel(responseType, c.responseMissing)
+	node.EnableRepair(c.handleRepair)
 
 	return c, err
 }
 
+var commitmentType = network.TypeToPacketTypeID(Commitment{})
+var responseType = network.TypeToPacketTypeID(Response{})
+
 // Dispatch will listen on the four channels we use (i.e. four steps)
 func (c *CoSi) Dispatch() error {
 	for {
@@ -132,12 +163,26 @@ func (c *CoSi) Dispatch() error {
 		select {
 		case packet := <-c.announce:
 			err = c.handleAnnouncement(&packet.Announcement)
-		case packet := <-c.commit:
-			err = c.handleCommitment(&packet.Commitment)
+		case packets := <-c.commit:
+			if len(packets) < len(c.Children()) {
+				return c.abort(<-c.commitMissing)
+			}
+			for _, packet := range packets {
+				if err = c.handleCommitment(&packet.Commitment); err != nil {
+					break
+				}
+			}
 		case packet := <-c.challenge:
 			err = c.handleChallenge(&packet.Challenge)
-		case packet := <-c.response:
-			err = c.handleResponse(&packet.Response)
+		case packets := <-c.response:
+			if len(packets) < len(c.Children()) {
+				return c.abort(<-c.responseMissing)
+			}
+			for _, packet := range packets {
+				if err = c.handleResponse(&packet.Response); err != nil {
+					break
+				}
+			}
 		case <-c.done:
 			return nil
 		}
@@ -150,10 +195,76 @@ func (c *CoSi) Dispatch() error {
 // Start will call the announcement function of its inner Round structure. It
 // will pass nil as *in* message.
 func (c *CoSi) Start() error {
-	out := &Announcement{}
+	out := &Announcement{Timeout: uint64(c.Timeout / time.Millisecond)}
 	return c.handleAnnouncement(out)
 }
 
+// abort stops the protocol instance of a node whose children didn't all
+// answer in time. The node doesn't answer its parent, which stops in turn,
+// up to the root.
+func (c *CoSi) abort(missing []*sda.TreeNode) error {
+	log.Lvl2(c.Name(), "stops without signature, missing", len(missing),
+		"children")
+	c.Done()
+	return nil
+}
+
+// handleRepair resumes the round once the tree has been repaired, if the
+// dead node didn't commit yet: the new parent announces the round to the
+// adopted children, which send it the commitment they couldn't send to the
+// dead node. As the dead node is missing from the signature, the root
+// finishes without signature. If the dead node committed already, the
+// round stops at the Timeout.
+func (c *CoSi) handleRepair(repaired *sda.Tree, dead *sda.TreeNode) {
+	c.repairLock.Lock()
+	defer c.repairLock.Unlock()
+	c.incomplete = true
+	if dead.Parent.ID.Equal(c.TreeNode().ID) && c.announcement != nil &&
+		!c.committed {
+		for _, tn := range dead.Children {
+			if err := c.SendTo(repaired.Search(tn.ID), c.announcement); err != nil {
+				log.Error(c.Name(), "couldn't announce to", tn.Name(), err)
+			}
+		}
+	}
+	if c.unsent != nil {
+		if err := c.SendTo(c.Parent(), c.unsent); err != nil {
+			log.Error(c.Name(), "couldn't send commitment again:", err)
+			return
+		}
+		c.unsent = nil
+	}
+}
+
+// sendCommitment sends the commitment to the parent. If that fails, it is
+// kept to be sent again once the tree is repaired, or sent to the new parent
+// right away if the tree has been repaired meanwhile.
+func (c *CoSi) sendCommitment(out *Commitment) error {
+	c.repairLock.Lock()
+	defer c.repairLock.Unlock()
+	parent := c.Parent()
+	err := c.SendTo(parent, out)
+	if err != nil && !c.Parent().ID.Equal(parent.ID) {
+		err = c.SendTo(c.Parent(), out)
+	}
+	if err != nil {
+		c.unsent = out
+	}
+	return err
+}
+
+// setAggregationTimeouts applies the Timeout to the commitments and
+// responses of the children. A node waits longer than its children, so that
+// it gets their messages if they timed out themselves.
+func (c *CoSi) setAggregationTimeouts() {
+	if c.Timeout <= 0 {
+		return
+	}
+	timeout := c.Timeout * time.Duration(c.TreeNode().SubtreeHeight())
+	c.SetAggregationTimeout(commitmentType, timeout)
+	c.SetAggregationTimeout(responseType, timeout)
+}
+
 // VerifySignature verifies if the challenge and the secret (from the response phase) form a
 // correct signature for this message using the aggregated public key.
 // This is copied from cosi, so that you don't need to include both lib/cosi
@@ -166,6 +277,16 @@ func VerifySignature(suite abstract.Suite, publics []abstract.Point, msg, sig []
 // output. If in == nil, we are root and we start the round.
 func (c *CoSi) handleAnnouncement(in *Announcement) error {
 	log.Lvlf3("Message: %x", c.Message)
+	c.repairLock.Lock()
+	if c.announcement != nil {
+		// the new parent of a repaired tree announces the round again
+		c.repairLock.Unlock()
+		return nil
+	}
+	c.announcement = in
+	c.repairLock.Unlock()
+	c.Timeout = time.Duration(in.Timeout) * time.Millisecond
+	c.setAggregationTimeouts()
 	// If we have a hook on announcement call the hook
 	if c.announcementHook != nil {
 		return c.announcementHook()
@@ -175,8 +296,9 @@ func (c *CoSi) handleAnnouncement(in *Announcement) error {
 	if c.IsLeaf() {
 		return c.handleCommitment(nil)
 	}
-	// send to children
-	return c.SendToChildren(in)
+	// send to all children, the unreachable ones are replaced once the
+	// tree is repaired
+	return c.SendToChildrenInParallel(in)
 }
 
 // handleAllCommitment relay the commitments up in the tree
@@ -195,6 +317,9 @@ func (c *CoSi) handleCommitment(in *Commitment) error {
 		}
 	}
 	log.Lvl3(c.Name(), "aggregated")
+	c.repairLock.Lock()
+	c.committed = true
+	c.repairLock.Unlock()
 	// pass it to the hook
 	if c.commitmentHook != nil {
 		return c.commitmentHook(c.tempCommitment)
@@ -212,7 +337,7 @@ func (c *CoSi) handleCommitment(in *Commitment) error {
 	outMsg := &Commitment{
 		Comm: out,
 	}
-	return c.SendTo(c.Parent(), outMsg)
+	return c.sendCommitment(outMsg)
 }
 
 // StartChallenge starts the challenge phase. Typically called by the Root ;)
@@ -287,6 +412,14 @@ func (c *CoSi) handleResponse(in *Response) error {
 		return c.SendTo(c.Parent(), out)
 	}
 
+	c.repairLock.Lock()
+	incomplete := c.incomplete
+	c.repairLock.Unlock()
+	if incomplete {
+		log.Lvl2(c.Name(), "finishes without signature, as a cosigner died")
+		return nil
+	}
+
 	// we are root, we have the signature now
 	if c.signatureHook != nil {
 		c.signatureHook(c.cosi.Signature())
@@ -65,3 +65,71 @@ func TestCosi(t *testing.T) {
 		local.CloseAll()
 	}
 }
+
+func TestCosiSilentChild(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	_, _, tree := local.GenBigTree(7, 7, 2, true)
+	log.ErrFatal(local.Faulty(tree.Root.Children[0], sda.ByzantineDrop()))
+
+	p, err := local.CreateProtocol("CoSi", tree)
+	log.ErrFatal(err)
+	root := p.(*CoSi)
+	root.Message = []byte("Hello World Cosi")
+	root.Timeout = 100 * time.Millisecond
+	root.RegisterSignatureHook(func(sig []byte) {
+		t.Fatal("Signed without all cosigners")
+	})
+	done := make(chan bool, 1)
+	root.OnDoneCallback(func() bool {
+		done <- true
+		return true
+	})
+	go root.StartProtocol()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Fatal("CoSi didn't stop without the silent child")
+	}
+}
+
+func TestCosiRepair(t *testing.T) {
+	defer func(timeout, interval time.Duration) {
+		sda.FailureTimeout = timeout
+		sda.FailureCheckInterval = interval
+	}(sda.FailureTimeout, sda.FailureCheckInterval)
+	sda.FailureTimeout = 100 * time.Millisecond
+	sda.FailureCheckInterval = 20 * time.Millisecond
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	_, _, tree := local.GenBigTree(7, 7, 2, true)
+	dead := tree.Root.Children[0]
+	log.ErrFatal(local.Conodes[dead.ServerIdentity.ID].Close())
+
+	p, err := local.CreateProtocol("CoSi", tree)
+	log.ErrFatal(err)
+	root := p.(*CoSi)
+	root.Message = []byte("Hello World Cosi")
+	responses := make(chan int, 1)
+	root.RegisterResponseHook(func(in []abstract.Scalar) {
+		responses <- len(in)
+	})
+	root.RegisterSignatureHook(func(sig []byte) {
+		t.Fatal("Signed without all cosigners")
+	})
+	done := make(chan bool, 1)
+	root.OnDoneCallback(func() bool {
+		done <- true
+		return true
+	})
+	go root.StartProtocol()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Fatal("CoSi didn't finish after the repair")
+	}
+	// the root adopted the children of the dead node
+	if n := <-responses; n != 3 {
+		t.Fatal("Root got", n, "responses instead of 3")
+	}
+}
@@ -12,6 +12,8 @@ import (
 
 // Announcement is broadcasted message initiated and signed by proposer.
 type Announcement struct {
+	// Timeout in milliseconds, see CoSi.Timeout
+	Timeout uint64
 }
 
 // Commitment of all nodes together with the data they want
@@ -2,8 +2,10 @@ package jvss
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
 	"github.com/dedis/cothority/sda"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,6 +27,16 @@ func TestSID(t *testing.T) {
 }
 
 func TestJVSS(t *testing.T) {
+	runJVSS(t, 0)
+}
+
+func TestJVSSSlowNode(t *testing.T) {
+	runJVSS(t, 200*time.Millisecond)
+}
+
+// runJVSS runs JVSS where one node sends its partial signatures with the
+// given delay.
+func runJVSS(t *testing.T, delay time.Duration) {
 	// Setup parameters
 	var name string = "JVSS"      // Protocol name
 	var nodes uint32 = 16         // Number of nodes
@@ -35,6 +47,10 @@ func TestJVSS(t *testing.T) {
 	_, _, tree := local.GenTree(int(nodes), true)
 
 	defer local.CloseAll()
+	if delay > 0 {
+		log.ErrFatal(local.Faulty(tree.List()[1], sda.ByzantineDelay(delay),
+			network.TypeToPacketTypeID(SigRespMsg{})))
+	}
 
 	log.Lvl1("JVSS - starting")
 	leader, err := local.CreateProtocol(name, tree)
@@ -11,5 +11,9 @@ waits for all connections to be set up.
 
 The close_all-protocol sends a 'terminate'-message to all nodes which will
 close down everything.
+
+The ping-protocol measures the round-trip times between all nodes of the tree.
+The resulting sda.LatencyMatrix can be used to create a tree with
+Roster.GenerateLatencyTree.
 */
 package manage
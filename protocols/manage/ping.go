@@ -0,0 +1,252 @@
+package manage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/cothority/sda"
+)
+
+/*
+The ping-protocol measures the round-trip times between all members of the
+roster of a tree. The root asks every node to ping all other nodes, and every
+node sends its measurements back to the root. The root puts them in a
+sda.LatencyMatrix, which can be given to Roster.GenerateLatencyTree.
+*/
+
+func init() {
+	network.RegisterPacketType(PingStart{})
+	network.RegisterPacketType(Ping{})
+	network.RegisterPacketType(Pong{})
+	network.RegisterPacketType(PingReport{})
+	network.RegisterPacketType(PingDone{})
+	sda.GlobalProtocolRegister("Ping", NewPing)
+}
+
+// PingTimeout is the time the root waits for the measurements of all nodes.
+// The RTTs not measured by then are unknown in the LatencyMatrix.
+var PingTimeout = 10 * time.Second
+
+// ProtocolPing holds the measurements of one node. Once all nodes sent their
+// measurements or PingTimeout passed, the root sends the LatencyMatrix on
+// the Latencies-channel.
+type ProtocolPing struct {
+	*sda.TreeNodeInstance
+	Latencies chan sda.LatencyMatrix
+	// nodes holds one TreeNode per member of the roster, indexed by its
+	// position in the roster
+	nodes   map[int]*sda.TreeNode
+	index   int
+	rtt     []time.Duration
+	pending int
+	// matrix is filled by the root
+	matrix sda.LatencyMatrix
+	// reported holds the roster-indexes of the nodes whose report arrived
+	reported map[int]bool
+	timeout  *time.Timer
+	finished bool
+	sync.Mutex
+}
+
+// PingStart is sent by the root to all nodes to start the measurements.
+type PingStart struct{}
+
+// Ping is sent by every node to all other nodes.
+type Ping struct {
+	// Sent is the time in nanoseconds when the ping has been sent
+	Sent int64
+}
+
+// Pong answers a Ping with the same Sent-value.
+type Pong struct {
+	Sent int64
+}
+
+// PingReport is sent to the root with the RTTs in nanoseconds between the
+// node at the position Index in the roster and all members of the roster.
+// Unknown RTTs are negative.
+type PingReport struct {
+	Index int
+	RTT   []int64
+}
+
+// PingDone is sent by the root to all nodes once it has all measurements.
+type PingDone struct{}
+
+// NewPing returns a new protocolInstance
+func NewPing(n *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
+	p := &ProtocolPing{
+		TreeNodeInstance: n,
+		Latencies:        make(chan sda.LatencyMatrix, 1),
+		nodes:            make(map[int]*sda.TreeNode),
+		reported:         make(map[int]bool),
+		index:            n.TreeNode().RosterIndex,
+	}
+	for _, tn := range n.Tree().List() {
+		if _, ok := p.nodes[tn.RosterIndex]; !ok {
+			p.nodes[tn.RosterIndex] = tn
+		}
+	}
+	p.rtt = sda.NewLatencyMatrix(len(n.Roster().List))[p.index]
+	for _, h := range []interface{}{p.handlePingStart, p.handlePing,
+		p.handlePong, p.handlePingReport, p.handlePingDone} {
+		if err := p.RegisterHandler(h); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Start asks all nodes to measure their RTTs
+func (p *ProtocolPing) Start() error {
+	p.Lock()
+	defer p.Unlock()
+	p.matrix = sda.NewLatencyMatrix(len(p.Roster().List))
+	p.timeout = time.AfterFunc(PingTimeout, p.finish)
+	for i, tn := range p.nodes {
+		if i == p.index {
+			continue
+		}
+		if err := p.SendTo(tn, &PingStart{}); err != nil {
+			log.Error(p.Info(), "couldn't start", tn.Name(), err)
+		}
+	}
+	p.pingAll()
+	return nil
+}
+
+// pingAll sends a Ping to all other nodes. The lock must be held.
+func (p *ProtocolPing) pingAll() {
+	p.pending = len(p.nodes) - 1
+	if p.pending == 0 {
+		p.report()
+		return
+	}
+	for i, tn := range p.nodes {
+		if i == p.index {
+			continue
+		}
+		if err := p.SendTo(tn, &Ping{Sent: time.Now().UnixNano()}); err != nil {
+			log.Error(p.Info(), "couldn't ping", tn.Name(), err)
+		}
+	}
+}
+
+// report sends the RTTs to the root, or adds them to the matrix if this is
+// the root. The lock must be held.
+func (p *ProtocolPing) report() {
+	rep := &PingReport{Index: p.index, RTT: make([]int64, len(p.rtt))}
+	for i, d := range p.rtt {
+		rep.RTT[i] = int64(d)
+	}
+	if p.IsRoot() {
+		p.addReport(rep)
+		return
+	}
+	if err := p.SendTo(p.Root(), rep); err != nil {
+		log.Error(p.Info(), "couldn't send report", err)
+	}
+}
+
+// addReport adds the RTTs of one node to the matrix. Repeated reports of
+// the same node are ignored. The lock must be held.
+func (p *ProtocolPing) addReport(rep *PingReport) {
+	if rep.Index < 0 || rep.Index >= len(p.matrix) ||
+		len(rep.RTT) != len(p.matrix) {
+		log.Error(p.Info(), "invalid report of", rep.Index)
+		return
+	}
+	if p.reported[rep.Index] {
+		log.Lvl2(p.Info(), "ignoring repeated report of", rep.Index)
+		return
+	}
+	p.reported[rep.Index] = true
+	for i, d := range rep.RTT {
+		p.matrix[rep.Index][i] = time.Duration(d)
+	}
+	if len(p.reported) == len(p.nodes) {
+		p.timeout.Stop()
+		go p.finish()
+	}
+}
+
+// finish is called on the root once all reports arrived or PingTimeout
+// passed. It tells all nodes to stop and returns the matrix.
+func (p *ProtocolPing) finish() {
+	p.Lock()
+	if p.finished {
+		p.Unlock()
+		return
+	}
+	p.finished = true
+	if len(p.reported) < len(p.nodes) {
+		log.Lvl2(p.Info(), "got only", len(p.reported), "of", len(p.nodes), "reports")
+	}
+	for i, tn := range p.nodes {
+		if i == p.index {
+			continue
+		}
+		if err := p.SendTo(tn, &PingDone{}); err != nil {
+			log.Lvl3(p.Info(), "couldn't stop", tn.Name(), err)
+		}
+	}
+	p.Latencies <- p.matrix
+	p.Unlock()
+	p.Done()
+}
+
+func (p *ProtocolPing) handlePingStart(msg struct {
+	*sda.TreeNode
+	PingStart
+}) {
+	p.Lock()
+	defer p.Unlock()
+	p.pingAll()
+}
+
+func (p *ProtocolPing) handlePing(msg struct {
+	*sda.TreeNode
+	Ping
+}) {
+	if err := p.SendTo(msg.TreeNode, &Pong{Sent: msg.Sent}); err != nil {
+		log.Error(p.Info(), "couldn't answer ping of", msg.TreeNode.Name(), err)
+	}
+}
+
+func (p *ProtocolPing) handlePong(msg struct {
+	*sda.TreeNode
+	Pong
+}) {
+	p.Lock()
+	defer p.Unlock()
+	p.rtt[msg.TreeNode.RosterIndex] = time.Since(time.Unix(0, msg.Sent))
+	p.pending--
+	if p.pending == 0 {
+		p.report()
+	}
+}
+
+func (p *ProtocolPing) handlePingReport(msg struct {
+	*sda.TreeNode
+	PingReport
+}) {
+	p.Lock()
+	defer p.Unlock()
+	if !p.IsRoot() || p.finished {
+		return
+	}
+	if msg.Index != msg.TreeNode.RosterIndex {
+		log.Lvl2(p.Info(), msg.TreeNode.Name(), "reports for", msg.Index)
+		return
+	}
+	p.addReport(&msg.PingReport)
+}
+
+func (p *ProtocolPing) handlePingDone(msg struct {
+	*sda.TreeNode
+	PingDone
+}) {
+	p.Done()
+}
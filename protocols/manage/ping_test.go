@@ -0,0 +1,62 @@
+package manage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/sda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPing(t *testing.T) {
+	for _, nbrNodes := range []int{1, 2, 5} {
+		local := sda.NewLocalTest()
+		_, el, tree := local.GenTree(nbrNodes, true)
+
+		pi, err := local.StartProtocol("Ping", tree)
+		require.Nil(t, err)
+		protocol := pi.(*ProtocolPing)
+		var rtt sda.LatencyMatrix
+		select {
+		case rtt = <-protocol.Latencies:
+		case <-time.After(PingTimeout + time.Second):
+			t.Fatal("Didn't finish in time")
+		}
+		require.Equal(t, nbrNodes, len(rtt))
+		for i := range rtt {
+			for j, d := range rtt[i] {
+				if i == j {
+					assert.Equal(t, time.Duration(0), d)
+				} else {
+					assert.True(t, d > 0, "RTT between", i, "and", j, "is", d)
+				}
+			}
+		}
+		_, err = el.GenerateLatencyTree(2, rtt)
+		assert.Nil(t, err)
+		local.CloseAll()
+	}
+}
+
+func TestPingRepeatedReport(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(3, true)
+	tni, err := local.NewTreeNodeInstance(tree.Root, "Ping")
+	require.Nil(t, err)
+	pi, err := NewPing(tni)
+	require.Nil(t, err)
+	p := pi.(*ProtocolPing)
+	p.matrix = sda.NewLatencyMatrix(3)
+	p.timeout = time.NewTimer(PingTimeout)
+
+	p.Lock()
+	defer p.Unlock()
+	for i := 0; i < 3; i++ {
+		p.addReport(&PingReport{Index: 1, RTT: []int64{1, 0, 1}})
+	}
+	assert.Equal(t, 1, len(p.reported))
+	// the root still waits for the other reports
+	assert.True(t, p.timeout.Stop())
+}
@@ -10,6 +10,16 @@ import (
 )
 
 func TestRandHound(t *testing.T) {
+	runRandHound(t, 0)
+}
+
+func TestRandHoundSilentServers(t *testing.T) {
+	runRandHound(t, 2)
+}
+
+// runRandHound runs RandHound where the given number of servers don't send
+// any message.
+func runRandHound(t *testing.T, silent int) {
 
 	var name = "RandHound"
 	var nodes int = 28
@@ -20,6 +30,9 @@ func TestRandHound(t *testing.T) {
 	local := sda.NewLocalTest()
 	_, _, tree := local.GenTree(int(nodes), true)
 	defer local.CloseAll()
+	for _, tn := range tree.List()[1 : silent+1] {
+		log.ErrFatal(local.Faulty(tn, sda.ByzantineDrop()))
+	}
 
 	// Setup and start RandHound
 
@@ -45,8 +45,6 @@ type RandHound struct {
 	// Misc
 	Done        chan bool // Channel to signal the end of a protocol run
 	SecretReady bool      // Boolean to indicate whether the collect randomness is ready or not
-
-	//Byzantine map[int]int // for simulating byzantine servers (= key)
 }
 
 // Share encapsulates all information for encrypted or decrypted shares and the
@@ -0,0 +1,199 @@
+package sda
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/crypto"
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/crypto/abstract"
+)
+
+// NonceWindow is how long a signed ClientRequest is accepted after it has been
+// created. The nonces of all requests in this window are remembered, so that
+// a request cannot be replayed at the same conode. As the signature covers the
+// destination, it can't be replayed at another conode either.
+var NonceWindow = 5 * time.Minute
+
+// nonceRandomLength is the number of random bytes in a nonce. They follow the
+// 8 bytes of the creation-time.
+const nonceRandomLength = 16
+
+// ClientSignature authenticates a ClientRequest: it holds the public key of
+// the client and a Schnorr signature over the service, the data, the nonce
+// and the public key of the destination of the request.
+type ClientSignature struct {
+	Public    abstract.Point
+	Nonce     []byte
+	Signature crypto.SchnorrSig
+}
+
+// Sign adds a ClientSignature to the request for the conode dst, using a
+// fresh nonce.
+func (cr *ClientRequest) Sign(private abstract.Scalar, dst *network.ServerIdentity) error {
+	nonce := make([]byte, 8+nonceRandomLength)
+	binary.BigEndian.PutUint64(nonce, uint64(time.Now().UnixNano()))
+	if _, err := rand.Read(nonce[8:]); err != nil {
+		return err
+	}
+	msg, err := cr.signedMessage(nonce, dst)
+	if err != nil {
+		return err
+	}
+	sig, err := crypto.SignSchnorr(network.Suite, private, msg)
+	if err != nil {
+		return err
+	}
+	cr.Signature = &ClientSignature{
+		Public:    network.Suite.Point().Mul(nil, private),
+		Nonce:     nonce,
+		Signature: sig,
+	}
+	return nil
+}
+
+// VerifySignature returns nil if the request has a valid ClientSignature
+// for the conode dst. It doesn't check the nonce for replays.
+func (cr *ClientRequest) VerifySignature(dst *network.ServerIdentity) error {
+	if cr.Signature == nil {
+		return errors.New("Request is not signed")
+	}
+	if len(cr.Signature.Nonce) != 8+nonceRandomLength {
+		return errors.New("Wrong nonce length")
+	}
+	msg, err := cr.signedMessage(cr.Signature.Nonce, dst)
+	if err != nil {
+		return err
+	}
+	return crypto.VerifySchnorr(network.Suite, cr.Signature.Public, msg,
+		cr.Signature.Signature)
+}
+
+// signedMessage returns the bytes that are signed by the client.
+func (cr *ClientRequest) signedMessage(nonce []byte, dst *network.ServerIdentity) ([]byte, error) {
+	if dst == nil || dst.Public == nil {
+		return nil, errors.New("No destination to sign the request for")
+	}
+	var msg bytes.Buffer
+	msg.Write(cr.Service[:])
+	msg.Write(cr.Data)
+	msg.Write(nonce)
+	if _, err := dst.Public.MarshalTo(&msg); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// accessControl verifies the signatures of the ClientRequests and holds the
+// public keys that are allowed to send requests to a service.
+type accessControl struct {
+	sync.Mutex
+	// acl holds the allowed keys for each restricted service
+	acl map[ServiceID][]abstract.Point
+	// nonces holds the nonces that can still be replayed
+	nonces map[string]bool
+	// seen holds the same nonces in the order they arrived, so that the
+	// outdated ones are removed without looking at all nonces
+	seen []seenNonce
+}
+
+// seenNonce is a nonce and the time it arrived.
+type seenNonce struct {
+	nonce   string
+	arrival time.Time
+}
+
+func newAccessControl() *accessControl {
+	return &accessControl{
+		acl:    make(map[ServiceID][]abstract.Point),
+		nonces: make(map[string]bool),
+	}
+}
+
+// setACL restricts the access of the service to the given public keys. A nil
+// slice gives everybody access to the service.
+func (ac *accessControl) setACL(service ServiceID, publics []abstract.Point) {
+	ac.Lock()
+	defer ac.Unlock()
+	if publics == nil {
+		delete(ac.acl, service)
+		return
+	}
+	ac.acl[service] = publics
+}
+
+// authorize returns an error if the signature of the request for the conode
+// dst is invalid, if the service has an ACL which doesn't include the public
+// key of the request, or if its nonce is outdated or has already been used.
+// The nonce is only recorded for authorized requests, so that a denied
+// request doesn't use up the nonce of a legitimate one.
+func (ac *accessControl) authorize(cr *ClientRequest, dst *network.ServerIdentity) error {
+	ac.Lock()
+	publics, restricted := ac.acl[cr.Service]
+	ac.Unlock()
+	if cr.Signature == nil {
+		if restricted {
+			return network.NewServiceError(network.ErrorCodeAccessDenied,
+				"Service only accepts signed requests")
+		}
+		return nil
+	}
+	// the signature is verified without holding the lock
+	if err := cr.VerifySignature(dst); err != nil {
+		return network.NewServiceError(network.ErrorCodeInvalidSignature,
+			"Wrong request-signature: "+err.Error())
+	}
+	if restricted && !containsPublic(publics, cr.Signature.Public) {
+		return network.NewServiceError(network.ErrorCodeAccessDenied,
+			"Public key is not allowed to use this service")
+	}
+	ac.Lock()
+	err := ac.checkNonce(cr.Signature.Nonce)
+	ac.Unlock()
+	if err != nil {
+		return network.NewServiceError(network.ErrorCodeInvalidSignature,
+			err.Error())
+	}
+	return nil
+}
+
+// containsPublic returns whether public is one of publics.
+func containsPublic(publics []abstract.Point, public abstract.Point) bool {
+	for _, p := range publics {
+		if p.Equal(public) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNonce returns an error if the nonce is outside of the NonceWindow or
+// if it has already been seen. The lock must be held by the caller.
+func (ac *accessControl) checkNonce(nonce []byte) error {
+	now := time.Now()
+	ac.pruneNonces(now)
+	created := time.Unix(0, int64(binary.BigEndian.Uint64(nonce)))
+	if now.Sub(created) > NonceWindow || created.Sub(now) > NonceWindow {
+		return errors.New("Nonce is outdated")
+	}
+	if ac.nonces[string(nonce)] {
+		return errors.New("Nonce has already been used")
+	}
+	ac.nonces[string(nonce)] = true
+	ac.seen = append(ac.seen, seenNonce{string(nonce), now})
+	return nil
+}
+
+// pruneNonces removes the nonces that are outdated. A nonce arrives at most
+// one NonceWindow before its creation-time and is outdated one NonceWindow
+// after it, so it can be removed two NonceWindows after its arrival.
+func (ac *accessControl) pruneNonces(now time.Time) {
+	for len(ac.seen) > 0 && now.Sub(ac.seen[0].arrival) > 2*NonceWindow {
+		delete(ac.nonces, ac.seen[0].nonce)
+		ac.seen = ac.seen[1:]
+	}
+}
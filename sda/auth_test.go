@@ -0,0 +1,109 @@
+package sda
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRequest_Sign(t *testing.T) {
+	kp := config.NewKeyPair(network.Suite)
+	dst := network.NewServerIdentity(config.NewKeyPair(network.Suite).Public,
+		network.NewLocalAddress("dst"))
+	other := network.NewServerIdentity(config.NewKeyPair(network.Suite).Public,
+		network.NewLocalAddress("other"))
+	cr := &ClientRequest{
+		Service: testServiceID,
+		Data:    []byte("request"),
+	}
+	require.NotNil(t, cr.VerifySignature(dst))
+	log.ErrFatal(cr.Sign(kp.Secret, dst))
+	log.ErrFatal(cr.VerifySignature(dst))
+
+	// the request can't be replayed at another conode
+	require.NotNil(t, newAccessControl().authorize(cr, other))
+
+	ac := newAccessControl()
+	log.ErrFatal(ac.authorize(cr, dst))
+	// replay of the same request
+	require.NotNil(t, ac.authorize(cr, dst))
+
+	cr.Data = []byte("other request")
+	require.NotNil(t, cr.VerifySignature(dst))
+}
+
+func TestAccessControl_DeniedNonce(t *testing.T) {
+	kp := config.NewKeyPair(network.Suite)
+	dst := network.NewServerIdentity(kp.Public, network.NewLocalAddress("dst"))
+	allowed := config.NewKeyPair(network.Suite)
+	ac := newAccessControl()
+	ac.setACL(testServiceID, []abstract.Point{config.NewKeyPair(network.Suite).Public})
+
+	cr := &ClientRequest{Service: testServiceID, Data: []byte("request")}
+	log.ErrFatal(cr.Sign(allowed.Secret, dst))
+	err := ac.authorize(cr, dst)
+	require.Equal(t, network.ErrorCodeAccessDenied, network.ErrorCodeOf(err))
+	require.Equal(t, 0, len(ac.nonces))
+
+	// the denied request didn't use up the nonce
+	ac.setACL(testServiceID, []abstract.Point{allowed.Public})
+	log.ErrFatal(ac.authorize(cr, dst))
+	require.NotNil(t, ac.authorize(cr, dst))
+}
+
+func TestAccessControl_PruneNonces(t *testing.T) {
+	defer func(w time.Duration) { NonceWindow = w }(NonceWindow)
+	NonceWindow = 50 * time.Millisecond
+	kp := config.NewKeyPair(network.Suite)
+	dst := network.NewServerIdentity(kp.Public, network.NewLocalAddress("dst"))
+	ac := newAccessControl()
+	for i := 0; i < 3; i++ {
+		cr := &ClientRequest{Service: testServiceID, Data: []byte{byte(i)}}
+		log.ErrFatal(cr.Sign(kp.Secret, dst))
+		log.ErrFatal(ac.authorize(cr, dst))
+	}
+	require.Equal(t, 3, len(ac.nonces))
+
+	time.Sleep(2*NonceWindow + 10*time.Millisecond)
+	cr := &ClientRequest{Service: testServiceID, Data: []byte("new")}
+	log.ErrFatal(cr.Sign(kp.Secret, dst))
+	log.ErrFatal(ac.authorize(cr, dst))
+	require.Equal(t, 1, len(ac.nonces))
+	require.Equal(t, 1, len(ac.seen))
+}
+
+func TestConode_SetACL(t *testing.T) {
+	local := NewLocalTest()
+	defer local.CloseAll()
+	h := local.GenConodes(1)[0]
+
+	allowed := config.NewKeyPair(network.Suite)
+	other := config.NewKeyPair(network.Suite)
+	require.NotNil(t, h.SetACL("unknownService", nil))
+	log.ErrFatal(h.SetACL("testService",
+		[]abstract.Point{allowed.Public}))
+
+	client := local.NewClient("testService")
+	_, err := client.Send(h.ServerIdentity, &testMsg{12})
+	require.Equal(t, network.ErrorCodeAccessDenied, network.ErrorCodeOf(err))
+
+	client.SignRequests(other.Secret)
+	_, err = client.Send(h.ServerIdentity, &testMsg{12})
+	require.Equal(t, network.ErrorCodeAccessDenied, network.ErrorCodeOf(err))
+
+	client.SignRequests(allowed.Secret)
+	resp, err := client.Send(h.ServerIdentity, &testMsg{12})
+	log.ErrFatal(err)
+	require.Equal(t, 12, resp.Msg.(testMsg).I)
+
+	// lifting the restriction
+	log.ErrFatal(h.SetACL("testService", nil))
+	client = local.NewClient("testService")
+	_, err = client.Send(h.ServerIdentity, &testMsg{12})
+	log.ErrFatal(err)
+}
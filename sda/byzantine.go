@@ -0,0 +1,206 @@
+package sda
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/crypto/abstract"
+	"github.com/dedis/crypto/random"
+)
+
+// ByzantineStrategy changes the behaviour of a faulty conode for an outgoing
+// protocol message. It gets the message and the function sending a message
+// to the recipient, and decides what to send, if anything at all. The
+// strategies of this file are meant for tests of protocols against
+// malicious participants.
+type ByzantineStrategy func(msg *ProtocolMsg, send func(*ProtocolMsg) error) error
+
+// byzantineRule applies a strategy to the messages of some types.
+type byzantineRule struct {
+	strategy ByzantineStrategy
+	// types is empty if the strategy applies to all messages
+	types map[network.PacketTypeID]bool
+}
+
+// Faulty makes the conode apply the strategy to its outgoing protocol
+// messages of the given types, or to all its protocol messages if no type is
+// given. If several strategies apply to a message, the first one given is
+// used.
+func (c *Conode) Faulty(s ByzantineStrategy, types ...network.PacketTypeID) {
+	c.overlay.byzantineLock.Lock()
+	defer c.overlay.byzantineLock.Unlock()
+	r := byzantineRule{strategy: s, types: make(map[network.PacketTypeID]bool)}
+	for _, t := range types {
+		r.types[t] = true
+	}
+	c.overlay.byzantine = append(c.overlay.byzantine, r)
+}
+
+// Honest removes all strategies of the conode.
+func (c *Conode) Honest() {
+	c.overlay.byzantineLock.Lock()
+	defer c.overlay.byzantineLock.Unlock()
+	c.overlay.byzantine = nil
+}
+
+// Faulty makes the conode of the TreeNode apply the strategy to the
+// messages of the given types, see Conode.Faulty. The whole conode becomes
+// faulty, not only tn: the strategy applies to the messages of every
+// TreeNode and protocol instance of that conode.
+func (l *LocalTest) Faulty(tn *TreeNode, s ByzantineStrategy, types ...network.PacketTypeID) error {
+	c, ok := l.Conodes[tn.ServerIdentity.ID]
+	if !ok {
+		return errors.New("No conode for " + tn.Name())
+	}
+	c.Faulty(s, types...)
+	return nil
+}
+
+// byzantineStrategy returns the strategy to apply to msg, or nil if the
+// conode is honest for it.
+func (o *Overlay) byzantineStrategy(msg network.Body) ByzantineStrategy {
+	o.byzantineLock.Lock()
+	defer o.byzantineLock.Unlock()
+	if len(o.byzantine) == 0 {
+		return nil
+	}
+	mt := network.TypeToPacketTypeID(msg)
+	for _, r := range o.byzantine {
+		if len(r.types) == 0 || r.types[mt] {
+			return r.strategy
+		}
+	}
+	return nil
+}
+
+// ByzantineDrop doesn't send the messages, but lets the protocol believe
+// they have been sent.
+func ByzantineDrop() ByzantineStrategy {
+	return func(msg *ProtocolMsg, send func(*ProtocolMsg) error) error {
+		log.Lvl3("Byzantine: dropping", reflect.TypeOf(msg.Msg))
+		return nil
+	}
+}
+
+// ByzantineDelay sends the messages after the delay d.
+func ByzantineDelay(d time.Duration) ByzantineStrategy {
+	return func(msg *ProtocolMsg, send func(*ProtocolMsg) error) error {
+		time.AfterFunc(d, func() {
+			if err := send(msg); err != nil {
+				log.Lvl3("Byzantine: couldn't send delayed message:", err)
+			}
+		})
+		return nil
+	}
+}
+
+// ByzantineCorrupt sends the messages with a random value in the field of
+// the given name.
+func ByzantineCorrupt(field string) ByzantineStrategy {
+	return func(msg *ProtocolMsg, send func(*ProtocolMsg) error) error {
+		corrupt, err := corruptField(msg.Msg, field)
+		if err != nil {
+			return err
+		}
+		c := *msg
+		c.Msg = corrupt
+		return send(&c)
+	}
+}
+
+// ByzantineEquivocate corrupts the field of the given name in the messages
+// to every second recipient, so that the recipients of a message sent to
+// several nodes get conflicting values. Each recipient always gets either
+// the honest or the corrupted messages.
+func ByzantineEquivocate(field string) ByzantineStrategy {
+	var m sync.Mutex
+	corrupted := make(map[TreeNodeID]bool)
+	corrupt := ByzantineCorrupt(field)
+	return func(msg *ProtocolMsg, send func(*ProtocolMsg) error) error {
+		m.Lock()
+		c, ok := corrupted[msg.To.TreeNodeID]
+		if !ok {
+			c = len(corrupted)%2 == 1
+			corrupted[msg.To.TreeNodeID] = c
+		}
+		m.Unlock()
+		if !c {
+			return send(msg)
+		}
+		return corrupt(msg, send)
+	}
+}
+
+// ByzantineReplay sends again the first message of each type instead of
+// the messages that follow it.
+func ByzantineReplay() ByzantineStrategy {
+	var m sync.Mutex
+	first := make(map[network.PacketTypeID]network.Body)
+	return func(msg *ProtocolMsg, send func(*ProtocolMsg) error) error {
+		mt := network.TypeToPacketTypeID(msg.Msg)
+		m.Lock()
+		old, ok := first[mt]
+		if !ok {
+			first[mt] = msg.Msg
+		}
+		m.Unlock()
+		if !ok {
+			return send(msg)
+		}
+		c := *msg
+		c.Msg = old
+		return send(&c)
+	}
+}
+
+// corruptField returns a copy of msg where the field of the given name has
+// a random value, or another value for booleans and numbers.
+func corruptField(msg network.Body, field string) (network.Body, error) {
+	v := reflect.ValueOf(msg)
+	ptr := v.Kind() == reflect.Ptr
+	if ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Cannot corrupt %T", msg)
+	}
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	f := c.Elem().FieldByName(field)
+	if !f.IsValid() || !f.CanSet() {
+		return nil, fmt.Errorf("%T has no field %s", msg, field)
+	}
+	switch {
+	case f.Type() == reflect.TypeOf((*abstract.Scalar)(nil)).Elem():
+		f.Set(reflect.ValueOf(network.Suite.Scalar().Pick(random.Stream)))
+	case f.Type() == reflect.TypeOf((*abstract.Point)(nil)).Elem():
+		p, _ := network.Suite.Point().Pick(nil, random.Stream)
+		f.Set(reflect.ValueOf(p))
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+		n := f.Len()
+		if n == 0 {
+			n = 1
+		}
+		f.SetBytes(random.Bytes(n, random.Stream))
+	case f.Kind() == reflect.String:
+		f.SetString(f.String() + "*")
+	case f.Kind() == reflect.Bool:
+		f.SetBool(!f.Bool())
+	case f.Kind() >= reflect.Int && f.Kind() <= reflect.Int64:
+		f.SetInt(f.Int() + 1)
+	case f.Kind() >= reflect.Uint && f.Kind() <= reflect.Uint64:
+		f.SetUint(f.Uint() + 1)
+	default:
+		return nil, fmt.Errorf("Cannot corrupt field %s of type %s", field,
+			f.Type())
+	}
+	if ptr {
+		return c.Interface(), nil
+	}
+	return c.Elem().Interface(), nil
+}
@@ -0,0 +1,113 @@
+package sda
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/crypto/abstract"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type byzantineTestMsg struct {
+	I      int
+	B      bool
+	Data   []byte
+	Scalar abstract.Scalar
+}
+
+func TestCorruptField(t *testing.T) {
+	msg := byzantineTestMsg{I: 1, Data: []byte{1, 2}, Scalar: network.Suite.Scalar().One()}
+	for _, f := range []string{"I", "B", "Data", "Scalar"} {
+		c, err := corruptField(msg, f)
+		require.Nil(t, err)
+		assert.NotEqual(t, msg, c.(byzantineTestMsg), f)
+		c, err = corruptField(&msg, f)
+		require.Nil(t, err)
+		assert.NotEqual(t, msg, *c.(*byzantineTestMsg), f)
+	}
+	// the original message is not changed
+	assert.Equal(t, 1, msg.I)
+	assert.Equal(t, []byte{1, 2}, msg.Data)
+	assert.True(t, msg.Scalar.Equal(network.Suite.Scalar().One()))
+
+	_, err := corruptField(msg, "Unknown")
+	assert.NotNil(t, err)
+	_, err = corruptField(3, "I")
+	assert.NotNil(t, err)
+}
+
+func TestByzantineStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy ByzantineStrategy
+		// sums of the two aggregated rounds
+		sums []int
+	}{
+		{"drop", ByzantineDrop(), []int{10, 20}},
+		{"corrupt", ByzantineCorrupt("I"), []int{12, 23}},
+		{"replay", ByzantineReplay(), []int{11, 21}},
+	}
+	for _, test := range tests {
+		sums := runFaultyChild(t, test.strategy)
+		assert.Equal(t, test.sums, sums, test.name)
+	}
+}
+
+func TestByzantineEquivocate(t *testing.T) {
+	s := ByzantineEquivocate("I")
+	var got []int
+	send := func(msg *ProtocolMsg) error {
+		got = append(got, msg.Msg.(*byzantineTestMsg).I)
+		return nil
+	}
+	to1 := &Token{TreeNodeID: TreeNodeID(uuid.NewV4())}
+	to2 := &Token{TreeNodeID: TreeNodeID(uuid.NewV4())}
+	for _, to := range []*Token{to1, to2, to2, to1} {
+		require.Nil(t, s(&ProtocolMsg{To: to, Msg: &byzantineTestMsg{I: 1}}, send))
+	}
+	// the recipients get conflicting values, but each one always the same
+	assert.Equal(t, []int{1, 2, 2, 1}, got)
+}
+
+// runFaultyChild runs two rounds of ProtocolAggTimeout where the first child
+// is faulty and sends 1 and 2, while the second child sends 10 and 20. It
+// returns the sums of the messages of both rounds.
+func runFaultyChild(t *testing.T, s ByzantineStrategy) []int {
+	local := NewLocalTest()
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(3, true)
+	IncomingHandlers = make(chan *TreeNodeInstance, 2)
+	p, err := local.CreateProtocol("ProtocolAggTimeout", tree)
+	require.Nil(t, err)
+	root := p.(*ProtocolAggTimeout)
+	go root.Start()
+	children := map[TreeNodeID]*TreeNodeInstance{}
+	for i := 0; i < 2; i++ {
+		c := <-IncomingHandlers
+		children[c.TreeNode().ID] = c
+	}
+	faulty := children[tree.Root.Children[0].ID]
+	honest := children[tree.Root.Children[1].ID]
+	require.Nil(t, local.Faulty(faulty.TreeNode(), s,
+		network.TypeFromData(NodeTestAggMsg{})))
+
+	var sums []int
+	for _, i := range []int{1, 2} {
+		faulty.SendTo(root.TreeNode(), &NodeTestAggMsg{i})
+		honest.SendTo(root.TreeNode(), &NodeTestAggMsg{10 * i})
+		select {
+		case r := <-root.incoming:
+			sum := 0
+			for _, m := range r.msgs {
+				sum += m.I
+			}
+			sums = append(sums, sum)
+		case <-time.After(time.Second):
+			t.Fatal("Aggregation didn't finish")
+		}
+	}
+	return sums
+}
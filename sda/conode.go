@@ -1,11 +1,14 @@
 package sda
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"strings"
 
 	"sort"
+	"strconv"
 
 	"errors"
 
@@ -30,6 +33,8 @@ type Conode struct {
 	// protocols holds a map of all available protocols and how to create an
 	// instance of it
 	protocols *protocolStorage
+	// acl authenticates and authorizes the requests of clients
+	acl *accessControl
 }
 
 // NewConode returns a fresh Host with a given Router.
@@ -39,8 +44,11 @@ func NewConode(r *network.Router, pkey abstract.Scalar) *Conode {
 		statusReporterStruct: newStatusReporterStruct(),
 		Router:               r,
 		protocols:            newProtocolStorage(),
+		acl:                  newAccessControl(),
 	}
 	c.overlay = NewOverlay(c)
+	// only reconnect to the members of the rosters, never to clients
+	c.SetKnownPeers(c.overlay.knownMember)
 	c.serviceManager = newServiceManager(c, c.overlay)
 	c.statusReporterStruct.RegisterStatusReporter("Status", c)
 	for name, inst := range protocols.instantiators {
@@ -71,9 +79,44 @@ func (c *Conode) GetStatus() Status {
 	a := ServiceFactory.RegisteredServiceNames()
 	sort.Strings(a)
 	m["Available_Services"] = strings.Join(a, ",")
+	for _, p := range c.Router.Peers() {
+		state := "down"
+		if p.Up {
+			state = "up"
+		}
+		m["Peer_"+p.ServerIdentity.Address.String()] = fmt.Sprintf(
+			"%s rtt=%s last-seen=%s reconnects=%d", state, p.RTT,
+			p.LastSeen.Format(time.RFC3339), p.Reconnects)
+	}
+	for addr, t := range c.Router.PeerTraffic() {
+		m["Traffic_"+addr.String()] = formatTraffic(t)
+	}
+	for id, t := range c.Router.TypeTraffic() {
+		m["Type_"+id.String()] = formatTraffic(t)
+	}
+	trees, rosters := c.TreesRosters()
+	m["Trees"] = strconv.Itoa(trees)
+	m["Rosters"] = strconv.Itoa(rosters)
+	for name, infos := range c.Instances() {
+		m["Instances_"+name] = strconv.Itoa(len(infos))
+	}
+	d := c.DropStats()
+	m["Dropped_instance_queue"] = strconv.FormatUint(d.InstanceQueue, 10)
+	m["Dropped_pending_messages"] = strconv.FormatUint(d.PendingMessages, 10)
+	m["Dropped_pending_trees"] = strconv.FormatUint(d.PendingTrees, 10)
+	m["Dropped_expired"] = strconv.FormatUint(d.Expired, 10)
+	m["Dropped_unsolicited"] = strconv.FormatUint(d.Unsolicited, 10)
+	m["Dropped_invalid_id"] = strconv.FormatUint(d.InvalidID, 10)
+	m["Dropped_not_member"] = strconv.FormatUint(d.NotMember, 10)
 	return m
 }
 
+// formatTraffic returns the counters of t in a single line.
+func formatTraffic(t network.Traffic) string {
+	return fmt.Sprintf("tx=%d/%dB rx=%d/%dB errors=%d", t.MsgsTx, t.BytesTx,
+		t.MsgsRx, t.BytesRx, t.Errors)
+}
+
 // Close closes the overlay and the Router
 func (c *Conode) Close() error {
 	c.overlay.Close()
@@ -88,6 +131,18 @@ func (c *Conode) Address() network.Address {
 	return c.ServerIdentity.Address
 }
 
+// SetACL restricts the access to the service to clients that sign their
+// requests with one of the private keys corresponding to publics. Giving nil
+// for publics lifts the restriction.
+func (c *Conode) SetACL(service string, publics []abstract.Point) error {
+	id := ServiceFactory.ServiceID(service)
+	if id == NilServiceID {
+		return errors.New("Unknown service: " + service)
+	}
+	c.acl.setACL(id, publics)
+	return nil
+}
+
 // GetService returns the service with the given name.
 func (c *Conode) GetService(name string) Service {
 	return c.serviceManager.Service(name)
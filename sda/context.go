@@ -1,6 +1,10 @@
 package sda
 
-import "github.com/dedis/cothority/network"
+import (
+	"io"
+
+	"github.com/dedis/cothority/network"
+)
 
 // Context represents the methods that are available to a service.
 type Context struct {
@@ -34,11 +38,32 @@ func (c *Context) SendRaw(si *network.ServerIdentity, msg interface{}) error {
 	return c.conode.Send(si, msg)
 }
 
+// SendStream sends the payload read from r to the ServerIdentity in Chunks,
+// so that it can be bigger than the maximum packet size.
+func (c *Context) SendStream(si *network.ServerIdentity, r io.Reader) error {
+	return c.conode.SendStream(si, r)
+}
+
+// RegisterStreamReceiver sets the StreamReceiver of the streams sent to this
+// Conode. It is registered on the Router, so that the Chunks are processed in
+// order. There is only one StreamReceiver per Conode: registering another
+// one replaces it.
+func (c *Context) RegisterStreamReceiver(sr *network.StreamReceiver) {
+	c.conode.RegisterProcessor(sr, network.ChunkType)
+}
+
 // ServerIdentity returns this Conode's identity.
 func (c *Context) ServerIdentity() *network.ServerIdentity {
 	return c.conode.ServerIdentity
 }
 
+// RegisterLegacyRoster lets the conode accept el from other conodes even if
+// its ID has been chosen at random by an older version. Services call it for
+// the Rosters they load from disk.
+func (c *Context) RegisterLegacyRoster(el *Roster) {
+	c.overlay.RegisterLegacyRoster(el)
+}
+
 // ServiceID returns the service-id.
 func (c *Context) ServiceID() ServiceID {
 	return c.servID
@@ -57,6 +82,12 @@ func (c *Context) CreateProtocolSDA(name string, t *Tree) (ProtocolInstance, err
 	return pi, err
 }
 
+// LaunchProtocol starts a ProtocolInstance bound to the service in the
+// background and returns a ProtocolFuture to wait for its end.
+func (c *Context) LaunchProtocol(pi ProtocolInstance) (*ProtocolFuture, error) {
+	return c.overlay.LaunchProtocol(pi)
+}
+
 // ProtocolRegister signs up a new protocol to this Conode. Contrary go
 // GlobalProtocolRegister, the protocol registered here is tied to that conode.
 // This is useful for simulations where more than one Conode exists in the
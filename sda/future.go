@@ -0,0 +1,111 @@
+package sda
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dedis/cothority/log"
+)
+
+// ProtocolFuture represents a ProtocolInstance that has been launched in the
+// background. It can be used to wait for the end of the protocol, to get the
+// errors returned by its Dispatch- or Start-method, and to stop it if
+// the caller is not interested anymore in the result.
+type ProtocolFuture struct {
+	overlay *Overlay
+	pi      ProtocolInstance
+	tni     *TreeNodeInstance
+	// errChan receives the errors of Dispatch and Start, and
+	// ErrInstanceTimeout if the instance is closed for being idle
+	errChan chan error
+	// once makes sure the result is only computed once
+	once sync.Once
+	err  error
+}
+
+// ErrProtocolFinished is returned by ProtocolFuture.Cancel if the protocol
+// already finished.
+var ErrProtocolFinished = errors.New("Protocol instance already finished")
+
+// LaunchProtocol calls the Dispatch- and the Start-method of the given
+// ProtocolInstance in go-routines and returns immediately with a
+// ProtocolFuture. The ProtocolInstance must already be registered with
+// RegisterProtocolInstance and must not be dispatched yet. Hooks that collect
+// the result of the protocol should be registered before calling
+// LaunchProtocol.
+func (o *Overlay) LaunchProtocol(pi ProtocolInstance) (*ProtocolFuture, error) {
+	o.instancesLock.Lock()
+	tni, ok := o.instances[pi.Token().ID()]
+	if !ok {
+		o.instancesLock.Unlock()
+		return nil, ErrWrongTreeNodeInstance
+	}
+	f := &ProtocolFuture{
+		overlay: o,
+		pi:      pi,
+		tni:     tni,
+		errChan: make(chan error, 3),
+	}
+	tni.futureErr = f.errChan
+	o.instancesLock.Unlock()
+	go func() {
+		if err := pi.Dispatch(); err != nil {
+			f.errChan <- errors.New("Dispatch failed: " + err.Error())
+		}
+	}()
+	go func() {
+		if err := pi.Start(); err != nil {
+			f.errChan <- errors.New("Start failed: " + err.Error())
+		}
+	}()
+	return f, nil
+}
+
+// Wait blocks until the protocol instance called Done, until its
+// Dispatch- or Start-method returned an error, until the instance has been
+// closed for being idle, which returns ErrInstanceTimeout, or until ctx is
+// done. Except if the protocol called Done, the TreeNodeInstance is closed
+// and removed from the Overlay, and the error is returned. Subsequent calls
+// return the same result.
+func (f *ProtocolFuture) Wait(ctx context.Context) error {
+	f.once.Do(func() {
+		select {
+		case <-f.tni.finished:
+			return
+		default:
+		}
+		select {
+		case <-f.tni.finished:
+		case err := <-f.errChan:
+			f.err = err
+		case <-ctx.Done():
+			f.err = ctx.Err()
+		}
+		if f.err != nil {
+			log.Lvl2(f.tni.Info(), "stopping protocol:", f.err)
+			f.overlay.nodeDone(f.tni.token)
+		}
+	})
+	return f.err
+}
+
+// Cancel stops the protocol instance and releases the resources of its
+// TreeNodeInstance. It returns ErrProtocolFinished if the protocol
+// already finished.
+func (f *ProtocolFuture) Cancel() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := f.Wait(ctx); err != context.Canceled {
+		if err == nil {
+			return ErrProtocolFinished
+		}
+		return err
+	}
+	return nil
+}
+
+// ProtocolInstance returns the protocol instance this future is waiting for.
+func (f *ProtocolFuture) ProtocolInstance() ProtocolInstance {
+	return f.pi
+}
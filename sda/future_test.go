@@ -0,0 +1,99 @@
+package sda
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/stretchr/testify/require"
+)
+
+type protocolFutureTest struct {
+	*TreeNodeInstance
+	startErr error
+	done     bool
+}
+
+func (pf *protocolFutureTest) Start() error {
+	if pf.startErr != nil {
+		return pf.startErr
+	}
+	if pf.done {
+		pf.Done()
+	}
+	return nil
+}
+
+func (pf *protocolFutureTest) Dispatch() error {
+	return nil
+}
+
+func newFutureInstance(o *Overlay, tree *Tree) *protocolFutureTest {
+	tni := o.NewTreeNodeInstanceFromProtoName(tree, "ProtocolOverlay")
+	pf := &protocolFutureTest{TreeNodeInstance: tni}
+	log.ErrFatal(o.RegisterProtocolInstance(pf))
+	return pf
+}
+
+func TestProtocolFuture(t *testing.T) {
+	local := NewLocalTest()
+	defer local.CloseAll()
+	h, _, tree := local.GenTree(1, true)
+	o := h[0].overlay
+
+	// Protocol calling Done
+	pf := newFutureInstance(o, tree)
+	pf.done = true
+	future, err := o.LaunchProtocol(pf)
+	log.ErrFatal(err)
+	require.Nil(t, future.Wait(context.Background()))
+	require.Equal(t, ErrProtocolFinished, future.Cancel())
+
+	// Protocol failing in Start
+	pf = newFutureInstance(o, tree)
+	pf.startErr = errors.New("failing")
+	future, err = o.LaunchProtocol(pf)
+	log.ErrFatal(err)
+	require.NotNil(t, future.Wait(context.Background()))
+	_, ok := o.TokenToNode(pf.Token())
+	require.False(t, ok)
+
+	// Protocol never finishing
+	pf = newFutureInstance(o, tree)
+	future, err = o.LaunchProtocol(pf)
+	log.ErrFatal(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, future.Wait(ctx))
+	_, ok = o.TokenToNode(pf.Token())
+	require.False(t, ok)
+
+	// Unknown protocol instance
+	_, err = o.LaunchProtocol(pf)
+	require.Equal(t, ErrWrongTreeNodeInstance, err)
+}
+
+func TestProtocolFutureIdle(t *testing.T) {
+	defer func(timeout time.Duration) {
+		InstanceTimeout = timeout
+	}(InstanceTimeout)
+	local := NewLocalTest()
+	defer local.CloseAll()
+	h, _, tree := local.GenTree(1, true)
+	o := h[0].overlay
+
+	// the idle instance is closed by the garbage collection
+	pf := newFutureInstance(o, tree)
+	future, err := o.LaunchProtocol(pf)
+	log.ErrFatal(err)
+	InstanceTimeout = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	o.collect()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Equal(t, ErrInstanceTimeout, future.Wait(ctx))
+	_, ok := o.TokenToNode(pf.Token())
+	require.False(t, ok)
+}
@@ -0,0 +1,245 @@
+package sda
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dedis/cothority/log"
+)
+
+// GCInterval is the time between two collections of the trees, rosters and
+// TreeNodeInstances an Overlay doesn't need anymore.
+var GCInterval = time.Minute
+
+// GCGracePeriod is the time a Tree or Roster is kept after the last
+// TreeNodeInstance using it finished. The Overlay also remembers finished
+// TreeNodeInstances for that long, so that late messages for them are not
+// taken for a new instance.
+var GCGracePeriod = 10 * time.Minute
+
+// InstanceTimeout is the time after which a TreeNodeInstance that neither
+// received nor sent a message is closed. A value of 0 disables the timeout.
+var InstanceTimeout = 10 * time.Minute
+
+// ErrInstanceTimeout is returned by ProtocolFuture.Wait if the
+// TreeNodeInstance has been closed because it was idle for InstanceTimeout.
+var ErrInstanceTimeout = errors.New("Protocol instance closed after being idle")
+
+// InstanceInfo describes a TreeNodeInstance running in an Overlay.
+type InstanceInfo struct {
+	Token *Token
+	// Protocol is the name of the protocol, or the empty string if the
+	// protocol is not registered anymore
+	Protocol string
+	Created  time.Time
+	// LastActive is the last time the instance received or sent a message
+	LastActive time.Time
+}
+
+// usage tracks how many TreeNodeInstances use a tree or roster, and when it
+// has last been used.
+type usage struct {
+	instances int
+	lastUsed  time.Time
+}
+
+// collectable returns true if no instance uses the tree or roster since
+// GCGracePeriod.
+func (u *usage) collectable() bool {
+	return u.instances == 0 && time.Since(u.lastUsed) > GCGracePeriod
+}
+
+// Instances returns the TreeNodeInstances running in the Overlay, sorted by
+// creation time.
+func (o *Overlay) Instances() []InstanceInfo {
+	o.instancesLock.Lock()
+	defer o.instancesLock.Unlock()
+	var infos []InstanceInfo
+	for _, tni := range o.instances {
+		infos = append(infos, InstanceInfo{
+			Token:      tni.Token(),
+			Protocol:   tni.ProtocolName(),
+			Created:    tni.created,
+			LastActive: tni.LastActive(),
+		})
+	}
+	sort.Sort(byCreation(infos))
+	return infos
+}
+
+// byCreation sorts InstanceInfos by creation time.
+type byCreation []InstanceInfo
+
+func (b byCreation) Len() int           { return len(b) }
+func (b byCreation) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byCreation) Less(i, j int) bool { return b[i].Created.Before(b[j].Created) }
+
+// Instances returns the TreeNodeInstances running on the conode, grouped by
+// the name of their protocol.
+func (c *Conode) Instances() map[string][]InstanceInfo {
+	m := make(map[string][]InstanceInfo)
+	for _, info := range c.overlay.Instances() {
+		m[info.Protocol] = append(m[info.Protocol], info)
+	}
+	return m
+}
+
+// TreesRosters returns how many trees and rosters the Overlay of the conode
+// keeps.
+func (c *Conode) TreesRosters() (trees, rosters int) {
+	c.overlay.treesMut.Lock()
+	trees = len(c.overlay.trees)
+	c.overlay.treesMut.Unlock()
+	c.overlay.entityListLock.Lock()
+	rosters = len(c.overlay.entityLists)
+	c.overlay.entityListLock.Unlock()
+	return
+}
+
+// gcLoop collects every GCInterval until the Overlay is closed.
+func (o *Overlay) gcLoop() {
+	ticker := time.NewTicker(GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.quit:
+			return
+		case <-ticker.C:
+			o.collect()
+		}
+	}
+}
+
+// collect closes the idle TreeNodeInstances, forgets the finished ones after
+// GCGracePeriod and removes the trees and rosters not used anymore.
+func (o *Overlay) collect() {
+	o.instancesLock.Lock()
+	for _, tni := range o.instances {
+		if InstanceTimeout > 0 && time.Since(tni.LastActive()) > InstanceTimeout {
+			log.Lvl2(o.conode.Address(), "closing idle instance of",
+				tni.ProtocolName())
+			if tni.futureErr != nil {
+				select {
+				case tni.futureErr <- ErrInstanceTimeout:
+				default:
+				}
+			}
+			o.nodeDelete(tni.Token())
+		}
+	}
+	for id, done := range o.instancesInfo {
+		if time.Since(done) > GCGracePeriod {
+			delete(o.instancesInfo, id)
+		}
+	}
+	o.instancesLock.Unlock()
+
+	o.usageLock.Lock()
+	defer o.usageLock.Unlock()
+	// the repaired versions of a tree in use are needed by its instances
+	needed := make(map[TreeID]bool)
+	o.treesMut.Lock()
+	for id, u := range o.treeUsage {
+		if u.collectable() {
+			continue
+		}
+		for next, ok := o.repaired[id]; ok; next, ok = o.repaired[next] {
+			needed[next] = true
+		}
+	}
+	o.treesMut.Unlock()
+	for id, u := range o.treeUsage {
+		if needed[id] || !u.collectable() {
+			continue
+		}
+		log.Lvl3(o.conode.Address(), "removing tree", id)
+		delete(o.treeUsage, id)
+		o.treesMut.Lock()
+		delete(o.trees, id)
+		delete(o.repaired, id)
+		o.treesMut.Unlock()
+		o.cache.Lock()
+		delete(o.cache.Entries, id)
+		o.cache.Unlock()
+	}
+	used := make(map[RosterID]bool)
+	o.treesMut.Lock()
+	for _, t := range o.trees {
+		used[t.Roster.ID] = true
+	}
+	o.treesMut.Unlock()
+	for id, u := range o.rosterUsage {
+		if used[id] || !u.collectable() {
+			continue
+		}
+		log.Lvl3(o.conode.Address(), "removing roster", id)
+		delete(o.rosterUsage, id)
+		o.entityListLock.Lock()
+		delete(o.entityLists, id)
+		o.entityListLock.Unlock()
+	}
+}
+
+// touchTree marks the tree as used now. usageLock must be held.
+func (o *Overlay) touchTree(id TreeID) *usage {
+	u, ok := o.treeUsage[id]
+	if !ok {
+		u = &usage{}
+		o.treeUsage[id] = u
+	}
+	u.lastUsed = time.Now()
+	return u
+}
+
+// touchRoster marks the roster as used now. usageLock must be held.
+func (o *Overlay) touchRoster(id RosterID) *usage {
+	u, ok := o.rosterUsage[id]
+	if !ok {
+		u = &usage{}
+		o.rosterUsage[id] = u
+	}
+	u.lastUsed = time.Now()
+	return u
+}
+
+// useTree counts a new TreeNodeInstance using the tree and its roster. It
+// also stores them again, in case they have been collected since the
+// instance looked them up.
+func (o *Overlay) useTree(t *Tree) {
+	o.usageLock.Lock()
+	defer o.usageLock.Unlock()
+	o.touchTree(t.ID).instances++
+	o.touchRoster(t.Roster.ID).instances++
+	o.treesMut.Lock()
+	o.trees[t.ID] = t
+	o.treesMut.Unlock()
+	o.entityListLock.Lock()
+	o.entityLists[t.Roster.ID] = t.Roster
+	o.entityListLock.Unlock()
+}
+
+// releaseTree counts a finished TreeNodeInstance that used the tree and
+// roster of tok.
+func (o *Overlay) releaseTree(tok *Token) {
+	o.usageLock.Lock()
+	defer o.usageLock.Unlock()
+	if u := o.touchTree(tok.TreeID); u.instances > 0 {
+		u.instances--
+	}
+	if u := o.touchRoster(tok.RosterID); u.instances > 0 {
+		u.instances--
+	}
+}
+
+// LastActive returns the last time the instance received or sent a message,
+// or its creation time if it didn't.
+func (n *TreeNodeInstance) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&n.lastActive))
+}
+
+// active marks the instance as active now.
+func (n *TreeNodeInstance) active() {
+	atomic.StoreInt64(&n.lastActive, time.Now().UnixNano())
+}
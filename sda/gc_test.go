@@ -0,0 +1,83 @@
+package sda
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProtocolOverlay(n *TreeNodeInstance) (ProtocolInstance, error) {
+	return &ProtocolOverlay{TreeNodeInstance: n}, nil
+}
+
+func TestOverlayCollect(t *testing.T) {
+	defer func(grace time.Duration) {
+		GCGracePeriod = grace
+	}(GCGracePeriod)
+	GlobalProtocolRegister("ProtocolOverlay", newProtocolOverlay)
+	local := NewLocalTest()
+	defer local.CloseAll()
+	hosts, el, tree := local.GenTree(2, true)
+	h1 := hosts[0]
+
+	p, err := h1.CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	GCGracePeriod = 50 * time.Millisecond
+	time.Sleep(100 * time.Millisecond)
+
+	// the tree is used by the instance
+	h1.overlay.collect()
+	_, ok := h1.GetTree(tree.ID)
+	assert.True(t, ok)
+	_, ok = h1.Roster(el.ID)
+	assert.True(t, ok)
+
+	p.(*ProtocolOverlay).Release()
+	h1.overlay.collect()
+	_, ok = h1.GetTree(tree.ID)
+	assert.True(t, ok, "tree removed before the grace period")
+
+	time.Sleep(100 * time.Millisecond)
+	h1.overlay.collect()
+	_, ok = h1.GetTree(tree.ID)
+	assert.False(t, ok)
+	_, ok = h1.Roster(el.ID)
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(h1.overlay.instancesInfo))
+	assert.Equal(t, 0, len(h1.overlay.protocolInstances))
+	trees, rosters := h1.TreesRosters()
+	assert.Equal(t, 0, trees)
+	assert.Equal(t, 0, rosters)
+}
+
+func TestOverlayInstanceTimeout(t *testing.T) {
+	defer func(timeout time.Duration) {
+		InstanceTimeout = timeout
+	}(InstanceTimeout)
+	GlobalProtocolRegister("ProtocolOverlay", newProtocolOverlay)
+	local := NewLocalTest()
+	defer local.CloseAll()
+	hosts, _, tree := local.GenTree(2, true)
+	h1 := hosts[0]
+
+	_, err := h1.CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	_, err = h1.CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	instances := h1.Instances()
+	assert.Equal(t, 1, len(instances))
+	assert.Equal(t, 2, len(instances["ProtocolOverlay"]))
+
+	// an active instance is kept
+	InstanceTimeout = time.Minute
+	h1.overlay.collect()
+	assert.Equal(t, 2, h1.ProtocolInstances())
+
+	InstanceTimeout = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	h1.overlay.collect()
+	assert.Equal(t, 0, h1.ProtocolInstances())
+	assert.Equal(t, 0, len(h1.Instances()))
+}
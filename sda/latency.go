@@ -0,0 +1,156 @@
+package sda
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LatencyMatrix holds the round-trip times between the members of a Roster:
+// the element [i][j] is the RTT between List[i] and List[j]. Negative values
+// mark unknown RTTs. The Ping-protocol of protocols/manage measures it.
+type LatencyMatrix [][]time.Duration
+
+// NewLatencyMatrix returns a matrix for n members where all RTTs are unknown,
+// except those of the members to themselves.
+func NewLatencyMatrix(n int) LatencyMatrix {
+	m := make(LatencyMatrix, n)
+	for i := range m {
+		m[i] = make([]time.Duration, n)
+		for j := range m[i] {
+			if i != j {
+				m[i][j] = -1
+			}
+		}
+	}
+	return m
+}
+
+// complete returns a copy of the matrix for n members where the unknown
+// RTTs are replaced by the RTT in the other direction, or else by the
+// largest known RTT.
+func (m LatencyMatrix) complete(n int) (LatencyMatrix, error) {
+	if len(m) != n {
+		return nil, fmt.Errorf("Latency matrix has %d rows for %d members",
+			len(m), n)
+	}
+	var max time.Duration
+	for i := range m {
+		if len(m[i]) != n {
+			return nil, fmt.Errorf("Latency matrix has %d columns in row %d "+
+				"for %d members", len(m[i]), i, n)
+		}
+		for _, d := range m[i] {
+			if d > max {
+				max = d
+			}
+		}
+	}
+	c := make(LatencyMatrix, n)
+	for i := range m {
+		c[i] = make([]time.Duration, n)
+		for j, d := range m[i] {
+			switch {
+			case d >= 0:
+				c[i][j] = d
+			case m[j][i] >= 0:
+				c[i][j] = m[j][i]
+			default:
+				c[i][j] = max
+			}
+		}
+	}
+	return c, nil
+}
+
+// GenerateLatencyTree creates a tree where each node has at most N children,
+// using the RTTs of rtt to keep the latency between the root and the
+// furthest node low. The first element of the Roster will be the root
+// element. The nodes are added one by one, always taking the node that can
+// be reached fastest from the root through a node that still has room for
+// a child.
+func (el *Roster) GenerateLatencyTree(N int, rtt LatencyMatrix) (*Tree, error) {
+	if N < 1 {
+		return nil, errors.New("Need at least one child per node")
+	}
+	n := len(el.List)
+	if n == 0 {
+		return nil, errors.New("Empty Roster")
+	}
+	lat, err := rtt.complete(n)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*TreeNode, n)
+	children := make([]int, n)
+	// dist is the latency from the root - for nodes not yet in the tree it
+	// is the latency through the best parent found so far, stored in parent
+	dist := make([]time.Duration, n)
+	parent := make([]int, n)
+	nodes[0] = NewTreeNode(0, el.List[0])
+	for v := 1; v < n; v++ {
+		dist[v] = lat[0][v]
+	}
+	// best searches the best parent for v among the nodes in the tree
+	best := func(v int) {
+		parent[v] = -1
+		for p := range nodes {
+			if nodes[p] == nil || children[p] >= N {
+				continue
+			}
+			if parent[v] == -1 || dist[p]+lat[p][v] < dist[v] {
+				parent[v] = p
+				dist[v] = dist[p] + lat[p][v]
+			}
+		}
+	}
+	for added := 1; added < n; added++ {
+		u := -1
+		for v := range nodes {
+			if nodes[v] == nil && (u == -1 || dist[v] < dist[u]) {
+				u = v
+			}
+		}
+		p := parent[u]
+		nodes[u] = NewTreeNode(u, el.List[u])
+		nodes[u].Parent = nodes[p]
+		nodes[p].Children = append(nodes[p].Children, nodes[u])
+		children[p]++
+		for v := range nodes {
+			switch {
+			case nodes[v] != nil:
+			case parent[v] == p && children[p] >= N:
+				best(v)
+			case dist[u]+lat[u][v] < dist[v]:
+				parent[v] = u
+				dist[v] = dist[u] + lat[u][v]
+			}
+		}
+	}
+	return NewTree(el, nodes[0]), nil
+}
+
+// Latency returns the time a message needs to go from the root to the
+// furthest node of the tree and back, using the RTTs of rtt which is
+// indexed like the Roster of the tree. Unknown RTTs are replaced like in
+// GenerateLatencyTree.
+func (t *Tree) Latency(rtt LatencyMatrix) (time.Duration, error) {
+	lat, err := rtt.complete(len(t.Roster.List))
+	if err != nil {
+		return 0, err
+	}
+	return subtreeLatency(t.Root, lat), nil
+}
+
+// subtreeLatency returns the latency from tn to the furthest node of its
+// subtree and back.
+func subtreeLatency(tn *TreeNode, lat LatencyMatrix) time.Duration {
+	var max time.Duration
+	for _, c := range tn.Children {
+		d := lat[tn.RosterIndex][c.RosterIndex] + subtreeLatency(c, lat)
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
@@ -0,0 +1,75 @@
+package sda
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// twoSites returns the RTTs of n nodes where the even nodes are on one site
+// and the odd nodes on another one.
+func twoSites(n int) LatencyMatrix {
+	m := NewLatencyMatrix(n)
+	for i := range m {
+		for j := range m[i] {
+			switch {
+			case i == j:
+			case i%2 == j%2:
+				m[i][j] = time.Millisecond
+			default:
+				m[i][j] = 100 * time.Millisecond
+			}
+		}
+	}
+	return m
+}
+
+func TestGenerateLatencyTree(t *testing.T) {
+	names := genLocalhostPeerNames(9, 2000)
+	el := genRoster(tSuite, names)
+	rtt := twoSites(9)
+
+	tree, err := el.GenerateLatencyTree(2, rtt)
+	require.Nil(t, err)
+	assert.Equal(t, el.List[0], tree.Root.ServerIdentity)
+	assert.Equal(t, 9, tree.Size())
+	assert.True(t, maxChildren(tree) <= 2)
+	used := make(map[int]bool)
+	for _, tn := range tree.List() {
+		used[tn.RosterIndex] = true
+	}
+	assert.Equal(t, 9, len(used))
+
+	// only one link between the sites is on the critical path
+	latency, err := tree.Latency(rtt)
+	require.Nil(t, err)
+	assert.True(t, latency < 110*time.Millisecond, latency)
+	binary, err := el.GenerateBinaryTree().Latency(rtt)
+	require.Nil(t, err)
+	assert.True(t, latency < binary)
+
+	// unknown RTTs are taken from the other direction
+	rtt[0][1] = -1
+	tree2, err := el.GenerateLatencyTree(2, rtt)
+	require.Nil(t, err)
+	latency2, err := tree2.Latency(rtt)
+	require.Nil(t, err)
+	assert.Equal(t, latency, latency2)
+
+	_, err = el.GenerateLatencyTree(2, NewLatencyMatrix(8))
+	assert.NotNil(t, err)
+	_, err = el.GenerateLatencyTree(0, rtt)
+	assert.NotNil(t, err)
+}
+
+func maxChildren(t *Tree) int {
+	max := 0
+	for _, tn := range t.List() {
+		if len(tn.Children) > max {
+			max = len(tn.Children)
+		}
+	}
+	return max
+}
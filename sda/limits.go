@@ -0,0 +1,87 @@
+package sda
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MaxInstanceQueue is the maximum number of messages waiting to be
+// dispatched to a TreeNodeInstance. Further messages are dropped until the
+// protocol instance catches up. It can be changed for a single instance with
+// TreeNodeInstance.SetQueueLimit.
+var MaxInstanceQueue = 1000
+
+// MaxPendingMessages is the maximum number of protocol messages an Overlay
+// keeps while waiting for their tree.
+var MaxPendingMessages = 1000
+
+// MaxPendingTrees is the maximum number of trees an Overlay keeps while
+// waiting for their roster.
+var MaxPendingTrees = 100
+
+// PendingTimeout is the time after which protocol messages and trees still
+// waiting for their tree or roster are dropped.
+var PendingTimeout = time.Minute
+
+// DropStats counts the messages dropped by an Overlay.
+type DropStats struct {
+	// InstanceQueue counts the messages dropped because the queue of their
+	// TreeNodeInstance was full
+	InstanceQueue uint64
+	// PendingMessages counts the protocol messages dropped because too many
+	// messages were waiting for their tree
+	PendingMessages uint64
+	// PendingTrees counts the trees dropped because too many trees were
+	// waiting for their roster
+	PendingTrees uint64
+	// Expired counts the protocol messages and trees dropped because their
+	// tree or roster didn't arrive within PendingTimeout
+	Expired uint64
+	// Unsolicited counts the trees and rosters dropped because they have
+	// not been requested
+	Unsolicited uint64
+	// InvalidID counts the trees and rosters dropped because their ID
+	// doesn't match their content
+	InvalidID uint64
+	// NotMember counts the protocol messages for trees not including this
+	// conode, and the requests for trees and rosters not including the
+	// requester
+	NotMember uint64
+}
+
+// pendingMsg is a protocol message waiting for its tree.
+type pendingMsg struct {
+	msg   *ProtocolMsg
+	added time.Time
+}
+
+// pendingTree is a tree waiting for its roster.
+type pendingTree struct {
+	tm    *TreeMarshal
+	added time.Time
+}
+
+// DropStats returns how many messages have been dropped by the Overlay.
+func (o *Overlay) DropStats() DropStats {
+	return DropStats{
+		InstanceQueue:   atomic.LoadUint64(&o.dropped.InstanceQueue),
+		PendingMessages: atomic.LoadUint64(&o.dropped.PendingMessages),
+		PendingTrees:    atomic.LoadUint64(&o.dropped.PendingTrees),
+		Expired:         atomic.LoadUint64(&o.dropped.Expired),
+		Unsolicited:     atomic.LoadUint64(&o.dropped.Unsolicited),
+		InvalidID:       atomic.LoadUint64(&o.dropped.InvalidID),
+		NotMember:       atomic.LoadUint64(&o.dropped.NotMember),
+	}
+}
+
+// DropStats returns how many messages have been dropped by the Overlay of
+// the conode.
+func (c *Conode) DropStats() DropStats {
+	return c.overlay.DropStats()
+}
+
+// expired returns true if something added at the given time waited longer
+// than PendingTimeout.
+func expired(added time.Time) bool {
+	return time.Since(added) > PendingTimeout
+}
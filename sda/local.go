@@ -340,9 +340,23 @@ func (l *LocalTest) NewLocalClient(serviceName string) *Client {
 	return &Client{
 		ServiceID: ServiceFactory.ServiceID(serviceName),
 		net:       network.NewLocalClientWithManager(l.ctx),
+		timeout:   ClientTimeout,
 	}
 }
 
+// InjectFaults makes all local connections of this LocalTest unreliable
+// and returns the FaultInjector to configure the faults. The random
+// decisions of the FaultInjector depend only on seed. It returns an error
+// if the LocalTest uses TCP.
+func (l *LocalTest) InjectFaults(seed int64) (*network.FaultInjector, error) {
+	if l.mode != Local {
+		return nil, errors.New("Faults can only be injected in local mode")
+	}
+	fi := network.NewFaultInjector(seed)
+	l.ctx.SetFaultInjector(fi)
+	return fi, nil
+}
+
 // genLocalHosts returns n conodes created with a localRouter
 func (l *LocalTest) genLocalHosts(n int) []*Conode {
 	conodes := make([]*Conode, n)
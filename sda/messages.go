@@ -9,13 +9,13 @@ import (
 
 // SDADataMessageID is to be embedded in every message that is made for a
 // ID of SDAData message as registered in network
-var SDADataMessageID = network.RegisterPacketType(ProtocolMsg{})
+var SDADataMessageID = network.RegisterPacketTypeVersion("sda.ProtocolMsg", 0, ProtocolMsg{})
 
 // RequestTreeMessageID of RequestTree message as registered in network
-var RequestTreeMessageID = network.RegisterPacketType(RequestTree{})
+var RequestTreeMessageID = network.RegisterPacketTypeVersion("sda.RequestTree", 0, RequestTree{})
 
 // RequestRosterMessageID of RequestRoster message as registered in network
-var RequestRosterMessageID = network.RegisterPacketType(RequestRoster{})
+var RequestRosterMessageID = network.RegisterPacketTypeVersion("sda.RequestRoster", 0, RequestRoster{})
 
 // SendTreeMessageID of TreeMarshal message as registered in network
 var SendTreeMessageID = TreeMarshalTypeID
@@ -40,6 +40,10 @@ type ProtocolMsg struct {
 	MsgSlice []byte
 	// Config the actual config
 	Config GenericConfig
+	// Received is the number of messages the sender got from the receiver
+	// in this protocol instance when it sent this one. It tells the
+	// aggregation to which message of the receiver this one replies.
+	Received int
 }
 
 // RoundID uniquely identifies a round of a protocol run
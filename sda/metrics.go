@@ -0,0 +1,93 @@
+package sda
+
+import (
+	"sync"
+	"time"
+)
+
+// ServiceStats counts the client requests handled by a service.
+type ServiceStats struct {
+	// Requests is the number of requests processed by the service
+	Requests uint64
+	// Refused is the number of requests refused by the access control
+	Refused uint64
+	// Latency is the total time spent processing the requests
+	Latency time.Duration
+}
+
+// MetricsReporter can be implemented by a Service to export numeric metrics,
+// like the number of blocks it stores. The metrics are returned by
+// Conode.ServiceMetrics.
+type MetricsReporter interface {
+	Metrics() map[string]float64
+}
+
+// serviceStats holds the ServiceStats of all services of a conode.
+type serviceStats struct {
+	sync.Mutex
+	stats map[ServiceID]*ServiceStats
+}
+
+func newServiceStats() *serviceStats {
+	return &serviceStats{stats: make(map[ServiceID]*ServiceStats)}
+}
+
+// get returns the stats of the service. The lock must be held by the caller.
+func (ss *serviceStats) get(id ServiceID) *ServiceStats {
+	st, ok := ss.stats[id]
+	if !ok {
+		st = &ServiceStats{}
+		ss.stats[id] = st
+	}
+	return st
+}
+
+// processed records a request that took d to be processed.
+func (ss *serviceStats) processed(id ServiceID, d time.Duration) {
+	ss.Lock()
+	defer ss.Unlock()
+	st := ss.get(id)
+	st.Requests++
+	st.Latency += d
+}
+
+// refused records a request refused by the access control.
+func (ss *serviceStats) refused(id ServiceID) {
+	ss.Lock()
+	defer ss.Unlock()
+	ss.get(id).Refused++
+}
+
+// ServiceStats returns the statistics about the client requests of all
+// services that received at least one request, indexed by the name of the
+// service.
+func (c *Conode) ServiceStats() map[string]ServiceStats {
+	ss := c.serviceManager.stats
+	ss.Lock()
+	defer ss.Unlock()
+	m := make(map[string]ServiceStats)
+	for id, st := range ss.stats {
+		m[ServiceFactory.Name(id)] = *st
+	}
+	return m
+}
+
+// ServiceMetrics returns the metrics of all services implementing
+// MetricsReporter, indexed by the name of the service.
+func (c *Conode) ServiceMetrics() map[string]map[string]float64 {
+	m := make(map[string]map[string]float64)
+	for id, s := range c.serviceManager.services {
+		if mr, ok := s.(MetricsReporter); ok {
+			m[ServiceFactory.Name(id)] = mr.Metrics()
+		}
+	}
+	return m
+}
+
+// ProtocolInstances returns the number of TreeNodeInstances currently
+// running on this conode.
+func (c *Conode) ProtocolInstances() int {
+	c.overlay.instancesLock.Lock()
+	defer c.overlay.instancesLock.Unlock()
+	return len(c.overlay.instances)
+}
@@ -2,6 +2,7 @@ package sda
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dedis/cothority/log"
 	"github.com/dedis/cothority/network"
@@ -12,6 +13,8 @@ func init() {
 	GlobalProtocolRegister("ProtocolHandlers", NewProtocolHandlers)
 	GlobalProtocolRegister("ProtocolBlocking", NewProtocolBlocking)
 	GlobalProtocolRegister("ProtocolChannels", NewProtocolChannels)
+	GlobalProtocolRegister("ProtocolAggTimeout", NewProtocolAggTimeout)
+	GlobalProtocolRegister("ProtocolAggTimeoutChannel", NewProtocolAggTimeoutChannel)
 	GlobalProtocolRegister(testProto, NewProtocolTest)
 	Incoming = make(chan struct {
 		*TreeNode
@@ -205,6 +208,90 @@ func TestTreeNodeMsgAggregation(t *testing.T) {
 
 }
 
+func TestTreeNodeAggregationTimeout(t *testing.T) {
+	local := NewLocalTest()
+	_, _, tree := local.GenTree(3, true)
+	defer local.CloseAll()
+	IncomingHandlers = make(chan *TreeNodeInstance, 2)
+	p, err := local.CreateProtocol("ProtocolAggTimeout", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := p.(*ProtocolAggTimeout)
+	go root.Start()
+	child1 := <-IncomingHandlers
+	child2 := <-IncomingHandlers
+
+	child1.SendTo(root.TreeNode(), &NodeTestAggMsg{1})
+	var partial aggTimeoutResult
+	select {
+	case partial = <-root.incoming:
+	case <-time.After(time.Second):
+		t.Fatal("Aggregation didn't time out")
+	}
+	if len(partial.msgs) != 1 || partial.msgs[0].I != 1 {
+		t.Fatal("Should have the message of child 1")
+	}
+	if len(partial.missing) != 1 ||
+		partial.missing[0].ServerIdentity.ID != child2.ServerIdentity().ID {
+		t.Fatal("Child 2 should be missing")
+	}
+
+	// the late reply is dropped, but not the reply to the next message
+	child2.SendTo(root.TreeNode(), &NodeTestAggMsg{2})
+	go root.Start()
+	<-IncomingHandlers
+	<-IncomingHandlers
+	child2.SendTo(root.TreeNode(), &NodeTestAggMsg{3})
+	child1.SendTo(root.TreeNode(), &NodeTestAggMsg{4})
+	select {
+	case full := <-root.incoming:
+		if len(full.msgs) != 2 || len(full.missing) != 0 {
+			t.Fatal("Should have all messages:", full)
+		}
+		if full.msgs[0].I+full.msgs[1].I != 7 {
+			t.Fatal("Wrong messages:", full)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Aggregation didn't finish")
+	}
+}
+
+func TestTreeNodeAggregationTimeoutChannel(t *testing.T) {
+	local := NewLocalTest()
+	_, _, tree := local.GenTree(3, true)
+	defer local.CloseAll()
+	IncomingHandlers = make(chan *TreeNodeInstance, 2)
+	p, err := local.CreateProtocol("ProtocolAggTimeoutChannel", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := p.(*ProtocolAggTimeoutChannel)
+	go root.Start()
+	child1 := <-IncomingHandlers
+	child2 := <-IncomingHandlers
+
+	child1.SendTo(root.TreeNode(), &NodeTestAggMsg{1})
+	select {
+	case msgs := <-root.aggregated:
+		if len(msgs) != 1 || msgs[0].I != 1 {
+			t.Fatal("Should have the message of child 1")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Aggregation didn't time out")
+	}
+	// the missing children are already there
+	select {
+	case missing := <-root.missing:
+		if len(missing) != 1 ||
+			missing[0].ServerIdentity.ID != child2.ServerIdentity().ID {
+			t.Fatal("Child 2 should be missing")
+		}
+	default:
+		t.Fatal("Missing children should be sent before the messages")
+	}
+}
+
 func TestTreeNodeFlags(t *testing.T) {
 	testType := network.PacketTypeID(uuid.Nil)
 	local := NewLocalTest()
@@ -355,6 +442,99 @@ func (p *ProtocolHandlers) Release() {
 	p.Done()
 }
 
+type ProtocolAggTimeout struct {
+	*TreeNodeInstance
+	incoming chan aggTimeoutResult
+}
+
+type aggTimeoutResult struct {
+	msgs    []NodeTestAggMsg
+	missing []*TreeNode
+}
+
+func NewProtocolAggTimeout(n *TreeNodeInstance) (ProtocolInstance, error) {
+	p := &ProtocolAggTimeout{
+		TreeNodeInstance: n,
+		incoming:         make(chan aggTimeoutResult, 2),
+	}
+	p.RegisterHandler(p.HandleMessageOne)
+	p.RegisterHandler(p.HandleMessageAggregate)
+	p.SetAggregationTimeout(network.TypeFromData(NodeTestAggMsg{}),
+		100*time.Millisecond)
+	return p, nil
+}
+
+func (p *ProtocolAggTimeout) Start() error {
+	for _, c := range p.Children() {
+		if err := p.SendTo(c, &NodeTestMsg{12}); err != nil {
+			log.Error("Error sending to ", c.Name(), ":", err)
+		}
+	}
+	return nil
+}
+
+func (p *ProtocolAggTimeout) HandleMessageOne(msg struct {
+	*TreeNode
+	NodeTestMsg
+}) {
+	IncomingHandlers <- p.TreeNodeInstance
+}
+
+func (p *ProtocolAggTimeout) HandleMessageAggregate(msg []struct {
+	*TreeNode
+	NodeTestAggMsg
+}, missing []*TreeNode) {
+	r := aggTimeoutResult{missing: missing}
+	for _, m := range msg {
+		r.msgs = append(r.msgs, m.NodeTestAggMsg)
+	}
+	p.incoming <- r
+}
+
+type ProtocolAggTimeoutChannel struct {
+	*TreeNodeInstance
+	aggregated chan []struct {
+		*TreeNode
+		NodeTestAggMsg
+	}
+	missing chan []*TreeNode
+}
+
+func NewProtocolAggTimeoutChannel(n *TreeNodeInstance) (ProtocolInstance, error) {
+	p := &ProtocolAggTimeoutChannel{
+		TreeNodeInstance: n,
+		missing:          make(chan []*TreeNode, 1),
+	}
+	p.RegisterHandler(p.HandleMessageOne)
+	if err := p.RegisterChannel(&p.aggregated); err != nil {
+		return nil, err
+	}
+	mt := network.TypeFromData(NodeTestAggMsg{})
+	p.SetAggregationTimeout(mt, 100*time.Millisecond)
+	p.SetMissingChannel(mt, p.missing)
+	return p, nil
+}
+
+func (p *ProtocolAggTimeoutChannel) Start() error {
+	for _, c := range p.Children() {
+		if err := p.SendTo(c, &NodeTestMsg{12}); err != nil {
+			log.Error("Error sending to ", c.Name(), ":", err)
+		}
+	}
+	return nil
+}
+
+func (p *ProtocolAggTimeoutChannel) HandleMessageOne(msg struct {
+	*TreeNode
+	NodeTestMsg
+}) {
+	IncomingHandlers <- p.TreeNodeInstance
+}
+
+func (p *ProtocolAggTimeout) Release() {
+	p.Done()
+}
+
 func TestNodeBlocking(t *testing.T) {
 	l := NewLocalTest()
 	_, _, tree := l.GenTree(2, true)
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dedis/cothority/log"
 	"github.com/dedis/cothority/network"
@@ -16,35 +18,71 @@ import (
 type Overlay struct {
 	conode *Conode
 	// mapping from Tree.Id to Tree
-	trees    map[TreeID]*Tree
+	trees map[TreeID]*Tree
+	// mapping from the ID of a repaired tree to the ID of its next version
+	repaired map[TreeID]TreeID
 	treesMut sync.Mutex
 	// mapping from Roster.id to Roster
-	entityLists    map[RosterID]*Roster
+	entityLists map[RosterID]*Roster
+	// mapping from the legacy Roster.id of a stored Roster to the id derived
+	// from its list
+	legacyRosters  map[RosterID]RosterID
 	entityListLock sync.Mutex
+	// how trees and rosters are used, to collect them once they're not
+	// needed anymore
+	treeUsage   map[TreeID]*usage
+	rosterUsage map[RosterID]*usage
+	usageLock   sync.Mutex
+	// quit stops the garbage collection
+	quit   chan struct{}
+	closed bool
 	// cache for relating token(~Node) to TreeNode
 	cache *TreeNodeCache
 
 	// TreeNodeInstance part
-	instances         map[TokenID]*TreeNodeInstance
-	instancesInfo     map[TokenID]bool
+	instances map[TokenID]*TreeNodeInstance
+	// instancesInfo holds when the finished instances have been deleted
+	instancesInfo     map[TokenID]time.Time
 	instancesLock     sync.Mutex
 	protocolInstances map[TokenID]ProtocolInstance
 
 	// treeMarshal that needs to be converted to Tree but host does not have the
 	// entityList associated yet.
 	// map from Roster.ID => trees that use this entity list
-	pendingTreeMarshal map[RosterID][]*TreeMarshal
+	pendingTreeMarshal map[RosterID][]*pendingTree
 	// lock associated with pending TreeMarshal
 	pendingTreeLock sync.Mutex
 
 	// pendingSDAData are a list of message we received that does not correspond
 	// to any local Tree or/and Roster. We first request theses so we can
 	// instantiate properly protocolInstance that will use these SDAData msg.
-	pendingSDAs []*ProtocolMsg
+	pendingSDAs []*pendingMsg
 	// lock associated with pending SDAdata
 	pendingSDAsLock sync.Mutex
 
+	// pendingRepairs are the repairs of trees we don't have yet. They are
+	// applied once the tree is registered.
+	pendingRepairs     []*pendingRepair
+	pendingRepairsLock sync.Mutex
+
 	transmitMux sync.Mutex
+
+	// records the delivered messages if not nil
+	tracer     *tracer
+	tracerLock sync.Mutex
+
+	// strategies of a faulty conode, for tests
+	byzantine     []byzantineRule
+	byzantineLock sync.Mutex
+
+	// trees and rosters we requested from other conodes - only those are
+	// accepted
+	requestedTrees   map[TreeID]time.Time
+	requestedRosters map[RosterID]time.Time
+	requestedLock    sync.Mutex
+
+	// dropped counts the dropped messages, it is updated atomically
+	dropped DropStats
 }
 
 // NewOverlay creates a new overlay-structure
@@ -52,13 +90,20 @@ func NewOverlay(c *Conode) *Overlay {
 	o := &Overlay{
 		conode:             c,
 		trees:              make(map[TreeID]*Tree),
+		repaired:           make(map[TreeID]TreeID),
 		entityLists:        make(map[RosterID]*Roster),
+		legacyRosters:      make(map[RosterID]RosterID),
+		treeUsage:          make(map[TreeID]*usage),
+		rosterUsage:        make(map[RosterID]*usage),
+		quit:               make(chan struct{}),
 		cache:              NewTreeNodeCache(),
 		instances:          make(map[TokenID]*TreeNodeInstance),
-		instancesInfo:      make(map[TokenID]bool),
+		instancesInfo:      make(map[TokenID]time.Time),
 		protocolInstances:  make(map[TokenID]ProtocolInstance),
-		pendingTreeMarshal: make(map[RosterID][]*TreeMarshal),
-		pendingSDAs:        make([]*ProtocolMsg, 0),
+		pendingTreeMarshal: make(map[RosterID][]*pendingTree),
+		pendingSDAs:        make([]*pendingMsg, 0),
+		requestedTrees:     make(map[TreeID]time.Time),
+		requestedRosters:   make(map[RosterID]time.Time),
 	}
 	// messages going to protocol instances
 	c.RegisterProcessor(o,
@@ -66,7 +111,9 @@ func NewOverlay(c *Conode) *Overlay {
 		RequestTreeMessageID,   // request a tree
 		SendTreeMessageID,      // send a tree back to a request
 		RequestRosterMessageID, // request a roster
-		SendRosterMessageID)    // send a roster back to request
+		SendRosterMessageID,    // send a roster back to request
+		TreeRepairMessageID)    // a tree has been repaired
+	go o.gcLoop()
 	return o
 }
 
@@ -86,6 +133,11 @@ func (o *Overlay) Process(data *network.Packet) {
 		// A host has sent us a request to get a tree definition
 		tid := data.Msg.(RequestTree).TreeID
 		tree := o.Tree(tid)
+		if tree != nil && !o.isMember(tree.Roster, data.ServerIdentity) {
+			log.Lvl2(o.conode.Address(), "refusing tree to non-member",
+				data.ServerIdentity.Address)
+			tree = nil
+		}
 		var err error
 		if tree != nil {
 			err = o.conode.Send(data.ServerIdentity, tree.MakeTreeMarshal())
@@ -105,11 +157,26 @@ func (o *Overlay) Process(data *network.Packet) {
 			log.Error("Received an empty Tree")
 			return
 		}
+		if o.Tree(tm.TreeID) != nil {
+			log.Lvl3("Received an already known Tree")
+			return
+		}
+		if !o.treeRequested(tm.TreeID) {
+			log.Lvl2(o.conode.Address(), "dropping unsolicited tree from",
+				data.ServerIdentity.Address)
+			atomic.AddUint64(&o.dropped.Unsolicited, 1)
+			return
+		}
+		if !tm.VerifyID() {
+			log.Lvl2(o.conode.Address(), "dropping tree with invalid ID from",
+				data.ServerIdentity.Address)
+			atomic.AddUint64(&o.dropped.InvalidID, 1)
+			return
+		}
 		il := o.Roster(tm.RosterID)
 		// The entity list does not exists, we should request that, too
 		if il == nil {
-			msg := &RequestRoster{tm.RosterID}
-			if err := o.conode.Send(data.ServerIdentity, msg); err != nil {
+			if err := o.sendRequestRoster(data.ServerIdentity, tm.RosterID); err != nil {
 				log.Error("Requesting Roster in SendTree failed", err)
 			}
 
@@ -124,12 +191,20 @@ func (o *Overlay) Process(data *network.Packet) {
 			log.Error("Couldn't create tree:", err)
 			return
 		}
+		if !o.acceptTree(tree) {
+			return
+		}
 		log.Lvl4("Received new tree")
 		o.RegisterTree(tree)
 	case RequestRosterMessageID:
 		// Some host requested an Roster
 		id := data.Msg.(RequestRoster).RosterID
 		el := o.Roster(id)
+		if el != nil && !o.isMember(el, data.ServerIdentity) {
+			log.Lvl2(o.conode.Address(), "refusing roster to non-member",
+				data.ServerIdentity.Address)
+			el = nil
+		}
 		var err error
 		if el != nil {
 			err = o.conode.Send(data.ServerIdentity, el)
@@ -146,14 +221,35 @@ func (o *Overlay) Process(data *network.Packet) {
 	case SendRosterMessageID:
 		// Host replied to our request of entitylist
 		il := data.Msg.(Roster)
-		if il.ID == RosterID(uuid.Nil) {
+		switch {
+		case il.ID == RosterID(uuid.Nil):
 			log.Lvl2("Received an empty Roster")
-		} else {
+		case o.Roster(il.ID) != nil:
+			log.Lvl3("Received an already known Roster")
+		case !o.rosterRequested(il.ID):
+			log.Lvl2(o.conode.Address(), "dropping unsolicited roster from",
+				data.ServerIdentity.Address)
+			atomic.AddUint64(&o.dropped.Unsolicited, 1)
+		case !il.VerifyID() && !o.isLegacyRoster(&il):
+			log.Lvl2(o.conode.Address(), "dropping roster with invalid ID from",
+				data.ServerIdentity.Address)
+			atomic.AddUint64(&o.dropped.InvalidID, 1)
+		case !il.verifyEntries():
+			log.Lvl2(o.conode.Address(), "dropping roster with invalid entries from",
+				data.ServerIdentity.Address)
+			atomic.AddUint64(&o.dropped.InvalidID, 1)
+		default:
+			// the aggregate key is not covered by the ID
+			il.Aggregate = aggregate(il.List)
 			o.RegisterRoster(&il)
 			// Check if some trees can be constructed from this entitylist
 			o.checkPendingTreeMarshal(&il)
+			log.Lvl4("Received new entityList")
 		}
-		log.Lvl4("Received new entityList")
+	case TreeRepairMessageID:
+		// The parent of a dead node repaired a tree
+		tr := data.Msg.(TreeRepair)
+		o.handleTreeRepair(data.ServerIdentity, &tr)
 	}
 }
 
@@ -174,7 +270,7 @@ func (o *Overlay) TransmitMsg(sdaMsg *ProtocolMsg) error {
 	var pi ProtocolInstance
 	o.instancesLock.Lock()
 	pi, ok := o.protocolInstances[sdaMsg.To.ID()]
-	done := o.instancesInfo[sdaMsg.To.ID()]
+	_, done := o.instancesInfo[sdaMsg.To.ID()]
 	o.instancesLock.Unlock()
 	if done {
 		log.Error("Message for TreeNodeInstance that is already finished")
@@ -187,7 +283,11 @@ func (o *Overlay) TransmitMsg(sdaMsg *ProtocolMsg) error {
 		if err != nil {
 			return errors.New("No TreeNode defined in this tree here")
 		}
-		tni := o.newTreeNodeInstanceFromToken(tn, sdaMsg.To)
+		if !tn.ServerIdentity.ID.Equal(o.conode.ServerIdentity.ID) {
+			atomic.AddUint64(&o.dropped.NotMember, 1)
+			return errors.New("Refusing to instantiate a TreeNode of another conode")
+		}
+		tni := o.newTreeNodeInstanceFromToken(tree, tn, sdaMsg.To)
 		// see if we know the Service Recipient
 		s, ok := o.conode.serviceManager.serviceByID(sdaMsg.To.ServiceID)
 
@@ -245,17 +345,36 @@ func (o *Overlay) sendSDAData(si *network.ServerIdentity, sdaMsg *ProtocolMsg) e
 // addPendingTreeMarshal adds a treeMarshal to the list.
 // This list is checked each time we receive a new Roster
 // so trees using this Roster can be constructed.
+// Trees waiting longer than PendingTimeout are removed, and the treeMarshal
+// is dropped if MaxPendingTrees are already waiting.
 func (o *Overlay) addPendingTreeMarshal(tm *TreeMarshal) {
 	o.pendingTreeLock.Lock()
-	var sl []*TreeMarshal
-	var ok bool
-	// initiate the slice before adding
-	if sl, ok = o.pendingTreeMarshal[tm.RosterID]; !ok {
-		sl = make([]*TreeMarshal, 0)
+	defer o.pendingTreeLock.Unlock()
+	total := 0
+	for id, sl := range o.pendingTreeMarshal {
+		var kept []*pendingTree
+		for _, pt := range sl {
+			if expired(pt.added) {
+				atomic.AddUint64(&o.dropped.Expired, 1)
+				continue
+			}
+			kept = append(kept, pt)
+		}
+		if len(kept) == 0 {
+			delete(o.pendingTreeMarshal, id)
+			continue
+		}
+		o.pendingTreeMarshal[id] = kept
+		total += len(kept)
 	}
-	sl = append(sl, tm)
-	o.pendingTreeMarshal[tm.RosterID] = sl
-	o.pendingTreeLock.Unlock()
+	if total >= MaxPendingTrees {
+		log.Lvl2(o.conode.Address(), "too many pending trees - dropping",
+			tm.TreeID)
+		atomic.AddUint64(&o.dropped.PendingTrees, 1)
+		return
+	}
+	o.pendingTreeMarshal[tm.RosterID] = append(o.pendingTreeMarshal[tm.RosterID],
+		&pendingTree{tm, time.Now()})
 }
 
 // checkPendingMessages is called each time we receive a new tree if there are some SDA
@@ -267,17 +386,19 @@ func (o *Overlay) addPendingTreeMarshal(tm *TreeMarshal) {
 func (o *Overlay) checkPendingMessages(t *Tree) {
 	go func() {
 		o.pendingSDAsLock.Lock()
-		var newPending []*ProtocolMsg
-		for _, msg := range o.pendingSDAs {
-			if t.ID.Equals(msg.To.TreeID) {
+		var newPending []*pendingMsg
+		for _, pm := range o.pendingSDAs {
+			if t.ID.Equals(pm.msg.To.TreeID) {
 				// if this message references t, instantiate it and go
-				err := o.TransmitMsg(msg)
+				err := o.TransmitMsg(pm.msg)
 				if err != nil {
 					log.Error("TransmitMsg failed:", err)
 					continue
 				}
+			} else if expired(pm.added) {
+				atomic.AddUint64(&o.dropped.Expired, 1)
 			} else {
-				newPending = append(newPending, msg)
+				newPending = append(newPending, pm)
 			}
 		}
 		o.pendingSDAs = newPending
@@ -291,33 +412,128 @@ func (o *Overlay) checkPendingMessages(t *Tree) {
 func (o *Overlay) checkPendingTreeMarshal(el *Roster) {
 	o.pendingTreeLock.Lock()
 	sl, ok := o.pendingTreeMarshal[el.ID]
+	delete(o.pendingTreeMarshal, el.ID)
+	o.pendingTreeLock.Unlock()
 	if !ok {
 		// no tree for this entitty list
 		return
 	}
-	for _, tm := range sl {
-		tree, err := tm.MakeTree(el)
+	for _, pt := range sl {
+		if expired(pt.added) {
+			atomic.AddUint64(&o.dropped.Expired, 1)
+			continue
+		}
+		tree, err := pt.tm.MakeTree(el)
 		if err != nil {
 			log.Error("Tree from Roster failed")
 			continue
 		}
+		if !o.acceptTree(tree) {
+			continue
+		}
 		// add the tree into our "database"
 		o.RegisterTree(tree)
 	}
-	o.pendingTreeLock.Unlock()
 }
 
 // requestTree will ask for the tree the sdadata is related to.
 // it will put the message inside the pending list of sda message waiting to
-// have their trees.
+// have their trees. Messages waiting longer than PendingTimeout are removed,
+// and the message is dropped if MaxPendingMessages are already waiting.
 func (o *Overlay) requestTree(si *network.ServerIdentity, sdaMsg *ProtocolMsg) error {
 	o.pendingSDAsLock.Lock()
-	o.pendingSDAs = append(o.pendingSDAs, sdaMsg)
+	var kept []*pendingMsg
+	for _, pm := range o.pendingSDAs {
+		if expired(pm.added) {
+			atomic.AddUint64(&o.dropped.Expired, 1)
+			continue
+		}
+		kept = append(kept, pm)
+	}
+	o.pendingSDAs = kept
+	if len(o.pendingSDAs) >= MaxPendingMessages {
+		o.pendingSDAsLock.Unlock()
+		atomic.AddUint64(&o.dropped.PendingMessages, 1)
+		return errors.New("Too many messages waiting for their tree - dropping")
+	}
+	o.pendingSDAs = append(o.pendingSDAs, &pendingMsg{sdaMsg, time.Now()})
 	o.pendingSDAsLock.Unlock()
 
-	treeRequest := &RequestTree{sdaMsg.To.TreeID}
+	return o.sendRequestTree(si, sdaMsg.To.TreeID)
+}
+
+// sendRequestTree asks si for the Tree and remembers the request, so that
+// the answer is accepted.
+func (o *Overlay) sendRequestTree(si *network.ServerIdentity, id TreeID) error {
+	o.requestedLock.Lock()
+	o.forgetExpiredRequests()
+	o.requestedTrees[id] = time.Now()
+	o.requestedLock.Unlock()
+	return o.conode.Send(si, &RequestTree{id})
+}
 
-	return o.conode.Send(si, treeRequest)
+// sendRequestRoster asks si for the Roster and remembers the request, so
+// that the answer is accepted.
+func (o *Overlay) sendRequestRoster(si *network.ServerIdentity, id RosterID) error {
+	o.requestedLock.Lock()
+	o.forgetExpiredRequests()
+	o.requestedRosters[id] = time.Now()
+	o.requestedLock.Unlock()
+	return o.conode.Send(si, &RequestRoster{id})
+}
+
+// forgetExpiredRequests removes the requests that have not been answered
+// within PendingTimeout. requestedLock must be held.
+func (o *Overlay) forgetExpiredRequests() {
+	for id, added := range o.requestedTrees {
+		if expired(added) {
+			delete(o.requestedTrees, id)
+		}
+	}
+	for id, added := range o.requestedRosters {
+		if expired(added) {
+			delete(o.requestedRosters, id)
+		}
+	}
+}
+
+// treeRequested returns true if the tree has been requested and the request
+// didn't expire yet.
+func (o *Overlay) treeRequested(id TreeID) bool {
+	o.requestedLock.Lock()
+	defer o.requestedLock.Unlock()
+	added, ok := o.requestedTrees[id]
+	return ok && !expired(added)
+}
+
+// rosterRequested returns true if the roster has been requested and the
+// request didn't expire yet.
+func (o *Overlay) rosterRequested(id RosterID) bool {
+	o.requestedLock.Lock()
+	defer o.requestedLock.Unlock()
+	added, ok := o.requestedRosters[id]
+	return ok && !expired(added)
+}
+
+// isMember returns true if si is part of the roster.
+func (o *Overlay) isMember(el *Roster, si *network.ServerIdentity) bool {
+	if _, e := el.Search(si.ID); e != nil {
+		return true
+	}
+	atomic.AddUint64(&o.dropped.NotMember, 1)
+	return false
+}
+
+// acceptTree returns true if the received tree includes this conode.
+func (o *Overlay) acceptTree(t *Tree) bool {
+	for _, tn := range t.List() {
+		if tn.ServerIdentity.ID.Equal(o.conode.ServerIdentity.ID) {
+			return true
+		}
+	}
+	log.Lvl2(o.conode.Address(), "dropping tree", t.ID, "not including us")
+	atomic.AddUint64(&o.dropped.NotMember, 1)
+	return false
 }
 
 // RegisterTree takes a tree and puts it in the map
@@ -325,14 +541,27 @@ func (o *Overlay) RegisterTree(t *Tree) {
 	o.treesMut.Lock()
 	o.trees[t.ID] = t
 	o.treesMut.Unlock()
+	o.usageLock.Lock()
+	o.touchTree(t.ID)
+	o.usageLock.Unlock()
+	o.requestedLock.Lock()
+	delete(o.requestedTrees, t.ID)
+	o.requestedLock.Unlock()
+	// repair the tree before the pending messages create instances with it
+	o.checkPendingRepairs(t)
 	o.checkPendingMessages(t)
 }
 
-// TreeFromToken searches for the tree corresponding to a token.
+// TreeFromToken searches for the tree corresponding to a token. If the tree
+// has been repaired, the latest version is returned.
 func (o *Overlay) TreeFromToken(tok *Token) *Tree {
 	o.treesMut.Lock()
 	defer o.treesMut.Unlock()
-	return o.trees[tok.TreeID]
+	id := tok.TreeID
+	for next, ok := o.repaired[id]; ok; next, ok = o.repaired[id] {
+		id = next
+	}
+	return o.trees[id]
 }
 
 // Tree returns the tree given by treeId or nil if not found
@@ -345,8 +574,47 @@ func (o *Overlay) Tree(tid TreeID) *Tree {
 // RegisterRoster puts an entityList in the map
 func (o *Overlay) RegisterRoster(el *Roster) {
 	o.entityListLock.Lock()
-	defer o.entityListLock.Unlock()
 	o.entityLists[el.ID] = el
+	o.entityListLock.Unlock()
+	o.usageLock.Lock()
+	o.touchRoster(el.ID)
+	o.usageLock.Unlock()
+	o.requestedLock.Lock()
+	delete(o.requestedRosters, el.ID)
+	o.requestedLock.Unlock()
+}
+
+// knownMember returns true if si is a member of a Roster known to the
+// overlay.
+func (o *Overlay) knownMember(si *network.ServerIdentity) bool {
+	o.entityListLock.Lock()
+	defer o.entityListLock.Unlock()
+	for _, el := range o.entityLists {
+		if _, m := el.Search(si.ID); m != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterLegacyRoster accepts el from other conodes even though its ID is
+// not derived from its list, as for the Rosters stored by older versions
+// with a random ID. Only the exact same list is accepted under that ID.
+func (o *Overlay) RegisterLegacyRoster(el *Roster) {
+	if el.VerifyID() {
+		return
+	}
+	o.entityListLock.Lock()
+	defer o.entityListLock.Unlock()
+	o.legacyRosters[el.ID] = rosterID(el.List)
+}
+
+// isLegacyRoster returns true if el has been registered as a legacy Roster.
+func (o *Overlay) isLegacyRoster(el *Roster) bool {
+	o.entityListLock.Lock()
+	defer o.entityListLock.Unlock()
+	id, ok := o.legacyRosters[el.ID]
+	return ok && id == rosterID(el.List)
 }
 
 // RosterFromToken returns the entitylist corresponding to a token
@@ -371,7 +639,7 @@ func (o *Overlay) TreeNodeFromToken(t *Token) (*TreeNode, error) {
 		return tn, nil
 	}
 	// If cache has not, then search the tree
-	tree := o.Tree(t.TreeID)
+	tree := o.TreeFromToken(t)
 	if tree == nil {
 		return nil, errors.New("didn't find tree")
 	}
@@ -386,12 +654,24 @@ func (o *Overlay) TreeNodeFromToken(t *Token) (*TreeNode, error) {
 
 // SendToTreeNode sends a message to a treeNode
 func (o *Overlay) SendToTreeNode(from *Token, to *TreeNode, msg network.Body) error {
+	return o.sendToTreeNode(from, to, msg, 0)
+}
+
+// sendToTreeNode sends a message to a treeNode, telling it how many messages
+// have been received from it.
+func (o *Overlay) sendToTreeNode(from *Token, to *TreeNode, msg network.Body, received int) error {
 	sda := &ProtocolMsg{
-		Msg:  msg,
-		From: from,
-		To:   from.ChangeTreeNodeID(to.ID),
+		Msg:      msg,
+		From:     from,
+		To:       from.ChangeTreeNodeID(to.ID),
+		Received: received,
 	}
 	log.Lvl4(o.conode.Address(), "Sending to entity", to.ServerIdentity.Address)
+	if s := o.byzantineStrategy(msg); s != nil {
+		return s(sda, func(m *ProtocolMsg) error {
+			return o.sendSDAData(to.ServerIdentity, m)
+		})
+	}
 	return o.sendSDAData(to.ServerIdentity, sda)
 }
 
@@ -417,8 +697,10 @@ func (o *Overlay) nodeDelete(tok *Token) {
 		log.Error("Error while closing node:", err)
 	}
 	delete(o.instances, tok.ID())
+	delete(o.protocolInstances, tok.ID())
 	// mark it done !
-	o.instancesInfo[tok.ID()] = true
+	o.instancesInfo[tok.ID()] = time.Now()
+	o.releaseTree(tok)
 }
 
 func (o *Overlay) suite() abstract.Suite {
@@ -429,10 +711,17 @@ func (o *Overlay) suite() abstract.Suite {
 func (o *Overlay) Close() {
 	o.instancesLock.Lock()
 	defer o.instancesLock.Unlock()
+	if !o.closed {
+		close(o.quit)
+		o.closed = true
+	}
 	for _, tni := range o.instances {
 		log.Lvl4(o.conode.Address(), "Closing TNI", tni.TokenID())
 		o.nodeDelete(tni.Token())
 	}
+	if err := o.stopTrace(); err != nil {
+		log.Error("Couldn't close trace:", err)
+	}
 }
 
 // CreateProtocolSDA returns a fresh Protocol Instance with an attached
@@ -488,7 +777,7 @@ func (o *Overlay) NewTreeNodeInstanceFromProtocol(t *Tree, tn *TreeNode, protoID
 		ProtoID:    protoID,
 		RoundID:    RoundID(uuid.NewV4()),
 	}
-	tni := o.newTreeNodeInstanceFromToken(tn, tok)
+	tni := o.newTreeNodeInstanceFromToken(t, tn, tok)
 	o.RegisterTree(t)
 	o.RegisterRoster(t.Roster)
 	return tni
@@ -505,7 +794,7 @@ func (o *Overlay) NewTreeNodeInstanceFromService(t *Tree, tn *TreeNode, protoID
 		ServiceID:  servID,
 		RoundID:    RoundID(uuid.NewV4()),
 	}
-	tni := o.newTreeNodeInstanceFromToken(tn, tok)
+	tni := o.newTreeNodeInstanceFromToken(t, tn, tok)
 	o.RegisterTree(t)
 	o.RegisterRoster(t.Roster)
 	return tni
@@ -519,8 +808,9 @@ func (o *Overlay) ServerIdentity() *network.ServerIdentity {
 // newTreeNodeInstanceFromToken is to be called by the Overlay when it receives
 // a message it does not have a treenodeinstance registered yet. The protocol is
 // already running so we should *not* generate a new RoundID.
-func (o *Overlay) newTreeNodeInstanceFromToken(tn *TreeNode, tok *Token) *TreeNodeInstance {
+func (o *Overlay) newTreeNodeInstanceFromToken(t *Tree, tn *TreeNode, tok *Token) *TreeNodeInstance {
 	tni := newTreeNodeInstance(o, tok, tn)
+	o.useTree(t)
 	o.instancesLock.Lock()
 	defer o.instancesLock.Unlock()
 	o.instances[tok.ID()] = tni
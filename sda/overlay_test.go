@@ -2,6 +2,7 @@ package sda
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dedis/cothority/network"
 	"github.com/satori/go.uuid"
@@ -86,6 +87,228 @@ func TestOverlayPendingTreeMarshal(t *testing.T) {
 	}
 }
 
+func TestOverlayPendingTreeMarshalLimit(t *testing.T) {
+	defer func(max int, timeout time.Duration) {
+		MaxPendingTrees = max
+		PendingTimeout = timeout
+	}(MaxPendingTrees, PendingTimeout)
+	MaxPendingTrees = 1
+	local := NewLocalTest()
+	hosts, el, tree := local.GenTree(2, false)
+	defer local.CloseAll()
+	h1 := hosts[0]
+
+	// the second tree doesn't fit
+	local.AddPendingTreeMarshal(h1, tree.MakeTreeMarshal())
+	tm := tree.MakeTreeMarshal()
+	tm.TreeID = TreeID(uuid.NewV4())
+	local.AddPendingTreeMarshal(h1, tm)
+	assert.Equal(t, uint64(1), h1.DropStats().PendingTrees)
+
+	// the first tree expires and makes room for the second one
+	PendingTimeout = 0
+	local.AddPendingTreeMarshal(h1, tm)
+	assert.Equal(t, uint64(1), h1.DropStats().Expired)
+	PendingTimeout = time.Minute
+	local.CheckPendingTreeMarshal(h1, el)
+	_, ok := h1.GetTree(tree.ID)
+	assert.False(t, ok)
+	_, ok = h1.GetTree(tm.TreeID)
+	assert.True(t, ok)
+}
+
+func TestOverlayPendingMessagesLimit(t *testing.T) {
+	defer func(max int, timeout time.Duration) {
+		MaxPendingMessages = max
+		PendingTimeout = timeout
+	}(MaxPendingMessages, PendingTimeout)
+	MaxPendingMessages = 1
+	local := NewLocalTest()
+	hosts, _, _ := local.GenTree(2, false)
+	defer local.CloseAll()
+	h1, h2 := hosts[0], hosts[1]
+
+	msg := &ProtocolMsg{To: &Token{TreeID: TreeID(uuid.NewV4())}}
+	require.Nil(t, h1.overlay.requestTree(h2.ServerIdentity, msg))
+	require.NotNil(t, h1.overlay.requestTree(h2.ServerIdentity, msg))
+	assert.Equal(t, uint64(1), h1.DropStats().PendingMessages)
+
+	// the pending message expires and makes room for the new one
+	PendingTimeout = 0
+	require.Nil(t, h1.overlay.requestTree(h2.ServerIdentity, msg))
+	assert.Equal(t, uint64(1), h1.DropStats().Expired)
+	assert.Equal(t, 1, len(h1.overlay.pendingSDAs))
+}
+
+func TestOverlayUnsolicited(t *testing.T) {
+	local := NewLocalTest()
+	hosts, el, tree := local.GenTree(2, false)
+	defer local.CloseAll()
+	h1, h2 := hosts[0], hosts[1]
+	process := func(msg network.Body, typ network.PacketTypeID) {
+		h1.overlay.Process(&network.Packet{
+			ServerIdentity: h2.ServerIdentity,
+			Msg:            msg,
+			MsgType:        typ,
+		})
+	}
+
+	// neither the roster nor the tree have been requested
+	process(*el, SendRosterMessageID)
+	process(*tree.MakeTreeMarshal(), SendTreeMessageID)
+	_, ok := h1.Roster(el.ID)
+	assert.False(t, ok)
+	_, ok = h1.GetTree(tree.ID)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(2), h1.DropStats().Unsolicited)
+
+	// the content must match the requested IDs
+	require.Nil(t, h1.overlay.sendRequestRoster(h2.ServerIdentity, el.ID))
+	forged := *el
+	forged.List = el.List[:1]
+	process(forged, SendRosterMessageID)
+	_, ok = h1.Roster(el.ID)
+	assert.False(t, ok)
+	process(*el, SendRosterMessageID)
+	_, ok = h1.Roster(el.ID)
+	assert.True(t, ok)
+
+	require.Nil(t, h1.overlay.sendRequestTree(h2.ServerIdentity, tree.ID))
+	tm := tree.MakeTreeMarshal()
+	tm.Children[0].Children = nil
+	process(*tm, SendTreeMessageID)
+	_, ok = h1.GetTree(tree.ID)
+	assert.False(t, ok)
+	process(*tree.MakeTreeMarshal(), SendTreeMessageID)
+	_, ok = h1.GetTree(tree.ID)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), h1.DropStats().InvalidID)
+}
+
+func TestOverlayLegacyRoster(t *testing.T) {
+	local := NewLocalTest()
+	hosts, el, _ := local.GenTree(3, false)
+	defer local.CloseAll()
+	h1, h2 := hosts[0], hosts[1]
+	process := func(msg network.Body) {
+		h1.overlay.Process(&network.Packet{
+			ServerIdentity: h2.ServerIdentity,
+			Msg:            msg,
+			MsgType:        SendRosterMessageID,
+		})
+	}
+
+	// a roster stored by an older version has a random ID
+	legacy := NewRoster(el.List)
+	legacy.ID = RosterID(uuid.NewV4())
+	b, err := network.MarshalRegisteredType(legacy)
+	require.Nil(t, err)
+	_, msg, err := network.UnmarshalRegistered(b)
+	require.Nil(t, err)
+	stored := msg.(*Roster)
+	require.False(t, stored.VerifyID())
+
+	require.Nil(t, h1.overlay.sendRequestRoster(h2.ServerIdentity, stored.ID))
+	process(*stored)
+	_, ok := h1.Roster(stored.ID)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), h1.DropStats().InvalidID)
+
+	// once the conode loaded it, it accepts the same list under that ID
+	h1.overlay.RegisterLegacyRoster(stored)
+	require.Nil(t, h1.overlay.sendRequestRoster(h2.ServerIdentity, stored.ID))
+	forged := *stored
+	forged.List = stored.List[:1]
+	process(forged)
+	_, ok = h1.Roster(stored.ID)
+	assert.False(t, ok)
+	process(*stored)
+	_, ok = h1.Roster(stored.ID)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), h1.DropStats().InvalidID)
+}
+
+func TestOverlayForgedRoster(t *testing.T) {
+	local := NewLocalTest()
+	hosts, el, _ := local.GenTree(3, false)
+	defer local.CloseAll()
+	h1, h2 := hosts[0], hosts[1]
+	process := func(msg network.Body) {
+		h1.overlay.Process(&network.Packet{
+			ServerIdentity: h2.ServerIdentity,
+			Msg:            msg,
+			MsgType:        SendRosterMessageID,
+		})
+	}
+
+	// the ID of the roster only covers the keys and addresses, not the IDs
+	// of the entries
+	list := make([]*network.ServerIdentity, len(el.List))
+	for i, si := range el.List {
+		cp := *si
+		list[i] = &cp
+	}
+	list[2].ID = el.List[1].ID
+	forged := NewRoster(list)
+	require.True(t, forged.VerifyID())
+	require.Nil(t, h1.overlay.sendRequestRoster(h2.ServerIdentity, forged.ID))
+	process(*forged)
+	_, ok := h1.Roster(forged.ID)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), h1.DropStats().InvalidID)
+
+	// nor the aggregate key, which is computed again
+	wrong := *el
+	wrong.Aggregate = network.Suite.Point().Null()
+	require.Nil(t, h1.overlay.sendRequestRoster(h2.ServerIdentity, el.ID))
+	process(wrong)
+	stored, ok := h1.Roster(el.ID)
+	require.True(t, ok)
+	assert.True(t, el.Aggregate.Equal(stored.Aggregate))
+}
+
+func TestOverlayNotMember(t *testing.T) {
+	local := NewLocalTest()
+	hosts, el, tree := local.GenTree(3, false)
+	defer local.CloseAll()
+	h1, h2 := hosts[0], hosts[1]
+
+	// h1 refuses a tree it is not part of
+	others := NewRoster(el.List[1:])
+	othersTree := others.GenerateBinaryTree()
+	h1.AddRoster(others)
+	h1.overlay.requestedTrees[othersTree.ID] = time.Now()
+	h1.overlay.Process(&network.Packet{
+		ServerIdentity: h2.ServerIdentity,
+		Msg:            *othersTree.MakeTreeMarshal(),
+		MsgType:        SendTreeMessageID,
+	})
+	_, ok := h1.GetTree(othersTree.ID)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), h1.DropStats().NotMember)
+
+	// h2 doesn't give the tree to h1
+	proc := newOverlayProc()
+	h1.RegisterProcessor(proc, SendTreeMessageID)
+	h2.AddRoster(others)
+	h2.AddTree(othersTree)
+	require.Nil(t, h1.Send(h2.ServerIdentity, &RequestTree{othersTree.ID}))
+	tm := <-proc.treeMarshal
+	assert.Equal(t, TreeID(uuid.Nil), tm.TreeID)
+	assert.Equal(t, uint64(1), h2.DropStats().NotMember)
+
+	// h1 doesn't instantiate the TreeNode of h2
+	h1.AddRoster(el)
+	h1.AddTree(tree)
+	err := h1.overlay.TransmitMsg(&ProtocolMsg{To: &Token{
+		RosterID:   el.ID,
+		TreeID:     tree.ID,
+		TreeNodeID: tree.Root.Children[0].ID,
+	}})
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(2), h1.DropStats().NotMember)
+}
+
 // overlayProc is a Processor which handles the management packet of Overlay,
 // i.e. Roster & Tree management.
 // Each type of message will be sent trhough the appropriate channel
@@ -150,7 +373,8 @@ func TestOverlayRosterPropagation(t *testing.T) {
 		t.Fatal("List should be equal to original list")
 	}
 
-	err = h1.Send(h2.ServerIdentity, &RequestRoster{RosterID: el.ID})
+	// the overlay only accepts rosters it requested
+	err = h1.overlay.sendRequestRoster(h2.ServerIdentity, el.ID)
 	if err != nil {
 		t.Fatal("Couldn't send message to h2:", err)
 	}
@@ -200,7 +424,8 @@ func TestOverlayTreePropagation(t *testing.T) {
 	msg = <-proc.treeMarshal
 	assert.Equal(t, msg.TreeID, tree.ID)
 
-	err = h1.Send(h2.ServerIdentity, &RequestTree{TreeID: tree.ID})
+	// the overlay only accepts trees it requested
+	err = h1.overlay.sendRequestTree(h2.ServerIdentity, tree.ID)
 	require.Nil(t, err)
 	// check if we receive the tree then
 	var tm TreeMarshal
@@ -238,7 +463,7 @@ func TestOverlayRosterTreePropagation(t *testing.T) {
 	// and the tree
 	h2.AddTree(tree)
 	// make the communcation happen
-	if err := h1.Send(h2.ServerIdentity, &RequestTree{TreeID: tree.ID}); err != nil {
+	if err := h1.overlay.sendRequestTree(h2.ServerIdentity, tree.ID); err != nil {
 		t.Fatal("Could not send tree request to host2", err)
 	}
 
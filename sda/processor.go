@@ -148,15 +148,42 @@ func (p *ServiceProcessor) SendISMOthers(el *Roster, msg network.Body) error {
 	return err
 }
 
+// errorReply converts err to a StatusRet of this service.
+func (p *ServiceProcessor) errorReply(err error) *network.StatusRet {
+	var service string
+	if p.Context != nil {
+		service = ServiceFactory.Name(p.Context.ServiceID())
+	}
+	return newErrorStatus(service, err)
+}
+
+// newErrorStatus converts err to a StatusRet. If err is a
+// *network.ServiceError, its code is kept, else network.ErrorCodeInternal is
+// used.
+func newErrorStatus(service string, err error) *network.StatusRet {
+	ret := &network.StatusRet{
+		Status:  err.Error(),
+		Code:    network.ErrorCodeInternal,
+		Service: service,
+	}
+	if se, ok := err.(*network.ServiceError); ok {
+		ret.Status = se.Message
+		ret.Code = se.Code
+		if se.Service != "" {
+			ret.Service = se.Service
+		}
+	}
+	return ret
+}
+
 // GetReply takes msgType and a message. It dispatches the msg to the right
 // function registered, then sends the responses to the sender.
 func (p *ServiceProcessor) GetReply(si *network.ServerIdentity, mt network.PacketTypeID, m network.Body) network.Body {
 	log.Lvl5("GetReply for", si.Address)
 	fu, ok := p.functions[mt]
 	if !ok {
-		return &network.StatusRet{
-			Status: "Didn't register message-handler: " + mt.String(),
-		}
+		return p.errorReply(network.NewServiceError(network.ErrorCodeNotFound,
+			"Didn't register message-handler: "+mt.String()))
 	}
 
 	//to0 := reflect.TypeOf(fu).In(0)
@@ -173,9 +200,7 @@ func (p *ServiceProcessor) GetReply(si *network.ServerIdentity, mt network.Packe
 	errI := ret[1].Interface()
 
 	if errI != nil {
-		return &network.StatusRet{
-			Status: errI.(error).Error(),
-		}
+		return p.errorReply(errI.(error))
 	}
 
 	reply := ret[0].Interface()
@@ -1,9 +1,11 @@
 package sda
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"reflect"
 
@@ -85,6 +87,18 @@ func TestProcessor_GetReply(t *testing.T) {
 	if errMsg.Status == "" {
 		t.Fatal("The error should be non-empty")
 	}
+	if errMsg.Code != network.ErrorCodeInternal {
+		t.Fatal("Untyped errors should be internal errors")
+	}
+
+	rep = p.GetReply(e, testMsgID, testMsg{43})
+	errMsg, ok = rep.(*network.StatusRet)
+	if !ok {
+		t.Fatal("43 should return an error")
+	}
+	if errMsg.Code != network.ErrorCodeNotFound {
+		t.Fatal("Code of the error got lost")
+	}
 }
 
 func TestProcessor_ProcessClientRequest(t *testing.T) {
@@ -114,6 +128,53 @@ func TestProcessor_ProcessClientRequest(t *testing.T) {
 		t.Fatal("Didn't send 12")
 	}
 
+	_, err = client.Send(h.ServerIdentity, &testMsg{43})
+	se, ok := err.(*network.ServiceError)
+	if !ok {
+		t.Fatalf("Should get a ServiceError, got %+v", err)
+	}
+	if se.Code != network.ErrorCodeNotFound || se.Service != "testService" {
+		t.Fatalf("Wrong error returned: %+v", se)
+	}
+
+}
+
+func TestClient_SendToAllContext(t *testing.T) {
+	local := NewLocalTest()
+	defer local.CloseAll()
+
+	hosts := local.GenConodes(2)
+	// A ServerIdentity that is not reachable
+	kp := config.NewKeyPair(network.Suite)
+	dead := network.NewServerIdentity(kp.Public,
+		network.NewLocalAddress("127.0.0.1:2999"))
+	el := NewRoster([]*network.ServerIdentity{hosts[0].ServerIdentity,
+		dead, hosts[1].ServerIdentity})
+	client := local.NewClient("testService")
+	client.SetTimeout(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resps, err := client.SendToAllContext(ctx, el, &testMsg{12})
+	if err == nil {
+		t.Fatal("Should get an error for the dead ServerIdentity")
+	}
+	if len(resps) != 3 || resps[1] != nil {
+		t.Fatal("Wrong replies:", resps)
+	}
+	for _, i := range []int{0, 2} {
+		if tm, ok := resps[i].Msg.(testMsg); !ok || tm.I != 12 {
+			t.Fatal("Wrong reply from", i)
+		}
+	}
+
+	// A cancelled context stops all requests
+	cancel()
+	for r := range client.StreamToAll(ctx, el, &testMsg{12}) {
+		if r.Err == nil {
+			t.Fatal("Cancelled request should fail")
+		}
+	}
 }
 
 func mkClientRequest(msg network.Body) []byte {
@@ -131,6 +192,9 @@ func procMsg(si *network.ServerIdentity, msg *testMsg) (network.Body, error) {
 	if msg.I == 42 {
 		return nil, fmt.Errorf("ServiceProcessor received %d (actual) vs 42 (expected)", msg.I)
 	}
+	if msg.I == 43 {
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "43 not found")
+	}
 	return msg, nil
 }
 
@@ -185,6 +249,9 @@ func (ts *testService) NewProtocol(tn *TreeNodeInstance, conf *GenericConfig) (P
 
 func (ts *testService) ProcessMsg(si *network.ServerIdentity, msg *testMsg) (network.Body, error) {
 	ts.Msg = msg
+	if msg.I == 43 {
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "43 not found")
+	}
 	return msg, nil
 }
 
@@ -0,0 +1,317 @@
+package sda
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+)
+
+// FailureTimeout is the time a child must be unreachable before its parent
+// considers it dead and repairs the tree.
+var FailureTimeout = 5 * time.Second
+
+// FailureCheckInterval is the time between two checks of the children of a
+// TreeNodeInstance with repair enabled.
+var FailureCheckInterval = time.Second
+
+// TreeRepair is sent by the parent of a dead TreeNode to all remaining nodes
+// of the tree once it adopted the children of the dead node. The receivers
+// repair their version of the tree themselves and verify that they get the
+// same tree.
+type TreeRepair struct {
+	// TreeID is the version of the tree that has been repaired
+	TreeID TreeID
+	// Dead is the TreeNode that has been removed
+	Dead TreeNodeID
+	// Repaired is the ID of the new version of the tree
+	Repaired TreeID
+}
+
+// TreeRepairMessageID of TreeRepair message as registered in network
+var TreeRepairMessageID = network.RegisterPacketTypeVersion("sda.TreeRepair", 0, TreeRepair{})
+
+// pendingRepair is a TreeRepair waiting for its tree.
+type pendingRepair struct {
+	si    *network.ServerIdentity
+	tr    *TreeRepair
+	added time.Time
+}
+
+// RepairHandler is called when the tree of a TreeNodeInstance has been
+// repaired. The instance already uses the repaired tree, so the protocol can
+// resume its current phase, for example by sending its last message again
+// to its new children. dead is the TreeNode that has been removed, as it was
+// in the previous version of the tree.
+type RepairHandler func(repaired *Tree, dead *TreeNode)
+
+// Repair returns a new version of the tree where the dead TreeNode is
+// removed and its children are adopted by its parent. All other TreeNodes
+// keep their ID, so that running protocol instances can continue. The root
+// cannot be repaired.
+func (t *Tree) Repair(dead TreeNodeID) (*Tree, error) {
+	tn := t.Search(dead)
+	if tn == nil {
+		return nil, errors.New("Dead TreeNode is not in the tree")
+	}
+	if tn.Parent == nil {
+		return nil, errors.New("Cannot repair the root of a tree")
+	}
+	root := TreeMarshalCopyTree(t.Root)
+	adopt(root, tn.Parent.ID, dead)
+	tm := &TreeMarshal{
+		TreeID:   treeID(t.Roster.ID, root),
+		RosterID: t.Roster.ID,
+		Children: []*TreeMarshal{root},
+	}
+	return tm.MakeTree(t.Roster)
+}
+
+// adopt searches the parent of the dead node in the subtree of tm and
+// replaces the dead node by its children. It returns true once done.
+func adopt(tm *TreeMarshal, parent, dead TreeNodeID) bool {
+	if tm.TreeNodeID != parent {
+		for _, c := range tm.Children {
+			if adopt(c, parent, dead) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, c := range tm.Children {
+		if c.TreeNodeID == dead {
+			children := append(tm.Children[:i:i], tm.Children[i+1:]...)
+			tm.Children = append(children, c.Children...)
+			return true
+		}
+	}
+	return false
+}
+
+// EnableRepair starts a failure detector for the children of the instance.
+// When a child is unreachable for FailureTimeout, the instance adopts its
+// children and sends the repaired tree to all remaining nodes. On every
+// conode where the tree is repaired, the instances using it switch to the
+// repaired tree and h is called, if it is not nil.
+func (n *TreeNodeInstance) EnableRepair(h RepairHandler) {
+	n.treeNodeLock.Lock()
+	defer n.treeNodeLock.Unlock()
+	n.repairHandler = h
+	if n.detectorQuit == nil {
+		n.detectorQuit = make(chan struct{})
+		go n.detectFailures(n.detectorQuit)
+	}
+}
+
+// detectFailures checks the children every FailureCheckInterval until quit
+// is closed.
+func (n *TreeNodeInstance) detectFailures(quit chan struct{}) {
+	ticker := time.NewTicker(FailureCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			for _, c := range n.Children() {
+				if !n.childDead(c) {
+					continue
+				}
+				if err := n.overlay.repairTree(n, c); err != nil {
+					log.Error(n.Info(), "couldn't repair tree:", err)
+				}
+				// the children changed
+				break
+			}
+		}
+	}
+}
+
+// childDead returns true if the child is not connected and no message could
+// be exchanged with it for FailureTimeout.
+func (n *TreeNodeInstance) childDead(c *TreeNode) bool {
+	status, ok := n.overlay.conode.Router.PeerStatus(c.ServerIdentity.ID)
+	if ok && status.Up {
+		return false
+	}
+	if ok && status.LastSeen.After(n.created) {
+		// the connection to the child went down while the instance runs
+		return time.Since(status.LastSeen) > FailureTimeout
+	}
+	// no connection could be made to the child yet, or it has been closed
+	// before the instance started, for example because it was idle
+	n.treeNodeLock.Lock()
+	failed, failing := n.sendFailures[c.ID]
+	n.treeNodeLock.Unlock()
+	return failing && time.Since(failed) > FailureTimeout
+}
+
+// sent records whether a message could be sent to tn, so that unreachable
+// children are detected even if no connection could ever be made.
+func (n *TreeNodeInstance) sent(tn *TreeNode, err error) {
+	n.treeNodeLock.Lock()
+	defer n.treeNodeLock.Unlock()
+	if err == nil {
+		delete(n.sendFailures, tn.ID)
+		n.sentTo[tn.ID]++
+	} else if _, ok := n.sendFailures[tn.ID]; !ok {
+		n.sendFailures[tn.ID] = time.Now()
+	}
+}
+
+// repaired switches the instance to the repaired tree and returns its
+// RepairHandler.
+func (n *TreeNodeInstance) repaired(t *Tree) RepairHandler {
+	n.mtx.Lock()
+	n.treeNodeList = nil
+	n.mtx.Unlock()
+	n.treeNodeLock.Lock()
+	defer n.treeNodeLock.Unlock()
+	if tn := t.Search(n.treeNode.ID); tn != nil {
+		n.treeNode = tn
+	}
+	return n.repairHandler
+}
+
+// stopRepair stops the failure detector.
+func (n *TreeNodeInstance) stopRepair() {
+	n.treeNodeLock.Lock()
+	defer n.treeNodeLock.Unlock()
+	if n.detectorQuit != nil {
+		close(n.detectorQuit)
+		n.detectorQuit = nil
+	}
+}
+
+// repairTree removes the dead child of the instance from its tree and sends
+// the repair to all remaining nodes.
+func (o *Overlay) repairTree(n *TreeNodeInstance, dead *TreeNode) error {
+	old := n.Tree()
+	repaired, err := old.Repair(dead.ID)
+	if err != nil {
+		return err
+	}
+	log.Lvl2(o.conode.Address(), "adopting the children of dead node",
+		dead.Name())
+	o.applyRepair(old, repaired, dead)
+	msg := &TreeRepair{TreeID: old.ID, Dead: dead.ID, Repaired: repaired.ID}
+	sent := map[network.ServerIdentityID]bool{
+		o.conode.ServerIdentity.ID: true,
+		dead.ServerIdentity.ID:     true,
+	}
+	for _, tn := range repaired.List() {
+		if sent[tn.ServerIdentity.ID] {
+			continue
+		}
+		sent[tn.ServerIdentity.ID] = true
+		if err := o.conode.Send(tn.ServerIdentity, msg); err != nil {
+			log.Error("Couldn't send repaired tree to", tn.Name(), err)
+		}
+	}
+	return nil
+}
+
+// handleTreeRepair repairs the tree like the parent of the dead node did,
+// if the repair comes from that parent.
+func (o *Overlay) handleTreeRepair(si *network.ServerIdentity, tr *TreeRepair) {
+	old := o.Tree(tr.TreeID)
+	if old == nil {
+		log.Lvl3(o.conode.Address(), "keeping repair of unknown tree", tr.TreeID)
+		o.keepRepair(si, tr)
+		return
+	}
+	dead := old.Search(tr.Dead)
+	if dead == nil || dead.Parent == nil ||
+		!dead.Parent.ServerIdentity.ID.Equal(si.ID) {
+		log.Lvl2(o.conode.Address(), "refusing repair from", si.Address)
+		atomic.AddUint64(&o.dropped.InvalidID, 1)
+		return
+	}
+	repaired, err := old.Repair(tr.Dead)
+	if err != nil || !repaired.ID.Equals(tr.Repaired) {
+		log.Lvl2(o.conode.Address(), "repair from", si.Address,
+			"gives another tree")
+		atomic.AddUint64(&o.dropped.InvalidID, 1)
+		return
+	}
+	o.applyRepair(old, repaired, dead)
+}
+
+// keepRepair keeps the repair of a tree we don't have yet, for example
+// because we are an orphan of the dead node and didn't get a message of the
+// protocol yet. Repairs waiting longer than PendingTimeout are removed, and
+// the repair is dropped if MaxPendingTrees are already waiting.
+func (o *Overlay) keepRepair(si *network.ServerIdentity, tr *TreeRepair) {
+	o.pendingRepairsLock.Lock()
+	defer o.pendingRepairsLock.Unlock()
+	var kept []*pendingRepair
+	for _, pr := range o.pendingRepairs {
+		if expired(pr.added) {
+			atomic.AddUint64(&o.dropped.Expired, 1)
+			continue
+		}
+		kept = append(kept, pr)
+	}
+	o.pendingRepairs = kept
+	if len(o.pendingRepairs) >= MaxPendingTrees {
+		atomic.AddUint64(&o.dropped.PendingTrees, 1)
+		return
+	}
+	o.pendingRepairs = append(o.pendingRepairs, &pendingRepair{si, tr, time.Now()})
+}
+
+// checkPendingRepairs applies the repairs that arrived before the tree.
+func (o *Overlay) checkPendingRepairs(t *Tree) {
+	var repairs []*pendingRepair
+	o.pendingRepairsLock.Lock()
+	var kept []*pendingRepair
+	for _, pr := range o.pendingRepairs {
+		if pr.tr.TreeID.Equals(t.ID) {
+			repairs = append(repairs, pr)
+		} else {
+			kept = append(kept, pr)
+		}
+	}
+	o.pendingRepairs = kept
+	o.pendingRepairsLock.Unlock()
+	for _, pr := range repairs {
+		if expired(pr.added) {
+			atomic.AddUint64(&o.dropped.Expired, 1)
+			continue
+		}
+		o.handleTreeRepair(pr.si, pr.tr)
+	}
+}
+
+// applyRepair registers the repaired tree, switches the instances using the
+// old tree to it and calls their RepairHandlers.
+func (o *Overlay) applyRepair(old, repaired *Tree, dead *TreeNode) {
+	o.treesMut.Lock()
+	if _, ok := o.repaired[old.ID]; ok {
+		o.treesMut.Unlock()
+		return
+	}
+	o.repaired[old.ID] = repaired.ID
+	o.treesMut.Unlock()
+	o.RegisterTree(repaired)
+	o.cache.Lock()
+	delete(o.cache.Entries, old.ID)
+	o.cache.Unlock()
+
+	var handlers []RepairHandler
+	o.instancesLock.Lock()
+	for _, tni := range o.instances {
+		if t := o.TreeFromToken(tni.token); t == nil || !t.ID.Equals(repaired.ID) {
+			continue
+		}
+		if h := tni.repaired(repaired); h != nil {
+			handlers = append(handlers, h)
+		}
+	}
+	o.instancesLock.Unlock()
+	for _, h := range handlers {
+		go h(repaired, dead)
+	}
+}
@@ -0,0 +1,146 @@
+package sda
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeRepair(t *testing.T) {
+	tree, _ := genLocalTree(7, 2000)
+	dead := tree.Root.Children[0]
+	orphans := dead.Children
+
+	repaired, err := tree.Repair(dead.ID)
+	require.Nil(t, err)
+	assert.False(t, repaired.ID.Equals(tree.ID))
+	assert.Equal(t, 6, repaired.Size())
+	assert.Nil(t, repaired.Search(dead.ID))
+	// the other nodes keep their IDs and the orphans are adopted by the root
+	for _, tn := range tree.List() {
+		if tn.ID != dead.ID {
+			assert.NotNil(t, repaired.Search(tn.ID))
+		}
+	}
+	assert.Equal(t, 3, len(repaired.Root.Children))
+	for _, o := range orphans {
+		assert.Equal(t, repaired.Root, repaired.Search(o.ID).Parent)
+	}
+	// the ID only depends on the repair
+	again, err := tree.Repair(dead.ID)
+	require.Nil(t, err)
+	assert.True(t, again.ID.Equals(repaired.ID))
+
+	_, err = tree.Repair(tree.Root.ID)
+	assert.NotNil(t, err)
+	_, err = repaired.Repair(dead.ID)
+	assert.NotNil(t, err)
+}
+
+func TestOverlayRepair(t *testing.T) {
+	GlobalProtocolRegister("ProtocolOverlay", newProtocolOverlay)
+	local := NewLocalTest()
+	defer local.CloseAll()
+	hosts, _, tree := local.GenTree(4, true)
+	h1 := hosts[0]
+	dead := tree.Root.Children[0]
+	repaired, err := tree.Repair(dead.ID)
+	require.Nil(t, err)
+
+	p, err := h1.CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	done := make(chan *Tree, 1)
+	p.(*ProtocolOverlay).EnableRepair(func(r *Tree, tn *TreeNode) {
+		assert.Equal(t, dead.ID, tn.ID)
+		done <- r
+	})
+	defer p.(*ProtocolOverlay).Release()
+
+	// only the parent of the dead node can repair the tree
+	tr := &TreeRepair{TreeID: tree.ID, Dead: dead.ID, Repaired: repaired.ID}
+	h1.overlay.handleTreeRepair(hosts[1].ServerIdentity, tr)
+	assert.Equal(t, uint64(1), h1.DropStats().InvalidID)
+	// and it must give the same tree
+	h1.overlay.handleTreeRepair(h1.ServerIdentity,
+		&TreeRepair{TreeID: tree.ID, Dead: dead.ID, Repaired: tree.ID})
+	assert.Equal(t, uint64(2), h1.DropStats().InvalidID)
+	_, ok := h1.GetTree(repaired.ID)
+	assert.False(t, ok)
+
+	h1.overlay.handleTreeRepair(h1.ServerIdentity, tr)
+	select {
+	case r := <-done:
+		assert.True(t, r.ID.Equals(repaired.ID))
+	case <-time.After(time.Second):
+		t.Fatal("RepairHandler not called")
+	}
+	tni := p.(*ProtocolOverlay).TreeNodeInstance
+	assert.True(t, tni.Tree().ID.Equals(repaired.ID))
+	assert.Equal(t, len(repaired.Root.Children), len(tni.Children()))
+	assert.Equal(t, repaired, h1.overlay.TreeFromToken(tni.Token()))
+}
+
+func TestOverlayRepairBeforeTree(t *testing.T) {
+	local := NewLocalTest()
+	defer local.CloseAll()
+	hosts, el, tree := local.GenTree(4, false)
+	parent := hosts[0]
+	dead := tree.Root.Children[0]
+	orphan := hosts[3]
+	require.Equal(t, orphan.ServerIdentity.ID, dead.Children[0].ServerIdentity.ID)
+	repaired, err := tree.Repair(dead.ID)
+	require.Nil(t, err)
+
+	// the orphan gets the repair before the tree
+	tr := &TreeRepair{TreeID: tree.ID, Dead: dead.ID, Repaired: repaired.ID}
+	orphan.overlay.handleTreeRepair(parent.ServerIdentity, tr)
+	_, ok := orphan.GetTree(repaired.ID)
+	assert.False(t, ok)
+
+	orphan.overlay.RegisterRoster(el)
+	orphan.overlay.RegisterTree(tree)
+	_, ok = orphan.GetTree(repaired.ID)
+	assert.True(t, ok)
+	r := orphan.overlay.TreeFromToken(&Token{TreeID: tree.ID})
+	assert.True(t, r.ID.Equals(repaired.ID))
+	assert.Equal(t, 0, len(orphan.overlay.pendingRepairs))
+}
+
+func TestTreeNodeInstanceRepair(t *testing.T) {
+	defer func(timeout, interval time.Duration) {
+		FailureTimeout = timeout
+		FailureCheckInterval = interval
+	}(FailureTimeout, FailureCheckInterval)
+	FailureTimeout = 50 * time.Millisecond
+	FailureCheckInterval = 10 * time.Millisecond
+	GlobalProtocolRegister("ProtocolOverlay", newProtocolOverlay)
+	local := NewLocalTest()
+	defer local.CloseAll()
+	hosts, _, tree := local.GenTree(4, true)
+	h1 := hosts[0]
+	dead := tree.Root.Children[0]
+
+	p, err := h1.CreateProtocol("ProtocolOverlay", tree)
+	require.Nil(t, err)
+	tni := p.(*ProtocolOverlay).TreeNodeInstance
+	done := make(chan *Tree, 1)
+	tni.EnableRepair(func(r *Tree, tn *TreeNode) {
+		done <- r
+	})
+	defer p.(*ProtocolOverlay).Release()
+
+	// the child is alive as long as messages can be sent to it
+	time.Sleep(2 * FailureTimeout)
+	assert.True(t, tni.Tree().ID.Equals(tree.ID))
+
+	tni.sent(dead, errors.New("unreachable"))
+	select {
+	case r := <-done:
+		assert.Nil(t, r.Search(dead.ID))
+	case <-time.After(time.Second):
+		t.Fatal("Dead child not detected")
+	}
+}
@@ -1,6 +1,7 @@
 package sda
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -9,9 +10,11 @@ import (
 	"strings"
 
 	"sync"
+	"time"
 
 	"github.com/dedis/cothority/log"
 	"github.com/dedis/cothority/network"
+	"github.com/dedis/crypto/abstract"
 	"github.com/satori/go.uuid"
 )
 
@@ -199,6 +202,8 @@ type serviceManager struct {
 	conode *Conode
 	// the dispather can take registration of Processors
 	network.Dispatcher
+	// stats counts the client requests of each service
+	stats *serviceStats
 }
 
 const configFolder = "config"
@@ -217,7 +222,13 @@ func newServiceManager(c *Conode, o *Overlay) *serviceManager {
 	}
 	services := make(map[ServiceID]Service)
 	configs := make(map[ServiceID]string)
-	s := &serviceManager{services, configs, c, network.NewRoutineDispatcher()}
+	s := &serviceManager{
+		services:   services,
+		paths:      configs,
+		conode:     c,
+		Dispatcher: network.NewRoutineDispatcher(),
+		stats:      newServiceStats(),
+	}
 	ids := ServiceFactory.registeredServiceIDs()
 	for _, id := range ids {
 		name := ServiceFactory.Name(id)
@@ -254,14 +265,27 @@ func (s *serviceManager) Process(data *network.Packet) {
 	case ClientRequestID:
 		r := data.Msg.(ClientRequest)
 		// check if the target service is indeed existing
-		s, ok := s.serviceByID(r.Service)
+		service, ok := s.serviceByID(r.Service)
 		if !ok {
 			log.Error("Received a request for an unknown service", r.Service)
 			// XXX TODO should reply with some generic response =>
 			// 404 Service Unknown
 			return
 		}
-		go s.ProcessClientRequest(id, &r)
+		if err := s.conode.acl.authorize(&r, s.conode.ServerIdentity); err != nil {
+			log.Lvl2("Refused request from", id, ":", err)
+			s.stats.refused(r.Service)
+			name := ServiceFactory.Name(r.Service)
+			if err := s.conode.Send(id, newErrorStatus(name, err)); err != nil {
+				log.Error(err)
+			}
+			return
+		}
+		go func() {
+			start := time.Now()
+			service.ProcessClientRequest(id, &r)
+			s.stats.processed(r.Service, time.Since(start))
+		}()
 	default:
 		// will launch a go routine for that message
 		s.Dispatch(data)
@@ -320,10 +344,12 @@ type ClientRequest struct {
 	Service ServiceID
 	// Data containing all the information in the request
 	Data []byte
+	// Signature is optional and authenticates the client
+	Signature *ClientSignature
 }
 
 // ClientRequestID is the type that registered by the network library
-var ClientRequestID = network.RegisterPacketType(ClientRequest{})
+var ClientRequestID = network.RegisterPacketTypeVersion("sda.ClientRequest", 0, ClientRequest{})
 
 // CreateClientRequest creates a Request message out of any message that is
 // destined to a Service. XXX For the moment it uses protobuf, as it is already
@@ -353,7 +379,7 @@ type InterServiceMessage struct {
 }
 
 // ServiceMessageID is the ID of the ServiceMessage struct.
-var ServiceMessageID = network.RegisterPacketType(InterServiceMessage{})
+var ServiceMessageID = network.RegisterPacketTypeVersion("sda.InterServiceMessage", 0, InterServiceMessage{})
 
 // CreateServiceMessage takes a service name and some data and encodes the whole
 // as a ServiceMessage.
@@ -370,11 +396,17 @@ func CreateServiceMessage(service string, r interface{}) (*InterServiceMessage,
 
 }
 
+// ClientTimeout is the default time a Client waits for the reply of a
+// remote Service.
+var ClientTimeout = 10 * time.Second
+
 // Client is a struct used to communicate with a remote Service running on a
 // sda.Conode
 type Client struct {
 	ServiceID ServiceID
 	net       *network.Client
+	timeout   time.Duration
+	private   abstract.Scalar
 }
 
 // NewClient returns a client using the service s. It uses TCP communication by
@@ -383,12 +415,35 @@ func NewClient(s string) *Client {
 	return &Client{
 		ServiceID: ServiceFactory.ServiceID(s),
 		net:       network.NewTCPClient(),
+		timeout:   ClientTimeout,
 	}
 }
 
+// SetTimeout changes the time the client waits for each reply. A timeout of
+// 0 means the client only stops waiting once the context given to
+// SendContext or SendToAllContext is done.
+func (c *Client) SetTimeout(t time.Duration) {
+	c.timeout = t
+}
+
+// SignRequests makes the client sign all following requests with the given
+// private key, so that they are accepted by services restricted to the
+// corresponding public key.
+func (c *Client) SignRequests(private abstract.Scalar) {
+	c.private = private
+}
+
 // Send will marshal the message into a ClientRequest message and send it.
+// It returns a network.TimeoutError if the remote Service didn't answer in
+// time.
 func (c *Client) Send(dst *network.ServerIdentity, msg network.Body) (*network.Packet, error) {
+	return c.SendContext(context.Background(), dst, msg)
+}
 
+// SendContext is like Send, but stops waiting for the reply as soon as ctx is
+// done. If the deadline of ctx or the timeout of the client is exceeded, a
+// network.TimeoutError is returned.
+func (c *Client) SendContext(ctx context.Context, dst *network.ServerIdentity, msg network.Body) (*network.Packet, error) {
 	m, err := network.NewNetworkPacket(msg)
 	if err != nil {
 		return nil, err
@@ -403,22 +458,77 @@ func (c *Client) Send(dst *network.ServerIdentity, msg network.Body) (*network.P
 		Service: c.ServiceID,
 		Data:    b,
 	}
+	if c.private != nil {
+		if err := serviceReq.Sign(c.private, dst); err != nil {
+			return nil, err
+		}
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
 	// send the request
 	log.Lvlf4("Sending request %x", serviceReq.Service)
-	return c.net.Send(dst, serviceReq)
+	return c.net.SendContext(ctx, dst, serviceReq)
+}
+
+// ServerReply holds the reply of one ServerIdentity of a Roster as returned
+// by StreamToAll.
+type ServerReply struct {
+	// Index is the position of the ServerIdentity in the Roster.
+	Index          int
+	ServerIdentity *network.ServerIdentity
+	Packet         *network.Packet
+	Err            error
+}
+
+// StreamToAll sends a message to all ServerIdentities of the Roster in
+// parallel. The replies are sent to the returned channel as they arrive, and
+// the channel is closed once all ServerIdentities answered or ctx is done.
+func (c *Client) StreamToAll(ctx context.Context, dst *Roster, msg network.Body) <-chan *ServerReply {
+	replies := make(chan *ServerReply, len(dst.List))
+	var wg sync.WaitGroup
+	for i, e := range dst.List {
+		wg.Add(1)
+		go func(i int, e *network.ServerIdentity) {
+			defer wg.Done()
+			p, err := c.SendContext(ctx, e, msg)
+			replies <- &ServerReply{
+				Index:          i,
+				ServerIdentity: e,
+				Packet:         p,
+				Err:            err,
+			}
+		}(i, e)
+	}
+	go func() {
+		wg.Wait()
+		close(replies)
+	}()
+	return replies
 }
 
 // SendToAll sends a message to all ServerIdentities of the Roster and returns
 // all errors encountered concatenated together as a string.
 func (c *Client) SendToAll(dst *Roster, msg network.Body) ([]*network.Packet, error) {
+	return c.SendToAllContext(context.Background(), dst, msg)
+}
+
+// SendToAllContext sends a message to all ServerIdentities of the Roster in
+// parallel and waits for all replies or until ctx is done. The returned slice
+// holds the replies in the order of the Roster, with nil for the
+// ServerIdentities that failed or didn't answer in time, so that partial
+// results are available even if an error is returned.
+func (c *Client) SendToAllContext(ctx context.Context, dst *Roster, msg network.Body) ([]*network.Packet, error) {
 	msgs := make([]*network.Packet, len(dst.List))
 	var errstrs []string
-	for i, e := range dst.List {
-		var err error
-		msgs[i], err = c.Send(e, msg)
-		if err != nil {
-			errstrs = append(errstrs, fmt.Sprint(e.String(), err.Error()))
+	for r := range c.StreamToAll(ctx, dst, msg) {
+		if r.Err != nil {
+			errstrs = append(errstrs, fmt.Sprint(r.ServerIdentity.String(), r.Err.Error()))
+			continue
 		}
+		msgs[r.Index] = r.Packet
 	}
 	var err error
 	if len(errstrs) > 0 {
@@ -195,11 +195,16 @@ type SimulationBFTree struct {
 	Hosts      int
 	SingleHost bool
 	Depth      int
+	// PortBase is the first port of the range used by the conodes of a
+	// simulation on localhost. If it is 0, free ports are searched.
+	PortBase int
 }
 
 // CreateRoster creates an Roster with the host-names in 'addresses'.
 // It creates 's.Hosts' entries, starting from 'port' for each round through
 // 'addresses'. The network.Address(es) created are of type PlainTCP.
+// On localhost, the ports are free ports, or the range starting at
+// 's.PortBase' if it is given.
 func (s *SimulationBFTree) CreateRoster(sc *SimulationConfig, addresses []string, port int) {
 	start := time.Now()
 	nbrAddr := len(addresses)
@@ -231,7 +236,10 @@ func (s *SimulationBFTree) CreateRoster(sc *SimulationConfig, addresses []string
 			key.Suite.Point().Base())
 		address := addresses[c%nbrAddr] + ":"
 		var add network.Address
-		if localhosts {
+		if localhosts && s.PortBase > 0 {
+			address += strconv.Itoa(s.PortBase + c)
+			add = network.NewTCPAddress(address)
+		} else if localhosts {
 			// If we have localhosts, we have to search for an empty port
 			var err error
 			listeners[c], err = net.Listen("tcp", ":0")
@@ -260,6 +268,9 @@ func (s *SimulationBFTree) CreateRoster(sc *SimulationConfig, addresses []string
 	// And close all our listeners
 	if localhosts {
 		for _, l := range listeners {
+			if l == nil {
+				continue
+			}
 			err := l.Close()
 			if err != nil {
 				log.Fatal("Couldn't close port:", l, err)
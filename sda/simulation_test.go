@@ -60,6 +60,18 @@ func TestSimulationBigTree(t *testing.T) {
 	}
 }
 
+func TestSimulationPortBase(t *testing.T) {
+	sc := &SimulationConfig{}
+	sb := &SimulationBFTree{Hosts: 3, BF: 2, PortBase: 3000}
+	sb.CreateRoster(sc, []string{"127.0.0.1", "127.0.0.2"}, 2000)
+	addresses := []string{"127.0.0.1:3000", "127.0.0.2:3001", "127.0.0.1:3002"}
+	for i, a := range sc.Roster.List {
+		if !strings.HasSuffix(string(a.Address), "/"+addresses[i]) {
+			t.Fatal("Address", string(a.Address), "should be", addresses[i])
+		}
+	}
+}
+
 func TestSimulationLoadSave(t *testing.T) {
 	sc, _, err := createBFTree(7, 2, []string{"127.0.0.1", "127.0.0.2"})
 	if err != nil {
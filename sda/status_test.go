@@ -6,6 +6,7 @@ import (
 
 	"strconv"
 
+	"github.com/dedis/cothority/network"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,6 +29,35 @@ func TestStatusHost(t *testing.T) {
 	assert.Equal(t, len(services), len(a))
 }
 
+func TestStatusPeers(t *testing.T) {
+	local := NewLocalTest()
+	defer local.CloseAll()
+	c := local.GenConodes(2)
+	assert.Nil(t, c[0].Send(c[1].ServerIdentity, &RequestRoster{}))
+	stats := c[0].GetStatus()
+	peer := stats["Peer_"+c[1].ServerIdentity.Address.String()]
+	assert.True(t, strings.HasPrefix(peer, "up"), peer)
+}
+
+func TestStatusTraffic(t *testing.T) {
+	local := NewLocalTest()
+	defer local.CloseAll()
+	c := local.GenConodes(2)
+	assert.Nil(t, c[0].Send(c[1].ServerIdentity, &RequestRoster{}))
+	traffic := c[0].PeerTraffic()[c[1].ServerIdentity.Address]
+	// the versions of the packets are sent when connecting
+	assert.Equal(t, uint64(2), traffic.MsgsTx)
+	assert.True(t, traffic.BytesTx > 0)
+	types := c[0].TypeTraffic()
+	assert.Equal(t, uint64(1), types[RequestRosterMessageID].MsgsTx)
+	assert.Equal(t, uint64(1), types[network.VersionsType].MsgsTx)
+
+	stats := c[0].GetStatus()
+	peer := stats["Traffic_"+c[1].ServerIdentity.Address.String()]
+	assert.True(t, strings.HasPrefix(peer, "tx=2/"), peer)
+	assert.NotEqual(t, "", stats["Type_"+RequestRosterMessageID.String()])
+}
+
 type dummyTestReporter struct {
 	Status int
 }
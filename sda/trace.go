@@ -0,0 +1,321 @@
+package sda
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+)
+
+// ReplayTimeout is the time Replay waits for the protocol instance to
+// handle a message before giving up.
+var ReplayTimeout = 10 * time.Second
+
+// TraceTree is written to a trace before the first message of a tree, so
+// that the trace can be replayed on its own.
+type TraceTree struct {
+	Roster *Roster
+	Tree   *TreeMarshal
+}
+
+// TraceMsg is a ProtocolMsg delivered to a TreeNodeInstance.
+type TraceMsg struct {
+	// Time of the delivery in nanoseconds since the epoch
+	Time     int64
+	From     *Token
+	To       *Token
+	MsgType  network.PacketTypeID
+	MsgSlice []byte
+	Config   GenericConfig
+}
+
+// TraceTreeID of TraceTree message as registered in network
+var TraceTreeID = network.RegisterPacketTypeVersion("sda.TraceTree", 0, TraceTree{})
+
+// TraceMsgID of TraceMsg message as registered in network
+var TraceMsgID = network.RegisterPacketTypeVersion("sda.TraceMsg", 0, TraceMsg{})
+
+// tracer writes the records of a trace file. Every record is prefixed by
+// its length as a 4-byte big-endian integer.
+type tracer struct {
+	sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	trees map[TreeID]bool
+}
+
+// RecordTrace writes every ProtocolMsg delivered to the protocol instances
+// of the conode to file, together with the trees and rosters they use,
+// until StopTrace is called. The trace can be read with ReadTrace.
+func (c *Conode) RecordTrace(file string) error {
+	return c.overlay.recordTrace(file)
+}
+
+// StopTrace stops recording and closes the trace file.
+func (c *Conode) StopTrace() error {
+	return c.overlay.stopTrace()
+}
+
+func (o *Overlay) recordTrace(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := o.stopTrace(); err != nil {
+		log.Error("Couldn't close previous trace:", err)
+	}
+	o.tracerLock.Lock()
+	o.tracer = &tracer{
+		file:  f,
+		w:     bufio.NewWriter(f),
+		trees: make(map[TreeID]bool),
+	}
+	o.tracerLock.Unlock()
+	return nil
+}
+
+func (o *Overlay) stopTrace() error {
+	o.tracerLock.Lock()
+	t := o.tracer
+	o.tracer = nil
+	o.tracerLock.Unlock()
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	if err := t.w.Flush(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
+
+// trace records the message delivered to n, if a trace is recorded.
+func (o *Overlay) trace(n *TreeNodeInstance, msg *ProtocolMsg) {
+	o.tracerLock.Lock()
+	t := o.tracer
+	o.tracerLock.Unlock()
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if !t.trees[msg.To.TreeID] {
+		if tree := o.Tree(msg.To.TreeID); tree != nil {
+			t.trees[tree.ID] = true
+			t.write(&TraceTree{Roster: tree.Roster, Tree: tree.MakeTreeMarshal()})
+		}
+	}
+	t.write(&TraceMsg{
+		Time:     time.Now().UnixNano(),
+		From:     msg.From,
+		To:       msg.To,
+		MsgType:  msg.MsgType,
+		MsgSlice: msg.MsgSlice,
+		Config:   msg.Config,
+	})
+}
+
+// write appends a record to the trace. The lock must be held.
+func (t *tracer) write(rec network.Body) {
+	buf, err := network.MarshalRegisteredType(rec)
+	if err != nil {
+		log.Error("Couldn't marshal trace record:", err)
+		return
+	}
+	if err := binary.Write(t.w, binary.BigEndian, uint32(len(buf))); err != nil {
+		log.Error("Couldn't write trace:", err)
+		return
+	}
+	if _, err := t.w.Write(buf); err != nil {
+		log.Error("Couldn't write trace:", err)
+	}
+}
+
+// Trace holds the records of a trace file.
+type Trace struct {
+	Rosters map[RosterID]*Roster
+	Trees   map[TreeID]*Tree
+	// Msgs are the delivered messages in the order of delivery
+	Msgs []*TraceMsg
+}
+
+// ReadTrace reads a trace written by Conode.RecordTrace.
+func ReadTrace(file string) (*Trace, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tr := &Trace{
+		Rosters: make(map[RosterID]*Roster),
+		Trees:   make(map[TreeID]*Tree),
+	}
+	r := bufio.NewReader(f)
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			if err == io.EOF {
+				return tr, nil
+			}
+			return nil, err
+		}
+		if network.Size(length) > network.MaxPacketSize {
+			return nil, fmt.Errorf("Trace record of %d bytes is too big", length)
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		_, rec, err := network.UnmarshalRegisteredType(buf,
+			network.DefaultConstructors(network.Suite))
+		if err != nil {
+			return nil, err
+		}
+		switch rec := rec.(type) {
+		case TraceTree:
+			tree, err := rec.Tree.MakeTree(rec.Roster)
+			if err != nil {
+				return nil, err
+			}
+			tr.Rosters[rec.Roster.ID] = rec.Roster
+			tr.Trees[tree.ID] = tree
+		case TraceMsg:
+			tr.Msgs = append(tr.Msgs, &rec)
+		default:
+			return nil, fmt.Errorf("Unknown trace record %T", rec)
+		}
+	}
+}
+
+// Instances returns the tokens of all protocol instances that received
+// messages, in the order of their first message.
+func (tr *Trace) Instances() []*Token {
+	var toks []*Token
+	seen := make(map[TokenID]bool)
+	for _, m := range tr.Msgs {
+		if !seen[m.To.ID()] {
+			seen[m.To.ID()] = true
+			toks = append(toks, m.To)
+		}
+	}
+	return toks
+}
+
+// Replay creates a new conode in the LocalTest which takes the place of the
+// TreeNode of the recorded instance to and delivers all messages recorded
+// for that instance to it, one after the other. The other members of the
+// roster keep their recorded identities, so the messages sent by the
+// replayed instance get lost. It returns the protocol instance once all
+// messages have been handled.
+func (l *LocalTest) Replay(tr *Trace, to *Token) (ProtocolInstance, error) {
+	tree := tr.Trees[to.TreeID]
+	if tree == nil {
+		return nil, errors.New("Tree of the instance is not in the trace")
+	}
+	tn := tree.Search(to.TreeNodeID)
+	if tn == nil {
+		return nil, errors.New("TreeNode of the instance is not in the tree")
+	}
+	c := l.GenConodes(1)[0]
+	list := make([]*network.ServerIdentity, len(tree.Roster.List))
+	for i, si := range tree.Roster.List {
+		list[i] = si
+		if si.ID.Equal(tn.ServerIdentity.ID) {
+			list[i] = c.ServerIdentity
+		}
+	}
+	roster := NewRoster(list)
+	root := TreeMarshalCopyTree(tree.Root)
+	replaceServerIdentity(root, tn.ServerIdentity.ID, c.ServerIdentity.ID)
+	tm := &TreeMarshal{
+		TreeID:   treeID(roster.ID, root),
+		RosterID: roster.ID,
+		Children: []*TreeMarshal{root},
+	}
+	replayTree, err := tm.MakeTree(roster)
+	if err != nil {
+		return nil, err
+	}
+	l.Rosters[roster.ID] = roster
+	l.Trees[replayTree.ID] = replayTree
+	c.overlay.RegisterRoster(roster)
+	c.overlay.RegisterTree(replayTree)
+
+	translate := func(tok *Token) *Token {
+		return &Token{
+			RosterID:   roster.ID,
+			TreeID:     replayTree.ID,
+			ProtoID:    tok.ProtoID,
+			ServiceID:  tok.ServiceID,
+			RoundID:    tok.RoundID,
+			TreeNodeID: tok.TreeNodeID,
+		}
+	}
+	replayTo := translate(to)
+	var handled uint64
+	for _, m := range tr.Msgs {
+		if m.To.ID() != to.ID() {
+			continue
+		}
+		msg := &ProtocolMsg{
+			From:     translate(m.From),
+			To:       replayTo,
+			MsgType:  m.MsgType,
+			MsgSlice: m.MsgSlice,
+			Config:   m.Config,
+		}
+		if from := replayTree.Search(m.From.TreeNodeID); from != nil {
+			msg.ServerIdentity = from.ServerIdentity
+		}
+		if err := c.overlay.TransmitMsg(msg); err != nil {
+			return nil, err
+		}
+		handled++
+		if err := c.overlay.waitDispatched(replayTo, handled); err != nil {
+			return nil, err
+		}
+	}
+	c.overlay.instancesLock.Lock()
+	defer c.overlay.instancesLock.Unlock()
+	pi, ok := c.overlay.protocolInstances[replayTo.ID()]
+	if !ok {
+		return nil, errors.New("No message of the instance in the trace")
+	}
+	return pi, nil
+}
+
+// replaceServerIdentity replaces the ServerIdentity old by si in tm and
+// its subtree.
+func replaceServerIdentity(tm *TreeMarshal, old, si network.ServerIdentityID) {
+	if tm.ServerIdentityID.Equal(old) {
+		tm.ServerIdentityID = si
+	}
+	for _, c := range tm.Children {
+		replaceServerIdentity(c, old, si)
+	}
+}
+
+// waitDispatched waits until the instance of tok handled n messages.
+func (o *Overlay) waitDispatched(tok *Token, n uint64) error {
+	deadline := time.Now().Add(ReplayTimeout)
+	for time.Now().Before(deadline) {
+		o.instancesLock.Lock()
+		tni, ok := o.instances[tok.ID()]
+		o.instancesLock.Unlock()
+		if ok && atomic.LoadUint64(&tni.dispatched) >= n {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("Message %d of the trace has not been handled", n)
+}
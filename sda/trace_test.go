@@ -0,0 +1,55 @@
+package sda
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceReplay(t *testing.T) {
+	f, err := ioutil.TempFile("", "trace")
+	require.Nil(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	local := NewLocalTest()
+	hosts, _, tree := local.GenTree(3, true)
+	require.Nil(t, hosts[0].RecordTrace(f.Name()))
+	IncomingHandlers = make(chan *TreeNodeInstance, 2)
+	p, err := local.CreateProtocol("ProtocolHandlers", tree)
+	require.Nil(t, err)
+	go p.Start()
+	child1 := <-IncomingHandlers
+	child2 := <-IncomingHandlers
+	root := p.(*ProtocolHandlers).TreeNodeInstance
+	child1.SendTo(root.TreeNode(), &NodeTestAggMsg{1})
+	child2.SendTo(root.TreeNode(), &NodeTestAggMsg{2})
+	<-IncomingHandlers
+	require.Nil(t, hosts[0].StopTrace())
+	local.CloseAll()
+
+	tr, err := ReadTrace(f.Name())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tr.Msgs))
+	assert.True(t, tr.Msgs[0].Time <= tr.Msgs[1].Time)
+	require.Equal(t, 1, len(tr.Trees))
+	assert.NotNil(t, tr.Trees[tree.ID])
+	instances := tr.Instances()
+	require.Equal(t, 1, len(instances))
+	assert.Equal(t, root.Token().ID(), instances[0].ID())
+
+	replay := NewLocalTest()
+	defer replay.CloseAll()
+	pi, err := replay.Replay(tr, instances[0])
+	require.Nil(t, err)
+	select {
+	case tni := <-IncomingHandlers:
+		assert.Equal(t, pi.(*ProtocolHandlers).TreeNodeInstance, tni)
+	case <-time.After(time.Second):
+		t.Fatal("Aggregated messages not replayed")
+	}
+}
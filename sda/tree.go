@@ -50,13 +50,13 @@ func (tId TreeID) String() string {
 }
 
 // NewTree creates a new tree using the entityList and the root-node. It
-// also generates the id.
+// also generates the id, which is derived from the id of the entityList and
+// the structure of the tree.
 func NewTree(el *Roster, r *TreeNode) *Tree {
-	url := network.NamespaceURL + "tree/" + el.ID.String() + r.ID.String()
 	t := &Tree{
 		Roster: el,
 		Root:   r,
-		ID:     TreeID(uuid.NewV5(uuid.NamespaceURL, url)),
+		ID:     treeID(el.ID, TreeMarshalCopyTree(r)),
 	}
 	// network.Suite used for the moment => explicit mark that something is
 	// wrong and that needs to be changed !
@@ -76,8 +76,11 @@ func NewTreeFromMarshal(buf []byte, el *Roster) (*Tree, error) {
 		return nil, errors.New("Didn't receive TreeMarshal-struct")
 	}
 	t, err := pm.(TreeMarshal).MakeTree(el)
+	if err != nil {
+		return nil, err
+	}
 	t.computeSubtreeAggregate(network.Suite, t.Root)
-	return t, err
+	return t, nil
 }
 
 // MakeTreeMarshal creates a replacement-tree that is safe to send: no
@@ -284,7 +287,7 @@ func (tm *TreeMarshal) String() string {
 }
 
 // TreeMarshalTypeID of TreeMarshal message as registered in network
-var TreeMarshalTypeID = network.RegisterPacketType(TreeMarshal{})
+var TreeMarshalTypeID = network.RegisterPacketTypeVersion("sda.TreeMarshal", 0, TreeMarshal{})
 
 // TreeMarshalCopyTree takes a TreeNode and returns a corresponding
 // TreeMarshal
@@ -305,15 +308,50 @@ func (tm TreeMarshal) MakeTree(el *Roster) (*Tree, error) {
 	if el.ID != tm.RosterID {
 		return nil, errors.New("Not correct Roster-Id")
 	}
+	if len(tm.Children) != 1 {
+		return nil, errors.New("TreeMarshal needs exactly one root")
+	}
 	tree := &Tree{
 		ID:     tm.TreeID,
 		Roster: el,
 	}
 	tree.Root = tm.Children[0].MakeTreeFromList(nil, el)
+	var missing bool
+	tree.Root.Visit(0, func(i int, tn *TreeNode) {
+		missing = missing || tn.ServerIdentity == nil
+	})
+	if missing {
+		return nil, errors.New("Tree uses a ServerIdentity not in the Roster")
+	}
 	tree.computeSubtreeAggregate(network.Suite, tree.Root)
 	return tree, nil
 }
 
+// VerifyID returns true if the TreeID of the top-node matches the Roster-ID
+// and the structure of the tree.
+func (tm *TreeMarshal) VerifyID() bool {
+	return len(tm.Children) == 1 &&
+		tm.TreeID == treeID(tm.RosterID, tm.Children[0])
+}
+
+// treeID derives the id of a tree from the id of its Roster and the ids of
+// all nodes, in order.
+func treeID(rid RosterID, root *TreeMarshal) TreeID {
+	url := network.NamespaceURL + "tree/" + rid.String() + "/" + root.structure()
+	return TreeID(uuid.NewV5(uuid.NamespaceURL, url))
+}
+
+// structure returns the ids of the TreeNode and its ServerIdentity together
+// with the structure of all children.
+func (tm *TreeMarshal) structure() string {
+	s := tm.TreeNodeID.String() + "@" +
+		uuid.UUID(tm.ServerIdentityID).String() + "("
+	for _, c := range tm.Children {
+		s += c.structure()
+	}
+	return s + ")"
+}
+
 // MakeTreeFromList creates a sub-tree given an Roster
 func (tm *TreeMarshal) MakeTreeFromList(parent *TreeNode, el *Roster) *TreeNode {
 	idx, ent := el.Search(tm.ServerIdentityID)
@@ -351,21 +389,54 @@ func (elId RosterID) String() string {
 }
 
 // RosterTypeID of Roster message as registered in network
-var RosterTypeID = network.RegisterPacketType(Roster{})
+var RosterTypeID = network.RegisterPacketTypeVersion("sda.Roster", 0, Roster{})
 
 // NewRoster creates a new ServerIdentity from a list of entities. It also
-// adds a UUID which is randomly chosen.
+// adds a UUID which is derived from the public keys and addresses of the
+// entities.
 func NewRoster(ids []*network.ServerIdentity) *Roster {
-	// compute the aggregate key already
+	return &Roster{
+		List:      ids,
+		Aggregate: aggregate(ids),
+		ID:        rosterID(ids),
+	}
+}
+
+// aggregate returns the sum of the public keys of the list.
+func aggregate(ids []*network.ServerIdentity) abstract.Point {
 	agg := network.Suite.Point().Null()
 	for _, e := range ids {
 		agg = agg.Add(agg, e.Public)
 	}
-	return &Roster{
-		List:      ids,
-		Aggregate: agg,
-		ID:        RosterID(uuid.NewV4()),
+	return agg
+}
+
+// VerifyID returns true if the ID of the Roster matches its list.
+func (el *Roster) VerifyID() bool {
+	return el.ID == rosterID(el.List)
+}
+
+// verifyEntries returns true if the ID of every ServerIdentity of the list is
+// the one derived from its public key, as the trees refer to the
+// ServerIdentities by their IDs.
+func (el *Roster) verifyEntries() bool {
+	for _, e := range el.List {
+		if e == nil || e.Public == nil ||
+			e.ID != network.NewServerIdentity(e.Public, e.Address).ID {
+			return false
+		}
+	}
+	return true
+}
+
+// rosterID derives the id of a Roster from the public keys and addresses of
+// the list, in order.
+func rosterID(ids []*network.ServerIdentity) RosterID {
+	url := network.NamespaceURL + "roster/"
+	for _, e := range ids {
+		url += e.Public.String() + "@" + e.Address.String() + ";"
 	}
+	return RosterID(uuid.NewV5(uuid.NamespaceURL, url))
 }
 
 // Search searches the Roster for the given ServerIdentityID and returns the
@@ -655,6 +726,18 @@ func (t *TreeNode) SubtreeCount() int {
 	return ret
 }
 
+// SubtreeHeight returns the length of the longest path from that TreeNode
+// down to a leaf.
+func (t *TreeNode) SubtreeHeight() int {
+	ret := 0
+	t.Visit(0, func(depth int, _ *TreeNode) {
+		if depth > ret {
+			ret = depth
+		}
+	})
+	return ret
+}
+
 // AggregatePublic will return the aggregate public key of the TreeNode
 // and all it's children
 func (t *TreeNode) AggregatePublic() abstract.Point {
@@ -684,14 +767,12 @@ func (el *Roster) Toml(suite abstract.Suite) *RosterToml {
 	}
 }
 
-// Roster returns the Id list from this toml read struct
+// Roster returns the Id list from this toml read struct. The ID is derived
+// again from the list, as older versions wrote random IDs.
 func (elt *RosterToml) Roster(suite abstract.Suite) *Roster {
 	ids := make([]*network.ServerIdentity, len(elt.List))
 	for i := range elt.List {
 		ids[i] = elt.List[i].ServerIdentity(suite)
 	}
-	return &Roster{
-		ID:   elt.ID,
-		List: ids,
-	}
+	return NewRoster(ids)
 }
@@ -1,6 +1,7 @@
 package sda
 
 import (
+	"encoding/json"
 	"strconv"
 	"testing"
 
@@ -40,6 +41,24 @@ func TestTreeId(t *testing.T) {
 	}
 }
 
+// Test that the IDs are derived from the content
+func TestVerifyID(t *testing.T) {
+	names := genLocalhostPeerNames(3, 0)
+	el := genRoster(tSuite, names)
+	assert.True(t, el.VerifyID())
+	assert.Equal(t, el.ID, NewRoster(el.List).ID)
+	el2 := NewRoster(el.List[1:])
+	assert.NotEqual(t, el.ID, el2.ID)
+	el2.ID = el.ID
+	assert.False(t, el2.VerifyID())
+
+	tm := el.GenerateBinaryTree().MakeTreeMarshal()
+	assert.True(t, tm.VerifyID())
+	tm.Children[0].Children[0].ServerIdentityID = el.List[0].ID
+	assert.False(t, tm.VerifyID())
+	assert.False(t, (&TreeMarshal{}).VerifyID())
+}
+
 // Test if topology correctly handles the "virtual" connections in the topology
 func TestTreeConnectedTo(t *testing.T) {
 	names := genLocalhostPeerNames(3, 0)
@@ -93,6 +112,14 @@ func TestInitPeerListFromConfigFile(t *testing.T) {
 	}
 }
 
+func TestRosterTomlLegacyID(t *testing.T) {
+	el := genRoster(tSuite, genLocalhostPeerNames(3, 2000))
+	el.ID = RosterID(uuid.NewV4())
+	decoded := el.Toml(tSuite).Roster(tSuite)
+	assert.True(t, decoded.VerifyID())
+	assert.Equal(t, NewRoster(el.List).ID, decoded.ID)
+}
+
 // Test initialisation of new random tree from a peer-list
 
 // Test initialisation of new graph from config-file using a peer-list
@@ -369,6 +396,36 @@ func TestTree_BinaryMarshaler(t *testing.T) {
 	log.Lvl1(tree2.Dump())
 }
 
+func TestTreeExport(t *testing.T) {
+	tree, el := genLocalTree(5, 2000)
+	metrics := NodeMetrics{1: {"msgs_tx": 12, "latency": 0.5}}
+
+	dot := tree.ExportDOT(metrics)
+	assert.True(t, strings.HasPrefix(dot, "digraph"))
+	assert.Equal(t, tree.Size()-1, strings.Count(dot, "->"))
+	assert.Contains(t, dot, string(el.List[4].Address))
+	assert.Contains(t, dot, `\nlatency=0.5\nmsgs_tx=12"`)
+	dot = el.ExportDOT(nil)
+	assert.True(t, strings.HasPrefix(dot, "graph"))
+	assert.Equal(t, len(el.List), strings.Count(dot, "label="))
+
+	buf, err := tree.ExportJSON(metrics)
+	assert.Nil(t, err)
+	var root struct {
+		ID   string
+		Root nodeJSON
+	}
+	assert.Nil(t, json.Unmarshal(buf, &root))
+	assert.Equal(t, tree.ID.String(), root.ID)
+	assert.Equal(t, len(tree.Root.Children), len(root.Root.Children))
+	child := root.Root.Children[0]
+	assert.Equal(t, tree.Root.Children[0].ID.String(), child.ID)
+	assert.Equal(t, metrics[child.RosterIndex], child.Metrics)
+	buf, err = el.ExportJSON(nil)
+	assert.Nil(t, err)
+	assert.Contains(t, string(buf), string(el.List[2].Address))
+}
+
 func TestTreeNode_SubtreeCount(t *testing.T) {
 	tree, _ := genLocalTree(15, 2000)
 	if tree.Root.SubtreeCount() != 14 {
@@ -385,6 +442,13 @@ func TestTreeNode_SubtreeCount(t *testing.T) {
 	}
 }
 
+func TestTreeNode_SubtreeHeight(t *testing.T) {
+	tree, _ := genLocalTree(15, 2000)
+	assert.Equal(t, 3, tree.Root.SubtreeHeight())
+	assert.Equal(t, 2, tree.Root.Children[0].SubtreeHeight())
+	assert.Equal(t, 0, tree.Root.Children[0].Children[0].Children[0].SubtreeHeight())
+}
+
 func TestRoster_GenerateNaryTree(t *testing.T) {
 	names := genLocalhostPeerNames(10, 2000)
 	peerList := genRoster(tSuite, names)
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"strings"
 
@@ -18,8 +20,20 @@ import (
 type TreeNodeInstance struct {
 	overlay *Overlay
 	token   *Token
-	// cache for the TreeNode this Node is representing
-	treeNode *TreeNode
+	// cache for the TreeNode this Node is representing, it changes when
+	// the tree is repaired
+	treeNode     *TreeNode
+	treeNodeLock sync.Mutex
+	// called when the tree is repaired
+	repairHandler RepairHandler
+	// stops the failure detector
+	detectorQuit chan struct{}
+	// first failure of sending to a TreeNode since the last success
+	sendFailures map[TreeNodeID]time.Time
+	// number of messages sent to and received from every TreeNode,
+	// protected by treeNodeLock
+	sentTo       map[TreeNodeID]int
+	receivedFrom map[TreeNodeID]int
 	// cached list of all TreeNodes
 	treeNodeList []*TreeNode
 	// mutex to synchronise creation of treeNodeList
@@ -36,6 +50,24 @@ type TreeNodeInstance struct {
 	// aggregate messages in order to dispatch them at once in the protocol
 	// instance
 	msgQueue map[network.PacketTypeID][]*ProtocolMsg
+	// maximum time to wait for the messages of all children, per
+	// message-type
+	aggregationTimeouts map[network.PacketTypeID]time.Duration
+	// channels receiving the missing children of aggregations that timed
+	// out, per message-type
+	missingChannels map[network.PacketTypeID]chan []*TreeNode
+	// aggregationLock protects aggregationTimeouts and missingChannels, as
+	// they can be set while the messages are dispatched
+	aggregationLock sync.Mutex
+	// the current aggregation of every message-type, counting up
+	aggregationRounds map[network.PacketTypeID]int
+	aggregationTimers map[network.PacketTypeID]*time.Timer
+	// aggregations that timed out and wait to be dispatched, protected by
+	// msgDispatchQueueMutex
+	aggregationExpired []aggregation
+	// children that were missing at a timeout of a message-type, with the
+	// number of messages sent to them at that time
+	lateChildren map[network.PacketTypeID]map[TreeNodeID]int
 	// done callback
 	onDoneCallback func() bool
 	// queue holding msgs
@@ -44,8 +76,25 @@ type TreeNodeInstance struct {
 	msgDispatchQueueMutex sync.Mutex
 	// kicking off new message
 	msgDispatchQueueWait chan bool
+	// maximum length of msgDispatchQueue, 0 means MaxInstanceQueue
+	queueLimit int
 	// whether this node is closing
 	closing bool
+	// finished is closed once the protocol instance called Done
+	finished     chan struct{}
+	finishedOnce sync.Once
+	// futureErr is the error channel of the ProtocolFuture of the instance,
+	// nil if it hasn't been launched. It is protected by the instancesLock
+	// of the Overlay.
+	futureErr chan error
+	// created is the creation time of the instance
+	created time.Time
+	// lastActive is the last time in nanoseconds a message has been received
+	// or sent, it is accessed atomically
+	lastActive int64
+	// dispatched counts the messages handled by the dispatcher, it is
+	// accessed atomically
+	dispatched uint64
 }
 
 // aggregateMessages (if set) tells to aggregate messages from all children
@@ -66,10 +115,21 @@ func newTreeNodeInstance(o *Overlay, tok *Token, tn *TreeNode) *TreeNodeInstance
 		handlers:             make(map[network.PacketTypeID]interface{}),
 		messageTypeFlags:     make(map[network.PacketTypeID]uint32),
 		msgQueue:             make(map[network.PacketTypeID][]*ProtocolMsg),
+		aggregationTimeouts:  make(map[network.PacketTypeID]time.Duration),
+		missingChannels:      make(map[network.PacketTypeID]chan []*TreeNode),
+		aggregationRounds:    make(map[network.PacketTypeID]int),
+		aggregationTimers:    make(map[network.PacketTypeID]*time.Timer),
+		lateChildren:         make(map[network.PacketTypeID]map[TreeNodeID]int),
 		treeNode:             tn,
+		sendFailures:         make(map[TreeNodeID]time.Time),
+		sentTo:               make(map[TreeNodeID]int),
+		receivedFrom:         make(map[TreeNodeID]int),
 		msgDispatchQueue:     make([]*ProtocolMsg, 0, 1),
 		msgDispatchQueueWait: make(chan bool, 1),
+		finished:             make(chan struct{}),
+		created:              time.Now(),
 	}
+	n.active()
 	go n.dispatchMsgReader()
 	return n
 }
@@ -77,22 +137,24 @@ func newTreeNodeInstance(o *Overlay, tok *Token, tn *TreeNode) *TreeNodeInstance
 // TreeNode gets the treeNode of this node. If there is no TreeNode for the
 // Token of this node, the function will return nil
 func (n *TreeNodeInstance) TreeNode() *TreeNode {
+	n.treeNodeLock.Lock()
+	defer n.treeNodeLock.Unlock()
 	return n.treeNode
 }
 
 // ServerIdentity returns our entity
 func (n *TreeNodeInstance) ServerIdentity() *network.ServerIdentity {
-	return n.treeNode.ServerIdentity
+	return n.TreeNode().ServerIdentity
 }
 
 // Parent returns the parent-TreeNode of ourselves
 func (n *TreeNodeInstance) Parent() *TreeNode {
-	return n.treeNode.Parent
+	return n.TreeNode().Parent
 }
 
 // Children returns the children of ourselves
 func (n *TreeNodeInstance) Children() []*TreeNode {
-	return n.treeNode.Children
+	return n.TreeNode().Children
 }
 
 // Root returns the root-node of that tree
@@ -102,12 +164,12 @@ func (n *TreeNodeInstance) Root() *TreeNode {
 
 // IsRoot returns whether whether we are at the top of the tree
 func (n *TreeNodeInstance) IsRoot() bool {
-	return n.treeNode.Parent == nil
+	return n.TreeNode().Parent == nil
 }
 
 // IsLeaf returns whether whether we are at the bottom of the tree
 func (n *TreeNodeInstance) IsLeaf() bool {
-	return len(n.treeNode.Children) == 0
+	return len(n.TreeNode().Children) == 0
 }
 
 // SendTo sends to a given node
@@ -115,7 +177,13 @@ func (n *TreeNodeInstance) SendTo(to *TreeNode, msg interface{}) error {
 	if to == nil {
 		return errors.New("Sent to a nil TreeNode")
 	}
-	return n.overlay.SendToTreeNode(n.token, to, msg)
+	n.active()
+	n.treeNodeLock.Lock()
+	received := n.receivedFrom[to.ID]
+	n.treeNodeLock.Unlock()
+	err := n.overlay.sendToTreeNode(n.token, to, msg, received)
+	n.sent(to, err)
+	return err
 }
 
 // Tree returns the tree of that node
@@ -141,6 +209,8 @@ func (n *TreeNodeInstance) Suite() abstract.Suite {
 // - registration of the message-type
 // - aggregation or not of messages: if you give a channel of slices, the
 //   messages will be aggregated, else they will come one-by-one
+// The children whose message is missing when an aggregation times out can
+// be received with SetMissingChannel.
 func (n *TreeNodeInstance) RegisterChannel(c interface{}) error {
 	flags := uint32(0)
 	cr := reflect.TypeOf(c)
@@ -198,6 +268,8 @@ func (n *TreeNodeInstance) RegisterChannels(channels ...interface{}) error {
 // - registration of the message-type
 // - aggregation or not of messages: if you give a channel of slices, the
 //   messages will be aggregated, else they will come one-by-one
+// A function taking a slice can take the children whose message is missing
+// as a second argument of type []*TreeNode, see SetAggregationTimeout.
 func (n *TreeNodeInstance) RegisterHandler(c interface{}) error {
 	flags := uint32(0)
 	cr := reflect.TypeOf(c)
@@ -205,6 +277,14 @@ func (n *TreeNodeInstance) RegisterHandler(c interface{}) error {
 	if cr.Kind() != reflect.Func {
 		return errors.New("Input is not function")
 	}
+	if cr.NumIn() == 2 {
+		if cr.In(0).Kind() != reflect.Slice ||
+			cr.In(1) != reflect.TypeOf([]*TreeNode{}) {
+			return errors.New("Second argument is not the missing children")
+		}
+	} else if cr.NumIn() != 1 {
+		return errors.New("Input is not function with one or two arguments")
+	}
 	cr = cr.In(0)
 	if cr.Kind() == reflect.Slice {
 		flags += AggregateMessages
@@ -266,6 +346,11 @@ func (n *TreeNodeInstance) Close() error {
 		n.msgDispatchQueueWait <- true
 	}
 	n.msgDispatchQueueMutex.Unlock()
+	n.stopRepair()
+	if !n.isBound() {
+		// the protocol instance failed to be created
+		return nil
+	}
 	return n.ProtocolInstance().Shutdown()
 }
 
@@ -274,7 +359,7 @@ func (n *TreeNodeInstance) ProtocolName() string {
 	return n.overlay.conode.protocols.ProtocolIDToName(n.token.ProtoID)
 }
 
-func (n *TreeNodeInstance) dispatchHandler(msgSlice []*ProtocolMsg) error {
+func (n *TreeNodeInstance) dispatchHandler(msgSlice []*ProtocolMsg, missing []*TreeNode) error {
 	mt := msgSlice[0].MsgType
 	to := reflect.TypeOf(n.handlers[mt]).In(0)
 	f := reflect.ValueOf(n.handlers[mt])
@@ -284,7 +369,11 @@ func (n *TreeNodeInstance) dispatchHandler(msgSlice []*ProtocolMsg) error {
 			msgs.Index(i).Set(n.reflectCreate(to.Elem(), msg))
 		}
 		log.Lvl4("Dispatching aggregation to", n.ServerIdentity().Address)
-		f.Call([]reflect.Value{msgs})
+		args := []reflect.Value{msgs}
+		if f.Type().NumIn() == 2 {
+			args = append(args, reflect.ValueOf(missing))
+		}
+		f.Call(args)
 	} else {
 		for _, msg := range msgSlice {
 			log.Lvl4("Dispatching to", n.ServerIdentity().Address)
@@ -336,7 +425,18 @@ func (n *TreeNodeInstance) DispatchChannel(msgSlice []*ProtocolMsg) error {
 // This allows a protocol to have a backlog of messages.
 func (n *TreeNodeInstance) ProcessProtocolMsg(msg *ProtocolMsg) {
 	log.Lvl4(n.Info(), "Received message")
+	n.active()
 	n.msgDispatchQueueMutex.Lock()
+	limit := n.queueLimit
+	if limit == 0 {
+		limit = MaxInstanceQueue
+	}
+	if len(n.msgDispatchQueue) >= limit {
+		n.msgDispatchQueueMutex.Unlock()
+		log.Lvl2(n.Info(), "DispatchQueue is full - dropping message")
+		atomic.AddUint64(&n.overlay.dropped.InstanceQueue, 1)
+		return
+	}
 	n.msgDispatchQueue = append(n.msgDispatchQueue, msg)
 	log.Lvl4(n.Info(), "DispatchQueue-length is", len(n.msgDispatchQueue))
 	if len(n.msgDispatchQueue) == 1 && len(n.msgDispatchQueueWait) == 0 {
@@ -345,6 +445,15 @@ func (n *TreeNodeInstance) ProcessProtocolMsg(msg *ProtocolMsg) {
 	n.msgDispatchQueueMutex.Unlock()
 }
 
+// SetQueueLimit sets the maximum number of messages waiting to be
+// dispatched to the protocol instance. Further messages are dropped. A limit
+// of 0 uses MaxInstanceQueue.
+func (n *TreeNodeInstance) SetQueueLimit(limit int) {
+	n.msgDispatchQueueMutex.Lock()
+	n.queueLimit = limit
+	n.msgDispatchQueueMutex.Unlock()
+}
+
 func (n *TreeNodeInstance) dispatchMsgReader() {
 	for {
 		n.msgDispatchQueueMutex.Lock()
@@ -353,16 +462,25 @@ func (n *TreeNodeInstance) dispatchMsgReader() {
 			n.msgDispatchQueueMutex.Unlock()
 			return
 		}
-		if len(n.msgDispatchQueue) > 0 {
+		if len(n.aggregationExpired) > 0 {
+			a := n.aggregationExpired[0]
+			n.aggregationExpired = n.aggregationExpired[1:]
+			n.msgDispatchQueueMutex.Unlock()
+			if err := n.dispatchPartial(a); err != nil {
+				log.Error("Error while dispatching partial aggregation:", err)
+			}
+		} else if len(n.msgDispatchQueue) > 0 {
 			log.Lvl4(n.Info(), "Read message and dispatching it",
 				len(n.msgDispatchQueue))
 			msg := n.msgDispatchQueue[0]
 			n.msgDispatchQueue = n.msgDispatchQueue[1:]
 			n.msgDispatchQueueMutex.Unlock()
+			n.overlay.trace(n, msg)
 			err := n.dispatchMsgToProtocol(msg)
 			if err != nil {
 				log.Error("Error while dispatching message:", err)
 			}
+			atomic.AddUint64(&n.dispatched, 1)
 		} else {
 			n.msgDispatchQueueMutex.Unlock()
 			log.Lvl4(n.Info(), "Waiting for message")
@@ -385,6 +503,9 @@ func (n *TreeNodeInstance) dispatchMsgToProtocol(sdaMsg *ProtocolMsg) error {
 	// Put the msg into SDAData
 	sdaMsg.MsgType = t
 	sdaMsg.Msg = msg
+	n.treeNodeLock.Lock()
+	n.receivedFrom[sdaMsg.From.TreeNodeID]++
+	n.treeNodeLock.Unlock()
 
 	// if message comes from parent, dispatch directly
 	// if messages come from children we must aggregate them
@@ -395,18 +516,20 @@ func (n *TreeNodeInstance) dispatchMsgToProtocol(sdaMsg *ProtocolMsg) error {
 		return nil
 	}
 	log.Lvlf5("%s->%s: Message is: %+v", n.Name(), sdaMsg.Msg)
+	return n.dispatch(msgType, msgs, nil)
+}
 
+// dispatch gives the messages to the channel or the handler of their type.
+func (n *TreeNodeInstance) dispatch(msgType network.PacketTypeID, msgs []*ProtocolMsg, missing []*TreeNode) error {
 	switch {
 	case n.channels[msgType] != nil:
 		log.Lvl4(n.Name(), "Dispatching to channel")
-		err = n.DispatchChannel(msgs)
+		return n.DispatchChannel(msgs)
 	case n.handlers[msgType] != nil:
 		log.Lvl4("Dispatching to handler", n.ServerIdentity().Address)
-		err = n.dispatchHandler(msgs)
-	default:
-		return errors.New("This message-type is not handled by this protocol")
+		return n.dispatchHandler(msgs, missing)
 	}
-	return err
+	return errors.New("This message-type is not handled by this protocol")
 }
 
 // SetFlag makes sure a given flag is set
@@ -434,9 +557,19 @@ func (n *TreeNodeInstance) aggregate(sdaMsg *ProtocolMsg) (network.PacketTypeID,
 	if fromParent || !n.HasFlag(mt, AggregateMessages) {
 		return mt, []*ProtocolMsg{sdaMsg}, true
 	}
+	late := n.lateChildren[mt]
+	if sent, ok := late[sdaMsg.From.TreeNodeID]; ok {
+		if sdaMsg.Received <= sent {
+			// the child replies to a message sent before the timeout
+			log.Lvl2(n.Info(), "dropping late message of", sdaMsg.From.TreeNodeID)
+			return mt, nil, false
+		}
+		delete(late, sdaMsg.From.TreeNodeID)
+	}
 	// store the msg according to its type
 	if _, ok := n.msgQueue[mt]; !ok {
 		n.msgQueue[mt] = make([]*ProtocolMsg, 0)
+		n.startAggregation(mt)
 	}
 	msgs := append(n.msgQueue[mt], sdaMsg)
 	n.msgQueue[mt] = msgs
@@ -448,12 +581,111 @@ func (n *TreeNodeInstance) aggregate(sdaMsg *ProtocolMsg) (network.PacketTypeID,
 	if len(msgs) == len(n.Children()) {
 		// erase
 		delete(n.msgQueue, mt)
+		if t, ok := n.aggregationTimers[mt]; ok {
+			t.Stop()
+			delete(n.aggregationTimers, mt)
+		}
 		return mt, msgs, true
 	}
 	// no we still have to wait!
 	return mt, nil, false
 }
 
+// aggregation identifies one aggregation of messages of a type.
+type aggregation struct {
+	msgType network.PacketTypeID
+	round   int
+}
+
+// SetAggregationTimeout sets the maximum time to wait for the messages of
+// all children of the aggregated message-type mt, starting with the first
+// message. Once it passed, the messages received so far are dispatched. A
+// handler taking the missing children as a second argument gets them, see
+// RegisterHandler. The messages a missing child sends in reply to the
+// messages it got before the timeout are dropped, as they belong to the
+// aggregation that timed out. A timeout of 0 waits for all children, which
+// is the default. It can be called while the protocol runs.
+func (n *TreeNodeInstance) SetAggregationTimeout(mt network.PacketTypeID, timeout time.Duration) {
+	n.aggregationLock.Lock()
+	defer n.aggregationLock.Unlock()
+	n.aggregationTimeouts[mt] = timeout
+}
+
+// SetMissingChannel sets the channel receiving the missing children of the
+// aggregations of mt that timed out, for protocols receiving mt on a
+// channel. The missing children are sent before the messages, so that the
+// protocol can check c without blocking once it got the messages. c should
+// be buffered, as the dispatching waits until the missing children are
+// received.
+func (n *TreeNodeInstance) SetMissingChannel(mt network.PacketTypeID, c chan []*TreeNode) {
+	n.aggregationLock.Lock()
+	defer n.aggregationLock.Unlock()
+	n.missingChannels[mt] = c
+}
+
+// startAggregation starts the timer of a new aggregation of mt, if a
+// timeout is set.
+func (n *TreeNodeInstance) startAggregation(mt network.PacketTypeID) {
+	n.aggregationRounds[mt]++
+	n.aggregationLock.Lock()
+	timeout := n.aggregationTimeouts[mt]
+	n.aggregationLock.Unlock()
+	if timeout <= 0 {
+		return
+	}
+	a := aggregation{mt, n.aggregationRounds[mt]}
+	n.aggregationTimers[mt] = time.AfterFunc(timeout, func() {
+		n.msgDispatchQueueMutex.Lock()
+		defer n.msgDispatchQueueMutex.Unlock()
+		n.aggregationExpired = append(n.aggregationExpired, a)
+		if len(n.msgDispatchQueueWait) == 0 {
+			n.msgDispatchQueueWait <- true
+		}
+	})
+}
+
+// dispatchPartial dispatches the messages of an aggregation that timed out,
+// together with the children that didn't send their message.
+func (n *TreeNodeInstance) dispatchPartial(a aggregation) error {
+	msgs := n.msgQueue[a.msgType]
+	if n.aggregationRounds[a.msgType] != a.round || len(msgs) == 0 {
+		// the aggregation finished before the timeout
+		return nil
+	}
+	delete(n.msgQueue, a.msgType)
+	delete(n.aggregationTimers, a.msgType)
+	received := make(map[TreeNodeID]bool)
+	for _, msg := range msgs {
+		received[msg.From.TreeNodeID] = true
+	}
+	var missing []*TreeNode
+	late, ok := n.lateChildren[a.msgType]
+	if !ok {
+		late = make(map[TreeNodeID]int)
+		n.lateChildren[a.msgType] = late
+	}
+	children := n.Children()
+	n.treeNodeLock.Lock()
+	for _, c := range children {
+		if !received[c.ID] {
+			missing = append(missing, c)
+			late[c.ID] = n.sentTo[c.ID]
+		}
+	}
+	n.treeNodeLock.Unlock()
+	log.Lvl2(n.Info(), "aggregation timed out with", len(missing),
+		"missing children")
+	if n.channels[a.msgType] != nil {
+		n.aggregationLock.Lock()
+		c := n.missingChannels[a.msgType]
+		n.aggregationLock.Unlock()
+		if c != nil {
+			c <- missing
+		}
+	}
+	return n.dispatch(a.msgType, msgs, missing)
+}
+
 // StartProtocol calls the Start() on the underlying protocol which in turn will
 // initiate the first message to its children
 func (n *TreeNodeInstance) StartProtocol() error {
@@ -470,6 +702,9 @@ func (n *TreeNodeInstance) Done() {
 		}
 	}
 	log.Lvl3(n.Info(), "has finished. Deleting its resources")
+	n.finishedOnce.Do(func() {
+		close(n.finished)
+	})
 	n.overlay.nodeDone(n.token)
 }
 
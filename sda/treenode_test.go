@@ -54,3 +54,26 @@ func (s *spawnProto) Start() error {
 	go proto.Start()
 	return nil
 }
+
+func TestTreeNodeQueueLimit(t *testing.T) {
+	GlobalProtocolRegister("ProtocolOverlay", newProtocolOverlay)
+	local := NewLocalTest()
+	defer local.CloseAll()
+
+	hosts, _, tree := local.GenTree(1, true)
+	pi, err := hosts[0].overlay.CreateProtocolSDA("ProtocolOverlay", tree)
+	log.ErrFatal(err)
+	n := pi.(*ProtocolOverlay).TreeNodeInstance
+	// stop the dispatching so that the messages stay in the queue
+	log.ErrFatal(n.Close())
+	n.SetQueueLimit(2)
+	for i := 0; i < 5; i++ {
+		n.ProcessProtocolMsg(&ProtocolMsg{})
+	}
+	if len(n.msgDispatchQueue) != 2 {
+		t.Fatal("Queue should hold 2 messages, not", len(n.msgDispatchQueue))
+	}
+	if d := hosts[0].DropStats().InstanceQueue; d != 3 {
+		t.Fatal("3 messages should be dropped, not", d)
+	}
+}
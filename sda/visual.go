@@ -0,0 +1,122 @@
+package sda
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// NodeMetrics holds values measured on the members of a Roster, like the
+// latency or the number of messages of a finished simulation. The first
+// index is the position of the member in the Roster, the second one the name
+// of the value.
+type NodeMetrics map[int]map[string]float64
+
+// ExportDOT returns the tree in the DOT language of Graphviz. Every TreeNode
+// is labeled with the address of its ServerIdentity and with its metrics,
+// if metrics is not nil.
+func (t *Tree) ExportDOT(metrics NodeMetrics) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote("tree-"+t.ID.String()))
+	b.WriteString("\tnode [shape=box];\n")
+	t.Root.Visit(0, func(d int, tn *TreeNode) {
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", strconv.Quote(tn.ID.String()),
+			strconv.Quote(dotLabel(tn.ServerIdentity.Address.String(),
+				metrics[tn.RosterIndex])))
+		if tn.Parent != nil {
+			fmt.Fprintf(&b, "\t%s -> %s;\n",
+				strconv.Quote(tn.Parent.ID.String()),
+				strconv.Quote(tn.ID.String()))
+		}
+	})
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ExportDOT returns the members of the Roster as nodes of an undirected
+// graph in the DOT language of Graphviz, labeled like in Tree.ExportDOT.
+func (el *Roster) ExportDOT(metrics NodeMetrics) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "graph %s {\n", strconv.Quote("roster-"+el.ID.String()))
+	b.WriteString("\tnode [shape=box];\n")
+	for i, si := range el.List {
+		fmt.Fprintf(&b, "\t%d [label=%s];\n", i,
+			strconv.Quote(dotLabel(si.Address.String(), metrics[i])))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotLabel returns the address followed by one line per metric, sorted by
+// name.
+func dotLabel(address string, metrics map[string]float64) string {
+	label := address
+	for _, name := range metricNames(metrics) {
+		label += fmt.Sprintf("\n%s=%g", name, metrics[name])
+	}
+	return label
+}
+
+func metricNames(metrics map[string]float64) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nodeJSON is a member of a Roster or a TreeNode in the JSON exports.
+type nodeJSON struct {
+	ID          string             `json:"id,omitempty"`
+	RosterIndex int                `json:"roster_index"`
+	Address     string             `json:"address"`
+	Public      string             `json:"public"`
+	Metrics     map[string]float64 `json:"metrics,omitempty"`
+	Children    []*nodeJSON        `json:"children,omitempty"`
+}
+
+// ExportJSON returns the tree as indented JSON. The root holds its
+// children recursively and every node has the address and public key of its
+// ServerIdentity and its metrics, if metrics is not nil.
+func (t *Tree) ExportJSON(metrics NodeMetrics) ([]byte, error) {
+	var export func(tn *TreeNode) *nodeJSON
+	export = func(tn *TreeNode) *nodeJSON {
+		n := &nodeJSON{
+			ID:          tn.ID.String(),
+			RosterIndex: tn.RosterIndex,
+			Address:     tn.ServerIdentity.Address.String(),
+			Public:      tn.ServerIdentity.Public.String(),
+			Metrics:     metrics[tn.RosterIndex],
+		}
+		for _, c := range tn.Children {
+			n.Children = append(n.Children, export(c))
+		}
+		return n
+	}
+	return json.MarshalIndent(struct {
+		ID     string    `json:"id"`
+		Roster string    `json:"roster"`
+		Root   *nodeJSON `json:"root"`
+	}{t.ID.String(), t.Roster.ID.String(), export(t.Root)}, "", "\t")
+}
+
+// ExportJSON returns the members of the Roster as indented JSON, like the
+// nodes of Tree.ExportJSON.
+func (el *Roster) ExportJSON(metrics NodeMetrics) ([]byte, error) {
+	list := make([]*nodeJSON, len(el.List))
+	for i, si := range el.List {
+		list[i] = &nodeJSON{
+			RosterIndex: i,
+			Address:     si.Address.String(),
+			Public:      si.Public.String(),
+			Metrics:     metrics[i],
+		}
+	}
+	return json.MarshalIndent(struct {
+		ID   string      `json:"id"`
+		List []*nodeJSON `json:"list"`
+	}{el.ID.String(), list}, "", "\t")
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 
 	"fmt"
@@ -21,6 +22,10 @@ import (
 // ServiceName is the name to refer to the CoSi service
 const ServiceName = "CoSi"
 
+// signatureTimeout is how long the service waits for the protocol to finish
+// before giving up.
+const signatureTimeout = 10 * time.Second
+
 func init() {
 	sda.RegisterNewService(ServiceName, newCoSiService)
 	network.RegisterPacketType(&SignatureRequest{})
@@ -53,21 +58,39 @@ func (cs *CoSi) SignatureRequest(si *network.ServerIdentity, req *SignatureReque
 	if err != nil {
 		return nil, errors.New("Couldn't make new protocol: " + err.Error())
 	}
-	cs.RegisterProtocolInstance(pi)
+	if err := cs.RegisterProtocolInstance(pi); err != nil {
+		return nil, errors.New("Couldn't register protocol: " + err.Error())
+	}
 	pcosi := pi.(*protocol.CoSi)
 	pcosi.SigningMessage(req.Message)
 	h, err := crypto.HashBytes(network.Suite.Hash(), req.Message)
 	if err != nil {
 		return nil, errors.New("Couldn't hash message: " + err.Error())
 	}
-	response := make(chan []byte)
+	response := make(chan []byte, 1)
 	pcosi.RegisterSignatureHook(func(sig []byte) {
 		response <- sig
 	})
 	log.Lvl3("Cosi Service starting up root protocol")
-	go pi.Dispatch()
-	go pi.Start()
-	sig := <-response
+	future, err := cs.LaunchProtocol(pi)
+	if err != nil {
+		return nil, errors.New("Couldn't start protocol: " + err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), signatureTimeout)
+	defer cancel()
+	if err := future.Wait(ctx); err != nil {
+		if err == context.DeadlineExceeded {
+			return nil, network.NewServiceError(network.ErrorCodeTimeout,
+				"Timed out while waiting for signature")
+		}
+		return nil, errors.New("Couldn't get signature: " + err.Error())
+	}
+	var sig []byte
+	select {
+	case sig = <-response:
+	default:
+		return nil, errors.New("Protocol finished without signature")
+	}
 	if log.DebugVisible() > 1 {
 		fmt.Printf("%s: Signed a message.\n", time.Now().Format("Mon Jan 2 15:04:05 -0700 MST 2006"))
 	}
@@ -117,7 +117,7 @@ func (s *Service) CreateIdentity(si *network.ServerIdentity, ai *CreateIdentity)
 func (s *Service) ConfigUpdate(si *network.ServerIdentity, cu *ConfigUpdate) (network.Body, error) {
 	sid := s.getIdentityStorage(cu.ID)
 	if sid == nil {
-		return nil, errors.New("Didn't find Identity")
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "Didn't find Identity")
 	}
 	sid.Lock()
 	defer sid.Unlock()
@@ -133,7 +133,7 @@ func (s *Service) ProposeSend(si *network.ServerIdentity, p *ProposeSend) (netwo
 	log.Lvl2(s, "Storing new proposal")
 	sid := s.getIdentityStorage(p.ID)
 	if sid == nil {
-		return nil, errors.New("Didn't find Identity")
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "Didn't find Identity")
 	}
 	roster := sid.Root.Roster
 	replies, err := s.propagateConfig(roster, p, propagateTimeout)
@@ -151,7 +151,7 @@ func (s *Service) ProposeUpdate(si *network.ServerIdentity, cnc *ProposeUpdate)
 	log.Lvl3(s, "Sending proposal-update to client")
 	sid := s.getIdentityStorage(cnc.ID)
 	if sid == nil {
-		return nil, errors.New("Didn't find Identity")
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "Didn't find Identity")
 	}
 	sid.Lock()
 	defer sid.Unlock()
@@ -168,7 +168,7 @@ func (s *Service) ProposeVote(si *network.ServerIdentity, v *ProposeVote) (netwo
 	// First verify if the signature is legitimate
 	sid := s.getIdentityStorage(v.ID)
 	if sid == nil {
-		return nil, errors.New("Didn't find identity")
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "Didn't find identity")
 	}
 
 	// Putting this in a function because of the lock which needs to be held
@@ -179,7 +179,7 @@ func (s *Service) ProposeVote(si *network.ServerIdentity, v *ProposeVote) (netwo
 		log.Lvl3("Voting on", sid.Proposed.Device)
 		owner, ok := sid.Latest.Device[v.Signer]
 		if !ok {
-			return errors.New("Didn't find signer")
+			return network.NewServiceError(network.ErrorCodeNotFound, "Didn't find signer")
 		}
 		if sid.Proposed == nil {
 			return errors.New("No proposed block")
@@ -195,7 +195,8 @@ func (s *Service) ProposeVote(si *network.ServerIdentity, v *ProposeVote) (netwo
 		if v.Signature != nil {
 			err = crypto.VerifySchnorr(network.Suite, owner.Point, hash, *v.Signature)
 			if err != nil {
-				return errors.New("Wrong signature: " + err.Error())
+				return network.NewServiceError(network.ErrorCodeInvalidSignature,
+					"Wrong signature: "+err.Error())
 			}
 		}
 		return nil
@@ -378,6 +379,14 @@ func (s *Service) tryLoad() error {
 		log.Lvl3("Successfully loaded")
 		s.StorageMap = msg.(*StorageMap)
 	}
+	// the rosters stored by older versions have random IDs
+	for _, is := range s.Identities {
+		for _, sb := range []*skipchain.SkipBlock{is.Root, is.Data} {
+			if sb != nil && sb.Roster != nil {
+				s.RegisterLegacyRoster(sb.Roster)
+			}
+		}
+	}
 	return nil
 }
 
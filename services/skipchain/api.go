@@ -55,8 +55,16 @@ func (c *Client) ProposeRoster(latest *SkipBlock, el *sda.Roster) (reply *Propos
 
 // CreateRoster will create a new SkipChainRoster with the parameters given
 func (c *Client) CreateRoster(el *sda.Roster, baseH, maxH int, ver VerifierID, parent SkipBlockID) (*SkipBlock, error) {
+	return c.CreateRosterWitnessed(el, nil, baseH, maxH, ver, parent)
+}
+
+// CreateRosterWitnessed will create a new SkipChainRoster like CreateRoster,
+// but the hash of every SkipBlock of that chain will also be collectively
+// signed by the witnesses. If witnesses is nil, no witnessing is done.
+func (c *Client) CreateRosterWitnessed(el, witnesses *sda.Roster, baseH, maxH int, ver VerifierID, parent SkipBlockID) (*SkipBlock, error) {
 	genesis := NewSkipBlock()
 	genesis.Roster = el
+	genesis.Witnesses = witnesses
 	genesis.VerifierID = ver
 	genesis.MaximumHeight = maxH
 	genesis.BaseHeight = baseH
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/dedis/cothority/network"
+	"github.com/dedis/cothority/protocols/bftcosi"
 	"github.com/dedis/cothority/sda"
 	"github.com/satori/go.uuid"
 )
@@ -24,6 +25,7 @@ func init() {
 		&ForwardSignature{},
 		&SkipBlockFix{},
 		&SkipBlock{},
+		&WitnessedMap{},
 		// Own service
 		&Service{},
 	}
@@ -131,3 +133,48 @@ type ForwardSignature struct {
 	ToUpdate SkipBlockID
 	Latest   *SkipBlock
 }
+
+// WitnessSkipBlockID is the network-ID of WitnessSkipBlock
+var WitnessSkipBlockID = network.RegisterPacketType(WitnessSkipBlock{})
+
+// WitnessSkipBlockReplyID is the network-ID of WitnessSkipBlockReply
+var WitnessSkipBlockReplyID = network.RegisterPacketType(WitnessSkipBlockReply{})
+
+// WitnessConfirmID is the network-ID of WitnessConfirm
+var WitnessConfirmID = network.RegisterPacketType(WitnessConfirm{})
+
+// WitnessSkipBlock asks the first of the Witnesses of a SkipChain to start a
+// BFTCoSi-round with all Witnesses on the hash of a newly signed SkipBlock.
+// Previous is the block before SkipBlock, so that a witness that missed it
+// can catch up - it is nil for a genesis block.
+type WitnessSkipBlock struct {
+	SkipBlock *SkipBlock
+	Previous  *SkipBlock
+}
+
+// WitnessSkipBlockReply returns the collective signature of the Witnesses.
+// If the Witnesses refused to sign, Signature is empty and Error and Code
+// hold the reason.
+type WitnessSkipBlockReply struct {
+	Hash      SkipBlockID
+	Signature *bftcosi.BFTSignature
+	Error     string
+	Code      network.ErrorCode
+}
+
+// WitnessConfirm is sent by the first of the Witnesses to all Witnesses once
+// they signed a SkipBlock, so that they record it as witnessed.
+type WitnessConfirm struct {
+	SkipBlock *SkipBlock
+}
+
+// WitnessedMap holds the SkipBlocks a conode witnessed. It is saved, so that
+// a restarted witness still refuses to sign forks.
+type WitnessedMap struct {
+	// Next maps the hash of a SkipBlock to the hash of the SkipBlock
+	// witnessed as its successor
+	Next map[string]SkipBlockID
+	// Rosters maps the hash of a witnessed SkipBlock to its roster, which
+	// has to sign its successor
+	Rosters map[string]*sda.Roster
+}
@@ -22,11 +22,16 @@ import (
 	"github.com/dedis/cothority/protocols/bftcosi"
 	"github.com/dedis/cothority/protocols/manage"
 	"github.com/dedis/cothority/sda"
+	"github.com/satori/go.uuid"
 )
 
 // ServiceName can be used to refer to the name of this service
 const ServiceName = "Skipchain"
 const skipchainBFT = "SkipchainBFT"
+const skipchainWitness = "SkipchainWitness"
+
+// How long to wait for the Witnesses to sign a new SkipBlock.
+const witnessTimeout = time.Second * 60
 
 func init() {
 	sda.RegisterNewService(ServiceName, newSkipchainService)
@@ -49,6 +54,17 @@ type Service struct {
 	path      string
 	verifiers map[VerifierID]SkipBlockVerifier
 
+	// witnessReplies holds the channels waiting for the signature of the
+	// Witnesses, indexed by the hash of the SkipBlock
+	witnessReplies map[string]chan *WitnessSkipBlockReply
+	// witnessed holds the SkipBlocks we witnessed, so that we never sign
+	// a fork
+	witnessed *WitnessedMap
+	// witnessPending holds the blocks we agreed to witness, but which are
+	// not confirmed yet, indexed by the hash of their previous block
+	witnessPending map[string]*pendingWitness
+	witnessMutex   sync.Mutex
+
 	// testVerify is set to true if a verification happened - only for testing
 	testVerify bool
 }
@@ -73,12 +89,13 @@ func (s *Service) ProposeSkipBlock(si *network.ServerIdentity, psbd *ProposeSkip
 		var ok bool
 		prev, ok = s.getSkipBlockByID(psbd.LatestID)
 		if !ok {
-			return nil, errors.New("Didn't find latest block")
+			return nil, network.NewServiceError(network.ErrorCodeNotFound, "Didn't find latest block")
 		}
 		prop.MaximumHeight = prev.MaximumHeight
 		prop.BaseHeight = prev.BaseHeight
 		prop.ParentBlockID = prev.ParentBlockID
 		prop.VerifierID = prev.VerifierID
+		prop.Witnesses = prev.Witnesses
 		prop.Index = prev.Index + 1
 		index := prop.Index
 		for prop.Height = 1; index%prop.BaseHeight == 0; prop.Height++ {
@@ -132,7 +149,7 @@ func (s *Service) ProposeSkipBlock(si *network.ServerIdentity, psbd *ProposeSkip
 
 	prev, prop, err = s.signNewSkipBlock(prev, prop)
 	if err != nil {
-		return nil, errors.New("Verification error: " + err.Error())
+		return nil, wrapError("Verification error: ", err)
 	}
 	s.save()
 
@@ -150,7 +167,7 @@ func (s *Service) ProposeSkipBlock(si *network.ServerIdentity, psbd *ProposeSkip
 func (s *Service) GetUpdateChain(si *network.ServerIdentity, latestKnown *GetUpdateChain) (network.Body, error) {
 	block, ok := s.getSkipBlockByID(latestKnown.LatestID)
 	if !ok {
-		return nil, errors.New("Couldn't find latest skipblock")
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "Couldn't find latest skipblock")
 	}
 	// at least the latest know and the next block:
 	blocks := []*SkipBlock{block}
@@ -176,11 +193,11 @@ func (s *Service) SetChildrenSkipBlock(si *network.ServerIdentity, scsb *SetChil
 	childID := scsb.ChildID
 	parent, ok := s.getSkipBlockByID(parentID)
 	if !ok {
-		return nil, errors.New("couldn't find skipblock")
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "couldn't find skipblock")
 	}
 	child, ok := s.getSkipBlockByID(childID)
 	if !ok {
-		return nil, errors.New("couldn't find skipblock")
+		return nil, network.NewServiceError(network.ErrorCodeNotFound, "couldn't find skipblock")
 	}
 	child.ParentBlockID = parentID
 	parent.ChildSL = NewBlockLink()
@@ -273,7 +290,7 @@ func (s *Service) signNewSkipBlock(latest, newest *SkipBlock) (*SkipBlock, *Skip
 	}
 	// Now verify if it's a valid block
 	if err := s.verifyNewSkipBlock(latest, newest); err != nil {
-		return nil, nil, errors.New("Verification of newest SkipBlock failed: " + err.Error())
+		return nil, nil, wrapError("Verification of newest SkipBlock failed: ", err)
 	}
 
 	// Sign it
@@ -281,6 +298,12 @@ func (s *Service) signNewSkipBlock(latest, newest *SkipBlock) (*SkipBlock, *Skip
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := s.startRosterSignature(latest, newest); err != nil {
+		return nil, nil, err
+	}
+	if err := s.startWitnessSignature(latest, newest); err != nil {
+		return nil, nil, err
+	}
 	if err := newest.VerifySignatures(); err != nil {
 		log.Error("Couldn't verify signature: " + err.Error())
 		return nil, nil, err
@@ -309,18 +332,51 @@ func (s *Service) signNewSkipBlock(latest, newest *SkipBlock) (*SkipBlock, *Skip
 }
 
 func (s *Service) startBFTSignature(block *SkipBlock) error {
-	done := make(chan bool)
-	// create the message we want to sign for this round
-	msg := []byte(block.Hash)
 	el, err := block.GetResponsible(s)
 	if err != nil {
 		return err
 	}
+	sig, err := s.bftSignature(block, el)
+	if err != nil {
+		return err
+	}
+	block.BlockSig = sig
+	return nil
+}
+
+// startRosterSignature lets the roster of latest sign newest, if newest
+// changes the roster of a witnessed SkipChain. The Witnesses only follow
+// the new roster if the previous one accepted it.
+func (s *Service) startRosterSignature(latest, newest *SkipBlock) error {
+	if latest == nil || newest.Witnesses == nil ||
+		sameRoster(latest.Roster, newest.Roster) {
+		return nil
+	}
+	if latest.Roster == nil {
+		return errors.New("Previous block has no Roster")
+	}
+	sig, err := s.bftSignature(newest, latest.Roster)
+	if err != nil {
+		return wrapError("Previous roster refused the new roster: ", err)
+	}
+	newest.RosterSig = sig
+	return nil
+}
+
+// bftSignature runs a BFTCoSi-round with the roster el on the hash of the
+// block and returns the signature, which has to be signed by everybody.
+func (s *Service) bftSignature(block *SkipBlock, el *sda.Roster) (*bftcosi.BFTSignature, error) {
+	done := make(chan bool)
+	// create the message we want to sign for this round
+	msg := []byte(block.Hash)
 	switch len(el.List) {
 	case 0:
-		return errors.New("Found empty Roster")
+		return nil, errors.New("Found empty Roster")
 	case 1:
-		return errors.New("Need more than 1 entry for Roster")
+		return nil, errors.New("Need more than 1 entry for Roster")
+	}
+	if i, _ := el.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("Not part of the Roster")
 	}
 
 	// Start the protocol
@@ -328,7 +384,7 @@ func (s *Service) startBFTSignature(block *SkipBlock) error {
 
 	node, err := s.CreateProtocolSDA(skipchainBFT, tree)
 	if err != nil {
-		return errors.New("Couldn't create new node: " + err.Error())
+		return nil, errors.New("Couldn't create new node: " + err.Error())
 	}
 
 	// Register the function generating the protocol instance
@@ -336,7 +392,7 @@ func (s *Service) startBFTSignature(block *SkipBlock) error {
 	root.Msg = msg
 	data, err := network.MarshalRegisteredType(block)
 	if err != nil {
-		return errors.New("Couldn't marshal block: " + err.Error())
+		return nil, errors.New("Couldn't marshal block: " + err.Error())
 	}
 	root.Data = data
 
@@ -350,19 +406,331 @@ func (s *Service) startBFTSignature(block *SkipBlock) error {
 	go node.Start()
 	select {
 	case <-done:
-		block.BlockSig = root.Signature()
-		if len(block.BlockSig.Exceptions) != 0 {
-			return errors.New("Not everybody signed off the new block")
+		sig := root.Signature()
+		if len(sig.Exceptions) != 0 {
+			return nil, errors.New("Not everybody signed off the new block")
 		}
-		if err := block.BlockSig.Verify(network.Suite, el.Publics()); err != nil {
-			return errors.New("Couldn't verify signature")
+		if err := sig.Verify(network.Suite, el.Publics()); err != nil {
+			return nil, network.NewServiceError(network.ErrorCodeInvalidSignature,
+				"Couldn't verify signature")
 		}
+		return sig, nil
 	case <-time.After(time.Second * 60):
-		return errors.New("Timed out while waiting for signature")
+		return nil, network.NewServiceError(network.ErrorCodeTimeout,
+			"Timed out while waiting for signature")
+	}
+}
+
+// startWitnessSignature asks the Witnesses of the SkipChain to collectively
+// sign the hash of the new block. It does nothing if the SkipChain has no
+// Witnesses. latest is passed along, so that the Witnesses can catch up if
+// they missed it.
+func (s *Service) startWitnessSignature(latest, block *SkipBlock) error {
+	if block.Witnesses == nil {
+		return nil
+	}
+	if len(block.Witnesses.List) == 0 {
+		return errors.New("Found empty witness-Roster")
+	}
+	var reply *WitnessSkipBlockReply
+	leader := block.Witnesses.List[0]
+	if leader.ID.Equal(s.ServerIdentity().ID) {
+		reply = s.witnessSkipBlock(block, latest)
+	} else {
+		replyChan := make(chan *WitnessSkipBlockReply, 1)
+		s.witnessMutex.Lock()
+		s.witnessReplies[string(block.Hash)] = replyChan
+		s.witnessMutex.Unlock()
+		defer func() {
+			s.witnessMutex.Lock()
+			delete(s.witnessReplies, string(block.Hash))
+			s.witnessMutex.Unlock()
+		}()
+		if err := s.SendRaw(leader, &WitnessSkipBlock{block, latest}); err != nil {
+			return errors.New("Couldn't contact witnesses: " + err.Error())
+		}
+		select {
+		case reply = <-replyChan:
+		case <-time.After(witnessTimeout):
+			return network.NewServiceError(network.ErrorCodeTimeout,
+				"Timed out while waiting for witness-signature")
+		}
+	}
+	if reply.Error != "" {
+		return network.NewServiceError(reply.Code,
+			"Witnesses refused to sign: "+reply.Error)
 	}
+	block.WitnessSig = reply.Signature
+	return block.VerifyWitnessSignature()
+}
+
+// witnessSkipBlock lets all Witnesses verify the block and sign its hash
+// in a BFTCoSi-round, see verifyWitness. If they signed, the block is
+// confirmed to all Witnesses.
+func (s *Service) witnessSkipBlock(block, previous *SkipBlock) *WitnessSkipBlockReply {
+	reply := &WitnessSkipBlockReply{
+		Hash: block.Hash,
+		Signature: &bftcosi.BFTSignature{
+			Sig: make([]byte, 0),
+			Msg: make([]byte, 0),
+		},
+	}
+	sig, err := s.signWitness(block, previous)
+	if err != nil {
+		log.Lvl2(s.ServerIdentity(), "refuses to witness", block, ":", err)
+		reply.Error = err.Error()
+		reply.Code = network.ErrorCodeInternal
+		if se, ok := err.(*network.ServiceError); ok {
+			reply.Error = se.Message
+			reply.Code = se.Code
+		}
+		return reply
+	}
+	reply.Signature = sig
+	witnessed := block.Copy()
+	witnessed.WitnessSig = sig
+	s.confirmWitnessed(witnessed)
+	return reply
+}
+
+func (s *Service) signWitness(block, previous *SkipBlock) (*bftcosi.BFTSignature, error) {
+	// we are a witness, too, and refuse before bothering the others
+	if err := s.verifyWitness(block, previous); err != nil {
+		return nil, err
+	}
+	data, err := network.MarshalRegisteredType(&WitnessSkipBlock{block, previous})
+	if err != nil {
+		return nil, errors.New("Couldn't marshal block: " + err.Error())
+	}
+	tree := block.Witnesses.GenerateNaryTreeWithRoot(2, s.ServerIdentity())
+	node, err := s.CreateProtocolSDA(skipchainWitness, tree)
+	if err != nil {
+		return nil, errors.New("Couldn't create new node: " + err.Error())
+	}
+	root := node.(*bftcosi.ProtocolBFTCoSi)
+	root.Msg = []byte(block.Hash)
+	root.Data = data
+	root.VerificationFunction = s.witnessVerify
+	done := make(chan bool, 1)
+	root.RegisterOnDone(func() {
+		done <- true
+	})
+	go func() {
+		if err := node.Start(); err != nil {
+			log.Error("Couldn't start witness-round:", err)
+		}
+	}()
+	select {
+	case <-done:
+		sig := root.Signature()
+		if len(sig.Sig) == 0 ||
+			len(sig.Exceptions) > maxWitnessExceptions(len(block.Witnesses.List)) {
+			return nil, errors.New("Not enough witnesses accepted the block")
+		}
+		return sig, nil
+	case <-time.After(witnessTimeout):
+		return nil, network.NewServiceError(network.ErrorCodeTimeout,
+			"Timed out while waiting for witnesses")
+	}
+}
+
+// confirmWitnessed sends the witnessed block to all Witnesses, so that they
+// record it.
+func (s *Service) confirmWitnessed(block *SkipBlock) {
+	for _, si := range block.Witnesses.List {
+		if si.ID.Equal(s.ServerIdentity().ID) {
+			s.witnessMutex.Lock()
+			err := s.recordWitnessed(block)
+			s.witnessMutex.Unlock()
+			if err != nil {
+				log.Error("Couldn't record witnessed block:", err)
+			}
+			continue
+		}
+		if err := s.SendRaw(si, &WitnessConfirm{block}); err != nil {
+			log.Lvl2("Couldn't confirm witnessed block to", si, ":", err)
+		}
+	}
+}
+
+// witnessVerify is the verification of every Witness in the BFTCoSi-round
+// on a new block.
+func (s *Service) witnessVerify(msg []byte, data []byte) bool {
+	_, wsbN, err := network.UnmarshalRegistered(data)
+	if err != nil {
+		log.Error("Couldn't unmarshal SkipBlock", data)
+		return false
+	}
+	wsb, ok := wsbN.(*WitnessSkipBlock)
+	if !ok || wsb.SkipBlock == nil ||
+		!wsb.SkipBlock.Hash.Equal(SkipBlockID(msg)) {
+		log.Lvl2("Witnessed data is not the block of the hash")
+		return false
+	}
+	if err := s.verifyWitness(wsb.SkipBlock, wsb.Previous); err != nil {
+		log.Lvl2(s.ServerIdentity(), "refuses to witness", wsb.SkipBlock, ":", err)
+		return false
+	}
+	return true
+}
+
+// pendingWitness is a block a witness agreed to sign, but which has not been
+// confirmed as witnessed yet.
+type pendingWitness struct {
+	hash  SkipBlockID
+	added time.Time
+}
+
+// verifyWitness verifies that the block has been correctly signed by its
+// roster, that this roster has been accepted by the roster of the previous
+// block, and that the block doesn't fork a chain we already witnessed. If we
+// didn't witness the previous block, we catch up with previous, if enough
+// Witnesses signed it. The block is then kept as pending, so that no fork is
+// signed before the block is confirmed, see recordWitnessed.
+func (s *Service) verifyWitness(block, previous *SkipBlock) error {
+	if block.Witnesses == nil {
+		return errors.New("SkipBlock has no witnesses")
+	}
+	if i, _ := block.Witnesses.Search(s.ServerIdentity().ID); i < 0 {
+		return errors.New("Not a witness of this SkipBlock")
+	}
+	if block.Roster == nil {
+		return errors.New("SkipBlock has no Roster")
+	}
+	if !block.Hash.Equal(SkipBlockID(block.BlockSig.Msg)) {
+		return errors.New("Signature of the roster is not on the hash")
+	}
+	if len(block.BackLinkIds) == 0 {
+		return errors.New("SkipBlock has no backlink")
+	}
+	if err := block.BlockSig.Verify(network.Suite, block.Roster.Publics()); err != nil {
+		return network.NewServiceError(network.ErrorCodeInvalidSignature,
+			"Wrong signature of the roster: "+err.Error())
+	}
+	prevID := string(block.BackLinkIds[0])
+	s.witnessMutex.Lock()
+	defer s.witnessMutex.Unlock()
+	if block.Index > 0 {
+		roster, ok := s.witnessed.Rosters[prevID]
+		if !ok {
+			if err := s.catchUp(block, previous); err != nil {
+				return errors.New("Didn't witness the previous block " +
+					block.BackLinkIds[0].String() + ": " + err.Error())
+			}
+			roster = previous.Roster
+		}
+		if err := block.VerifyRosterSignature(roster); err != nil {
+			return network.NewServiceError(network.ErrorCodeInvalidSignature,
+				"Roster not accepted by the previous roster: "+err.Error())
+		}
+	}
+	if next, ok := s.witnessed.Next[prevID]; ok && !next.Equal(block.Hash) {
+		return errors.New("Already witnessed block " + next.String() +
+			" after " + block.BackLinkIds[0].String())
+	}
+	if p, ok := s.witnessPending[prevID]; ok && !p.hash.Equal(block.Hash) &&
+		time.Since(p.added) < witnessTimeout {
+		return errors.New("Already witnessing block " + p.hash.String() +
+			" after " + block.BackLinkIds[0].String())
+	}
+	s.witnessPending[prevID] = &pendingWitness{block.Hash, time.Now()}
 	return nil
 }
 
+// catchUp records previous as witnessed if enough Witnesses signed it, so
+// that a witness that was offline can verify its successor block. The
+// witnessMutex must be held.
+func (s *Service) catchUp(block, previous *SkipBlock) error {
+	if previous == nil {
+		return errors.New("no previous block given")
+	}
+	if !previous.Hash.Equal(block.BackLinkIds[0]) {
+		return errors.New("given block is not the previous block")
+	}
+	if !sameRoster(previous.Witnesses, block.Witnesses) {
+		return errors.New("previous block has other witnesses")
+	}
+	return s.recordWitnessed(previous)
+}
+
+// recordWitnessed stores the block as witnessed, if enough Witnesses signed
+// it and it doesn't fork a chain we witnessed. The witnessMutex must be
+// held.
+func (s *Service) recordWitnessed(block *SkipBlock) error {
+	if block.Witnesses == nil || block.Roster == nil || len(block.BackLinkIds) == 0 {
+		return errors.New("SkipBlock can't be witnessed")
+	}
+	if !block.calculateHash().Equal(block.Hash) {
+		return errors.New("Wrong hash of the SkipBlock")
+	}
+	if err := block.VerifyWitnessSignature(); err != nil {
+		return err
+	}
+	if err := block.BlockSig.Verify(network.Suite, block.Roster.Publics()); err != nil {
+		return errors.New("Wrong signature of the roster: " + err.Error())
+	}
+	prevID := string(block.BackLinkIds[0])
+	if next, ok := s.witnessed.Next[prevID]; ok {
+		if next.Equal(block.Hash) {
+			return nil
+		}
+		return errors.New("Already witnessed block " + next.String() +
+			" after " + block.BackLinkIds[0].String())
+	}
+	if p, ok := s.witnessPending[prevID]; ok && p.hash.Equal(block.Hash) {
+		delete(s.witnessPending, prevID)
+	}
+	s.witnessed.Next[prevID] = block.Hash
+	s.witnessed.Rosters[string(block.Hash)] = block.Roster
+	return s.saveWitnessed()
+}
+
+// Process handles the messages exchanged between the skipchain-service of
+// a roster and the first of the Witnesses, and the confirmations between
+// the Witnesses.
+func (s *Service) Process(packet *network.Packet) {
+	switch packet.MsgType {
+	case WitnessSkipBlockID:
+		wsb := packet.Msg.(WitnessSkipBlock)
+		reply := s.witnessSkipBlock(wsb.SkipBlock, wsb.Previous)
+		if err := s.SendRaw(packet.ServerIdentity, reply); err != nil {
+			log.Error("Couldn't send witness-signature:", err)
+		}
+	case WitnessSkipBlockReplyID:
+		reply := packet.Msg.(WitnessSkipBlockReply)
+		s.witnessMutex.Lock()
+		replyChan, ok := s.witnessReplies[string(reply.Hash)]
+		s.witnessMutex.Unlock()
+		if !ok {
+			log.Lvl2("Got witness-signature for unknown block", reply.Hash)
+			return
+		}
+		select {
+		case replyChan <- &reply:
+		default:
+			log.Lvl2("Got witness-signature twice for block", reply.Hash)
+		}
+	case WitnessConfirmID:
+		wc := packet.Msg.(WitnessConfirm)
+		if wc.SkipBlock == nil || wc.SkipBlock.Witnesses == nil {
+			log.Lvl2("Got confirmation without witnesses")
+			return
+		}
+		if i, _ := wc.SkipBlock.Witnesses.Search(s.ServerIdentity().ID); i < 0 {
+			log.Lvl2("Got confirmation of a block we don't witness")
+			return
+		}
+		s.witnessMutex.Lock()
+		err := s.recordWitnessed(wc.SkipBlock)
+		s.witnessMutex.Unlock()
+		if err != nil {
+			log.Error("Couldn't record witnessed block:", err)
+		}
+	default:
+		s.ServiceProcessor.Process(packet)
+	}
+}
+
 func (s *Service) verifyNewSkipBlock(latest, newest *SkipBlock) error {
 	// Do some sanity-checks on the latest and newest skipblock
 	if latest != nil {
@@ -476,6 +844,32 @@ func (s *Service) lenSkipBlocks() int {
 	return len(s.SkipBlocks)
 }
 
+// Metrics implements sda.MetricsReporter and returns the number of
+// skipchains and skipblocks stored by the service.
+func (s *Service) Metrics() map[string]float64 {
+	s.gMutex.Lock()
+	defer s.gMutex.Unlock()
+	chains := 0
+	for _, sb := range s.SkipBlocks {
+		if sb.Index == 0 {
+			chains++
+		}
+	}
+	return map[string]float64{
+		"skipchains": float64(chains),
+		"skipblocks": float64(len(s.SkipBlocks)),
+	}
+}
+
+// wrapError prefixes the message of err, keeping the code if err is a
+// ServiceError.
+func wrapError(prefix string, err error) error {
+	if se, ok := err.(*network.ServiceError); ok {
+		return network.NewServiceError(se.Code, prefix+se.Message)
+	}
+	return errors.New(prefix + err.Error())
+}
+
 // saves the actual identity
 func (s *Service) save() {
 	log.Lvl3("Saving service")
@@ -490,6 +884,26 @@ func (s *Service) save() {
 	}
 }
 
+// saveWitnessed writes the witnessed blocks - the witnessMutex must be
+// held.
+func (s *Service) saveWitnessed() error {
+	b, err := network.MarshalRegisteredType(s.witnessed)
+	if err != nil {
+		return errors.New("Couldn't marshal witnessed blocks: " + err.Error())
+	}
+	if err := ioutil.WriteFile(s.witnessFile(), b, 0660); err != nil {
+		return errors.New("Couldn't save witnessed blocks: " + err.Error())
+	}
+	return nil
+}
+
+// witnessFile returns the file of the witnessed blocks. It depends on the
+// conode, as all conodes of a LocalTest share the path of the service.
+func (s *Service) witnessFile() string {
+	return s.path + "/witnessed_" +
+		uuid.UUID(s.ServerIdentity().ID).String() + ".bin"
+}
+
 // Tries to load the configuration and updates the data in the service
 // if it finds a valid config-file.
 func (s *Service) tryLoad() error {
@@ -506,15 +920,51 @@ func (s *Service) tryLoad() error {
 		log.Lvl3("Successfully loaded")
 		s.SkipBlockMap = msg.(*SkipBlockMap)
 	}
+	// the rosters stored by older versions have random IDs
+	for _, sb := range s.SkipBlocks {
+		for _, el := range []*sda.Roster{sb.Roster, sb.Witnesses} {
+			if el != nil {
+				s.RegisterLegacyRoster(el)
+			}
+		}
+	}
+	witnessFile := s.witnessFile()
+	b, err = ioutil.ReadFile(witnessFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error while reading %s: %s", witnessFile, err)
+	}
+	if len(b) > 0 {
+		_, msg, err := network.UnmarshalRegistered(b)
+		if err != nil {
+			return fmt.Errorf("Couldn't unmarshal: %s", err)
+		}
+		s.witnessed = msg.(*WitnessedMap)
+		if s.witnessed.Next == nil {
+			s.witnessed.Next = make(map[string]SkipBlockID)
+		}
+		if s.witnessed.Rosters == nil {
+			s.witnessed.Rosters = make(map[string]*sda.Roster)
+		}
+	}
 	return nil
 }
 
+func newWitnessedMap() *WitnessedMap {
+	return &WitnessedMap{
+		Next:    make(map[string]SkipBlockID),
+		Rosters: make(map[string]*sda.Roster),
+	}
+}
+
 func newSkipchainService(c *sda.Context, path string) sda.Service {
 	s := &Service{
 		ServiceProcessor: sda.NewServiceProcessor(c),
 		path:             path,
 		SkipBlockMap:     &SkipBlockMap{make(map[string]*SkipBlock)},
 		verifiers:        map[VerifierID]SkipBlockVerifier{},
+		witnessReplies:   make(map[string]chan *WitnessSkipBlockReply),
+		witnessed:        newWitnessedMap(),
+		witnessPending:   make(map[string]*pendingWitness),
 	}
 	var err error
 	s.Propagate, err = manage.NewPropagationFunc(c, "SkipchainPropagate", s.PropagateSkipBlock)
@@ -522,9 +972,15 @@ func newSkipchainService(c *sda.Context, path string) sda.Service {
 	c.ProtocolRegister(skipchainBFT, func(n *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
 		return bftcosi.NewBFTCoSiProtocol(n, s.bftVerify)
 	})
+	c.ProtocolRegister(skipchainWitness, func(n *sda.TreeNodeInstance) (sda.ProtocolInstance, error) {
+		return bftcosi.NewBFTCoSiProtocol(n, s.witnessVerify)
+	})
 	if err := s.tryLoad(); err != nil {
 		log.Error(err)
 	}
+	c.RegisterProcessor(s, WitnessSkipBlockID)
+	c.RegisterProcessor(s, WitnessSkipBlockReplyID)
+	c.RegisterProcessor(s, WitnessConfirmID)
 	log.ErrFatal(s.RegisterMessages(s.ProposeSkipBlock, s.SetChildrenSkipBlock,
 		s.GetUpdateChain))
 	if err := s.RegisterVerification(VerifyShard, s.VerifyShardFunc); err != nil {
@@ -10,7 +10,11 @@ import (
 	"errors"
 	"fmt"
 
+	"time"
+
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
+	"github.com/dedis/cothority/protocols/bftcosi"
 	"github.com/dedis/cothority/sda"
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
@@ -335,6 +339,189 @@ func TestService_Verification(t *testing.T) {
 	service.SetChildrenSkipBlock(nil, scsb)
 }
 
+func TestService_Witness(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	hosts, el, genService := local.MakeHELS(5, skipchainSID)
+	service := genService.(*Service)
+	elRoot := sda.NewRoster(el.List[0:3])
+	witnesses := sda.NewRoster(el.List[3:5])
+
+	sb := NewSkipBlock()
+	sb.Roster = elRoot
+	sb.MaximumHeight = 1
+	sb.BaseHeight = 1
+	sb.VerifierID = VerifyNone
+	sb.Witnesses = witnesses
+	psbr, err := service.ProposeSkipBlock(nil, &ProposeSkipBlock{nil, sb})
+	log.ErrFatal(err)
+	genesis := psbr.(*ProposedSkipBlockReply).Latest
+	require.NotEqual(t, 0, len(genesis.WitnessSig.Sig))
+	log.ErrFatal(genesis.VerifySignatures())
+
+	log.Lvl1("Adding a witnessed block")
+	next := NewSkipBlock()
+	next.Roster = elRoot
+	psbr, err = service.ProposeSkipBlock(nil, &ProposeSkipBlock{genesis.Hash, next})
+	log.ErrFatal(err)
+	latest := psbr.(*ProposedSkipBlockReply).Latest
+	require.NotNil(t, latest.Witnesses)
+	log.ErrFatal(latest.VerifySignatures())
+
+	wrongSig := latest.Copy()
+	wrongSig.WitnessSig = genesis.WitnessSig
+	require.NotNil(t, wrongSig.VerifySignatures())
+
+	log.Lvl1("The previous roster has to accept a new roster")
+	changed := NewSkipBlock()
+	changed.Roster = sda.NewRoster(el.List[0:2])
+	psbr, err = service.ProposeSkipBlock(nil, &ProposeSkipBlock{latest.Hash, changed})
+	log.ErrFatal(err)
+	changed = psbr.(*ProposedSkipBlockReply).Latest
+	log.ErrFatal(changed.VerifySignatures())
+	log.ErrFatal(changed.VerifyRosterSignature(elRoot))
+	require.NotNil(t, changed.VerifyRosterSignature(sda.NewRoster(el.List[1:4])))
+
+	log.Lvl1("Witnesses must refuse a fork")
+	leader := local.Services[hosts[3].ServerIdentity.ID][skipchainSID].(*Service)
+	witness := local.Services[hosts[4].ServerIdentity.ID][skipchainSID].(*Service)
+	previous := string(latest.BackLinkIds[0])
+	for _, w := range []*Service{leader, witness} {
+		w.witnessMutex.Lock()
+		w.witnessed.Next[previous] = genesis.Hash
+		w.witnessMutex.Unlock()
+	}
+	require.NotNil(t, witness.verifyWitness(latest, genesis))
+	reply := leader.witnessSkipBlock(latest, genesis)
+	require.NotEqual(t, "", reply.Error)
+	require.Equal(t, 0, len(reply.Signature.Sig))
+
+	log.Lvl1("A block is only witnessed once it is confirmed")
+	witness.witnessMutex.Lock()
+	delete(witness.witnessed.Next, previous)
+	witness.witnessPending[previous] = &pendingWitness{genesis.Hash, time.Now()}
+	witness.witnessMutex.Unlock()
+	require.NotNil(t, witness.verifyWitness(latest, genesis))
+	// the round of the pending block failed and it has never been confirmed
+	witness.witnessMutex.Lock()
+	witness.witnessPending[previous].added = time.Now().Add(-witnessTimeout)
+	witness.witnessMutex.Unlock()
+	log.ErrFatal(witness.verifyWitness(latest, genesis))
+	witness.witnessMutex.Lock()
+	_, ok := witness.witnessed.Next[previous]
+	require.False(t, ok)
+	require.Equal(t, latest.Hash, witness.witnessPending[previous].hash)
+	witness.witnessMutex.Unlock()
+
+	log.Lvl1("Witnesses check the roster of the previous block")
+	witness.witnessMutex.Lock()
+	delete(witness.witnessPending, previous)
+	witness.witnessed.Rosters[previous] = sda.NewRoster(el.List[1:4])
+	witness.witnessMutex.Unlock()
+	require.NotNil(t, witness.verifyWitness(latest, genesis))
+}
+
+func TestService_WitnessFaulty(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	hosts, el, genService := local.MakeHELS(7, skipchainSID)
+	service := genService.(*Service)
+	response := network.TypeToPacketTypeID(bftcosi.Response{})
+
+	log.Lvl1("A faulty witness is excluded from the signature")
+	// the last witness is a leaf of the tree of the witnesses
+	hosts[6].Faulty(sda.ByzantineCorrupt("Response"), response)
+	sb := NewSkipBlock()
+	sb.Roster = sda.NewRoster(el.List[0:3])
+	sb.MaximumHeight = 1
+	sb.BaseHeight = 1
+	sb.VerifierID = VerifyNone
+	sb.Witnesses = sda.NewRoster(el.List[3:7])
+	psbr, err := service.ProposeSkipBlock(nil, &ProposeSkipBlock{nil, sb})
+	log.ErrFatal(err)
+	genesis := psbr.(*ProposedSkipBlockReply).Latest
+	log.ErrFatal(genesis.VerifySignatures())
+	require.Equal(t, 1, len(genesis.WitnessSig.Exceptions))
+
+	log.Lvl1("A faulty member of the roster makes the block fail")
+	hosts[2].Faulty(sda.ByzantineCorrupt("Response"), response)
+	next := NewSkipBlock()
+	next.Roster = sb.Roster
+	_, err = service.ProposeSkipBlock(nil, &ProposeSkipBlock{genesis.Hash, next})
+	require.NotNil(t, err)
+}
+
+func TestService_WitnessCatchUp(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	hosts, el, genService := local.MakeHELS(5, skipchainSID)
+	service := genService.(*Service)
+
+	sb := NewSkipBlock()
+	sb.Roster = sda.NewRoster(el.List[0:3])
+	sb.MaximumHeight = 1
+	sb.BaseHeight = 1
+	sb.VerifierID = VerifyNone
+	sb.Witnesses = sda.NewRoster(el.List[3:5])
+	psbr, err := service.ProposeSkipBlock(nil, &ProposeSkipBlock{nil, sb})
+	log.ErrFatal(err)
+	genesis := psbr.(*ProposedSkipBlockReply).Latest
+
+	next := NewSkipBlock()
+	next.Roster = sb.Roster
+	psbr, err = service.ProposeSkipBlock(nil, &ProposeSkipBlock{genesis.Hash, next})
+	log.ErrFatal(err)
+	next = psbr.(*ProposedSkipBlockReply).Latest
+
+	// a witness that lost everything it witnessed
+	witness := local.Services[hosts[4].ServerIdentity.ID][skipchainSID].(*Service)
+	lost := &Service{
+		ServiceProcessor: witness.ServiceProcessor,
+		path:             witness.path,
+		SkipBlockMap:     &SkipBlockMap{make(map[string]*SkipBlock)},
+		witnessed:        newWitnessedMap(),
+		witnessPending:   make(map[string]*pendingWitness),
+	}
+	require.NotNil(t, lost.verifyWitness(next, nil))
+	log.ErrFatal(lost.verifyWitness(next, genesis))
+	require.Equal(t, genesis.Hash,
+		lost.witnessed.Next[string(genesis.BackLinkIds[0])])
+	require.NotNil(t, lost.witnessed.Rosters[string(genesis.Hash)])
+	require.Equal(t, next.Hash, lost.witnessPending[string(genesis.Hash)].hash)
+}
+
+func TestService_WitnessRestart(t *testing.T) {
+	local := sda.NewLocalTest()
+	defer local.CloseAll()
+	hosts, el, genService := local.MakeHELS(5, skipchainSID)
+	service := genService.(*Service)
+	elRoot := sda.NewRoster(el.List[0:3])
+
+	sb := NewSkipBlock()
+	sb.Roster = elRoot
+	sb.MaximumHeight = 1
+	sb.BaseHeight = 1
+	sb.VerifierID = VerifyNone
+	sb.Witnesses = sda.NewRoster(el.List[3:5])
+	psbr, err := service.ProposeSkipBlock(nil, &ProposeSkipBlock{nil, sb})
+	log.ErrFatal(err)
+	genesis := psbr.(*ProposedSkipBlockReply).Latest
+
+	// a restarted witness loads what it witnessed
+	witness := local.Services[hosts[4].ServerIdentity.ID][skipchainSID].(*Service)
+	restarted := &Service{
+		ServiceProcessor: witness.ServiceProcessor,
+		path:             witness.path,
+		SkipBlockMap:     &SkipBlockMap{make(map[string]*SkipBlock)},
+		witnessed:        newWitnessedMap(),
+		witnessPending:   make(map[string]*pendingWitness),
+	}
+	log.ErrFatal(restarted.tryLoad())
+	previous := string(genesis.BackLinkIds[0])
+	require.Equal(t, genesis.Hash, restarted.witnessed.Next[previous])
+	require.NotNil(t, restarted.witnessed.Rosters[string(genesis.Hash)])
+}
+
 func TestCopy(t *testing.T) {
 	// Test if copy is deep or only shallow
 	b1 := NewBlockLink()
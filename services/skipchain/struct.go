@@ -76,6 +76,12 @@ type SkipBlockFix struct {
 	Data []byte
 	// Roster holds the roster-definition of that SkipBlock
 	Roster *sda.Roster
+	// Witnesses is an optional roster of external servers that have to
+	// collectively sign the hash of every new block of this SkipChain -
+	// is nil if no witnessing is required. The Witnesses only sign a block
+	// whose roster has been accepted by the roster of the previous block,
+	// see RosterSig.
+	Witnesses *sda.Roster
 }
 
 // addSliceToHash hashes the whole SkipBlockFix plus a slice of bytes.
@@ -100,6 +106,13 @@ type SkipBlock struct {
 	Hash SkipBlockID
 	// BlockSig is the BFT-signature of the hash
 	BlockSig *bftcosi.BFTSignature
+	// WitnessSig is the BFT-signature of the Witnesses on the hash - is
+	// empty if the SkipChain has no Witnesses
+	WitnessSig *bftcosi.BFTSignature
+	// RosterSig is the BFT-signature of the roster of the previous block on
+	// the hash, if the block changes the roster of a witnessed SkipChain -
+	// is empty otherwise
+	RosterSig *bftcosi.BFTSignature
 
 	// ForwardLink will be calculated once future SkipBlocks are
 	// available
@@ -120,6 +133,14 @@ func NewSkipBlock() *SkipBlock {
 			Sig: make([]byte, 0),
 			Msg: make([]byte, 0),
 		},
+		WitnessSig: &bftcosi.BFTSignature{
+			Sig: make([]byte, 0),
+			Msg: make([]byte, 0),
+		},
+		RosterSig: &bftcosi.BFTSignature{
+			Sig: make([]byte, 0),
+			Msg: make([]byte, 0),
+		},
 	}
 }
 
@@ -130,6 +151,9 @@ func (sb *SkipBlock) VerifySignatures() error {
 		log.Error(err.Error() + log.Stack())
 		return err
 	}
+	if err := sb.VerifyWitnessSignature(); err != nil {
+		return err
+	}
 	//for _, fl := range sb.ForwardLink {
 	//	if err := fl.VerifySignature(sb.Aggregate); err != nil {
 	//		return err
@@ -141,6 +165,69 @@ func (sb *SkipBlock) VerifySignatures() error {
 	return nil
 }
 
+// VerifyWitnessSignature returns whether the hash of the block has been
+// collectively signed by the Witnesses, of which at most
+// maxWitnessExceptions may have refused. If the SkipChain has no Witnesses,
+// nil is returned.
+func (sb *SkipBlock) VerifyWitnessSignature() error {
+	if sb.Witnesses == nil {
+		return nil
+	}
+	if sb.WitnessSig == nil || len(sb.WitnessSig.Sig) == 0 {
+		return errors.New("Missing signature of the witnesses")
+	}
+	if !sb.Hash.Equal(SkipBlockID(sb.WitnessSig.Msg)) {
+		return errors.New("Signature of the witnesses is not on the hash")
+	}
+	if len(sb.WitnessSig.Exceptions) > maxWitnessExceptions(len(sb.Witnesses.List)) {
+		return errors.New("Not enough witnesses signed the block")
+	}
+	return sb.WitnessSig.Verify(network.Suite, sb.Witnesses.Publics())
+}
+
+// VerifyRosterSignature returns whether previous, the roster of the block
+// preceding sb, accepted the roster of sb. This is only needed on witnessed
+// SkipChains, where the Witnesses follow the rosters from block to block.
+func (sb *SkipBlock) VerifyRosterSignature(previous *sda.Roster) error {
+	if sameRoster(previous, sb.Roster) {
+		return nil
+	}
+	if sb.RosterSig == nil || len(sb.RosterSig.Sig) == 0 {
+		return errors.New("Missing signature of the previous roster")
+	}
+	if !sb.Hash.Equal(SkipBlockID(sb.RosterSig.Msg)) {
+		return errors.New("Signature of the previous roster is not on the hash")
+	}
+	if len(sb.RosterSig.Exceptions) != 0 {
+		return errors.New("Not all of the previous roster signed the block")
+	}
+	return sb.RosterSig.Verify(network.Suite, previous.Publics())
+}
+
+// maxWitnessExceptions returns how many of n Witnesses may refuse to sign a
+// block, so that a single offline or lagging witness doesn't stop the
+// SkipChain.
+func maxWitnessExceptions(n int) int {
+	return (n - 1) / 3
+}
+
+// sameRoster returns whether a and b hold the same public keys in the same
+// order.
+func sameRoster(a, b *sda.Roster) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if len(a.List) != len(b.List) {
+		return false
+	}
+	for i, si := range a.List {
+		if !si.Public.Equal(b.List[i].Public) {
+			return false
+		}
+	}
+	return true
+}
+
 // Equal returns bool if both hashes are equal
 func (sb *SkipBlock) Equal(other *SkipBlock) bool {
 	return bytes.Equal(sb.Hash, other.Hash)
@@ -158,6 +245,24 @@ func (sb *SkipBlock) Copy() *SkipBlock {
 		Msg:        b.BlockSig.Msg,
 		Exceptions: b.BlockSig.Exceptions,
 	}
+	if sb.WitnessSig != nil {
+		witnessCopy := make([]byte, len(sb.WitnessSig.Sig))
+		copy(witnessCopy, sb.WitnessSig.Sig)
+		b.WitnessSig = &bftcosi.BFTSignature{
+			Sig:        witnessCopy,
+			Msg:        sb.WitnessSig.Msg,
+			Exceptions: sb.WitnessSig.Exceptions,
+		}
+	}
+	if sb.RosterSig != nil {
+		rosterCopy := make([]byte, len(sb.RosterSig.Sig))
+		copy(rosterCopy, sb.RosterSig.Sig)
+		b.RosterSig = &bftcosi.BFTSignature{
+			Sig:        rosterCopy,
+			Msg:        sb.RosterSig.Msg,
+			Exceptions: sb.RosterSig.Exceptions,
+		}
+	}
 	b.ForwardLink = make([]*BlockLink, len(sb.ForwardLink))
 	for i, fl := range sb.ForwardLink {
 		b.ForwardLink[i] = fl.Copy()
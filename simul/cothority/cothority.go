@@ -6,9 +6,14 @@ package main
 
 import (
 	"flag"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/network"
 	"github.com/dedis/cothority/sda"
 
 	"github.com/dedis/cothority/monitor"
@@ -31,6 +36,13 @@ var simul string
 
 var debugVisible int
 
+// traceDir is != "" if the conodes record their messages to a trace in it
+var traceDir string
+
+// Network conditions emulated on the TCP connections of the conodes
+var delay, jitter int
+var loss, bandwidth float64
+
 // Initialize before 'init' so we can directly use the fields as parameters
 // to 'Flag'
 func init() {
@@ -38,6 +50,11 @@ func init() {
 	flag.StringVar(&simul, "simul", "", "start simulating that protocol")
 	flag.StringVar(&monitorAddress, "monitor", "", "remote monitor")
 	flag.IntVar(&debugVisible, "debug", 1, "verbosity: 0-5")
+	flag.StringVar(&traceDir, "trace", "", "record the messages of every conode to a trace in that directory")
+	flag.IntVar(&delay, "delay", 0, "delay of every packet sent in milliseconds")
+	flag.IntVar(&jitter, "jitter", 0, "maximal random delay added to every packet in milliseconds")
+	flag.Float64Var(&loss, "loss", 0, "percentage of packets lost and retransmitted")
+	flag.Float64Var(&bandwidth, "bandwidth", 0, "bandwidth of every connection in Mbit/s")
 }
 
 // Main starts the conode and will setup the protocol.
@@ -45,9 +62,20 @@ func main() {
 	flag.Parse()
 	log.SetDebugVisible(debugVisible)
 	log.Lvl3("Flags are:", conodeAddress, simul, log.DebugVisible, monitorAddress)
+	if delay > 0 || jitter > 0 || loss > 0 || bandwidth > 0 {
+		fi := network.NewFaultInjector(time.Now().UnixNano())
+		fi.SetDefault(network.LinkFaults{
+			Latency:   time.Duration(delay) * time.Millisecond,
+			Jitter:    time.Duration(jitter) * time.Millisecond,
+			LossRate:  loss / 100,
+			Bandwidth: bandwidth,
+		})
+		network.SetTCPFaultInjector(fi)
+	}
 
 	scs, err := sda.LoadSimulationConfig(".", conodeAddress)
 	measures := make([]*monitor.CounterIOMeasure, len(scs))
+	traffics := make([]*monitor.CounterMapMeasure, len(scs))
 	if err != nil {
 		// We probably are not needed
 		log.Lvl2(err, conodeAddress)
@@ -68,18 +96,29 @@ func main() {
 		// Starting all conodes for that server
 		conode := sc.Conode
 		measures[i] = monitor.NewCounterIOMeasure("bandwidth", conode)
+		traffics[i] = monitor.NewCounterMapMeasure("traffic", conode.TrafficCounters)
 		log.Lvl3(conodeAddress, "Starting conode", conode.ServerIdentity.Address)
+		if traceDir != "" {
+			file := strings.Replace(conode.ServerIdentity.Address.NetworkAddress(),
+				":", "_", -1) + ".trace"
+			if err := conode.RecordTrace(filepath.Join(traceDir, file)); err != nil {
+				log.Error("Couldn't record trace:", err)
+			}
+		}
 		// Launch a conode and notifies when it's done
 
 		wg.Add(1)
-		go func(c *sda.Conode, m monitor.Measure) {
+		index, _ := sc.Roster.Search(conode.ServerIdentity.ID)
+		go func(c *sda.Conode, m, tm monitor.Measure) {
 			ready <- true
 			defer wg.Done()
 			c.Start()
-			// record bandwidth
+			// record bandwidth and the traffic per message type
 			m.Record()
+			tm.Record()
+			recordNode(c, index)
 			log.Lvl3(conodeAddress, "Simulation closed conode", c.ServerIdentity)
-		}(conode, measures[i])
+		}(conode, measures[i], traffics[i])
 		// wait to be sure the goroutine started
 		<-ready
 
@@ -167,3 +206,31 @@ func main() {
 	log.Lvl2(conodeAddress, "has all conodes closed")
 	monitor.EndAndCleanup()
 }
+
+// recordNode sends the messages and bytes exchanged by the conode and the
+// highest round-trip time to its peers as measures of the node at the
+// position index of the roster.
+func recordNode(c *sda.Conode, index int) {
+	node := strconv.Itoa(index)
+	var total network.Traffic
+	for _, t := range c.TypeTraffic() {
+		total.MsgsTx += t.MsgsTx
+		total.MsgsRx += t.MsgsRx
+		total.BytesTx += t.BytesTx
+		total.BytesRx += t.BytesRx
+	}
+	monitor.NewNodeMeasure(node, "msgs_tx", float64(total.MsgsTx)).Record()
+	monitor.NewNodeMeasure(node, "msgs_rx", float64(total.MsgsRx)).Record()
+	monitor.NewNodeMeasure(node, "bytes_tx", float64(total.BytesTx)).Record()
+	monitor.NewNodeMeasure(node, "bytes_rx", float64(total.BytesRx)).Record()
+	var rtt time.Duration
+	for _, p := range c.Peers() {
+		if p.RTT > rtt {
+			rtt = p.RTT
+		}
+	}
+	if rtt > 0 {
+		monitor.NewNodeMeasure(node, "rtt_ms",
+			rtt.Seconds()*1000).Record()
+	}
+}
@@ -342,6 +342,11 @@ func (d *Deterlab) Wait() error {
 	return nil
 }
 
+// SimulationConfig returns the configuration of the last deployed simulation
+func (d *Deterlab) SimulationConfig() *sda.SimulationConfig {
+	return simulConfig
+}
+
 // Write the hosts.txt file automatically
 // from project name and number of servers
 func (d *Deterlab) createHosts() {
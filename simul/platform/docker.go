@@ -0,0 +1,323 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/monitor"
+	"github.com/dedis/cothority/sda"
+)
+
+// Docker runs every server of a simulation in its own container on a local
+// Docker network, so that networks with latency and limited bandwidth can be
+// emulated on a single Linux machine. The simulation binary is built into an
+// image, the configuration of every run is mounted into the containers.
+//
+// The outgoing traffic of every container is shaped with 'tc' to emulate the
+// network conditions of the runfile, see NetworkEmulation.
+type Docker struct {
+	// The simulation to run
+	Simulation string
+	// Image is the name of the image the simulation is built into
+	Image string
+	// Network is the name of the Docker network of the containers. It is
+	// also used as the prefix of the names of the containers.
+	Network string
+	// Subnet of the Docker network - the first address is the gateway, the
+	// servers get the following ones
+	Subnet string
+
+	// Where the simulation and the Dockerfile are built and where the
+	// configuration of a run is written to
+	runDir string
+	// Debug level 1 - 5
+	debug int
+
+	// The number of servers
+	servers int
+	// Addresses of the containers
+	addresses []string
+	// Address of the gateway, where the proxy for the monitor listens
+	gateway string
+	// Network conditions of the run
+	emulation NetworkEmulation
+
+	// WaitGroup for running containers
+	wgRun sync.WaitGroup
+	// errors go here:
+	errChan chan error
+
+	// Listening monitor port
+	monitorPort int
+
+	// SimulationConfig holds all things necessary for the run
+	sc *sda.SimulationConfig
+}
+
+// dockerBinary is the path of the simulation binary in the image
+const dockerBinary = "/usr/local/bin/cothority"
+
+// dockerWorkDir is the directory where the run directory is mounted in the
+// containers
+const dockerWorkDir = "/cothority"
+
+// Configure various internal variables
+func (d *Docker) Configure(pc *Config) {
+	pwd, _ := os.Getwd()
+	d.runDir = pwd + "/platform/docker"
+	d.debug = pc.Debug
+	d.monitorPort = pc.MonitorPort
+	if d.Simulation == "" {
+		log.Fatal("No simulation defined in simulation")
+	}
+	if d.Image == "" {
+		d.Image = "cothority-simul"
+	}
+	if d.Network == "" {
+		d.Network = "cothority-simul"
+	}
+	if d.Subnet == "" {
+		d.Subnet = "172.28.0.0/16"
+	}
+	if err := os.MkdirAll(d.runDir, 0777); err != nil {
+		log.Fatal("Couldn't create", d.runDir, err)
+	}
+	log.Lvl3("Docker dirs: RunDir", d.runDir)
+	log.Lvl3("Docker configured ...")
+}
+
+// Build compiles the simulation for linux and builds the image holding it
+func (d *Docker) Build(build string, arg ...string) error {
+	src := "./cothority"
+	dst := d.runDir + "/" + d.Simulation
+	start := time.Now()
+	res, err := Build(src, dst, "amd64", "linux", arg...)
+	if err != nil {
+		log.Fatal("Error while building for docker (src", src, ", dst", dst, ":", res)
+	}
+	dockerfile := fmt.Sprintf("FROM debian:jessie\n"+
+		"RUN apt-get update && apt-get install -y iproute2 && "+
+		"rm -rf /var/lib/apt/lists/*\n"+
+		"COPY %s %s\n"+
+		"WORKDIR %s\n", d.Simulation, dockerBinary, dockerWorkDir)
+	if err := ioutil.WriteFile(d.runDir+"/Dockerfile", []byte(dockerfile),
+		0660); err != nil {
+		return err
+	}
+	cmd := exec.Command("docker", "build", "-t", d.Image, d.runDir)
+	cmd.Stderr = os.Stderr
+	if log.DebugVisible() > 1 {
+		cmd.Stdout = os.Stdout
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Couldn't build image %s: %v", d.Image, err)
+	}
+	log.Lvl2("Docker: build finished in", time.Since(start))
+	return nil
+}
+
+// Cleanup removes all containers and the network of the simulation, and
+// stops the proxy of the monitor
+func (d *Docker) Cleanup() error {
+	log.Lvl3("Cleaning up")
+	if err := monitor.ProxyStop(); err != nil {
+		log.Error("Couldn't stop the proxy:", err)
+	}
+	out, err := exec.Command("docker", "ps", "-aq", "--filter",
+		"label=cothority.network="+d.Network).Output()
+	if err != nil {
+		return fmt.Errorf("Couldn't list containers: %v", err)
+	}
+	if ids := strings.Fields(string(out)); len(ids) > 0 {
+		args := append([]string{"rm", "-f"}, ids...)
+		if err := exec.Command("docker", args...).Run(); err != nil {
+			log.Error("Couldn't remove containers:", err)
+		}
+	}
+	if err := exec.Command("docker", "network", "rm", d.Network).Run(); err != nil {
+		log.Lvl3("Couldn't remove network", d.Network, err)
+	}
+	return nil
+}
+
+// Deploy writes the configuration of the run, which is mounted into the
+// containers
+func (d *Docker) Deploy(rc RunConfig) error {
+	d.servers, _ = strconv.Atoi(rc.Get("servers"))
+	var err error
+	if d.emulation, err = ReadNetworkEmulation(rc); err != nil {
+		return err
+	}
+	log.Lvl2("Docker: Deploying and writing config-files for", d.servers, "servers")
+	addresses, err := subnetAddresses(d.Subnet, d.servers+1)
+	if err != nil {
+		return err
+	}
+	d.gateway, d.addresses = addresses[0], addresses[1:]
+	sim, err := sda.NewSimulation(d.Simulation, string(rc.Toml()))
+	if err != nil {
+		return err
+	}
+	d.sc, err = sim.Setup(d.runDir, d.addresses)
+	if err != nil {
+		return err
+	}
+	d.sc.Config = string(rc.Toml())
+	if err := d.sc.Save(d.runDir); err != nil {
+		return err
+	}
+	log.Lvl2("Docker: Done deploying")
+	return nil
+}
+
+// Start creates the network and runs one container for each server. The
+// containers send their measures to a proxy which forwards them to the
+// monitor.
+func (d *Docker) Start(args ...string) error {
+	out, err := exec.Command("docker", "network", "create",
+		"--subnet", d.Subnet, "--gateway", d.gateway, d.Network).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Couldn't create network %s: %v - %s", d.Network,
+			err, out)
+	}
+	// the proxy listens on the port below the monitor
+	if err := monitor.Proxy("localhost:" + strconv.Itoa(d.monitorPort)); err != nil {
+		return err
+	}
+	monitorAddr := d.gateway + ":" + strconv.Itoa(d.monitorPort-1)
+	log.Lvl1("Starting", d.servers, "containers of", d.Image)
+	// room for the error of every container and the nil of Wait, so that
+	// no routine blocks once Wait returned
+	d.errChan = make(chan error, len(d.addresses)+1)
+	for index, host := range d.addresses {
+		d.wgRun.Add(1)
+		cmdArgs := append([]string{}, args...)
+		cmdArgs = append(cmdArgs, "-address", host, "-monitor", monitorAddr,
+			"-simul", d.Simulation,
+			"-debug", strconv.Itoa(log.DebugVisible()))
+		runArgs := []string{"run", "--rm",
+			"--name", d.Network + "-" + strconv.Itoa(index),
+			"--label", "cothority.network=" + d.Network,
+			"--net", d.Network, "--ip", host,
+			"-v", d.runDir + ":" + dockerWorkDir,
+		}
+		runArgs = append(runArgs, mountTrace(args)...)
+		shaping := d.shaping()
+		if shaping != "" {
+			runArgs = append(runArgs, "--cap-add", "NET_ADMIN")
+		}
+		runArgs = append(runArgs, d.Image, "sh", "-c",
+			shaping+"exec "+dockerBinary+" "+shellQuote(cmdArgs))
+		log.Lvl3("Docker args are", runArgs)
+		cmd := exec.Command("docker", runArgs...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		go func(i int, h string) {
+			log.Lvl3("Docker: will start host", h)
+			if err := cmd.Run(); err != nil {
+				log.Error("Error running container", h, ":", err)
+				d.errChan <- err
+			}
+			d.wgRun.Done()
+			log.Lvl3("host (index", i, ")", h, "done")
+		}(index, host)
+	}
+	return nil
+}
+
+// shaping returns the 'tc'-command emulating the network conditions in a
+// container, followed by '&&', or an empty string if the traffic is not
+// shaped.
+func (d *Docker) shaping() string {
+	netem := d.emulation.netem()
+	if netem == "" {
+		return ""
+	}
+	return "tc qdisc add dev eth0 root netem" + netem + " && "
+}
+
+// shellQuote quotes every argument for 'sh -c' and joins them.
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = "'" + strings.Replace(a, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// mountTrace returns the volume of the trace directory, if the conodes
+// record traces.
+func mountTrace(args []string) []string {
+	for i, a := range args {
+		if a == "-trace" && i+1 < len(args) {
+			return []string{"-v", args[i+1] + ":" + args[i+1]}
+		}
+	}
+	return nil
+}
+
+// SimulationConfig returns the configuration of the last deployed simulation
+func (d *Docker) SimulationConfig() *sda.SimulationConfig {
+	return d.sc
+}
+
+// Wait for all containers to finish
+func (d *Docker) Wait() error {
+	log.Lvl3("Waiting for containers to finish")
+	go func() {
+		d.wgRun.Wait()
+		log.Lvl3("WaitGroup is 0")
+		// write to error channel when done:
+		d.errChan <- nil
+	}()
+
+	// if one of the containers fails, stop waiting and return the error:
+	err := <-d.errChan
+	if err != nil {
+		if err := d.Cleanup(); err != nil {
+			log.Error("Couldn't cleanup running containers", err)
+		}
+		return err
+	}
+	if err := exec.Command("docker", "network", "rm", d.Network).Run(); err != nil {
+		log.Error("Couldn't remove network", d.Network, err)
+	}
+	log.Lvl2("Containers finished")
+	return nil
+}
+
+// subnetAddresses returns the first n addresses of the subnet, skipping the
+// address of the subnet itself.
+func subnetAddresses(subnet string, n int) ([]string, error) {
+	ip, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, err
+	}
+	ip = ip.Mask(ipnet.Mask).To4()
+	if ip == nil {
+		return nil, errors.New("Only IPv4 subnets are supported")
+	}
+	base := uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	ones, bits := ipnet.Mask.Size()
+	// without the address of the subnet and the broadcast address
+	if uint64(n) > uint64(1)<<uint(bits-ones)-2 {
+		return nil, fmt.Errorf("Subnet %s is too small for %d addresses",
+			subnet, n)
+	}
+	addresses := make([]string, n)
+	for i := range addresses {
+		a := base + uint32(i) + 1
+		addresses[i] = net.IPv4(byte(a>>24), byte(a>>16), byte(a>>8),
+			byte(a)).String()
+	}
+	return addresses, nil
+}
@@ -0,0 +1,30 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubnetAddresses(t *testing.T) {
+	addresses, err := subnetAddresses("172.28.0.0/16", 3)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"172.28.0.1", "172.28.0.2", "172.28.0.3"},
+		addresses)
+
+	// the broadcast address is not used
+	addresses, err = subnetAddresses("10.0.1.7/24", 254)
+	require.Nil(t, err)
+	assert.Equal(t, "10.0.1.1", addresses[0])
+	assert.Equal(t, "10.0.1.254", addresses[253])
+	_, err = subnetAddresses("10.0.1.0/24", 255)
+	assert.NotNil(t, err)
+	_, err = subnetAddresses("fd00::/64", 2)
+	assert.NotNil(t, err)
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'-address' '172.28.0.2' 'it'\''s a dir'`,
+		shellQuote([]string{"-address", "172.28.0.2", "it's a dir"}))
+}
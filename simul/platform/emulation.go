@@ -0,0 +1,107 @@
+package platform
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NetworkEmulation holds the network conditions a platform emulates for a
+// run. They are read from the following fields of the runfile:
+// 'delay' and 'jitter' in milliseconds, 'loss' in percent and 'bandwidth' in
+// Mbit/s. As all fields of the runfile, they are written to the result CSV.
+type NetworkEmulation struct {
+	// Delay of every packet sent in milliseconds, so that the round-trip
+	// time between two servers is twice the delay
+	Delay int
+	// Jitter is the maximal random delay in milliseconds added to Delay
+	Jitter int
+	// Loss is the percentage of packets that are lost and retransmitted
+	Loss float64
+	// Bandwidth of the servers in Mbit/s
+	Bandwidth float64
+}
+
+// ReadNetworkEmulation returns the network conditions of the run. Missing
+// fields are 0 and mean that the network is not degraded.
+func ReadNetworkEmulation(rc RunConfig) (NetworkEmulation, error) {
+	var ne NetworkEmulation
+	var err error
+	if ne.Delay, err = emulationInt(rc, "delay"); err != nil {
+		return ne, err
+	}
+	if ne.Jitter, err = emulationInt(rc, "jitter"); err != nil {
+		return ne, err
+	}
+	if ne.Loss, err = emulationFloat(rc, "loss"); err != nil {
+		return ne, err
+	}
+	if ne.Bandwidth, err = emulationFloat(rc, "bandwidth"); err != nil {
+		return ne, err
+	}
+	if ne.Loss < 0 || ne.Loss > 100 {
+		return ne, fmt.Errorf("Loss of %v%% is not a percentage", ne.Loss)
+	}
+	return ne, nil
+}
+
+func emulationInt(rc RunConfig, field string) (int, error) {
+	if rc.Get(field) == "" {
+		return 0, nil
+	}
+	i, err := rc.GetInt(field)
+	if err != nil {
+		return 0, fmt.Errorf("Couldn't parse %s: %v", field, err)
+	}
+	return i, nil
+}
+
+func emulationFloat(rc RunConfig, field string) (float64, error) {
+	v := rc.Get(field)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Couldn't parse %s: %v", field, err)
+	}
+	return f, nil
+}
+
+// Args returns the arguments of the simulation binary which make its
+// conodes emulate the network conditions on their TCP connections.
+func (ne NetworkEmulation) Args() []string {
+	var args []string
+	if ne.Delay > 0 {
+		args = append(args, "-delay", strconv.Itoa(ne.Delay))
+	}
+	if ne.Jitter > 0 {
+		args = append(args, "-jitter", strconv.Itoa(ne.Jitter))
+	}
+	if ne.Loss > 0 {
+		args = append(args, "-loss", strconv.FormatFloat(ne.Loss, 'f', -1, 64))
+	}
+	if ne.Bandwidth > 0 {
+		args = append(args, "-bandwidth",
+			strconv.FormatFloat(ne.Bandwidth, 'f', -1, 64))
+	}
+	return args
+}
+
+// netem returns the options of the 'tc netem' queueing discipline emulating
+// the network conditions, or an empty string if there are none.
+func (ne NetworkEmulation) netem() string {
+	var opts string
+	if ne.Delay > 0 || ne.Jitter > 0 {
+		opts += fmt.Sprintf(" delay %dms", ne.Delay)
+		if ne.Jitter > 0 {
+			opts += fmt.Sprintf(" %dms", ne.Jitter)
+		}
+	}
+	if ne.Loss > 0 {
+		opts += " loss " + strconv.FormatFloat(ne.Loss, 'f', -1, 64) + "%"
+	}
+	if ne.Bandwidth > 0 {
+		opts += fmt.Sprintf(" rate %dkbit", int(ne.Bandwidth*1000))
+	}
+	return opts
+}
@@ -0,0 +1,35 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkEmulation(t *testing.T) {
+	rc := NewRunConfig()
+	ne, err := ReadNetworkEmulation(*rc)
+	require.Nil(t, err)
+	assert.Nil(t, ne.Args())
+	assert.Equal(t, "", ne.netem())
+
+	rc.Put("delay", "50")
+	rc.Put("jitter", "10")
+	rc.Put("loss", "0.5")
+	rc.Put("bandwidth", "1.5")
+	ne, err = ReadNetworkEmulation(*rc)
+	require.Nil(t, err)
+	assert.Equal(t, NetworkEmulation{50, 10, 0.5, 1.5}, ne)
+	assert.Equal(t, []string{"-delay", "50", "-jitter", "10", "-loss", "0.5",
+		"-bandwidth", "1.5"}, ne.Args())
+	assert.Equal(t, " delay 50ms 10ms loss 0.5% rate 1500kbit", ne.netem())
+
+	rc.Put("loss", "200")
+	_, err = ReadNetworkEmulation(*rc)
+	assert.NotNil(t, err)
+	rc.Put("loss", "0")
+	rc.Put("delay", "fast")
+	_, err = ReadNetworkEmulation(*rc)
+	assert.NotNil(t, err)
+}
@@ -21,7 +21,9 @@ import (
 )
 
 // Localhost is responsible for launching the app with the specified number of nodes
-// directly on your machine, for local testing.
+// directly on your machine, for local testing. The network conditions of the
+// runfile are emulated by the conodes on their TCP connections, see
+// NetworkEmulation.
 
 // Localhost is the platform for launching thee apps locally
 type Localhost struct {
@@ -38,6 +40,8 @@ type Localhost struct {
 	// where to read the config file
 	// it will be assembled like LocalDir/RunDir
 	runDir string
+	// The simulation binary, which is shared by all workers
+	binary string
 
 	// Debug level 1 - 5
 	debug int
@@ -59,6 +63,11 @@ type Localhost struct {
 
 	// Listening monitor port
 	monitorPort int
+	// First port of the servers, or 0 if free ports are searched
+	portBase int
+
+	// Network conditions emulated on the TCP connections of the conodes
+	emulation NetworkEmulation
 
 	// SimulationConfig holds all things necessary for the run
 	sc *sda.SimulationConfig
@@ -72,10 +81,19 @@ func (d *Localhost) Configure(pc *Config) {
 	d.debug = pc.Debug
 	d.running = false
 	d.monitorPort = pc.MonitorPort
+	d.portBase = pc.PortBase
 	d.errChan = make(chan error)
 	if d.Simulation == "" {
 		log.Fatal("No simulation defined in simulation")
 	}
+	d.binary = d.runDir + "/" + d.Simulation
+	// every worker writes the configuration of its runs to its own directory
+	if pc.Worker > 0 {
+		d.runDir += "/worker" + strconv.Itoa(pc.Worker)
+	}
+	if err := os.MkdirAll(d.runDir, 0777); err != nil {
+		log.Fatal("Couldn't create", d.runDir, err)
+	}
 	log.Lvl3(fmt.Sprintf("Localhost dirs: RunDir %s", d.runDir))
 	log.Lvl3("Localhost configured ...")
 }
@@ -83,7 +101,7 @@ func (d *Localhost) Configure(pc *Config) {
 // Build makes sure that the binary is available for our local platform
 func (d *Localhost) Build(build string, arg ...string) error {
 	src := "./cothority"
-	dst := d.runDir + "/" + d.Simulation
+	dst := d.binary
 	start := time.Now()
 	// build for the local machine
 	res, err := Build(src, dst,
@@ -98,10 +116,15 @@ func (d *Localhost) Build(build string, arg ...string) error {
 	return err
 }
 
-// Cleanup kills all running cothority-binaryes
+// Cleanup kills all running cothority-binaryes. If the platform has its own
+// port range, only the binaries reporting to its monitor are killed, so that
+// the simulations of other workers keep running.
 func (d *Localhost) Cleanup() error {
 	log.Lvl3("Cleaning up")
-	ex := d.runDir + "/" + d.Simulation
+	ex := d.binary
+	if d.portBase > 0 {
+		ex += " .*-monitor localhost:" + strconv.Itoa(d.monitorPort) + " "
+	}
 	err := exec.Command("pkill", "-f", ex).Run()
 	if err != nil {
 		log.Lvl3("Error stopping localhost", err)
@@ -136,8 +159,18 @@ func (d *Localhost) Deploy(rc RunConfig) error {
 	}
 
 	d.servers, _ = strconv.Atoi(rc.Get("servers"))
+	var err error
+	if d.emulation, err = ReadNetworkEmulation(rc); err != nil {
+		return err
+	}
 	log.Lvl2("Localhost: Deploying and writing config-files for", d.servers, "servers")
-	sim, err := sda.NewSimulation(d.Simulation, string(rc.Toml()))
+	config := rc.Toml()
+	if d.portBase > 0 {
+		withPorts := rc.Clone()
+		withPorts.Put("portbase", strconv.Itoa(d.portBase))
+		config = withPorts.Toml()
+	}
+	sim, err := sda.NewSimulation(d.Simulation, string(config))
 	if err != nil {
 		return err
 	}
@@ -161,11 +194,7 @@ func (d *Localhost) Deploy(rc RunConfig) error {
 // Start will execute one cothority-binary for each server
 // configured
 func (d *Localhost) Start(args ...string) error {
-	if err := os.Chdir(d.runDir); err != nil {
-		return err
-	}
-	log.Lvl4("Localhost: chdir into", d.runDir)
-	ex := d.runDir + "/" + d.Simulation
+	ex := d.binary
 	d.running = true
 	log.Lvl1("Starting", d.servers, "applications of", ex)
 	for index := 0; index < d.servers; index++ {
@@ -177,9 +206,10 @@ func (d *Localhost) Start(args ...string) error {
 			"-simul", d.Simulation,
 			"-debug", strconv.Itoa(log.DebugVisible()),
 		}
-		cmdArgs = append(args, cmdArgs...)
+		cmdArgs = append(append(args, d.emulation.Args()...), cmdArgs...)
 		log.Lvl3("CmdArgs are", cmdArgs)
 		cmd := exec.Command(ex, cmdArgs...)
+		cmd.Dir = d.runDir
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		go func(i int, h string) {
@@ -196,6 +226,11 @@ func (d *Localhost) Start(args ...string) error {
 	return nil
 }
 
+// SimulationConfig returns the configuration of the last deployed simulation
+func (d *Localhost) SimulationConfig() *sda.SimulationConfig {
+	return d.sc
+}
+
 // Wait for all processes to finish
 func (d *Localhost) Wait() error {
 	log.Lvl3("Waiting for processes to finish")
@@ -1,6 +1,7 @@
 // Package platform contains interface and implementation to run SDA code
 // amongst multiple platforms. Such implementations include Localhost (run your
-// test locally) and Deterlab (similar to emulab).
+// test locally), Docker (run your test locally in one container per server)
+// and Deterlab (similar to emulab).
 package platform
 
 import (
@@ -14,6 +15,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/sda"
 )
 
 // Platform interface that has to be implemented to add another simulation-
@@ -33,6 +35,9 @@ type Platform interface {
 	Start(args ...string) error
 	// Waits for the application to quit
 	Wait() error
+	// Returns the configuration of the last deployed simulation, with its
+	// Roster and Tree, or nil if nothing has been deployed yet
+	SimulationConfig() *sda.SimulationConfig
 }
 
 // Config is passed to Platform.Config and prepares the platform for
@@ -40,13 +45,21 @@ type Platform interface {
 type Config struct {
 	MonitorPort int
 	Debug       int
+	// Worker is the index of the platform when several simulations run in
+	// parallel on the same machine, each on its own platform
+	Worker int
+	// PortBase is the first port of the range of the servers, if the
+	// platform has to stay out of the ports of other workers. If it is 0,
+	// the platform chooses the ports.
+	PortBase int
 }
 
 var deterlab = "deterlab"
 var localhost = "localhost"
+var docker = "docker"
 
 // NewPlatform returns the appropriate platform
-// [deterlab,localhost]
+// [deterlab,localhost,docker]
 func NewPlatform(t string) Platform {
 	var p Platform
 	switch t {
@@ -54,6 +67,8 @@ func NewPlatform(t string) Platform {
 		p = &Deterlab{}
 	case localhost:
 		p = &Localhost{}
+	case docker:
+		p = &Docker{}
 	}
 	return p
 }
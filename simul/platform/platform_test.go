@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/sda"
 	"github.com/dedis/cothority/simul/platform"
 )
 
@@ -52,3 +53,6 @@ func (t *TPlat) Start(...string) error               { return nil }
 func (t *TPlat) Stop() error                         { return nil }
 func (t *TPlat) Cleanup() error                      { return nil }
 func (t *TPlat) Wait() error                         { return nil }
+func (t *TPlat) SimulationConfig() *sda.SimulationConfig {
+	return nil
+}
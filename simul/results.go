@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/monitor"
+	"github.com/dedis/cothority/simul/platform"
+)
+
+// results writes everything measured during the simulation of a runfile to
+// its own directory, resultsDir/<simulation>/<date>_<commit>, so that the
+// experiment can be plotted again or compared with other commits without
+// running it again. The directory holds a copy of the runfile, info.json
+// describing the experiment, raw.jsonl with every measure of every
+// successful run, summary.jsonl with the statistics of every line of the
+// runfile, progress.jsonl with the averages of the lines that are done and a
+// copy of the CSV-file.
+//
+// With -resume, the results of the last experiment of the runfile are
+// completed instead, and the lines it has done are not run again.
+type results struct {
+	dir string
+	// absolute path of the CSV-file
+	csv      string
+	raw      *json.Encoder
+	summary  *json.Encoder
+	progress *json.Encoder
+	// progress.jsonl is synced after every line
+	progressFile *os.File
+	files        []*os.File
+	// lines done by the experiment that is resumed
+	resumed map[int]*progressLine
+	// the lines of the runfile are written by several workers
+	mutex sync.Mutex
+}
+
+// resultsInfo describes an experiment.
+type resultsInfo struct {
+	Simulation string
+	Date       time.Time
+	// Commit of the cothority, with "-dirty" appended if the working tree
+	// has changes
+	Commit   string
+	Platform string
+	Args     []string
+}
+
+// rawMeasure is a line of raw.jsonl.
+type rawMeasure struct {
+	// Line of the runfile
+	Line int
+	// Run is the number of the run of this line
+	Run int
+	monitor.RawMeasure
+}
+
+// summaryLine is a line of summary.jsonl.
+type summaryLine struct {
+	Line   int
+	Config map[string]string
+	// Runs is the number of successful runs and Failed the number of runs
+	// that failed
+	Runs   int
+	Failed int
+	// Values holds the statistics of all runs, by measure
+	Values map[string]monitor.ValueSummary
+}
+
+// progressLine is a line of progress.jsonl. It holds the averages of a line
+// of the runfile as written to the CSV-file.
+type progressLine struct {
+	Line   int
+	Header string
+	Values string
+}
+
+// newProgressLine returns the progress of the line of the runfile, whose
+// runs are averaged in stats.
+func newProgressLine(line int, stats *monitor.Stats) *progressLine {
+	var header, values bytes.Buffer
+	stats.WriteHeader(&header)
+	stats.WriteValues(&values)
+	return &progressLine{line, header.String(), values.String()}
+}
+
+// newResults creates the directory of the results of the runfile, whose
+// averages are written to the CSV-file csv. If resume is set, the last
+// results of the runfile are completed.
+func newResults(name, runfile, csv string) (*results, error) {
+	csv, err := filepath.Abs(csv)
+	if err != nil {
+		return nil, err
+	}
+	r := &results{csv: csv, resumed: make(map[int]*progressLine)}
+	if resume {
+		if r.dir, err = lastResults(name, runfile); err != nil {
+			return nil, err
+		}
+	}
+	if r.dir == "" {
+		if r.dir, err = createResults(name, runfile); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := r.readProgress(); err != nil {
+			return nil, err
+		}
+		log.Lvl1("Resuming", r.dir, "with", len(r.resumed), "lines done")
+	}
+	raw, err := r.open("raw.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	summary, err := r.open("summary.jsonl")
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	progress, err := r.open("progress.jsonl")
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	r.raw = json.NewEncoder(raw)
+	r.summary = json.NewEncoder(summary)
+	r.progress = json.NewEncoder(progress)
+	r.progressFile = progress
+	log.Lvl2("Writing results to", r.dir)
+	return r, nil
+}
+
+// createResults creates a new directory for the results of the runfile.
+func createResults(name, runfile string) (string, error) {
+	info := resultsInfo{
+		Simulation: name,
+		Date:       time.Now(),
+		Commit:     gitCommit(),
+		Platform:   platformDst,
+		Args:       os.Args[1:],
+	}
+	dir := filepath.Join(resultsDir, name,
+		info.Date.Format("20060102-150405")+"_"+info.Commit)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	if err := copyFile(runfile, filepath.Join(dir, "runfile.toml")); err != nil {
+		return "", err
+	}
+	buf, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return dir, ioutil.WriteFile(filepath.Join(dir, "info.json"), buf, 0660)
+}
+
+// lastResults returns the directory of the last experiment of the runfile
+// that can be resumed, or an empty string if there is none. It returns an
+// error if the runfile changed since that experiment.
+func lastResults(name, runfile string) (string, error) {
+	progress, err := filepath.Glob(filepath.Join(resultsDir, name, "*",
+		"progress.jsonl"))
+	if err != nil || len(progress) == 0 {
+		log.Lvl1("No results of", name, "to resume")
+		return "", err
+	}
+	// the directories start with the date
+	sort.Strings(progress)
+	dir := filepath.Dir(progress[len(progress)-1])
+	old, err := ioutil.ReadFile(filepath.Join(dir, "runfile.toml"))
+	if err != nil {
+		return "", err
+	}
+	current, err := ioutil.ReadFile(runfile)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(old, current) {
+		return "", fmt.Errorf("%s changed since the experiment in %s",
+			runfile, dir)
+	}
+	return dir, nil
+}
+
+// readProgress reads the lines done by the experiment that is resumed. An
+// incomplete last line, written while the experiment crashed, is ignored.
+func (r *results) readProgress() error {
+	f, err := os.Open(filepath.Join(r.dir, "progress.jsonl"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		p := &progressLine{}
+		if err := dec.Decode(p); err == io.EOF {
+			return nil
+		} else if err != nil {
+			log.Error("Couldn't read all progress of", r.dir, err)
+			return nil
+		}
+		r.resumed[p.Line] = p
+	}
+}
+
+// open opens a file of the results for appending.
+func (r *results) open(file string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(r.dir, file),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, err
+	}
+	r.files = append(r.files, f)
+	return f, nil
+}
+
+// addRun writes all measures of a successful run of the line of the
+// runfile.
+func (r *results) addRun(line, run int, stats *monitor.Stats) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, m := range stats.Raw() {
+		if err := r.raw.Encode(&rawMeasure{line, run, m}); err != nil {
+			log.Error("Couldn't write raw measure:", err)
+			return
+		}
+	}
+}
+
+// addSummary writes the statistics of all successful runs of the line of
+// the runfile. stats must be the average of the runs.
+func (r *results) addSummary(line int, rc platform.RunConfig,
+	stats *monitor.Stats, runs, failed int) {
+	s := &summaryLine{
+		Line:   line,
+		Config: rc.Map(),
+		Runs:   runs,
+		Failed: failed,
+	}
+	if stats != nil {
+		s.Values = stats.Summary()
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.summary.Encode(s); err != nil {
+		log.Error("Couldn't write summary:", err)
+	}
+}
+
+// addDone records that the line of the runfile is done, so that it is not
+// run again when the experiment is resumed.
+func (r *results) addDone(p *progressLine) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.progress.Encode(p); err != nil {
+		log.Error("Couldn't write progress:", err)
+		return
+	}
+	if err := r.progressFile.Sync(); err != nil {
+		log.Error("Couldn't sync progress:", err)
+	}
+}
+
+// done returns the averages of the line of the runfile if it was done by
+// the experiment that is resumed, else nil.
+func (r *results) done(line int) *progressLine {
+	return r.resumed[line]
+}
+
+// finish copies the CSV-file to the results and closes them.
+func (r *results) finish() {
+	if err := copyFile(r.csv, filepath.Join(r.dir, filepath.Base(r.csv))); err != nil {
+		log.Error("Couldn't copy", r.csv, "to the results:", err)
+	}
+	r.close()
+}
+
+func (r *results) close() {
+	for _, f := range r.files {
+		if err := f.Close(); err != nil {
+			log.Error("Couldn't close", f.Name(), err)
+		}
+	}
+	r.files = nil
+}
+
+// gitCommit returns the abbreviated commit of the working directory, or
+// "unknown" if it is not in a git repository.
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	commit := strings.TrimSpace(string(out))
+	status, err := exec.Command("git", "status", "--porcelain",
+		"--untracked-files=no").Output()
+	if err == nil && len(strings.TrimSpace(string(status))) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+func copyFile(src, dst string) error {
+	buf, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, buf, 0660)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/log"
+	"github.com/dedis/cothority/monitor"
+	"github.com/dedis/cothority/simul/platform"
+)
+
+// worker runs lines of a runfile on its own platform. When several workers
+// run in parallel on localhost, every worker has its own monitor port, port
+// range and run directory, so that their simulations don't interfere.
+type worker struct {
+	id          int
+	platform    platform.Platform
+	monitorPort int
+	// portBase is the first port of the servers of the worker, or 0 if the
+	// worker runs alone
+	portBase int
+	// traceDir is != "" if the conodes record their messages
+	traceDir string
+}
+
+// newWorkers returns the workers running the lines of the runfile, with
+// their platforms configured. The first worker uses deployP, the others get
+// their own platform.
+func newWorkers(simulation string) []*worker {
+	workers := make([]*worker, parallel)
+	for i := range workers {
+		p := deployP
+		if i > 0 {
+			p = platform.NewPlatform(platformDst)
+			platform.ReadRunFile(p, simulation)
+		}
+		workers[i] = newWorker(i, p)
+		p.Configure(workers[i].config())
+	}
+	return workers
+}
+
+// newWorker returns the worker of the given index, running its simulations
+// on p.
+func newWorker(id int, p platform.Platform) *worker {
+	w := &worker{
+		id:          id,
+		platform:    p,
+		monitorPort: monitorPort + id,
+		traceDir:    traceDir,
+	}
+	if parallel > 1 {
+		w.portBase = portBase + id*portRange
+		if traceDir != "" {
+			w.traceDir = filepath.Join(traceDir, "worker"+strconv.Itoa(id))
+		}
+	}
+	return w
+}
+
+// config returns the configuration of the platform of the worker.
+func (w *worker) config() *platform.Config {
+	return &platform.Config{
+		MonitorPort: w.monitorPort,
+		Debug:       log.DebugVisible(),
+		Worker:      w.id,
+		PortBase:    w.portBase,
+	}
+}
+
+// runLine runs the line of the runfile until it has the number of
+// successful runs asked for or too many runs failed, and returns the average
+// of its runs, or nil if no run succeeded.
+func (w *worker) runLine(name string, line int, rc platform.RunConfig,
+	res *results) *progressLine {
+	log.Lvl1("Worker", w.id, "starts line", line, "-", rc.String())
+	stats := make([]*monitor.Stats, 0, runs)
+	failed := 0
+	for r := 0; len(stats) < runs && failed <= retries; r++ {
+		s, err := w.RunTest(rc)
+		if err != nil {
+			log.Error("Error running test, trying again:", err)
+			failed++
+			if failed <= retries && retryWait > 0 {
+				time.Sleep(time.Duration(retryWait) * time.Second)
+			}
+			continue
+		}
+		stats = append(stats, s)
+		res.addRun(line, r, s)
+	}
+
+	if len(stats) == 0 {
+		log.Lvl1("unable to get any data for test:", rc)
+		res.addSummary(line, rc, nil, 0, failed)
+		return nil
+	}
+	if export {
+		exportRun(w.platform, name, line, stats[len(stats)-1])
+	}
+
+	s := monitor.AverageStats(stats)
+	p := newProgressLine(line, s)
+	res.addSummary(line, rc, s, len(stats), failed)
+	res.addDone(p)
+	return p
+}
+
+// RunTest a single test - takes a test-file as a string that will be copied
+// to the deterlab-server
+func (w *worker) RunTest(rc platform.RunConfig) (*monitor.Stats, error) {
+	done := make(chan struct{})
+	CheckHosts(rc)
+	rc.Delete("simulation")
+	rs := monitor.NewStats(rc.Map(), "hosts", "bf")
+	monitor := monitor.NewMonitor(rs)
+
+	if hosts, _ := rc.GetInt("hosts"); w.portBase > 0 && hosts > portRange {
+		return rs, fmt.Errorf("%d hosts don't fit in a port range of %d",
+			hosts, portRange)
+	}
+	if err := w.platform.Deploy(rc); err != nil {
+		log.Error(err)
+		return rs, err
+	}
+
+	monitor.SinkPort = w.monitorPort
+	if err := w.platform.Cleanup(); err != nil {
+		log.Error(err)
+		return rs, err
+	}
+	monitor.SinkPort = w.monitorPort
+	go func() {
+		if err := monitor.Listen(); err != nil {
+			log.Fatal("Could not monitor.Listen():", err)
+		}
+	}()
+	// Start monitor before so ssh tunnel can connect to the monitor
+	// in case of deterlab.
+	var args []string
+	if w.traceDir != "" {
+		if err := os.MkdirAll(w.traceDir, 0777); err != nil {
+			return rs, err
+		}
+		args = []string{"-trace", w.traceDir}
+	}
+	err := w.platform.Start(args...)
+	if err != nil {
+		log.Error(err)
+		return rs, err
+	}
+
+	go func() {
+		var err error
+		if err = w.platform.Wait(); err != nil {
+			log.Lvl3("Test failed:", err)
+			if err := w.platform.Cleanup(); err != nil {
+				log.Lvl3("Couldn't cleanup platform:", err)
+			}
+			done <- struct{}{}
+		}
+		log.Lvl3("Test complete:", rs)
+		done <- struct{}{}
+	}()
+
+	timeOut := getRunWait(rc)
+	// can timeout the command if it takes too long
+	select {
+	case <-done:
+		monitor.Stop()
+		return rs, nil
+	case <-time.After(time.Second * time.Duration(timeOut)):
+		monitor.Stop()
+		return rs, errors.New("Simulation timeout")
+	}
+}
+
+// csvFile writes the averages of the lines of the runfile to the CSV-file in
+// the order of the runfile, even if the workers finish them in another
+// order.
+type csvFile struct {
+	file *os.File
+	// lines to write, in order
+	lines []int
+	// index in lines of the next line to write
+	next int
+	// lines that are done, with nil for lines without data
+	done  map[int]*progressLine
+	mutex sync.Mutex
+}
+
+func newCSVFile(file *os.File, lines []int) *csvFile {
+	return &csvFile{
+		file:  file,
+		lines: lines,
+		done:  make(map[int]*progressLine),
+	}
+}
+
+// add records that the line is done and writes all lines that can be
+// written in order.
+func (c *csvFile) add(line int, p *progressLine) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.done[line] = p
+	for ; c.next < len(c.lines); c.next++ {
+		p, ok := c.done[c.lines[c.next]]
+		if !ok {
+			break
+		}
+		if p == nil {
+			continue
+		}
+		if p.Line == 0 {
+			fmt.Fprint(c.file, p.Header)
+		}
+		fmt.Fprint(c.file, p.Values)
+	}
+	if err := c.file.Sync(); err != nil {
+		log.Fatal("error syncing data to test file:", err)
+	}
+}
@@ -3,17 +3,20 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"errors"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/dedis/cothority/log"
 	"github.com/dedis/cothority/monitor"
+	"github.com/dedis/cothority/sda"
 	"github.com/dedis/cothority/simul/platform"
 )
 
@@ -30,9 +33,19 @@ var simRange = ""
 var race = false
 var runWait = 180
 var experimentWait = 0
+var export = false
+var traceDir = ""
+var resultsDir = "results"
+var parallel = 1
+var portBase = 20000
+var portRange = 1000
+var runs = 1
+var retries = 9
+var retryWait = 0
+var resume = false
 
 func init() {
-	flag.StringVar(&platformDst, "platform", platformDst, "platform to deploy to [deterlab,localhost]")
+	flag.StringVar(&platformDst, "platform", platformDst, "platform to deploy to [deterlab,localhost,docker]")
 	flag.BoolVar(&nobuild, "nobuild", false, "Don't rebuild all helpers")
 	flag.BoolVar(&clean, "clean", false, "Only clean platform")
 	flag.StringVar(&build, "build", "", "List of packages to build")
@@ -42,6 +55,16 @@ func init() {
 	flag.StringVar(&simRange, "range", simRange, "Range of simulations to run. 0: or 3:4 or :4")
 	flag.IntVar(&runWait, "runwait", runWait, "How long to wait for each simulation to finish - overwrites .toml-value")
 	flag.IntVar(&experimentWait, "experimentwait", experimentWait, "How long to wait for the whole experiment to finish")
+	flag.BoolVar(&export, "export", false, "Write the tree and roster of each run as DOT and JSON to test_data")
+	flag.StringVar(&traceDir, "trace", "", "Record the messages of every conode of the last run to a trace in that directory (localhost only)")
+	flag.StringVar(&resultsDir, "results", resultsDir, "Directory where the raw measures and statistics of every simulation are kept")
+	flag.IntVar(&parallel, "parallel", parallel, "Number of lines of the runfile run in parallel (localhost only)")
+	flag.IntVar(&portBase, "portbase", portBase, "First port of the servers when running in parallel")
+	flag.IntVar(&portRange, "portrange", portRange, "Number of ports of every parallel worker, starting at portbase")
+	flag.IntVar(&runs, "runs", runs, "Number of successful runs of every line of the runfile that are averaged")
+	flag.IntVar(&retries, "retries", retries, "Number of failed runs of a line before giving up on it")
+	flag.IntVar(&retryWait, "retrywait", retryWait, "How long to wait in seconds before running a failed line again")
+	flag.BoolVar(&resume, "resume", false, "Resume the last experiment of the runfile, skipping the lines it has done")
 	log.RegisterFlags()
 }
 
@@ -52,6 +75,25 @@ func main() {
 	if deployP == nil {
 		log.Fatal("Platform not recognized.", platformDst)
 	}
+	if parallel < 1 || runs < 1 || retries < 0 {
+		log.Fatal("-parallel and -runs must be positive, -retries can't be negative")
+	}
+	if parallel > 1 && platformDst != "localhost" {
+		log.Fatal("Only localhost can run simulations in parallel")
+	}
+	// the simulation is started in another directory
+	var err error
+	if resultsDir, err = filepath.Abs(resultsDir); err != nil {
+		log.Fatal("Couldn't find results directory:", err)
+	}
+	if traceDir != "" {
+		if traceDir, err = filepath.Abs(traceDir); err != nil {
+			log.Fatal("Couldn't find trace directory:", err)
+		}
+		if err := os.MkdirAll(traceDir, 0777); err != nil {
+			log.Fatal("Couldn't create trace directory:", err)
+		}
+	}
 	log.Lvl1("Deploying to", platformDst)
 
 	simulations := flag.Args()
@@ -65,24 +107,28 @@ func main() {
 		if len(runconfigs) == 0 {
 			log.Fatal("No tests found in", simulation)
 		}
-		deployP.Configure(&platform.Config{
-			MonitorPort: monitorPort,
-			Debug:       log.DebugVisible(),
-		})
+		workers := newWorkers(simulation)
 
 		if clean {
-			err := deployP.Deploy(runconfigs[0])
-			if err != nil {
-				log.Fatal("Couldn't deploy:", err)
-			}
-			if err := deployP.Cleanup(); err != nil {
-				log.Error("Couldn't cleanup correctly:", err)
+			// every worker has its own monitor port and conodes
+			for _, w := range workers {
+				if err := w.platform.Deploy(runconfigs[0]); err != nil {
+					log.Fatal("Couldn't deploy:", err)
+				}
+				if err := w.platform.Cleanup(); err != nil {
+					log.Error("Couldn't cleanup correctly:", err)
+				}
 			}
 		} else {
 			logname := strings.Replace(filepath.Base(simulation), ".toml", "", 1)
+			mkTestDir()
+			res, err := newResults(logname, simulation, testFile(logname))
+			if err != nil {
+				log.Fatal("Couldn't create results:", err)
+			}
 			testsDone := make(chan bool)
 			go func() {
-				RunTests(logname, runconfigs)
+				RunTests(logname, runconfigs, workers, res)
 				testsDone <- true
 			}()
 			timeout := getExperimentWait(runconfigs)
@@ -97,28 +143,29 @@ func main() {
 }
 
 // RunTests the given tests and puts the output into the
-// given file name. It outputs RunStats in a CSV format.
-func RunTests(name string, runconfigs []platform.RunConfig) {
-
+// given file name. It outputs RunStats in a CSV format and writes all
+// measures and their statistics to res. The lines of the runfile are
+// distributed to the workers, which run them in parallel. Lines done by an
+// experiment that is resumed are not run again.
+func RunTests(name string, runconfigs []platform.RunConfig, workers []*worker,
+	res *results) {
+	defer res.finish()
+
+	// the workers share the binary
 	if nobuild == false {
 		if race {
-			if err := deployP.Build(build, "-race"); err != nil {
+			if err := workers[0].platform.Build(build, "-race"); err != nil {
 				log.Error("Couln't finish build without errors:",
 					err)
 			}
 		} else {
-			if err := deployP.Build(build); err != nil {
+			if err := workers[0].platform.Build(build); err != nil {
 				log.Error("Couln't finish build without errors:",
 					err)
 			}
 		}
 	}
 
-	mkTestDir()
-	rs := make([]*monitor.Stats, len(runconfigs))
-	// Try 10 times to run the test
-	nTimes := 10
-	stopOnSuccess := true
 	var f *os.File
 	args := os.O_CREATE | os.O_RDWR | os.O_TRUNC
 	// If a range is given, we only append
@@ -140,104 +187,78 @@ func RunTests(name string, runconfigs []platform.RunConfig) {
 	}
 
 	start, stop := getStartStop(len(runconfigs))
+	var lines []int
 	for i, t := range runconfigs {
 		// Implement a simple range-argument that will skip checks not in range
 		if i < start || i > stop {
 			log.Lvl2("Skipping", t, "because of range")
 			continue
 		}
-		// Waiting for the document-branch to be merged, then uncomment this
-		//log.Lvl1("Starting run with parameters -", t.String())
-
-		// run test t nTimes times
-		// take the average of all successful runs
-		runs := make([]*monitor.Stats, 0, nTimes)
-		for r := 0; r < nTimes; r++ {
-			stats, err := RunTest(t)
-			if err != nil {
-				log.Error("Error running test, trying again:", err)
-				continue
-			}
-
-			runs = append(runs, stats)
-			if stopOnSuccess {
-				break
+		lines = append(lines, i)
+	}
+	csv := newCSVFile(f, lines)
+
+	todo := make(chan int)
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			for i := range todo {
+				csv.add(i, w.runLine(name, i, runconfigs[i], res))
 			}
-		}
-
-		if len(runs) == 0 {
-			log.Lvl1("unable to get any data for test:", t)
+		}(w)
+	}
+	for _, i := range lines {
+		if p := res.done(i); p != nil {
+			log.Lvl1("Skipping line", i, "which is already done")
+			csv.add(i, p)
 			continue
 		}
-
-		s := monitor.AverageStats(runs)
-		if i == 0 {
-			s.WriteHeader(f)
-		}
-		rs[i] = s
-		rs[i].WriteValues(f)
-		err = f.Sync()
-		if err != nil {
-			log.Fatal("error syncing data to test file:", err)
-		}
+		todo <- i
 	}
+	close(todo)
+	wg.Wait()
 }
 
-// RunTest a single test - takes a test-file as a string that will be copied
-// to the deterlab-server
-func RunTest(rc platform.RunConfig) (*monitor.Stats, error) {
-	done := make(chan struct{})
-	CheckHosts(rc)
-	rc.Delete("simulation")
-	rs := monitor.NewStats(rc.Map(), "hosts", "bf")
-	monitor := monitor.NewMonitor(rs)
-
-	if err := deployP.Deploy(rc); err != nil {
-		log.Error(err)
-		return rs, err
-	}
-
-	monitor.SinkPort = monitorPort
-	if err := deployP.Cleanup(); err != nil {
-		log.Error(err)
-		return rs, err
+// exportRun writes the tree and the roster of the last simulation deployed
+// on p as DOT and JSON files, annotated with the measures of every node.
+func exportRun(p platform.Platform, name string, run int, stats *monitor.Stats) {
+	sc := p.SimulationConfig()
+	if sc == nil {
+		log.Error("No simulation to export")
+		return
 	}
-	monitor.SinkPort = monitorPort
-	go func() {
-		if err := monitor.Listen(); err != nil {
-			log.Fatal("Could not monitor.Listen():", err)
+	metrics := make(sda.NodeMetrics)
+	for node, values := range stats.Nodes() {
+		i, err := strconv.Atoi(node)
+		if err != nil {
+			log.Lvl2("Measures of unknown node", node)
+			continue
 		}
-	}()
-	// Start monitor before so ssh tunnel can connect to the monitor
-	// in case of deterlab.
-	err := deployP.Start()
+		metrics[i] = values
+	}
+	treeJSON, err := sc.Tree.ExportJSON(metrics)
 	if err != nil {
-		log.Error(err)
-		return rs, err
+		log.Error("Couldn't export tree:", err)
+		return
 	}
-
-	go func() {
-		var err error
-		if err = deployP.Wait(); err != nil {
-			log.Lvl3("Test failed:", err)
-			if err := deployP.Cleanup(); err != nil {
-				log.Lvl3("Couldn't cleanup platform:", err)
-			}
-			done <- struct{}{}
+	rosterJSON, err := sc.Roster.ExportJSON(metrics)
+	if err != nil {
+		log.Error("Couldn't export roster:", err)
+		return
+	}
+	base := fmt.Sprintf("test_data/%s_%d", name, run)
+	files := map[string][]byte{
+		base + "_tree.dot":    []byte(sc.Tree.ExportDOT(metrics)),
+		base + "_tree.json":   treeJSON,
+		base + "_roster.dot":  []byte(sc.Roster.ExportDOT(metrics)),
+		base + "_roster.json": rosterJSON,
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(file, content, 0660); err != nil {
+			log.Error("Couldn't write", file, err)
 		}
-		log.Lvl3("Test complete:", rs)
-		done <- struct{}{}
-	}()
-
-	timeOut := getRunWait(rc)
-	// can timeout the command if it takes too long
-	select {
-	case <-done:
-		monitor.Stop()
-		return rs, nil
-	case <-time.After(time.Second * time.Duration(timeOut)):
-		monitor.Stop()
-		return rs, errors.New("Simulation timeout")
 	}
 }
 
@@ -332,7 +353,9 @@ func getRunWait(rc platform.RunConfig) int {
 // getExperimentWait returns
 // 1. the command-line value
 // 2. the value from runconfig
-// 3. #runconfigs * runWait
+// 3. the time the workers need if every line runs until it gives up: runs *
+// (1 + retries) times runWait plus the retryWaits, shared by the parallel
+// workers, but at least the time of the longest line
 func getExperimentWait(rcs []platform.RunConfig) int {
 	if experimentWait > 0 {
 		return experimentWait
@@ -341,9 +364,17 @@ func getExperimentWait(rcs []platform.RunConfig) int {
 	if err == nil {
 		return rcExp
 	}
-	wait := 0
+	wait, longest := 0, 0
 	for _, rc := range rcs {
-		wait += getRunWait(rc)
+		line := runs*(1+retries)*getRunWait(rc) + retries*retryWait
+		wait += line
+		if line > longest {
+			longest = line
+		}
+	}
+	wait = (wait + parallel - 1) / parallel
+	if wait < longest {
+		return longest
 	}
 	return wait
 }
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 
+	"github.com/dedis/cothority/monitor"
 	"github.com/dedis/cothority/simul/platform"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBuild(t *testing.T) {
@@ -44,3 +51,135 @@ func TestDepth(t *testing.T) {
 		}
 	}
 }
+
+func TestExperimentWait(t *testing.T) {
+	defer func(r, rt, rw, p int) {
+		runs, retries, retryWait, parallel = r, rt, rw, p
+	}(runs, retries, retryWait, parallel)
+	rcs := make([]platform.RunConfig, 4)
+	for i := range rcs {
+		rcs[i] = *platform.NewRunConfig()
+		rcs[i].Put("runwait", "10")
+	}
+	runs, retries, retryWait, parallel = 1, 0, 0, 1
+	require.Equal(t, 40, getExperimentWait(rcs))
+	runs, retries, retryWait = 5, 1, 3
+	require.Equal(t, 4*(5*2*10+3), getExperimentWait(rcs))
+	parallel = 3
+	require.Equal(t, (4*(5*2*10+3)+2)/3, getExperimentWait(rcs))
+	// a worker needs at least the time of the longest line
+	parallel = 8
+	require.Equal(t, 5*2*10+3, getExperimentWait(rcs))
+}
+
+func TestResults(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "results")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	defer func(dir string) { resultsDir = dir }(resultsDir)
+	resultsDir = tmp
+	runfile := filepath.Join(tmp, "test.toml")
+	csv := filepath.Join(tmp, "test.csv")
+	require.Nil(t, ioutil.WriteFile(runfile, []byte("Hosts\n3\n"), 0660))
+	require.Nil(t, ioutil.WriteFile(csv, []byte("hosts\n3\n"), 0660))
+
+	res, err := newResults("test", runfile, csv)
+	require.Nil(t, err)
+	rc := platform.NewRunConfig()
+	rc.Put("hosts", "3")
+	stats := monitor.NewStats(rc.Map())
+	stats.Update(monitor.NewSingleMeasure("round_wall", 1))
+	stats.Update(monitor.NewSingleMeasure("round_wall", 3))
+	res.addRun(0, 0, stats)
+	res.addSummary(0, *rc, stats, 1, 2)
+	res.finish()
+
+	dirs, err := filepath.Glob(filepath.Join(tmp, "test", "*"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dirs))
+	for _, f := range []string{"runfile.toml", "info.json", "test.csv"} {
+		_, err := os.Stat(filepath.Join(dirs[0], f))
+		require.Nil(t, err, f)
+	}
+
+	raw := readJSONLines(t, filepath.Join(dirs[0], "raw.jsonl"))
+	require.Equal(t, 2, len(raw))
+	require.Equal(t, "round_wall", raw[1]["Name"])
+	require.Equal(t, 3.0, raw[1]["Value"])
+	require.Equal(t, "3", raw[1]["Config"].(map[string]interface{})["hosts"])
+
+	summary := readJSONLines(t, filepath.Join(dirs[0], "summary.jsonl"))
+	require.Equal(t, 1, len(summary))
+	require.Equal(t, 2.0, summary[0]["Failed"])
+	round := summary[0]["Values"].(map[string]interface{})["round_wall"]
+	require.Equal(t, 2.0, round.(map[string]interface{})["Avg"])
+}
+
+func TestResultsResume(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "results")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	defer func(dir string) { resultsDir = dir }(resultsDir)
+	defer func() { resume = false }()
+	resultsDir = tmp
+	runfile := filepath.Join(tmp, "test.toml")
+	csv := filepath.Join(tmp, "test.csv")
+	require.Nil(t, ioutil.WriteFile(runfile, []byte("Hosts\n3\n5\n"), 0660))
+	require.Nil(t, ioutil.WriteFile(csv, nil, 0660))
+
+	res, err := newResults("test", runfile, csv)
+	require.Nil(t, err)
+	res.addDone(&progressLine{1, "hosts\n", "5\n"})
+	res.finish()
+
+	resume = true
+	res, err = newResults("test", runfile, csv)
+	require.Nil(t, err)
+	require.Nil(t, res.done(0))
+	require.Equal(t, "5\n", res.done(1).Values)
+	res.addDone(&progressLine{0, "hosts\n", "3\n"})
+	res.finish()
+	dirs, err := filepath.Glob(filepath.Join(tmp, "test", "*"))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(dirs))
+	require.Equal(t, 2, len(readJSONLines(t, filepath.Join(dirs[0],
+		"progress.jsonl"))))
+
+	// a changed runfile can't be resumed
+	require.Nil(t, ioutil.WriteFile(runfile, []byte("Hosts\n3\n"), 0660))
+	_, err = newResults("test", runfile, csv)
+	require.NotNil(t, err)
+}
+
+func TestCSVFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "csv")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	csv := newCSVFile(f, []int{0, 1, 2, 3})
+	csv.add(2, &progressLine{2, "hosts\n", "5\n"})
+	csv.add(1, nil)
+	buf, err := ioutil.ReadFile(f.Name())
+	require.Nil(t, err)
+	require.Equal(t, "", string(buf))
+	csv.add(0, &progressLine{0, "hosts\n", "3\n"})
+	csv.add(3, &progressLine{3, "hosts\n", "7\n"})
+	buf, err = ioutil.ReadFile(f.Name())
+	require.Nil(t, err)
+	require.Equal(t, "hosts\n3\n5\n7\n", string(buf))
+}
+
+func readJSONLines(t *testing.T, file string) []map[string]interface{} {
+	f, err := os.Open(file)
+	require.Nil(t, err)
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var l map[string]interface{}
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &l))
+		lines = append(lines, l)
+	}
+	return lines
+}